@@ -2,19 +2,21 @@ package kb_memory_module
 
 import (
 	//"context"
+	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	
-	"log"
+	//"log"
 	"regexp"
 	"sort"
 	//"strconv"
 	"strings"
 	//"time"
 
-	//"github.com/lib/pq"
-	//_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // TreeNode represents a node in the tree with metadata
@@ -23,6 +25,7 @@ type TreeNode struct {
 	Data      interface{} `json:"data"`
 	CreatedAt *string     `json:"created_at,omitempty"`
 	UpdatedAt *string     `json:"updated_at,omitempty"`
+	Table     string      `json:"table,omitempty"` // source table, set by SearchMemDB loaders
 }
 
 // BasicConstructDB is a comprehensive system for storing and querying tree-structured data with full ltree compatibility
@@ -36,6 +39,10 @@ type BasicConstructDB struct {
 	password         string
 	TableName        string
 	connectionParams map[string]interface{}
+	logger           Logger
+	// UseNumber makes ImportFromPostgres decode numbers as json.Number, so large
+	// 64-bit integers keep their exact value instead of rounding through float64
+	UseNumber bool
 }
 
 // QueryResult represents a query result
@@ -93,6 +100,65 @@ func (db *BasicConstructDB) AddKB(kbName, description string) error {
 	return nil
 }
 
+// Clone returns a deep copy of the store. Node data made of JSON values (maps,
+// slices and scalars) is copied recursively, so the clone shares no state
+// with db; other values inside node data are copied by reference. The
+// Logger is shared.
+func (db *BasicConstructDB) Clone() *BasicConstructDB {
+	clone := *db
+	clone.data = make(map[string]*TreeNode, len(db.data))
+	for path, node := range db.data {
+		clone.data[path] = &TreeNode{
+			Path:      node.Path,
+			Data:      deepCopyValue(node.Data),
+			CreatedAt: copyStringPtr(node.CreatedAt),
+			UpdatedAt: copyStringPtr(node.UpdatedAt),
+			Table:     node.Table,
+		}
+	}
+	clone.kbDict = make(map[string]map[string]interface{}, len(db.kbDict))
+	for kb, info := range db.kbDict {
+		clone.kbDict[kb] = deepCopyValue(info).(map[string]interface{})
+	}
+	clone.connectionParams = deepCopyValue(db.connectionParams).(map[string]interface{})
+	return &clone
+}
+
+// deepCopyValue copies the maps and slices of a decoded JSON value
+func deepCopyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if value == nil {
+			return value
+		}
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			copied[k] = deepCopyValue(item)
+		}
+		return copied
+	case []interface{}:
+		if value == nil {
+			return value
+		}
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = deepCopyValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// copyStringPtr returns a pointer to a copy of *s, or nil
+func copyStringPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	return &copied
+}
+
 // ValidatePath validates that a path conforms to ltree format
 func (db *BasicConstructDB) ValidatePath(path string) bool {
 	if path == "" {
@@ -121,24 +187,45 @@ func (db *BasicConstructDB) PathDepth(path string) int {
 	return len(strings.Split(path, "."))
 }
 
+// DepthOf returns the number of labels in path, matching ltree's nlevel: an
+// empty path has depth 0, where PathDepth and Nlevel return 1
+func (db *BasicConstructDB) DepthOf(path string) int {
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, ".") + 1
+}
+
 // PathLabels gets the labels of a path as a slice
 func (db *BasicConstructDB) PathLabels(path string) []string {
 	return strings.Split(path, ".")
 }
 
-// Subpath extracts a subpath from a path
+// Subpath extracts a subpath from a path with ltree's subpath semantics. A nil
+// length is the two-argument form and runs to the end of the path. A negative
+// start counts from the end, and a negative length stops that many labels
+// short of the end. Positions ltree rejects as invalid yield an empty string.
 func (db *BasicConstructDB) Subpath(path string, start int, length *int) string {
 	labels := db.PathLabels(path)
+	levels := db.DepthOf(path)
+
 	if start < 0 {
-		start = len(labels) + start
+		start += levels
+	}
+	end := levels
+	if length != nil {
+		if *length < 0 {
+			end = levels + *length
+		} else {
+			end = start + *length
+		}
 	}
 
-	if length == nil {
-		return strings.Join(labels[start:], ".")
+	if start < 0 || end < 0 || start >= levels || start > end {
+		return ""
 	}
-	end := start + *length
-	if end > len(labels) {
-		end = len(labels)
+	if end > levels {
+		end = levels
 	}
 	return strings.Join(labels[start:end], ".")
 }
@@ -452,6 +539,7 @@ func (db *BasicConstructDB) GetNode(path string) (*TreeNode, error) {
 		Data:      node.Data,
 		CreatedAt: node.CreatedAt,
 		UpdatedAt: node.UpdatedAt,
+		Table:     node.Table,
 	}, nil
 }
 
@@ -499,44 +587,93 @@ func (db *BasicConstructDB) QueryLtxtquery(ltxtquery string) []QueryResult {
 	return results
 }
 
-// QueryByOperator queries using specific ltree operators
+// QueryByOperator queries the stored paths with an ltree operator and operand
+// path1; see QueryByOperatorChecked for the operators. An unknown operator
+// returns no results.
 func (db *BasicConstructDB) QueryByOperator(operator, path1, path2 string) []QueryResult {
-	var results []QueryResult
+	results, _ := db.QueryByOperatorChecked(operator, path1, path2)
+	return results
+}
+
+// QueryByOperatorChecked queries the stored paths with an ltree operator and
+// operand path1, matching the operators of the Postgres ltree extension:
+//
+//	"@>"  path1 and its descendants (path1 @> path)
+//	"<@"  path1 and its descendants (path <@ path1)
+//	"="   the node at path1 (path = path1)
+//	"~"   paths matching the lquery path1 (path ~ path1)
+//	"?"   paths matching any of the comma-separated lqueries in path1, e.g. "a.*, b.{c,d}"
+//	"@", "@@"  paths matching the ltxtquery path1
+//
+// As in ltree, "@>" and "<@" include path1 itself. Use QueryAncestors for the
+// ancestors of a path. path2 is unused and kept for compatibility. Results are
+// sorted by path; an unknown operator returns an error.
+func (db *BasicConstructDB) QueryByOperatorChecked(operator, path1, path2 string) ([]QueryResult, error) {
+	var match func(path string) bool
 
 	switch operator {
 	case "@>": // ancestor-of
-		for path, node := range db.data {
-			if db.LtreeAncestor(path1, path) {
-				results = append(results, QueryResult{
-					Path:      path,
-					Data:      node.Data,
-					CreatedAt: node.CreatedAt,
-					UpdatedAt: node.UpdatedAt,
-				})
-			}
-		}
+		match = func(path string) bool { return db.LtreeAncestorOrEqual(path1, path) }
 	case "<@": // descendant-of
-		for path, node := range db.data {
-			if db.LtreeDescendant(path, path1) {
-				results = append(results, QueryResult{
-					Path:      path,
-					Data:      node.Data,
-					CreatedAt: node.CreatedAt,
-					UpdatedAt: node.UpdatedAt,
-				})
+		match = func(path string) bool { return db.LtreeDescendantOrEqual(path, path1) }
+	case "=":
+		match = func(path string) bool { return path == path1 }
+	case "~": // lquery match
+		match = func(path string) bool { return db.LtreeMatch(path, path1) }
+	case "?": // match any lquery
+		lqueries := splitLqueries(path1)
+		match = func(path string) bool {
+			for _, lquery := range lqueries {
+				if db.LtreeMatch(path, lquery) {
+					return true
+				}
 			}
+			return false
+		}
+	case "@", "@@": // ltxtquery match
+		match = func(path string) bool { return db.LtxtqueryMatch(path, path1) }
+	default:
+		return nil, fmt.Errorf("unsupported ltree operator: %q", operator)
+	}
+
+	results := []QueryResult{}
+	for path, node := range db.data {
+		if match(path) {
+			results = append(results, QueryResult{
+				Path:      path,
+				Data:      node.Data,
+				CreatedAt: node.CreatedAt,
+				UpdatedAt: node.UpdatedAt,
+			})
 		}
-	case "~": // lquery match
-		return db.Query(path1)
-	case "@@": // ltxtquery match
-		return db.QueryLtxtquery(path1)
 	}
 
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Path < results[j].Path
 	})
 
-	return results
+	return results, nil
+}
+
+// splitLqueries splits a comma-separated lquery list, leaving the commas of
+// {a,b} alternatives and {n,m} quantifiers intact
+func splitLqueries(list string) []string {
+	var lqueries []string
+	depth, start := 0, 0
+	for i, r := range list {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				lqueries = append(lqueries, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(lqueries, strings.TrimSpace(list[start:]))
 }
 
 // QueryAncestors gets all ancestors using @> operator
@@ -700,16 +837,29 @@ func (db *BasicConstructDB) ImportFromPostgres(tableName, pathColumn, dataColumn
 		return 0, fmt.Errorf("table '%s' does not exist", tableName)
 	}
 
+	// Tables created before the knowledge base table had timestamps lack the
+	// timestamp columns; import their rows with nil timestamps
+	columns, err := tableColumns(conn, tableName)
+	if err != nil {
+		return 0, err
+	}
+	timestampColumn := func(column string) string {
+		if columns[column] {
+			return column + "::text"
+		}
+		return "NULL::text"
+	}
+
 	// Import data
 	query := fmt.Sprintf(`
 		SELECT 
 			%s::text as path,
 			%s,
-			%s::text as created_at,
-			%s::text as updated_at
+			%s as created_at,
+			%s as updated_at
 		FROM %s
 		ORDER BY %s`,
-		pathColumn, dataColumn, createdAtColumn, updatedAtColumn, tableName, pathColumn)
+		pathColumn, dataColumn, timestampColumn(createdAtColumn), timestampColumn(updatedAtColumn), tableName, pathColumn)
 
 	rows, err := conn.Query(query)
 	if err != nil {
@@ -730,7 +880,11 @@ func (db *BasicConstructDB) ImportFromPostgres(tableName, pathColumn, dataColumn
 
 		var data interface{}
 		if len(dataBytes) > 0 {
-			json.Unmarshal(dataBytes, &data)
+			decoder := json.NewDecoder(bytes.NewReader(dataBytes))
+			if db.UseNumber {
+				decoder.UseNumber()
+			}
+			decoder.Decode(&data)
 		}
 
 		var createdAtPtr, updatedAtPtr *string
@@ -748,66 +902,311 @@ func (db *BasicConstructDB) ImportFromPostgres(tableName, pathColumn, dataColumn
 	return importedCount, nil
 }
 
-// ExportToPostgres exports data to a PostgreSQL table with ltree support
+// tableColumns returns the set of column names of tableName
+func tableColumns(conn *sql.DB, tableName string) (map[string]bool, error) {
+	rows, err := conn.Query("SELECT column_name FROM information_schema.columns WHERE table_name = $1", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns[column] = true
+	}
+	return columns, rows.Err()
+}
+
+// ConflictStrategy selects what an export does with paths already in the table
+type ConflictStrategy int
+
+const (
+	// ConflictReplace overwrites the data and updated_at of existing paths
+	ConflictReplace ConflictStrategy = iota
+	// ConflictSkip leaves existing paths untouched
+	ConflictSkip
+	// ConflictFail aborts the export, rolling back every row written
+	ConflictFail
+)
+
+// DefaultExportBatchSize is the number of rows per INSERT when ExportOptions.BatchSize is 0
+const DefaultExportBatchSize = 500
+
+// MaxExportBatchSize is the largest number of rows per INSERT. Each row binds 4
+// parameters and Postgres accepts at most 65535 per statement.
+const MaxExportBatchSize = 65535 / 4
+
+// ExportOptions controls ExportToPostgresWithOptions
+type ExportOptions struct {
+	CreateTable bool             // Create the table, ltree extension and indexes if missing
+	Truncate    bool             // Remove every existing row before exporting
+	OnConflict  ConflictStrategy // What to do with paths that already exist
+	BatchSize   int              // Rows per INSERT statement, capped at MaxExportBatchSize
+}
+
+// exportBatchSize returns the rows per INSERT for opts
+func exportBatchSize(opts ExportOptions) int {
+	if opts.BatchSize <= 0 {
+		return DefaultExportBatchSize
+	}
+	if opts.BatchSize > MaxExportBatchSize {
+		return MaxExportBatchSize
+	}
+	return opts.BatchSize
+}
+
+// ExportToPostgres exports data to a PostgreSQL table with ltree support.
+// createTable creates the table and indexes if missing and clearExisting
+// truncates it first; existing paths are replaced.
+//
+// Deprecated: use ExportToPostgresWithOptions.
 func (db *BasicConstructDB) ExportToPostgres(tableName string, createTable, clearExisting bool) (int, error) {
+	return db.ExportToPostgresWithOptions(tableName, ExportOptions{
+		CreateTable: createTable,
+		Truncate:    clearExisting,
+		OnConflict:  ConflictReplace,
+	})
+}
+
+// ExportToPostgresWithOptions exports data to a PostgreSQL table in a single
+// transaction; any error rolls back the whole export. It returns the number of
+// rows inserted or replaced.
+func (db *BasicConstructDB) ExportToPostgresWithOptions(tableName string, opts ExportOptions) (int, error) {
 	conn, err := db.getDBConnection()
 	if err != nil {
 		return 0, err
 	}
 	defer conn.Close()
 
-	// Enable ltree extension
-	_, err = conn.Exec("CREATE EXTENSION IF NOT EXISTS ltree")
+	tx, err := conn.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	if createTable {
-		// Create table with ltree support
-		createTableQuery := fmt.Sprintf(`
-			CREATE TABLE IF NOT EXISTS %s (
-				id SERIAL PRIMARY KEY,
-				path LTREE UNIQUE NOT NULL,
-				data JSONB,
-				created_at TIMESTAMP,
-				updated_at TIMESTAMP
-			)`, tableName)
-		_, err = conn.Exec(createTableQuery)
-		if err != nil {
+	exportedCount, err := db.exportNodes(tx, tableName, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return exportedCount, nil
+}
+
+// exportNodes writes all nodes to tableName within tx
+func (db *BasicConstructDB) exportNodes(tx *sql.Tx, tableName string, opts ExportOptions) (int, error) {
+	if opts.CreateTable {
+		if err := createExportTable(tx, tableName); err != nil {
 			return 0, err
 		}
+	}
 
-		// Create indexes
-		_, err = conn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_path_idx ON %s USING GIST (path)", tableName, tableName))
-		if err != nil {
+	if opts.Truncate {
+		if _, err := tx.Exec(fmt.Sprintf("TRUNCATE TABLE %s", tableName)); err != nil {
 			return 0, err
 		}
-		_, err = conn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_data_idx ON %s USING GIN (data)", tableName, tableName))
+	}
+
+	batchSize := exportBatchSize(opts)
+
+	paths := db.GetAllPaths()
+	exportedCount := 0
+	for start := 0; start < len(paths); start += batchSize {
+		end := start + batchSize
+		if end > len(paths) {
+			end = len(paths)
+		}
+
+		query, err := exportInsertQuery(tableName, end-start, opts.OnConflict)
 		if err != nil {
 			return 0, err
 		}
-	}
 
-	if clearExisting {
-		_, err = conn.Exec(fmt.Sprintf("TRUNCATE TABLE %s", tableName))
+		args := make([]interface{}, 0, 4*(end-start))
+		for _, path := range paths[start:end] {
+			node := db.data[path]
+			dataBytes, err := json.Marshal(node.Data)
+			if err != nil {
+				return 0, fmt.Errorf("error marshaling data for path %s: %v", path, err)
+			}
+
+			var createdAt, updatedAt interface{}
+			if node.CreatedAt != nil {
+				createdAt = *node.CreatedAt
+			}
+			if node.UpdatedAt != nil {
+				updatedAt = *node.UpdatedAt
+			}
+			args = append(args, path, dataBytes, createdAt, updatedAt)
+		}
+
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("error exporting paths %s..%s: %v", paths[start], paths[end-1], err)
+		}
+		affected, err := result.RowsAffected()
 		if err != nil {
 			return 0, err
 		}
+		exportedCount += int(affected)
 	}
 
-	// Export data
-	exportedCount := 0
-	insertQuery := fmt.Sprintf(`
-		INSERT INTO %s (path, data, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (path) 
-		DO UPDATE SET 
-			data = EXCLUDED.data,
-			updated_at = EXCLUDED.updated_at`, tableName)
+	return exportedCount, nil
+}
 
-	for path, node := range db.data {
+// createExportTable creates tableName, the ltree extension and the indexes if
+// missing. New tables include the content_hash column used by ExportDelta;
+// older tables gain it through MigrateContentHash.
+func createExportTable(tx *sql.Tx, tableName string) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS ltree",
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				id SERIAL PRIMARY KEY,
+				path LTREE UNIQUE NOT NULL,
+				data JSONB,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				content_hash TEXT
+			)`, tableName),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_path_idx ON %s USING GIST (path)", tableName, tableName),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_data_idx ON %s USING GIN (data)", tableName, tableName),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeltaStats counts the rows written by ExportDelta
+type DeltaStats struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+}
+
+// contentHash hashes the exported form of node, so equal hashes mean the row
+// ExportDelta would write is already stored
+func contentHash(dataBytes []byte, node *TreeNode) string {
+	h := sha256.New()
+	h.Write(dataBytes)
+	for _, ts := range []*string{node.CreatedAt, node.UpdatedAt} {
+		h.Write([]byte{0})
+		if ts != nil {
+			h.Write([]byte(*ts))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ExportDelta makes tableName match the in-memory nodes while writing only the
+// differences: paths missing from the table are inserted, paths whose content
+// hash differs are updated and rows for paths no longer in memory are deleted.
+// Each row's hash is kept in a content_hash column rather than in data, because
+// data holds the node's value as is, which need not be a JSON object, and
+// ImportFromPostgres reads it back unchanged. Rows written by
+// ExportToPostgresWithOptions have no hash and are rewritten once. The table is
+// created if it does not exist; a table created before content_hash existed
+// must be upgraded with MigrateContentHash first. The whole delta runs in one
+// transaction.
+func (db *BasicConstructDB) ExportDelta(tableName string) (DeltaStats, error) {
+	conn, err := db.getDBConnection()
+	if err != nil {
+		return DeltaStats{}, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return DeltaStats{}, err
+	}
+	defer tx.Rollback()
+
+	stats, err := db.exportDelta(tx, tableName)
+	if err != nil {
+		return DeltaStats{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DeltaStats{}, err
+	}
+	return stats, nil
+}
+
+// MigrateContentHash adds the content_hash column ExportDelta needs to an export
+// table created before ExportDelta existed. Existing rows get no hash and are
+// rewritten by the next ExportDelta. Running it again is a no-op.
+func (db *BasicConstructDB) MigrateContentHash(tableName string) error {
+	conn, err := db.getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS content_hash TEXT", tableName)); err != nil {
+		return fmt.Errorf("error adding content_hash column: %v", err)
+	}
+	return nil
+}
+
+// exportDelta writes the differences between the nodes and tableName within tx
+func (db *BasicConstructDB) exportDelta(tx *sql.Tx, tableName string) (DeltaStats, error) {
+	var stats DeltaStats
+
+	if err := createExportTable(tx, tableName); err != nil {
+		return stats, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT path::text, content_hash FROM %s", tableName))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "42703" { // undefined_column
+		return stats, fmt.Errorf("table %s has no content_hash column; run MigrateContentHash first", tableName)
+	} else if err != nil {
+		return stats, fmt.Errorf("error reading stored hashes: %v", err)
+	}
+	stored := make(map[string]sql.NullString)
+	for rows.Next() {
+		var path string
+		var hash sql.NullString
+		if err := rows.Scan(&path, &hash); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("error scanning stored hash: %v", err)
+		}
+		stored[path] = hash
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error reading stored hashes: %v", err)
+	}
+
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO %s (path, data, created_at, updated_at, content_hash)
+		VALUES ($1, $2, $3, $4, $5)`, tableName)
+	updateQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET data = $2, created_at = $3, updated_at = $4, content_hash = $5
+		WHERE path = $1`, tableName)
+
+	for _, path := range db.GetAllPaths() {
+		node := db.data[path]
 		dataBytes, err := json.Marshal(node.Data)
 		if err != nil {
+			return stats, fmt.Errorf("error marshaling data for path %s: %v", path, err)
+		}
+		hash := contentHash(dataBytes, node)
+
+		storedHash, exists := stored[path]
+		delete(stored, path)
+		if exists && storedHash.Valid && storedHash.String == hash {
+			stats.Unchanged++
 			continue
 		}
 
@@ -819,15 +1218,67 @@ func (db *BasicConstructDB) ExportToPostgres(tableName string, createTable, clea
 			updatedAt = *node.UpdatedAt
 		}
 
-		_, err = conn.Exec(insertQuery, path, dataBytes, createdAt, updatedAt)
+		query := insertQuery
+		if exists {
+			query = updateQuery
+		}
+		if _, err := tx.Exec(query, path, dataBytes, createdAt, updatedAt, hash); err != nil {
+			return stats, fmt.Errorf("error exporting path %s: %v", path, err)
+		}
+		if exists {
+			stats.Updated++
+		} else {
+			stats.Inserted++
+		}
+	}
+
+	// Whatever is left in stored is no longer in memory
+	if len(stored) > 0 {
+		removed := make([]string, 0, len(stored))
+		for path := range stored {
+			removed = append(removed, path)
+		}
+		result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE path::text = ANY($1)", tableName), pq.Array(removed))
 		if err != nil {
-			log.Printf("Error exporting path %s: %v", path, err)
-			continue
+			return stats, fmt.Errorf("error deleting removed paths: %v", err)
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return stats, err
 		}
-		exportedCount++
+		stats.Deleted = int(deleted)
 	}
 
-	return exportedCount, nil
+	return stats, nil
+}
+
+// exportInsertQuery builds a multi-row INSERT for rows nodes using onConflict
+func exportInsertQuery(tableName string, rows int, onConflict ConflictStrategy) (string, error) {
+	var conflictClause string
+	switch onConflict {
+	case ConflictReplace:
+		conflictClause = `
+		ON CONFLICT (path)
+		DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at`
+	case ConflictSkip:
+		conflictClause = `
+		ON CONFLICT (path) DO NOTHING`
+	case ConflictFail:
+		conflictClause = ""
+	default:
+		return "", fmt.Errorf("unknown conflict strategy: %d", onConflict)
+	}
+
+	values := make([]string, rows)
+	for i := 0; i < rows; i++ {
+		values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d)", 4*i+1, 4*i+2, 4*i+3, 4*i+4)
+	}
+
+	return fmt.Sprintf(`
+		INSERT INTO %s (path, data, created_at, updated_at)
+		VALUES %s%s`, tableName, strings.Join(values, ", "), conflictClause), nil
 }
 
 // SyncWithPostgres synchronizes data with PostgreSQL table
@@ -837,16 +1288,16 @@ func (db *BasicConstructDB) SyncWithPostgres(direction string) SyncStats {
 	if direction == "import" || direction == "both" {
 		imported, err := db.ImportFromPostgres(db.TableName, "path", "data", "created_at", "updated_at")
 		if err != nil {
-			log.Printf("Import failed: %v", err)
+			db.log().Errorf("Import failed: %v", err)
 		} else {
 			stats.Imported = imported
 		}
 	}
 
 	if direction == "export" || direction == "both" {
-		exported, err := db.ExportToPostgres(db.TableName, true, false)
+		exported, err := db.ExportToPostgresWithOptions(db.TableName, ExportOptions{CreateTable: true})
 		if err != nil {
-			log.Printf("Export failed: %v", err)
+			db.log().Errorf("Export failed: %v", err)
 		} else {
 			stats.Exported = exported
 		}
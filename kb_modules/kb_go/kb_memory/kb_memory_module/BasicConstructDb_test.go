@@ -0,0 +1,380 @@
+package kb_memory_module
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExportInsertQuery checks the conflict clause and placeholders of batched inserts
+func TestExportInsertQuery(t *testing.T) {
+	tests := []struct {
+		strategy ConflictStrategy
+		contains string
+		excludes string
+	}{
+		{ConflictReplace, "DO UPDATE SET", "DO NOTHING"},
+		{ConflictSkip, "DO NOTHING", "DO UPDATE"},
+		{ConflictFail, "VALUES", "ON CONFLICT"},
+	}
+
+	for _, tt := range tests {
+		query, err := exportInsertQuery("nodes", 2, tt.strategy)
+		if err != nil {
+			t.Fatalf("exportInsertQuery(%d) failed: %v", tt.strategy, err)
+		}
+		if !strings.Contains(query, "($1, $2, $3, $4), ($5, $6, $7, $8)") {
+			t.Errorf("Expected two rows of placeholders, got %s", query)
+		}
+		if !strings.Contains(query, tt.contains) || strings.Contains(query, tt.excludes) {
+			t.Errorf("Unexpected query for strategy %d: %s", tt.strategy, query)
+		}
+	}
+
+	if _, err := exportInsertQuery("nodes", 1, ConflictStrategy(99)); err == nil {
+		t.Error("Expected error for unknown conflict strategy")
+	}
+}
+
+// TestExportOnConflict exports over a table that already holds overlapping paths
+func TestExportOnConflict(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		testDBHost, testDBPort, testDBUser, testDBPassword, testDBName)
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// seed writes a.b=old and a.c=old to a fresh table
+	seed := func() {
+		dropTestTables(t)
+		db := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+		db.Store("a.b", "old", nil, nil)
+		db.Store("a.c", "old", nil, nil)
+		if _, err := db.ExportToPostgresWithOptions(testDBTable, ExportOptions{CreateTable: true}); err != nil {
+			t.Fatalf("Seeding failed: %v", err)
+		}
+	}
+
+	// readAll returns path -> data for every row in the table
+	readAll := func() map[string]string {
+		rows, err := conn.Query(fmt.Sprintf("SELECT path::text, data::text FROM %s", testDBTable))
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer rows.Close()
+		values := make(map[string]string)
+		for rows.Next() {
+			var path, data string
+			if err := rows.Scan(&path, &data); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			values[path] = data
+		}
+		return values
+	}
+
+	tests := []struct {
+		name     string
+		strategy ConflictStrategy
+		wantErr  bool
+		want     map[string]string
+	}{
+		{"Replace", ConflictReplace, false, map[string]string{"a.b": `"new"`, "a.c": `"old"`, "a.d": `"new"`}},
+		{"Skip", ConflictSkip, false, map[string]string{"a.b": `"old"`, "a.c": `"old"`, "a.d": `"new"`}},
+		{"Fail", ConflictFail, true, map[string]string{"a.b": `"old"`, "a.c": `"old"`}},
+	}
+	defer dropTestTables(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed()
+
+			db := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+			db.Store("a.b", "new", nil, nil)
+			db.Store("a.d", "new", nil, nil)
+
+			_, err := db.ExportToPostgresWithOptions(testDBTable, ExportOptions{OnConflict: tt.strategy, BatchSize: 1})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+
+			got := readAll()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for path, data := range tt.want {
+				if got[path] != data {
+					t.Errorf("Path %s: expected %s, got %s", path, data, got[path])
+				}
+			}
+		})
+	}
+}
+
+// TestExportBatchSize checks batches default and stay under Postgres's bind parameter limit
+func TestExportBatchSize(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		want      int
+	}{
+		{0, DefaultExportBatchSize},
+		{-1, DefaultExportBatchSize},
+		{100, 100},
+		{MaxExportBatchSize, MaxExportBatchSize},
+		{20000, MaxExportBatchSize},
+	}
+	for _, tt := range tests {
+		if got := exportBatchSize(ExportOptions{BatchSize: tt.batchSize}); got != tt.want {
+			t.Errorf("exportBatchSize(%d): expected %d, got %d", tt.batchSize, tt.want, got)
+		}
+	}
+
+	query, err := exportInsertQuery("nodes", MaxExportBatchSize, ConflictFail)
+	if err != nil {
+		t.Fatalf("exportInsertQuery failed: %v", err)
+	}
+	if !strings.Contains(query, fmt.Sprintf("$%d)", 4*MaxExportBatchSize)) || 4*MaxExportBatchSize > 65535 {
+		t.Errorf("Expected the largest batch to bind %d parameters", 4*MaxExportBatchSize)
+	}
+}
+
+// TestExportDelta re-exports after small edits and checks only the changed rows are written
+func TestExportDelta(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	dropTestTables(t)
+	defer dropTestTables(t)
+
+	db := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	db.Store("a.b", map[string]interface{}{"v": 1}, nil, nil)
+	db.Store("a.c", map[string]interface{}{"v": 2}, nil, nil)
+	db.Store("a.d", map[string]interface{}{"v": 3}, nil, nil)
+
+	steps := []struct {
+		name string
+		edit func()
+		want DeltaStats
+	}{
+		{"Initial", func() {}, DeltaStats{Inserted: 3}},
+		{"NoChange", func() {}, DeltaStats{Unchanged: 3}},
+		{"OneChange", func() { db.Store("a.c", map[string]interface{}{"v": 20}, nil, nil) }, DeltaStats{Updated: 1, Unchanged: 2}},
+		{"AddAndRemove", func() {
+			db.Delete("a.d")
+			db.Store("a.e", map[string]interface{}{"v": 5}, nil, nil)
+		}, DeltaStats{Inserted: 1, Deleted: 1, Unchanged: 2}},
+	}
+	for _, step := range steps {
+		step.edit()
+		stats, err := db.ExportDelta(testDBTable)
+		if err != nil {
+			t.Fatalf("%s: ExportDelta failed: %v", step.name, err)
+		}
+		if stats != step.want {
+			t.Errorf("%s: expected %+v, got %+v", step.name, step.want, stats)
+		}
+	}
+
+	imported := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	if _, err := imported.ImportFromPostgres(testDBTable, "path", "data", "created_at", "updated_at"); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if paths := imported.GetAllPaths(); !reflect.DeepEqual(paths, []string{"a.b", "a.c", "a.e"}) {
+		t.Errorf("Unexpected exported paths %v", paths)
+	}
+	if data, _ := imported.Get("a.c"); !reflect.DeepEqual(data, map[string]interface{}{"v": float64(20)}) {
+		t.Errorf("Expected updated data for a.c, got %v", data)
+	}
+}
+
+// TestMigrateContentHash upgrades an export table without content_hash and
+// checks ExportDelta refuses it until then and rewrites its rows once after
+func TestMigrateContentHash(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	dropTestTables(t)
+	defer dropTestTables(t)
+
+	db := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	db.Store("a.b", map[string]interface{}{"v": 1}, nil, nil)
+	if _, err := db.ExportToPostgres(testDBTable, true, false); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	conn, err := db.getDBConnection()
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN content_hash", testDBTable)); err != nil {
+		t.Fatalf("Failed to drop content_hash: %v", err)
+	}
+
+	if _, err := db.ExportDelta(testDBTable); err == nil {
+		t.Error("Expected ExportDelta to refuse a table without content_hash")
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.MigrateContentHash(testDBTable); err != nil {
+			t.Fatalf("MigrateContentHash failed: %v", err)
+		}
+	}
+
+	for _, want := range []DeltaStats{{Updated: 1}, {Unchanged: 1}} {
+		stats, err := db.ExportDelta(testDBTable)
+		if err != nil {
+			t.Fatalf("ExportDelta failed after migrating: %v", err)
+		}
+		if stats != want {
+			t.Errorf("Expected %+v, got %+v", want, stats)
+		}
+	}
+}
+
+// TestImportWithoutTimestamps imports a table that has no created_at or updated_at columns
+func TestImportWithoutTimestamps(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		testDBHost, testDBPort, testDBUser, testDBPassword, testDBName)
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	dropTestTables(t)
+	defer dropTestTables(t)
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS ltree",
+		fmt.Sprintf("CREATE TABLE %s (path LTREE UNIQUE, data JSON)", testDBTable),
+		fmt.Sprintf(`INSERT INTO %s (path, data) VALUES ('a.b', '{"v": 1}')`, testDBTable),
+	}
+	for _, stmt := range statements {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing table: %v", err)
+		}
+	}
+
+	db := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	imported, err := db.ImportFromPostgres(testDBTable, "path", "data", "created_at", "updated_at")
+	if err != nil || imported != 1 {
+		t.Fatalf("Expected 1 row imported, got %d, %v", imported, err)
+	}
+	node, err := db.GetNode("a.b")
+	if err != nil {
+		t.Fatalf("Error reading imported node: %v", err)
+	}
+	if node.CreatedAt != nil || node.UpdatedAt != nil {
+		t.Errorf("Expected nil timestamps, got %v and %v", node.CreatedAt, node.UpdatedAt)
+	}
+}
+
+// TestQueryByOperator runs every supported ltree operator against a known tree
+func TestQueryByOperator(t *testing.T) {
+	db := NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "knowledge_base")
+	for _, path := range []string{"a", "a.b", "a.b.c", "a.b.d", "a.e", "f.b"} {
+		if err := db.Store(path, path, nil, nil); err != nil {
+			t.Fatalf("Error storing %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		operator, operand string
+		want              []string
+	}{
+		// Both keep the descendants of a.b, as QueryByOperator always has,
+		// plus a.b itself as ltree does
+		{"@>", "a.b", []string{"a.b", "a.b.c", "a.b.d"}},
+		{"<@", "a.b", []string{"a.b", "a.b.c", "a.b.d"}},
+		{"=", "a.e", []string{"a.e"}},
+		{"=", "a.x", []string{}},
+		{"~", "a.*", []string{"a.b", "a.e"}},
+		{"?", "a.e, *.b", []string{"a.b", "a.e", "f.b"}},
+		{"?", "a.b.{c,d},f.*", []string{"a.b.c", "a.b.d", "f.b"}},
+		{"@", "d | e", []string{"a.b.d", "a.e"}},
+		{"@@", "b & c", []string{"a.b.c"}},
+	}
+	for _, tt := range tests {
+		results, err := db.QueryByOperatorChecked(tt.operator, tt.operand, "")
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", tt.operator, tt.operand, err)
+			continue
+		}
+		got := []string{}
+		for _, r := range results {
+			got = append(got, r.Path)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: expected %v, got %v", tt.operator, tt.operand, tt.want, got)
+		}
+	}
+
+	// SearchPath passes its operator through unchanged
+	smdb := newTestSearchMemDB(t, map[string]interface{}{"a": 1, "a.b": 2, "a.b.c": 3, "a.b.d": 4, "a.e": 5, "f.b": 6})
+	if results := smdb.SearchPath("<@", "a"); len(results) != 5 {
+		t.Errorf("Expected a and its 4 descendants, got %v", results)
+	}
+	if results, err := smdb.SearchPathChecked("<>", "a"); err == nil {
+		t.Errorf("Expected SearchPathChecked to reject an unknown operator, got %v", results)
+	}
+
+	if results, err := db.QueryByOperatorChecked("<>", "a", ""); err == nil {
+		t.Errorf("Expected an error for an unknown operator, got %v", results)
+	}
+	if results := db.QueryByOperator("<>", "a", ""); len(results) != 0 {
+		t.Errorf("Expected no results for an unknown operator, got %v", results)
+	}
+}
+
+// subpathCasesFile holds subpath('a.b.c.d', start[, length]) results as returned
+// by Postgres; kb_construct's TestSubpath checks the same table against the server
+const subpathCasesFile = "../../postgres/kb_construct/kb_construct_module/testdata/subpath_cases.json"
+
+// TestDepthOfAndSubpath checks the in-memory helpers follow ltree's nlevel and subpath
+func TestDepthOfAndSubpath(t *testing.T) {
+	db := NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "knowledge_base")
+
+	for path, want := range map[string]int{"a.b.c.d": 4, "a": 1, "": 0} {
+		if got := db.DepthOf(path); got != want {
+			t.Errorf("DepthOf(%q): expected %d, got %d", path, want, got)
+		}
+	}
+	// PathDepth and Nlevel keep counting an empty path as one label
+	if db.PathDepth("") != 1 || db.Nlevel("") != 1 {
+		t.Errorf("Expected PathDepth and Nlevel of an empty path to stay 1, got %d and %d", db.PathDepth(""), db.Nlevel(""))
+	}
+
+	raw, err := os.ReadFile(subpathCasesFile)
+	if err != nil {
+		t.Fatalf("Error reading subpath cases: %v", err)
+	}
+	var cases []struct {
+		Start  int    `json:"start"`
+		Length *int   `json:"length"` // absent is the two-argument form
+		Want   string `json:"want"`
+	}
+	if err := json.Unmarshal(raw, &cases); err != nil {
+		t.Fatalf("Error decoding subpath cases: %v", err)
+	}
+	for _, c := range cases {
+		// Positions ltree rejects yield an empty string, which is their Want
+		if got := db.Subpath("a.b.c.d", c.Start, c.Length); got != c.Want {
+			t.Errorf("Subpath(%d, %v): expected %q, got %q", c.Start, c.Length, c.Want, got)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package kb_memory_module
 
 import (
+	"database/sql"
 	"fmt"
 	//"log"
 	"strings"
@@ -13,6 +14,24 @@ type ConstructMemDB struct {
 	workingKB           *string          // Working knowledge base
 	compositePath       map[string][]string          // Tracks composite paths for each KB
 	compositePathValues map[string]map[string]bool   // Tracks existing paths in each KB
+	links               []LinkNode                   // Links recorded with AddLinkNode
+	headerStacks        map[string][]headerEntry     // Header nodes entered in each KB, innermost last
+}
+
+// headerEntry records a header node entered with AddHeaderNode
+type headerEntry struct {
+	label string
+	name  string
+	depth int // Length of the composite path before the header was entered
+}
+
+// LinkNode is a link from a header node to a mount point, mirroring the
+// _link and _link_mount tables of the SQL knowledge base
+type LinkNode struct {
+	LinkName      string `json:"link_name"`
+	KnowledgeBase string `json:"knowledge_base"`
+	ParentPath    string `json:"parent_path"`
+	MountPath     string `json:"mount_path,omitempty"`
 }
 
 // NewConstructMemDB creates a new ConstructMemDB instance
@@ -23,9 +42,41 @@ func NewConstructMemDB(host string, port int, dbname, user, password, database s
 		workingKB:           nil,
 		compositePath:       make(map[string][]string),
 		compositePathValues: make(map[string]map[string]bool),
+		links:               make([]LinkNode, 0),
+		headerStacks:        make(map[string][]headerEntry),
 	}
 }
 
+// Clone returns a deep copy of the construction state: the stored nodes, the
+// composite paths, the selected and working KBs, the recorded links and the
+// open header nodes. The clone shares no state with cmdb, so it can be taken
+// as a snapshot before a risky export and either side mutated freely.
+func (cmdb *ConstructMemDB) Clone() *ConstructMemDB {
+	clone := &ConstructMemDB{
+		BasicConstructDB:    cmdb.BasicConstructDB.Clone(),
+		kbName:              copyStringPtr(cmdb.kbName),
+		workingKB:           copyStringPtr(cmdb.workingKB),
+		compositePath:       make(map[string][]string, len(cmdb.compositePath)),
+		compositePathValues: make(map[string]map[string]bool, len(cmdb.compositePathValues)),
+		links:               append([]LinkNode(nil), cmdb.links...),
+		headerStacks:        make(map[string][]headerEntry, len(cmdb.headerStacks)),
+	}
+	for kb, path := range cmdb.compositePath {
+		clone.compositePath[kb] = append([]string(nil), path...)
+	}
+	for kb, values := range cmdb.compositePathValues {
+		copied := make(map[string]bool, len(values))
+		for path, exists := range values {
+			copied[path] = exists
+		}
+		clone.compositePathValues[kb] = copied
+	}
+	for kb, stack := range cmdb.headerStacks {
+		clone.headerStacks[kb] = append([]headerEntry(nil), stack...)
+	}
+	return clone
+}
+
 // AddKB adds a knowledge base with composite path tracking
 func (cmdb *ConstructMemDB) AddKB(kbName, description string) error {
 	// Check if KB already exists in composite path
@@ -41,6 +92,73 @@ func (cmdb *ConstructMemDB) AddKB(kbName, description string) error {
 	return cmdb.BasicConstructDB.AddKB(kbName, description)
 }
 
+// RemoveKB removes a knowledge base, its composite path tracking, its links and
+// every stored node under it. The working KB can only be removed while its
+// path is at the KB root, after which no KB is selected.
+func (cmdb *ConstructMemDB) RemoveKB(kbName string) error {
+	path, exists := cmdb.compositePath[kbName]
+	if !exists {
+		return fmt.Errorf("knowledge base %s does not exist", kbName)
+	}
+	if cmdb.workingKB != nil && *cmdb.workingKB == kbName && len(path) > 1 {
+		return fmt.Errorf("cannot remove knowledge base %s: header nodes are still open at %s", kbName, strings.Join(path, "."))
+	}
+
+	for nodePath := range cmdb.data {
+		if nodePath == kbName || strings.HasPrefix(nodePath, kbName+".") {
+			delete(cmdb.data, nodePath)
+		}
+	}
+
+	links := cmdb.links[:0]
+	for _, link := range cmdb.links {
+		if link.KnowledgeBase != kbName {
+			links = append(links, link)
+		}
+	}
+	cmdb.links = links
+
+	delete(cmdb.compositePath, kbName)
+	delete(cmdb.compositePathValues, kbName)
+	delete(cmdb.headerStacks, kbName)
+	delete(cmdb.kbDict, kbName)
+
+	if cmdb.workingKB != nil && *cmdb.workingKB == kbName {
+		cmdb.workingKB = nil
+	}
+	return nil
+}
+
+// RemoveNode removes a single stored node and the links attached to it. Nodes
+// on the current composite path of their KB cannot be removed.
+func (cmdb *ConstructMemDB) RemoveNode(path string) error {
+	if _, exists := cmdb.data[path]; !exists {
+		return fmt.Errorf("node %s does not exist", path)
+	}
+
+	kbName := strings.Split(path, ".")[0]
+	if current, exists := cmdb.compositePath[kbName]; exists {
+		currentPath := strings.Join(current, ".")
+		if currentPath == path || strings.HasPrefix(currentPath, path+".") {
+			return fmt.Errorf("cannot remove node %s: it is on the current path %s", path, currentPath)
+		}
+	}
+
+	delete(cmdb.data, path)
+	if values, exists := cmdb.compositePathValues[kbName]; exists {
+		delete(values, path)
+	}
+
+	links := cmdb.links[:0]
+	for _, link := range cmdb.links {
+		if link.ParentPath != path {
+			links = append(links, link)
+		}
+	}
+	cmdb.links = links
+	return nil
+}
+
 // SelectKB selects a knowledge base to work with
 func (cmdb *ConstructMemDB) SelectKB(kbName string) error {
 	if _, exists := cmdb.compositePath[kbName]; !exists {
@@ -50,12 +168,31 @@ func (cmdb *ConstructMemDB) SelectKB(kbName string) error {
 	return nil
 }
 
-// AddHeaderNode adds a header node to the knowledge base
+// AddHeaderNode adds a header node to the knowledge base and enters it. On error
+// the path is left unchanged.
 func (cmdb *ConstructMemDB) AddHeaderNode(link, nodeName string, nodeData map[string]interface{}, description string) error {
 	if cmdb.workingKB == nil {
 		return fmt.Errorf("no working knowledge base selected")
 	}
 
+	depth := len(cmdb.compositePath[*cmdb.workingKB])
+	if err := cmdb.addHeaderNode(link, nodeName, nodeData, description); err != nil {
+		return err
+	}
+
+	// Record the header so LeaveHeaderNode can verify the nesting
+	cmdb.headerStacks[*cmdb.workingKB] = append(cmdb.headerStacks[*cmdb.workingKB], headerEntry{
+		label: link,
+		name:  nodeName,
+		depth: depth,
+	})
+	return nil
+}
+
+// addHeaderNode stores a node under the current path and extends the path with
+// link and nodeName. The path is left unchanged on error.
+func (cmdb *ConstructMemDB) addHeaderNode(link, nodeName string, nodeData map[string]interface{}, description string) error {
+
 	// Validate input types
 	if nodeData == nil {
 		return fmt.Errorf("nodeData must be a dictionary")
@@ -66,23 +203,26 @@ func (cmdb *ConstructMemDB) AddHeaderNode(link, nodeName string, nodeData map[st
 		nodeData["description"] = description
 	}
 
-	// Build composite path
-	cmdb.compositePath[*cmdb.workingKB] = append(cmdb.compositePath[*cmdb.workingKB], link)
-	cmdb.compositePath[*cmdb.workingKB] = append(cmdb.compositePath[*cmdb.workingKB], nodeName)
-	nodePath := strings.Join(cmdb.compositePath[*cmdb.workingKB], ".")
+	// Build composite path; the working path is only extended once the node is stored
+	currentPath := cmdb.compositePath[*cmdb.workingKB]
+	labels := append(append(make([]string, 0, len(currentPath)+2), currentPath...), link, nodeName)
+	nodePath := strings.Join(labels, ".")
 
 	// Check if path already exists
 	if cmdb.compositePathValues[*cmdb.workingKB][nodePath] {
 		return fmt.Errorf("path %s already exists in knowledge base", nodePath)
 	}
 
-	// Mark path as used
-	cmdb.compositePathValues[*cmdb.workingKB][nodePath] = true
-
 	// Store in the underlying BasicConstructDB
-	path := strings.Join(cmdb.compositePath[*cmdb.workingKB], ".")
-	fmt.Println("path", path)
-	return cmdb.BasicConstructDB.Store(path, nodeData, nil, nil)
+	cmdb.log().Debugf("path %s", nodePath)
+	if err := cmdb.BasicConstructDB.Store(nodePath, nodeData, nil, nil); err != nil {
+		return err
+	}
+
+	// Mark path as used and enter it
+	cmdb.compositePathValues[*cmdb.workingKB][nodePath] = true
+	cmdb.compositePath[*cmdb.workingKB] = labels
+	return nil
 }
 
 // AddInfoNode adds an info node (temporary header node that gets removed from path)
@@ -91,67 +231,300 @@ func (cmdb *ConstructMemDB) AddInfoNode(link, nodeName string, nodeData map[stri
 		return fmt.Errorf("no working knowledge base selected")
 	}
 
-	// Add as header node first
-	err := cmdb.AddHeaderNode(link, nodeName, nodeData, description)
-	if err != nil {
-		return err
+	// Snapshot the path so the link and nodeName added by addHeaderNode are
+	// removed again, whether or not it succeeds
+	savedPath := cmdb.GetCurrentPath()
+	defer func() {
+		cmdb.compositePath[*cmdb.workingKB] = savedPath
+	}()
+
+	// Add as header node first, without entering it
+	return cmdb.addHeaderNode(link, nodeName, nodeData, description)
+}
+
+// AddLinkNode records a link named linkName at the current composite path.
+// mountPath is the ltree path the link mounts; an empty mountPath records the
+// link without a mount. The composite path is not changed.
+func (cmdb *ConstructMemDB) AddLinkNode(linkName, mountPath string) error {
+	if cmdb.workingKB == nil {
+		return fmt.Errorf("no working knowledge base selected")
+	}
+	if linkName == "" {
+		return fmt.Errorf("link name must not be empty")
+	}
+	if mountPath != "" && !cmdb.ValidatePath(mountPath) {
+		return fmt.Errorf("invalid mount path: %s", mountPath)
+	}
+
+	parentPath := strings.Join(cmdb.compositePath[*cmdb.workingKB], ".")
+	if !cmdb.compositePathValues[*cmdb.workingKB][parentPath] {
+		return fmt.Errorf("no header node at path %s to attach link %s to", parentPath, linkName)
 	}
 
-	// Remove node_name and link from path (reverse order)
-	pathLen := len(cmdb.compositePath[*cmdb.workingKB])
-	if pathLen >= 2 {
-		cmdb.compositePath[*cmdb.workingKB] = cmdb.compositePath[*cmdb.workingKB][:pathLen-1] // Remove nodeName
-		cmdb.compositePath[*cmdb.workingKB] = cmdb.compositePath[*cmdb.workingKB][:pathLen-2] // Remove link
+	for _, link := range cmdb.links {
+		if link.LinkName == linkName && link.KnowledgeBase == *cmdb.workingKB && link.ParentPath == parentPath {
+			return fmt.Errorf("link %s already exists at path %s", linkName, parentPath)
+		}
+		if mountPath != "" && link.LinkName == linkName && link.MountPath != "" && link.MountPath != mountPath {
+			return fmt.Errorf("link %s is already mounted at %s", linkName, link.MountPath)
+		}
 	}
 
+	cmdb.links = append(cmdb.links, LinkNode{
+		LinkName:      linkName,
+		KnowledgeBase: *cmdb.workingKB,
+		ParentPath:    parentPath,
+		MountPath:     mountPath,
+	})
 	return nil
 }
 
-// LeaveHeaderNode leaves a header node, verifying the label and name
-func (cmdb *ConstructMemDB) LeaveHeaderNode(label, name string) error {
-	if cmdb.workingKB == nil {
-		return fmt.Errorf("no working knowledge base selected")
+// GetLinkNodes returns a copy of the recorded links
+func (cmdb *ConstructMemDB) GetLinkNodes() []LinkNode {
+	links := make([]LinkNode, len(cmdb.links))
+	copy(links, cmdb.links)
+	return links
+}
+
+// ExportToPostgres exports the nodes and recorded links; see ExportToPostgresWithOptions.
+//
+// Deprecated: use ExportToPostgresWithOptions.
+func (cmdb *ConstructMemDB) ExportToPostgres(tableName string, createTable, clearExisting bool) (int, error) {
+	return cmdb.ExportToPostgresWithOptions(tableName, ExportOptions{
+		CreateTable: createTable,
+		Truncate:    clearExisting,
+		OnConflict:  ConflictReplace,
+	})
+}
+
+// ExportToPostgresWithOptions exports the nodes like
+// BasicConstructDB.ExportToPostgresWithOptions and writes the recorded links to
+// the <tableName>_link and <tableName>_link_mount tables in the same transaction.
+// With no links recorded the link tables are neither created nor required; they
+// are only truncated if they already exist.
+func (cmdb *ConstructMemDB) ExportToPostgresWithOptions(tableName string, opts ExportOptions) (int, error) {
+	conn, err := cmdb.getDBConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	exportedCount, err := cmdb.exportNodes(tx, tableName, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := cmdb.exportLinks(tx, tableName, opts); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return exportedCount, nil
+}
+
+// ExportDelta writes only the node differences like BasicConstructDB.ExportDelta
+// and, in the same transaction, writes the recorded links to the link tables as
+// ExportToPostgresWithOptions does with ConflictReplace. Links already stored are
+// left as they are, and stored links no longer recorded are not removed.
+func (cmdb *ConstructMemDB) ExportDelta(tableName string) (DeltaStats, error) {
+	conn, err := cmdb.getDBConnection()
+	if err != nil {
+		return DeltaStats{}, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return DeltaStats{}, err
+	}
+	defer tx.Rollback()
+
+	stats, err := cmdb.exportDelta(tx, tableName)
+	if err != nil {
+		return DeltaStats{}, err
+	}
+	if err := cmdb.exportLinks(tx, tableName, ExportOptions{CreateTable: true, OnConflict: ConflictReplace}); err != nil {
+		return DeltaStats{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DeltaStats{}, err
+	}
+	return stats, nil
+}
+
+// exportLinks writes the recorded links to the link tables of tableName within tx
+func (cmdb *ConstructMemDB) exportLinks(tx *sql.Tx, tableName string, opts ExportOptions) error {
+	if len(cmdb.links) == 0 {
+		// Nothing to write, so only clear link tables that are already there
+		if !opts.Truncate {
+			return nil
+		}
+		exists, err := linkTablesExist(tx, tableName)
+		if err != nil || !exists {
+			return err
+		}
 	}
 
-	path := cmdb.compositePath[*cmdb.workingKB]
+	if opts.CreateTable {
+		statements := []string{
+			fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s_link (
+					id SERIAL PRIMARY KEY,
+					link_name VARCHAR NOT NULL,
+					parent_node_kb VARCHAR NOT NULL,
+					parent_path LTREE NOT NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(link_name, parent_node_kb, parent_path)
+				)`, tableName),
+			fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s_link_mount (
+					id SERIAL PRIMARY KEY,
+					link_name VARCHAR NOT NULL UNIQUE,
+					knowledge_base VARCHAR NOT NULL,
+					mount_path LTREE NOT NULL,
+					description VARCHAR,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(knowledge_base, mount_path)
+				)`, tableName),
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("error creating link tables: %v", err)
+			}
+		}
+	}
 
-	// Check if path is empty
-	if len(path) == 0 {
-		return fmt.Errorf("cannot leave a header node: path is empty")
+	if opts.Truncate {
+		if _, err := tx.Exec(fmt.Sprintf("TRUNCATE TABLE %s_link, %s_link_mount", tableName, tableName)); err != nil {
+			return fmt.Errorf("error clearing link tables: %v", err)
+		}
 	}
 
-	// Pop the name
-	if len(path) < 1 {
-		return fmt.Errorf("cannot leave a header node: path is empty")
+	// A link row is all key, so only the mount can be replaced
+	var linkConflict, mountConflict string
+	switch opts.OnConflict {
+	case ConflictReplace:
+		linkConflict = "ON CONFLICT (link_name, parent_node_kb, parent_path) DO NOTHING"
+		mountConflict = "ON CONFLICT (link_name) DO UPDATE SET knowledge_base = EXCLUDED.knowledge_base, mount_path = EXCLUDED.mount_path"
+	case ConflictSkip:
+		linkConflict = "ON CONFLICT (link_name, parent_node_kb, parent_path) DO NOTHING"
+		mountConflict = "ON CONFLICT DO NOTHING"
+	case ConflictFail:
+	default:
+		return fmt.Errorf("unknown conflict strategy: %d", opts.OnConflict)
 	}
-	refName := path[len(path)-1]
-	cmdb.compositePath[*cmdb.workingKB] = path[:len(path)-1]
 
-	// Check if we have enough elements for label
-	path = cmdb.compositePath[*cmdb.workingKB]
-	if len(path) == 0 {
-		// Put the name back and raise an error
-		cmdb.compositePath[*cmdb.workingKB] = append(cmdb.compositePath[*cmdb.workingKB], refName)
-		return fmt.Errorf("cannot leave a header node: not enough elements in path")
+	linkQuery := fmt.Sprintf(`
+		INSERT INTO %s_link (link_name, parent_node_kb, parent_path)
+		VALUES ($1, $2, $3)
+		%s`, tableName, linkConflict)
+	mountQuery := fmt.Sprintf(`
+		INSERT INTO %s_link_mount (link_name, knowledge_base, mount_path)
+		VALUES ($1, $2, $3)
+		%s`, tableName, mountConflict)
+
+	// Several links may share one mount, which is written once
+	mounted := make(map[string]bool)
+	for _, link := range cmdb.links {
+		if _, err := tx.Exec(linkQuery, link.LinkName, link.KnowledgeBase, link.ParentPath); err != nil {
+			return fmt.Errorf("error exporting link %s at %s: %v", link.LinkName, link.ParentPath, err)
+		}
+		if link.MountPath == "" || mounted[link.LinkName] {
+			continue
+		}
+		mounted[link.LinkName] = true
+		mountKB := strings.Split(link.MountPath, ".")[0]
+		if _, err := tx.Exec(mountQuery, link.LinkName, mountKB, link.MountPath); err != nil {
+			return fmt.Errorf("error exporting link mount %s at %s: %v", link.LinkName, link.MountPath, err)
+		}
 	}
 
-	// Pop the label
-	refLabel := path[len(path)-1]
-	cmdb.compositePath[*cmdb.workingKB] = path[:len(path)-1]
+	return nil
+}
+
+// linkTablesExist reports whether both link tables of tableName exist
+func linkTablesExist(tx *sql.Tx, tableName string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT to_regclass($1) IS NOT NULL AND to_regclass($2) IS NOT NULL",
+		tableName+"_link", tableName+"_link_mount").Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for link tables: %v", err)
+	}
+	return exists, nil
+}
 
-	// Verify the popped values
-	var errorMsgs []string
-	if refName != name {
-		errorMsgs = append(errorMsgs, fmt.Sprintf("expected name '%s', but got '%s'", name, refName))
+// ImportLinksFromPostgres reads the <tableName>_link and <tableName>_link_mount
+// tables back into the recorded links, skipping links that are already present
+func (cmdb *ConstructMemDB) ImportLinksFromPostgres(tableName string) (int, error) {
+	conn, err := cmdb.getDBConnection()
+	if err != nil {
+		return 0, err
 	}
-	if refLabel != label {
-		errorMsgs = append(errorMsgs, fmt.Sprintf("expected label '%s', but got '%s'", label, refLabel))
+	defer conn.Close()
+
+	query := fmt.Sprintf(`
+		SELECT l.link_name, l.parent_node_kb, l.parent_path::text, COALESCE(m.mount_path::text, '')
+		FROM %s_link l
+		LEFT JOIN %s_link_mount m ON m.link_name = l.link_name
+		ORDER BY l.id`, tableName, tableName)
+
+	rows, err := conn.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	importedCount := 0
+	for rows.Next() {
+		var link LinkNode
+		if err := rows.Scan(&link.LinkName, &link.KnowledgeBase, &link.ParentPath, &link.MountPath); err != nil {
+			return importedCount, err
+		}
+
+		duplicate := false
+		for _, existing := range cmdb.links {
+			if existing.LinkName == link.LinkName && existing.KnowledgeBase == link.KnowledgeBase && existing.ParentPath == link.ParentPath {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		cmdb.links = append(cmdb.links, link)
+		importedCount++
+	}
+
+	return importedCount, rows.Err()
+}
+
+// LeaveHeaderNode leaves the innermost header node entered with AddHeaderNode,
+// verifying the label and name. On a mismatch nothing is left.
+func (cmdb *ConstructMemDB) LeaveHeaderNode(label, name string) error {
+	if cmdb.workingKB == nil {
+		return fmt.Errorf("no working knowledge base selected")
+	}
+
+	stack := cmdb.headerStacks[*cmdb.workingKB]
+	if len(stack) == 0 {
+		return fmt.Errorf("tried to leave '%s.%s' but no header node is open", label, name)
 	}
 
-	if len(errorMsgs) > 0 {
-		return fmt.Errorf("assertion error: %s", strings.Join(errorMsgs, ", "))
+	current := stack[len(stack)-1]
+	if current.label != label || current.name != name {
+		return fmt.Errorf("tried to leave '%s.%s' but current header is '%s.%s'", label, name, current.label, current.name)
 	}
 
+	cmdb.headerStacks[*cmdb.workingKB] = stack[:len(stack)-1]
+	cmdb.compositePath[*cmdb.workingKB] = cmdb.compositePath[*cmdb.workingKB][:current.depth]
 	return nil
 }
 
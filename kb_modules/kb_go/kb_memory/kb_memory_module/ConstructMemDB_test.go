@@ -0,0 +1,448 @@
+package kb_memory_module
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Test database configuration
+var (
+	testDBHost     = "localhost"
+	testDBPort     = 5432
+	testDBName     = "knowledge_base"
+	testDBUser     = "gedgar"
+	testDBTable    = "knowledge_base_mem_test" // Use a different table for testing
+	testDBPassword = os.Getenv("POSTGRES_PASSWORD")
+)
+
+// newTestConstructMemDB returns a ConstructMemDB with kb1 selected
+func newTestConstructMemDB(t *testing.T) *ConstructMemDB {
+	t.Helper()
+
+	cmdb := NewConstructMemDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	if err := cmdb.AddKB("kb1", "test knowledge base"); err != nil {
+		t.Fatalf("AddKB failed: %v", err)
+	}
+	if err := cmdb.SelectKB("kb1"); err != nil {
+		t.Fatalf("SelectKB failed: %v", err)
+	}
+	return cmdb
+}
+
+// dropTestTables removes the test table and its link tables
+func dropTestTables(t *testing.T) {
+	t.Helper()
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		testDBHost, testDBPort, testDBUser, testDBPassword, testDBName)
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	for _, suffix := range []string{"", "_link", "_link_mount"} {
+		if _, err := conn.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s%s", testDBTable, suffix)); err != nil {
+			t.Fatalf("Failed to drop test table: %v", err)
+		}
+	}
+}
+
+// TestAddLinkNode checks link validation and that the composite path is unchanged
+func TestAddLinkNode(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+
+	if err := cmdb.AddLinkNode("link1", "kb2.mount.point"); err == nil {
+		t.Error("Expected error adding a link at the kb root")
+	}
+
+	if err := cmdb.AddHeaderNode("header", "node1", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("", "kb2.mount.point"); err == nil {
+		t.Error("Expected error for empty link name")
+	}
+	if err := cmdb.AddLinkNode("link1", "bad path!"); err == nil {
+		t.Error("Expected error for invalid mount path")
+	}
+	if err := cmdb.AddLinkNode("link1", "kb2.mount.point"); err != nil {
+		t.Fatalf("AddLinkNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("link1", "kb2.mount.point"); err == nil {
+		t.Error("Expected error for duplicate link")
+	}
+	if got := cmdb.GetCurrentPathString(); got != "kb1.header.node1" {
+		t.Errorf("Expected path kb1.header.node1, got %s", got)
+	}
+
+	links := cmdb.GetLinkNodes()
+	expected := LinkNode{LinkName: "link1", KnowledgeBase: "kb1", ParentPath: "kb1.header.node1", MountPath: "kb2.mount.point"}
+	if len(links) != 1 || links[0] != expected {
+		t.Errorf("Unexpected links: %+v", links)
+	}
+}
+
+// TestLinkNodeRoundTrip exports links to PostgreSQL and imports them back
+func TestLinkNodeRoundTrip(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+	dropTestTables(t)
+	defer dropTestTables(t)
+
+	cmdb := newTestConstructMemDB(t)
+	if err := cmdb.AddHeaderNode("header", "node1", map[string]interface{}{"value": 1}, ""); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("link1", "kb2.mount.point"); err != nil {
+		t.Fatalf("AddLinkNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("link2", ""); err != nil {
+		t.Fatalf("AddLinkNode failed: %v", err)
+	}
+
+	if _, err := cmdb.ExportToPostgresWithOptions(testDBTable, ExportOptions{CreateTable: true, Truncate: true}); err != nil {
+		t.Fatalf("ExportToPostgresWithOptions failed: %v", err)
+	}
+
+	imported := NewConstructMemDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	count, err := imported.ImportLinksFromPostgres(testDBTable)
+	if err != nil {
+		t.Fatalf("ImportLinksFromPostgres failed: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 links imported, got %d", count)
+	}
+
+	want := cmdb.GetLinkNodes()
+	got := imported.GetLinkNodes()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Link %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+// TestExportWithoutLinks checks that exporting without recorded links works
+// against a database that has no link tables
+func TestExportWithoutLinks(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+	dropTestTables(t)
+	defer dropTestTables(t)
+
+	cmdb := newTestConstructMemDB(t)
+	if err := cmdb.AddHeaderNode("header", "node1", map[string]interface{}{"value": 1}, ""); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if _, err := cmdb.ExportToPostgres(testDBTable, true, true); err != nil {
+		t.Fatalf("ExportToPostgres failed: %v", err)
+	}
+	if _, err := cmdb.ExportDelta(testDBTable); err != nil {
+		t.Fatalf("ExportDelta failed: %v", err)
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		testDBHost, testDBPort, testDBUser, testDBPassword, testDBName)
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var created bool
+	if err := conn.QueryRow("SELECT to_regclass($1) IS NOT NULL", testDBTable+"_link").Scan(&created); err != nil {
+		t.Fatalf("Checking for the link table failed: %v", err)
+	}
+	if created {
+		t.Error("Expected no link tables to be created without recorded links")
+	}
+}
+
+// TestAddInfoNodeRestoresPath interleaves header and info nodes and checks the path
+func TestAddInfoNodeRestoresPath(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+
+	expectPath := func(expected string) {
+		t.Helper()
+		if got := cmdb.GetCurrentPathString(); got != expected {
+			t.Fatalf("Expected path %s, got %s", expected, got)
+		}
+	}
+
+	steps := []struct {
+		info     bool
+		link     string
+		name     string
+		expected string
+	}{
+		{false, "header", "a", "kb1.header.a"},
+		{true, "info", "i1", "kb1.header.a"},
+		{false, "header", "b", "kb1.header.a.header.b"},
+		{true, "info", "i2", "kb1.header.a.header.b"},
+		{true, "info", "i3", "kb1.header.a.header.b"},
+		{false, "header", "c", "kb1.header.a.header.b.header.c"},
+		{true, "info", "i4", "kb1.header.a.header.b.header.c"},
+	}
+	for _, step := range steps {
+		var err error
+		if step.info {
+			err = cmdb.AddInfoNode(step.link, step.name, map[string]interface{}{}, "")
+		} else {
+			err = cmdb.AddHeaderNode(step.link, step.name, map[string]interface{}{}, "")
+		}
+		if err != nil {
+			t.Fatalf("Adding %s.%s failed: %v", step.link, step.name, err)
+		}
+		expectPath(step.expected)
+	}
+
+	if !cmdb.Exists("kb1.header.a.header.b.info.i3") {
+		t.Error("Expected info node kb1.header.a.header.b.info.i3 to be stored")
+	}
+
+	// A failing info node must leave the path untouched
+	if err := cmdb.AddInfoNode("info", "i4", map[string]interface{}{}, ""); err == nil {
+		t.Error("Expected error for duplicate info node")
+	}
+	expectPath("kb1.header.a.header.b.header.c")
+
+	for _, name := range []string{"c", "b", "a"} {
+		if err := cmdb.LeaveHeaderNode("header", name); err != nil {
+			t.Fatalf("LeaveHeaderNode failed: %v", err)
+		}
+	}
+	if err := cmdb.CheckInstallation(); err != nil {
+		t.Errorf("CheckInstallation failed: %v", err)
+	}
+}
+
+// TestRemoveKBAndNode checks removal guards and that CheckInstallation still passes
+func TestRemoveKBAndNode(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+	if err := cmdb.AddKB("kb2", "second knowledge base"); err != nil {
+		t.Fatalf("AddKB failed: %v", err)
+	}
+
+	if err := cmdb.AddHeaderNode("header", "a", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if err := cmdb.AddInfoNode("info", "i1", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddInfoNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("link1", ""); err != nil {
+		t.Fatalf("AddLinkNode failed: %v", err)
+	}
+
+	if err := cmdb.RemoveKB("kb1"); err == nil {
+		t.Error("Expected error removing the working KB with an open header")
+	}
+	if err := cmdb.RemoveNode("kb1.header.a"); err == nil {
+		t.Error("Expected error removing a node on the current path")
+	}
+	if err := cmdb.RemoveNode("kb1.header.a.info.i1"); err != nil {
+		t.Fatalf("RemoveNode failed: %v", err)
+	}
+	if cmdb.Exists("kb1.header.a.info.i1") {
+		t.Error("Expected kb1.header.a.info.i1 to be removed")
+	}
+	if err := cmdb.RemoveNode("kb1.header.a.info.i1"); err == nil {
+		t.Error("Expected error removing a missing node")
+	}
+	// The info node can be added again once removed
+	if err := cmdb.AddInfoNode("info", "i1", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("Re-adding removed info node failed: %v", err)
+	}
+
+	if err := cmdb.LeaveHeaderNode("header", "a"); err != nil {
+		t.Fatalf("LeaveHeaderNode failed: %v", err)
+	}
+	if err := cmdb.RemoveKB("kb1"); err != nil {
+		t.Fatalf("RemoveKB failed: %v", err)
+	}
+	if cmdb.GetWorkingKB() != nil {
+		t.Error("Expected no working KB after removing it")
+	}
+	if cmdb.Size() != 0 || len(cmdb.GetLinkNodes()) != 0 {
+		t.Errorf("Expected no nodes or links left, got %d nodes and %v", cmdb.Size(), cmdb.GetLinkNodes())
+	}
+	if names := cmdb.GetAllKBNames(); len(names) != 1 || names[0] != "kb2" {
+		t.Errorf("Expected only kb2 left, got %v", names)
+	}
+	if err := cmdb.RemoveKB("kb1"); err == nil {
+		t.Error("Expected error removing a missing KB")
+	}
+	if err := cmdb.CheckInstallation(); err != nil {
+		t.Errorf("CheckInstallation failed: %v", err)
+	}
+}
+
+// TestHeaderStackUnbalanced checks LeaveHeaderNode against unbalanced enter/leave sequences
+func TestHeaderStackUnbalanced(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+
+	if err := cmdb.LeaveHeaderNode("header", "a"); err == nil {
+		t.Error("Expected error leaving with no header open")
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := cmdb.AddHeaderNode("header", name, map[string]interface{}{}, ""); err != nil {
+			t.Fatalf("AddHeaderNode failed: %v", err)
+		}
+	}
+
+	// Leaving an outer header first is rejected and leaves the path alone
+	err := cmdb.LeaveHeaderNode("header", "b")
+	if err == nil {
+		t.Fatal("Expected error leaving an outer header")
+	}
+	if want := "tried to leave 'header.b' but current header is 'header.c'"; err.Error() != want {
+		t.Errorf("Expected error %q, got %q", want, err.Error())
+	}
+	if got := cmdb.GetCurrentPathString(); got != "kb1.header.a.header.b.header.c" {
+		t.Errorf("Expected path unchanged, got %s", got)
+	}
+
+	// A duplicate header is rejected without entering it
+	if err := cmdb.LeaveHeaderNode("header", "c"); err != nil {
+		t.Fatalf("LeaveHeaderNode failed: %v", err)
+	}
+	if err := cmdb.AddHeaderNode("header", "c", map[string]interface{}{}, ""); err == nil {
+		t.Error("Expected error for duplicate header node")
+	}
+	if got := cmdb.GetCurrentPathString(); got != "kb1.header.a.header.b" {
+		t.Errorf("Expected path kb1.header.a.header.b, got %s", got)
+	}
+
+	// A header with an invalid label is rejected without entering or reserving it
+	if err := cmdb.AddHeaderNode("header", "bad-name", map[string]interface{}{}, ""); err == nil {
+		t.Error("Expected error for an invalid label")
+	}
+	if got := cmdb.GetCurrentPathString(); got != "kb1.header.a.header.b" {
+		t.Errorf("Expected path unchanged after an invalid label, got %s", got)
+	}
+	if cmdb.compositePathValues["kb1"]["kb1.header.a.header.b.header.bad-name"] {
+		t.Error("Expected the invalid path not to be marked as used")
+	}
+
+	// Info nodes are never entered, so they cannot be left
+	if err := cmdb.AddInfoNode("info", "i1", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddInfoNode failed: %v", err)
+	}
+	if err := cmdb.LeaveHeaderNode("info", "i1"); err == nil {
+		t.Error("Expected error leaving an info node")
+	}
+
+	if err := cmdb.CheckInstallation(); err == nil {
+		t.Error("Expected CheckInstallation to fail with headers still open")
+	}
+	for _, name := range []string{"b", "a"} {
+		if err := cmdb.LeaveHeaderNode("header", name); err != nil {
+			t.Fatalf("LeaveHeaderNode failed: %v", err)
+		}
+	}
+	if err := cmdb.LeaveHeaderNode("header", "a"); err == nil {
+		t.Error("Expected error leaving more headers than were entered")
+	}
+	if err := cmdb.CheckInstallation(); err != nil {
+		t.Errorf("CheckInstallation failed: %v", err)
+	}
+}
+
+// debugLogger captures Debugf output for tests
+type debugLogger struct {
+	messages []string
+}
+
+func (l *debugLogger) Debugf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+func (l *debugLogger) Infof(format string, args ...interface{})  {}
+func (l *debugLogger) Errorf(format string, args ...interface{}) {}
+
+// TestSetLogger checks that diagnostic output goes to an injected logger
+func TestSetLogger(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+	logger := &debugLogger{}
+	cmdb.SetLogger(logger)
+
+	if err := cmdb.AddHeaderNode("header", "a", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if len(logger.messages) != 1 || logger.messages[0] != "path kb1.header.a" {
+		t.Errorf("Unexpected captured output: %v", logger.messages)
+	}
+
+	cmdb.SetLogger(nil)
+	if _, ok := cmdb.log().(noopLogger); !ok {
+		t.Errorf("Expected nil logger to restore the no-op logger, got %T", cmdb.log())
+	}
+}
+
+// TestClone mutates a clone and checks the original is unchanged
+func TestClone(t *testing.T) {
+	cmdb := newTestConstructMemDB(t)
+	if err := cmdb.AddHeaderNode("header", "a", map[string]interface{}{"list": []interface{}{"x"}}, "header a"); err != nil {
+		t.Fatalf("AddHeaderNode failed: %v", err)
+	}
+	if err := cmdb.AddLinkNode("link1", "kb1.header.a"); err != nil {
+		t.Fatalf("AddLinkNode failed: %v", err)
+	}
+
+	clone := cmdb.Clone()
+	if clone.GetCurrentPathString() != "kb1.header.a" {
+		t.Fatalf("Expected clone at kb1.header.a, got %s", clone.GetCurrentPathString())
+	}
+
+	// Mutate every piece of clone state
+	node, _ := clone.GetNode("kb1.header.a")
+	data := node.Data.(map[string]interface{})
+	data["list"].([]interface{})[0] = "changed"
+	data["added"] = true
+	if err := clone.AddHeaderNode("header", "b", map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("AddHeaderNode on clone failed: %v", err)
+	}
+	if err := clone.AddLinkNode("link2", "kb1.header.a"); err != nil {
+		t.Fatalf("AddLinkNode on clone failed: %v", err)
+	}
+	if err := clone.AddKB("kb2", "clone only"); err != nil {
+		t.Fatalf("AddKB on clone failed: %v", err)
+	}
+	if err := clone.SelectKB("kb2"); err != nil {
+		t.Fatalf("SelectKB on clone failed: %v", err)
+	}
+
+	if got := cmdb.GetCurrentPathString(); got != "kb1.header.a" {
+		t.Errorf("Expected original path kb1.header.a, got %s", got)
+	}
+	if cmdb.Exists("kb1.header.a.header.b") {
+		t.Error("Expected node added to the clone to be absent from the original")
+	}
+	original, _ := cmdb.GetNode("kb1.header.a")
+	originalData := original.Data.(map[string]interface{})
+	if originalData["list"].([]interface{})[0] != "x" || originalData["added"] != nil {
+		t.Errorf("Expected original node data unchanged, got %v", originalData)
+	}
+	if len(cmdb.GetLinkNodes()) != 1 {
+		t.Errorf("Expected 1 link on the original, got %d", len(cmdb.GetLinkNodes()))
+	}
+	if len(cmdb.GetAllKBNames()) != 1 || *cmdb.GetWorkingKB() != "kb1" {
+		t.Errorf("Expected original to keep only kb1 selected, got %v and %s", cmdb.GetAllKBNames(), *cmdb.GetWorkingKB())
+	}
+
+	if err := clone.SelectKB("kb1"); err != nil {
+		t.Fatalf("SelectKB on clone failed: %v", err)
+	}
+	if err := clone.LeaveHeaderNode("header", "b"); err != nil {
+		t.Fatalf("LeaveHeaderNode on clone failed: %v", err)
+	}
+	if err := cmdb.LeaveHeaderNode("header", "a"); err != nil {
+		t.Fatalf("LeaveHeaderNode on original failed: %v", err)
+	}
+	if err := cmdb.CheckInstallation(); err != nil {
+		t.Errorf("Expected original installation to check out, got %v", err)
+	}
+}
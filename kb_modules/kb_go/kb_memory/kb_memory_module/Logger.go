@@ -0,0 +1,29 @@
+package kb_memory_module
+
+// Logger receives diagnostic output from the in-memory databases. Library code
+// never writes to stdout; install a Logger with SetLogger to see it.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards all output and is the default Logger
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Infof(format string, args ...interface{})  {}
+func (noopLogger) Errorf(format string, args ...interface{}) {}
+
+// SetLogger sets the Logger used for diagnostic output; nil restores the no-op logger
+func (db *BasicConstructDB) SetLogger(logger Logger) {
+	db.logger = logger
+}
+
+// log returns the configured Logger, or a no-op logger when none is set
+func (db *BasicConstructDB) log() Logger {
+	if db.logger == nil {
+		return noopLogger{}
+	}
+	return db.logger
+}
@@ -1,8 +1,16 @@
 package kb_memory_module
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	//"log"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -13,8 +21,11 @@ type SearchMemDB struct {
 	kbs             map[string][]string  // Knowledge bases mapping
 	labels          map[string][]string  // Labels mapping
 	names           map[string][]string  // Names mapping
+	tables          map[string][]string  // Source tables mapping
 	DecodedKeys     map[string][]string  // Decoded path keys
 	FilterResults   map[string]*TreeNode // Current filter results
+	updated         map[string]bool      // Paths changed by UpdateNodeData since the last Flush
+	deleted         map[string]string    // Paths removed by DeleteNode since the last Flush, with their source table
 }
 
 // NewSearchMemDB creates a new SearchMemDB instance and loads data from PostgreSQL
@@ -33,6 +44,9 @@ func NewSearchMemDB(host string, port int, dbname, user, password, tableName str
 	if err != nil {
 		return nil, fmt.Errorf("failed to import from postgres: %w", err)
 	}
+	for _, node := range smdb.data {
+		node.Table = tableName
+	}
 
 	// Generate decoded keys
 	smdb.keys = smdb.generateDecodedKeys(smdb.data)
@@ -43,25 +57,73 @@ func NewSearchMemDB(host string, port int, dbname, user, password, tableName str
 	return smdb, nil
 }
 
-// generateDecodedKeys processes the data and creates lookup maps
+// NewMultiSearchMemDB creates a SearchMemDB loaded from several tables, for
+// deployments that split knowledge bases across tables. Every node is tagged
+// with its source table, so SearchKB and the other filters span all tables and
+// SearchTable narrows to one. Paths must be unique across the tables: a path
+// found in two tables is an error rather than one node silently replacing the
+// other. TableName is set to the first table.
+func NewMultiSearchMemDB(host string, port int, dbname, user, password string, tableNames []string) (*SearchMemDB, error) {
+	if len(tableNames) == 0 {
+		return nil, fmt.Errorf("at least one table name is required")
+	}
+
+	smdb := &SearchMemDB{
+		BasicConstructDB: NewBasicConstructDB(host, port, dbname, user, password, tableNames[0]),
+	}
+
+	for _, tableName := range tableNames {
+		source := NewBasicConstructDB(host, port, dbname, user, password, tableName)
+		if _, err := source.ImportFromPostgres(tableName, "path", "data", "created_at", "updated_at"); err != nil {
+			return nil, fmt.Errorf("failed to import table '%s' from postgres: %w", tableName, err)
+		}
+		if err := smdb.mergeTable(tableName, source.data); err != nil {
+			return nil, err
+		}
+	}
+
+	smdb.keys = smdb.generateDecodedKeys(smdb.data)
+	smdb.ClearFilters()
+
+	return smdb, nil
+}
+
+// mergeTable adds the nodes loaded from tableName to the store, tagging each
+// with its table. It fails without changing the store if any path is already
+// held by another table.
+func (smdb *SearchMemDB) mergeTable(tableName string, nodes map[string]*TreeNode) error {
+	for path := range nodes {
+		if existing, exists := smdb.data[path]; exists {
+			return fmt.Errorf("path '%s' is in both table '%s' and table '%s'", path, existing.Table, tableName)
+		}
+	}
+	for path, node := range nodes {
+		node.Table = tableName
+		smdb.data[path] = node
+	}
+	return nil
+}
+
+// generateDecodedKeys processes the data and creates lookup maps.
+// Paths are expected to look like kb.[...].label.name: the first component is
+// the knowledge base and the last two are the label and name. Shorter paths
+// (a kb root or kb.x) are indexed under their kb only.
 func (smdb *SearchMemDB) generateDecodedKeys(data map[string]*TreeNode) map[string][]string {
 	smdb.kbs = make(map[string][]string)
 	smdb.labels = make(map[string][]string)
 	smdb.names = make(map[string][]string)
+	smdb.tables = make(map[string][]string)
 	smdb.DecodedKeys = make(map[string][]string)
 
-	for key := range data {
+	for key, node := range data {
 		// Split the key into components
 		smdb.DecodedKeys[key] = strings.Split(key, ".")
-		
-		if len(smdb.DecodedKeys[key]) < 3 {
-			// Skip keys that don't have at least kb.label.name structure
-			continue
-		}
 
+		if node != nil && node.Table != "" {
+			smdb.tables[node.Table] = append(smdb.tables[node.Table], key)
+		}
+		
 		kb := smdb.DecodedKeys[key][0]
-		label := smdb.DecodedKeys[key][len(smdb.DecodedKeys[key])-2]
-		name := smdb.DecodedKeys[key][len(smdb.DecodedKeys[key])-1]
 
 		// Add to knowledge bases map
 		if _, exists := smdb.kbs[kb]; !exists {
@@ -69,6 +131,14 @@ func (smdb *SearchMemDB) generateDecodedKeys(data map[string]*TreeNode) map[stri
 		}
 		smdb.kbs[kb] = append(smdb.kbs[kb], key)
 
+		if len(smdb.DecodedKeys[key]) < 3 {
+			// No kb.label.name structure, so there is no label or name to index
+			continue
+		}
+
+		label := smdb.DecodedKeys[key][len(smdb.DecodedKeys[key])-2]
+		name := smdb.DecodedKeys[key][len(smdb.DecodedKeys[key])-1]
+
 		// Add to labels map
 		if _, exists := smdb.labels[label]; !exists {
 			smdb.labels[label] = make([]string, 0)
@@ -85,15 +155,25 @@ func (smdb *SearchMemDB) generateDecodedKeys(data map[string]*TreeNode) map[stri
 	return smdb.DecodedKeys
 }
 
-// ClearFilters clears all filters and resets the query state
+// ClearFilters clears all filters and resets the query state. FilterResults
+// becomes a copy of the store, sized up front so the copy allocates once, and
+// can be modified without touching the store.
 func (smdb *SearchMemDB) ClearFilters() {
-	smdb.FilterResults = make(map[string]*TreeNode)
-	// Copy all data to filter results
+	smdb.FilterResults = make(map[string]*TreeNode, len(smdb.data))
 	for key, value := range smdb.data {
 		smdb.FilterResults[key] = value
 	}
 }
 
+// copyResults returns a private copy of the current filter results
+func (smdb *SearchMemDB) copyResults() map[string]*TreeNode {
+	results := make(map[string]*TreeNode, len(smdb.FilterResults))
+	for key, value := range smdb.FilterResults {
+		results[key] = value
+	}
+	return results
+}
+
 // SearchKB searches for rows matching the specified knowledge base
 func (smdb *SearchMemDB) SearchKB(knowledgeBase string) map[string]*TreeNode {
 	newFilterResults := make(map[string]*TreeNode)
@@ -110,6 +190,11 @@ func (smdb *SearchMemDB) SearchKB(knowledgeBase string) map[string]*TreeNode {
 	return smdb.FilterResults
 }
 
+// SearchTable keeps the rows loaded from table; see NewMultiSearchMemDB
+func (smdb *SearchMemDB) SearchTable(table string) map[string]*TreeNode {
+	return smdb.searchIndex(smdb.tables, func(candidate string) bool { return candidate == table })
+}
+
 // SearchLabel searches for rows matching the specified label
 func (smdb *SearchMemDB) SearchLabel(label string) map[string]*TreeNode {
 	newFilterResults := make(map[string]*TreeNode)
@@ -142,6 +227,57 @@ func (smdb *SearchMemDB) SearchName(name string) map[string]*TreeNode {
 	return smdb.FilterResults
 }
 
+// searchIndex narrows the filter results to keys whose index entry satisfies match
+func (smdb *SearchMemDB) searchIndex(index map[string][]string, match func(string) bool) map[string]*TreeNode {
+	newFilterResults := make(map[string]*TreeNode)
+
+	for entry, keys := range index {
+		if !match(entry) {
+			continue
+		}
+		for _, key := range keys {
+			if _, exists := smdb.FilterResults[key]; exists {
+				newFilterResults[key] = smdb.FilterResults[key]
+			}
+		}
+	}
+
+	smdb.FilterResults = newFilterResults
+	return smdb.FilterResults
+}
+
+// SearchNamePrefix searches for rows whose name starts with prefix
+func (smdb *SearchMemDB) SearchNamePrefix(prefix string) map[string]*TreeNode {
+	return smdb.searchIndex(smdb.names, func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// SearchNameRegex searches for rows whose name matches the regular expression pattern
+func (smdb *SearchMemDB) SearchNameRegex(pattern string) (map[string]*TreeNode, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name pattern '%s': %w", pattern, err)
+	}
+	return smdb.searchIndex(smdb.names, re.MatchString), nil
+}
+
+// SearchLabelPrefix searches for rows whose label starts with prefix
+func (smdb *SearchMemDB) SearchLabelPrefix(prefix string) map[string]*TreeNode {
+	return smdb.searchIndex(smdb.labels, func(label string) bool {
+		return strings.HasPrefix(label, prefix)
+	})
+}
+
+// SearchLabelRegex searches for rows whose label matches the regular expression pattern
+func (smdb *SearchMemDB) SearchLabelRegex(pattern string) (map[string]*TreeNode, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label pattern '%s': %w", pattern, err)
+	}
+	return smdb.searchIndex(smdb.labels, re.MatchString), nil
+}
+
 // SearchPropertyKey searches for rows that contain the specified property key
 func (smdb *SearchMemDB) SearchPropertyKey(dataKey string) map[string]*TreeNode {
 	newFilterResults := make(map[string]*TreeNode)
@@ -168,7 +304,7 @@ func (smdb *SearchMemDB) SearchPropertyValue(dataKey string, dataValue interface
 		if node, exists := smdb.data[key]; exists {
 			if dataMap, ok := node.Data.(map[string]interface{}); ok {
 				if value, hasKey := dataMap[dataKey]; hasKey {
-					if value == dataValue {
+					if valuesEqual(value, dataValue) {
 						newFilterResults[key] = smdb.FilterResults[key]
 					}
 				}
@@ -180,6 +316,34 @@ func (smdb *SearchMemDB) SearchPropertyValue(dataKey string, dataValue interface
 	return smdb.FilterResults
 }
 
+// SearchPropertyValueRange keeps rows whose data field dataKey is numerically within [min, max].
+// A nil bound is treated as unbounded; rows with non-numeric values are dropped.
+func (smdb *SearchMemDB) SearchPropertyValueRange(dataKey string, min, max interface{}) map[string]*TreeNode {
+	newFilterResults := make(map[string]*TreeNode)
+
+	minValue, hasMin := toFloat64(min)
+	maxValue, hasMax := toFloat64(max)
+	if (min != nil && !hasMin) || (max != nil && !hasMax) {
+		smdb.FilterResults = newFilterResults
+		return smdb.FilterResults
+	}
+
+	for key := range smdb.FilterResults {
+		if node, exists := smdb.data[key]; exists {
+			if dataMap, ok := node.Data.(map[string]interface{}); ok {
+				if value, ok := toFloat64(dataMap[dataKey]); ok {
+					if (!hasMin || value >= minValue) && (!hasMax || value <= maxValue) {
+						newFilterResults[key] = smdb.FilterResults[key]
+					}
+				}
+			}
+		}
+	}
+
+	smdb.FilterResults = newFilterResults
+	return smdb.FilterResults
+}
+
 // SearchStartingPath searches for a specific path and all its descendants
 func (smdb *SearchMemDB) SearchStartingPath(startingPath string) (map[string]*TreeNode, error) {
 	newFilterResults := make(map[string]*TreeNode)
@@ -209,10 +373,45 @@ func (smdb *SearchMemDB) SearchStartingPath(startingPath string) (map[string]*Tr
 	return newFilterResults, nil
 }
 
-// SearchPath searches for rows matching the specified LTREE path expression using operators
+// SearchStartingPathDepth is SearchStartingPath limited to descendants at most
+// maxDepth levels below startingPath: 0 keeps just the path, 1 adds its direct
+// children. A negative maxDepth is unbounded.
+func (smdb *SearchMemDB) SearchStartingPathDepth(startingPath string, maxDepth int) (map[string]*TreeNode, error) {
+	results, err := smdb.SearchStartingPath(startingPath)
+	if err != nil || maxDepth < 0 {
+		return results, err
+	}
+
+	limit := smdb.Nlevel(startingPath) + maxDepth
+	for path := range results {
+		if smdb.Nlevel(path) > limit {
+			delete(results, path)
+		}
+	}
+	smdb.FilterResults = results
+	return results, nil
+}
+
+// SearchPath searches for rows matching the specified LTREE path expression using operators.
+// An unknown operator leaves no rows; use SearchPathChecked to get an error instead.
 func (smdb *SearchMemDB) SearchPath(operator, startingPath string) map[string]*TreeNode {
+	results, _ := smdb.SearchPathChecked(operator, startingPath)
+	if results == nil {
+		smdb.FilterResults = make(map[string]*TreeNode)
+		return smdb.FilterResults
+	}
+	return results
+}
+
+// SearchPathChecked keeps the rows matching startingPath under an ltree
+// operator; see QueryByOperatorChecked for the supported operators. An unknown
+// operator returns an error and leaves the filter results unchanged.
+func (smdb *SearchMemDB) SearchPathChecked(operator, startingPath string) (map[string]*TreeNode, error) {
 	// Use the parent class query method
-	searchResults := smdb.QueryByOperator(operator, startingPath, "")
+	searchResults, err := smdb.QueryByOperatorChecked(operator, startingPath, "")
+	if err != nil {
+		return nil, err
+	}
 	
 	newFilterResults := make(map[string]*TreeNode)
 	for _, item := range searchResults {
@@ -222,41 +421,117 @@ func (smdb *SearchMemDB) SearchPath(operator, startingPath string) map[string]*T
 	}
 	
 	smdb.FilterResults = newFilterResults
+	return smdb.FilterResults, nil
+}
+
+// Union adds the rows in other to the current filter results (OR)
+func (smdb *SearchMemDB) Union(other map[string]*TreeNode) map[string]*TreeNode {
+	for key, value := range other {
+		smdb.FilterResults[key] = value
+	}
 	return smdb.FilterResults
 }
 
-// FindDescriptions extracts descriptions from all data entries or a specific key
+// Intersect keeps only the current filter results that are also in other (AND)
+func (smdb *SearchMemDB) Intersect(other map[string]*TreeNode) map[string]*TreeNode {
+	newFilterResults := make(map[string]*TreeNode)
+	for key, value := range smdb.FilterResults {
+		if _, exists := other[key]; exists {
+			newFilterResults[key] = value
+		}
+	}
+	smdb.FilterResults = newFilterResults
+	return smdb.FilterResults
+}
+
+// Or runs each clause against the current filter results and keeps the union of
+// what they match. Clauses are ordinary Search* calls, so
+//
+//	smdb.SearchKB("kb1")
+//	smdb.Or(
+//		func(s *SearchMemDB) { s.SearchLabel("person") },
+//		func(s *SearchMemDB) { s.SearchLabel("org") },
+//	)
+//
+// selects label=person OR label=org within kb1. Successive Or calls are ANDed.
+func (smdb *SearchMemDB) Or(clauses ...func(*SearchMemDB)) map[string]*TreeNode {
+	base := smdb.FilterResults
+	union := make(map[string]*TreeNode)
+
+	for _, clause := range clauses {
+		// Each clause starts from its own copy, so a clause that modifies
+		// FilterResults cannot affect the next
+		smdb.FilterResults = make(map[string]*TreeNode, len(base))
+		for key, value := range base {
+			smdb.FilterResults[key] = value
+		}
+		clause(smdb)
+		for key, value := range smdb.FilterResults {
+			union[key] = value
+		}
+	}
+
+	smdb.FilterResults = union
+	return smdb.FilterResults
+}
+
+// FindDescriptions extracts descriptions from all data entries or a specific key.
+// A string key returns a one-entry map for that path (empty if the path does
+// not exist) and a []string returns entries for each existing path; a nil key
+// returns every node. Nodes without a string description map to "".
 func (smdb *SearchMemDB) FindDescriptions(key interface{}) map[string]string {
 	returnValues := make(map[string]string)
-	
-	// Process all data entries
-	for rowKey, rowData := range smdb.data {
-		if dataMap, ok := rowData.Data.(map[string]interface{}); ok {
-			if description, exists := dataMap["description"]; exists {
-				if descStr, ok := description.(string); ok {
-					returnValues[rowKey] = descStr
-				} else {
-					returnValues[rowKey] = ""
-				}
-			} else {
-				returnValues[rowKey] = ""
+
+	switch k := key.(type) {
+	case string:
+		if rowData, exists := smdb.data[k]; exists {
+			returnValues[k] = nodeDescription(rowData)
+		}
+	case []string:
+		for _, path := range k {
+			if rowData, exists := smdb.data[path]; exists {
+				returnValues[path] = nodeDescription(rowData)
 			}
-		} else {
-			returnValues[rowKey] = ""
+		}
+	default:
+		// Process all data entries
+		for rowKey, rowData := range smdb.data {
+			returnValues[rowKey] = nodeDescription(rowData)
 		}
 	}
-	
+
 	return returnValues
 }
 
+// FindDescriptionsByLabel returns the descriptions of the nodes with label,
+// keyed by path, reading only the keys indexed under that label
+func (smdb *SearchMemDB) FindDescriptionsByLabel(label string) map[string]string {
+	return smdb.FindDescriptions(smdb.labels[label])
+}
+
+// FindDescriptionsByKB returns the descriptions of the nodes in knowledge base
+// kb, keyed by path, reading only the keys indexed under that kb
+func (smdb *SearchMemDB) FindDescriptionsByKB(kb string) map[string]string {
+	return smdb.FindDescriptions(smdb.kbs[kb])
+}
+
+// nodeDescription returns the description stored in a node's data, or ""
+func nodeDescription(node *TreeNode) string {
+	if node == nil {
+		return ""
+	}
+	if dataMap, ok := node.Data.(map[string]interface{}); ok {
+		if descStr, ok := dataMap["description"].(string); ok {
+			return descStr
+		}
+	}
+	return ""
+}
+
 // GetFilterResults returns the current filter results
 func (smdb *SearchMemDB) GetFilterResults() map[string]*TreeNode {
 	// Return a copy to prevent external modification
-	results := make(map[string]*TreeNode)
-	for key, value := range smdb.FilterResults {
-		results[key] = value
-	}
-	return results
+	return smdb.copyResults()
 }
 
 // GetFilterResultKeys returns just the keys of current filter results
@@ -268,11 +543,82 @@ func (smdb *SearchMemDB) GetFilterResultKeys() []string {
 	return keys
 }
 
+// Count returns the number of current filter results without copying them
+func (smdb *SearchMemDB) Count() int {
+	return len(smdb.FilterResults)
+}
+
+// sortedResultKeys returns the filter result keys in path order
+func (smdb *SearchMemDB) sortedResultKeys() []string {
+	keys := smdb.GetFilterResultKeys()
+	sort.Strings(keys)
+	return keys
+}
+
+// FirstN returns up to n filter results in sorted path order. It copies and
+// sorts every result key to find them, so it costs as much as sorting the whole
+// set; the returned nodes are the stored ones, not copies.
+func (smdb *SearchMemDB) FirstN(n int) []*TreeNode {
+	if n <= 0 {
+		return []*TreeNode{}
+	}
+	keys := smdb.sortedResultKeys()
+	if n > len(keys) {
+		n = len(keys)
+	}
+	results := make([]*TreeNode, 0, n)
+	for _, key := range keys[:n] {
+		results = append(results, smdb.FilterResults[key])
+	}
+	return results
+}
+
+// resultJSON is the serialized form of a single filter result
+type resultJSON struct {
+	Path string      `json:"path"`
+	Data interface{} `json:"data"`
+}
+
+// MarshalResults writes the current filter results to w as a JSON array of
+// {path, data} objects in sorted path order
+func (smdb *SearchMemDB) MarshalResults(w io.Writer) error {
+	keys := smdb.sortedResultKeys()
+	results := make([]resultJSON, 0, len(keys))
+	for _, key := range keys {
+		var data interface{}
+		if node := smdb.FilterResults[key]; node != nil {
+			data = node.Data
+		}
+		results = append(results, resultJSON{Path: key, Data: data})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(results); err != nil {
+		return fmt.Errorf("failed to marshal filter results: %v", err)
+	}
+	return nil
+}
+
+// ResultsJSON returns the current filter results as JSON (see MarshalResults)
+func (smdb *SearchMemDB) ResultsJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := smdb.MarshalResults(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // GetKBs returns all knowledge bases
 func (smdb *SearchMemDB) GetKBs() map[string][]string {
 	return smdb.kbs
 }
 
+// GetTables returns the keys loaded from each source table
+func (smdb *SearchMemDB) GetTables() map[string][]string {
+	return smdb.tables
+}
+
 // GetLabels returns all labels
 func (smdb *SearchMemDB) GetLabels() map[string][]string {
 	return smdb.labels
@@ -288,3 +634,414 @@ func (smdb *SearchMemDB) GetDecodedKeys() map[string][]string {
 	return smdb.DecodedKeys
 }
 
+// toFloat64 converts Go and JSON numeric values to float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toInt64 converts an integer value, including a json.Number holding an
+// integer, to int64 without going through float64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// valuesEqual compares numbers by value and everything else structurally
+func valuesEqual(a, b interface{}) bool {
+	if ai, ok := toInt64(a); ok {
+		if bi, ok := toInt64(b); ok {
+			return ai == bi
+		}
+	}
+	if af, ok := toFloat64(a); ok {
+		if bf, ok := toFloat64(b); ok {
+			return af == bf
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// HasPath reports whether a node is stored at path
+func (smdb *SearchMemDB) HasPath(path string) bool {
+	_, exists := smdb.data[path]
+	return exists
+}
+
+// GetAncestors returns the stored ancestors of path, root first
+func (smdb *SearchMemDB) GetAncestors(path string) []*TreeNode {
+	labels := strings.Split(path, ".")
+	ancestors := make([]*TreeNode, 0, len(labels)-1)
+	for i := 1; i < len(labels); i++ {
+		if node, exists := smdb.data[strings.Join(labels[:i], ".")]; exists {
+			ancestors = append(ancestors, node)
+		}
+	}
+	return ancestors
+}
+
+// GetChildren returns the stored nodes exactly one level below path, in path order
+func (smdb *SearchMemDB) GetChildren(path string) []*TreeNode {
+	prefix := path + "."
+	children := make([]*TreeNode, 0)
+	for key, node := range smdb.data {
+		if strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], ".") {
+			children = append(children, node)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return children
+}
+
+// WalkFunc is called by Walk and WalkBreadthFirst for each visited node. depth
+// is 0 for the top of the walked subtree. Returning an error stops the walk and
+// the error is returned to the caller.
+type WalkFunc func(path string, node *TreeNode, depth int) error
+
+// subtreeChildren groups the stored nodes at or below root by parent, where a
+// node's parent is its nearest stored ancestor, as in GetAncestors. Nodes with no
+// stored ancestor inside the subtree are returned as tops. Both lists are in path
+// order. An empty root covers the whole store.
+func (smdb *SearchMemDB) subtreeChildren(root string) ([]string, map[string][]string) {
+	inSubtree := make(map[string]bool)
+	for path := range smdb.data {
+		if root == "" || path == root || strings.HasPrefix(path, root+".") {
+			inSubtree[path] = true
+		}
+	}
+
+	tops := make([]string, 0)
+	children := make(map[string][]string)
+	for path := range inSubtree {
+		labels := strings.Split(path, ".")
+		parent := ""
+		for i := len(labels) - 1; i > 0; i-- {
+			if candidate := strings.Join(labels[:i], "."); inSubtree[candidate] {
+				parent = candidate
+				break
+			}
+		}
+		if parent == "" {
+			tops = append(tops, path)
+		} else {
+			children[parent] = append(children[parent], path)
+		}
+	}
+
+	sort.Strings(tops)
+	for _, paths := range children {
+		sort.Strings(paths)
+	}
+	return tops, children
+}
+
+// Walk visits the stored nodes at or below root depth first, each node before
+// its children and siblings in path order. A node's parent is its nearest stored
+// ancestor, so the link labels between KB nodes do not need nodes of their own.
+// If root is not stored, its top-most stored descendants are visited at depth 0.
+// The whole store is walked, not FilterResults; an empty root walks every node.
+func (smdb *SearchMemDB) Walk(root string, visit WalkFunc) error {
+	tops, children := smdb.subtreeChildren(root)
+
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		if err := visit(path, smdb.data[path], depth); err != nil {
+			return err
+		}
+		for _, child := range children[path] {
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, top := range tops {
+		if err := walk(top, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkBreadthFirst visits the same nodes as Walk in level order: every node at
+// depth d, in path order within each parent, before any node at depth d+1
+func (smdb *SearchMemDB) WalkBreadthFirst(root string, visit WalkFunc) error {
+	tops, children := smdb.subtreeChildren(root)
+
+	level := tops
+	for depth := 0; len(level) > 0; depth++ {
+		var next []string
+		for _, path := range level {
+			if err := visit(path, smdb.data[path], depth); err != nil {
+				return err
+			}
+			next = append(next, children[path]...)
+		}
+		level = next
+	}
+	return nil
+}
+
+// UpdateNodeData replaces the data of the node at path in memory and marks it
+// for Flush. The node is changed in place, so FilterResults and maps returned
+// by earlier searches see the new data; they are not re-filtered. Paths, and
+// so the decoded-key indexes, are unchanged.
+func (smdb *SearchMemDB) UpdateNodeData(path string, data map[string]interface{}) error {
+	node, exists := smdb.data[path]
+	if !exists {
+		return fmt.Errorf("path '%s' does not exist", path)
+	}
+
+	node.Data = data
+	if smdb.updated == nil {
+		smdb.updated = make(map[string]bool)
+	}
+	smdb.updated[path] = true
+	return nil
+}
+
+// DeleteNode removes the node at path from the store, the decoded-key indexes
+// and FilterResults, and marks it for Flush. Descendants are kept.
+func (smdb *SearchMemDB) DeleteNode(path string) error {
+	node, exists := smdb.data[path]
+	if !exists {
+		return fmt.Errorf("path '%s' does not exist", path)
+	}
+
+	table := node.Table
+	if table == "" {
+		table = smdb.TableName
+	}
+	smdb.unindex(path, node)
+	delete(smdb.data, path)
+	// A no-op when FilterResults is the store itself
+	delete(smdb.FilterResults, path)
+
+	delete(smdb.updated, path)
+	if smdb.deleted == nil {
+		smdb.deleted = make(map[string]string)
+	}
+	smdb.deleted[path] = table
+	return nil
+}
+
+// unindex removes key from the maps built by generateDecodedKeys
+func (smdb *SearchMemDB) unindex(key string, node *TreeNode) {
+	labels := smdb.DecodedKeys[key]
+	delete(smdb.DecodedKeys, key)
+
+	if node.Table != "" {
+		removeIndexKey(smdb.tables, node.Table, key)
+	}
+	if len(labels) == 0 {
+		return
+	}
+	removeIndexKey(smdb.kbs, labels[0], key)
+	if len(labels) >= 3 {
+		removeIndexKey(smdb.labels, labels[len(labels)-2], key)
+		removeIndexKey(smdb.names, labels[len(labels)-1], key)
+	}
+}
+
+// removeIndexKey drops key from index[entry], removing the entry once empty
+func removeIndexKey(index map[string][]string, entry, key string) {
+	keys := index[entry]
+	for i, candidate := range keys {
+		if candidate == key {
+			keys = append(keys[:i:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(index, entry)
+	} else {
+		index[entry] = keys
+	}
+}
+
+// PendingChanges returns the number of nodes updated or deleted since the last Flush
+func (smdb *SearchMemDB) PendingChanges() int {
+	return len(smdb.updated) + len(smdb.deleted)
+}
+
+// Flush writes the changes made by UpdateNodeData and DeleteNode to the tables
+// the nodes were loaded from, in one transaction, and returns the number of rows
+// written. Updated rows get the new data and, where the table has the column, an
+// updated_at of now, which is also stored on the node. If any change fails,
+// including an updated path that is no longer in its table, nothing is written
+// and the changes stay pending.
+func (smdb *SearchMemDB) Flush() (int, error) {
+	if smdb.PendingChanges() == 0 {
+		return 0, nil
+	}
+
+	conn, err := smdb.getDBConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	written, updatedAt, err := smdb.flushChanges(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for path, ts := range updatedAt {
+		ts := ts
+		smdb.data[path].UpdatedAt = &ts
+	}
+	smdb.updated = nil
+	smdb.deleted = nil
+	return written, nil
+}
+
+// flushChanges writes the pending changes within tx. It returns the number of
+// rows written and the updated_at stored for each updated path.
+func (smdb *SearchMemDB) flushChanges(tx *sql.Tx) (int, map[string]string, error) {
+	hasUpdatedAt := make(map[string]bool)
+	tableHasUpdatedAt := func(table string) (bool, error) {
+		if has, checked := hasUpdatedAt[table]; checked {
+			return has, nil
+		}
+		rows, err := tx.Query("SELECT column_name FROM information_schema.columns WHERE table_name = $1 AND column_name = 'updated_at'", table)
+		if err != nil {
+			return false, err
+		}
+		has := rows.Next()
+		rows.Close()
+		hasUpdatedAt[table] = has
+		return has, rows.Err()
+	}
+
+	updatedPaths := make([]string, 0, len(smdb.updated))
+	for path := range smdb.updated {
+		updatedPaths = append(updatedPaths, path)
+	}
+	sort.Strings(updatedPaths)
+	deletedPaths := make([]string, 0, len(smdb.deleted))
+	for path := range smdb.deleted {
+		deletedPaths = append(deletedPaths, path)
+	}
+	sort.Strings(deletedPaths)
+
+	written := 0
+	updatedAt := make(map[string]string)
+	for _, path := range updatedPaths {
+		node := smdb.data[path]
+		table := node.Table
+		if table == "" {
+			table = smdb.TableName
+		}
+		dataBytes, err := json.Marshal(node.Data)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error marshaling data for path %s: %v", path, err)
+		}
+
+		has, err := tableHasUpdatedAt(table)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error reading columns of table '%s': %v", table, err)
+		}
+		if has {
+			var ts string
+			err = tx.QueryRow(fmt.Sprintf("UPDATE %s SET data = $2, updated_at = NOW() WHERE path = $1::ltree RETURNING updated_at::text", table),
+				path, dataBytes).Scan(&ts)
+			if err == nil {
+				updatedAt[path] = ts
+			}
+		} else {
+			var result sql.Result
+			result, err = tx.Exec(fmt.Sprintf("UPDATE %s SET data = $2 WHERE path = $1::ltree", table), path, dataBytes)
+			if err == nil {
+				var affected int64
+				if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+					err = sql.ErrNoRows
+				}
+			}
+		}
+		if err == sql.ErrNoRows {
+			return 0, nil, fmt.Errorf("path %s is no longer in table '%s'", path, table)
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("error updating path %s: %v", path, err)
+		}
+		written++
+	}
+
+	for _, path := range deletedPaths {
+		result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE path = $1::ltree", smdb.deleted[path]), path)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error deleting path %s: %v", path, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, nil, err
+		}
+		written += int(affected)
+	}
+
+	return written, updatedAt, nil
+}
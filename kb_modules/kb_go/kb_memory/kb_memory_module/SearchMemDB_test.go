@@ -0,0 +1,850 @@
+package kb_memory_module
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// newTestSearchMemDB builds a SearchMemDB over in-memory nodes without a database
+func newTestSearchMemDB(t *testing.T, nodes map[string]interface{}) *SearchMemDB {
+	t.Helper()
+
+	smdb := &SearchMemDB{
+		BasicConstructDB: NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "knowledge_base"),
+	}
+	for path, data := range nodes {
+		if err := smdb.Store(path, data, nil, nil); err != nil {
+			t.Fatalf("Error storing %s: %v", path, err)
+		}
+	}
+	smdb.keys = smdb.generateDecodedKeys(smdb.data)
+	smdb.ClearFilters()
+	return smdb
+}
+
+// TestSearchPropertyValueNumeric checks numbers compare by value across types
+func TestSearchPropertyValueNumeric(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": map[string]interface{}{"age": float64(30)},
+		"kb1.person.bob":   map[string]interface{}{"age": json.Number("30")},
+		"kb1.person.carol": map[string]interface{}{"age": 31},
+		"kb1.person.dave":  map[string]interface{}{"age": "30"},
+	})
+
+	results := smdb.SearchPropertyValue("age", 30)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 matches for int 30, got %v", results)
+	}
+	for _, key := range []string{"kb1.person.alice", "kb1.person.bob"} {
+		if _, ok := results[key]; !ok {
+			t.Errorf("Expected %s to match", key)
+		}
+	}
+
+	smdb.ClearFilters()
+	if results := smdb.SearchPropertyValue("age", "30"); len(results) != 1 {
+		t.Errorf("Expected string '30' to match only dave, got %v", results)
+	}
+}
+
+// TestSearchPropertyValueLargeInt checks 64-bit integers beyond 2^53 compare exactly
+func TestSearchPropertyValueLargeInt(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.counter.a": map[string]interface{}{"id": json.Number("9007199254740992")},
+		"kb1.counter.b": map[string]interface{}{"id": json.Number("9007199254740993")},
+	})
+
+	results := smdb.SearchPropertyValue("id", int64(9007199254740993))
+	if len(results) != 1 {
+		t.Fatalf("Expected exactly 1 match, got %v", results)
+	}
+	if _, ok := results["kb1.counter.b"]; !ok {
+		t.Errorf("Expected kb1.counter.b to match, got %v", results)
+	}
+}
+
+// TestSearchPropertyValueRange checks inclusive and open-ended ranges over mixed numeric types
+func TestSearchPropertyValueRange(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.sensor.a": map[string]interface{}{"temp": 10},
+		"kb1.sensor.b": map[string]interface{}{"temp": 20.5},
+		"kb1.sensor.c": map[string]interface{}{"temp": json.Number("30")},
+		"kb1.sensor.d": map[string]interface{}{"temp": "hot"},
+		"kb1.sensor.e": map[string]interface{}{"other": 15},
+	})
+
+	cases := []struct {
+		name     string
+		min, max interface{}
+		expected int
+	}{
+		{"Inclusive", 10, 30.0, 3},
+		{"FloatBounds", 10.5, 29.9, 1},
+		{"OpenMax", int64(20), nil, 2},
+		{"OpenMin", nil, 20, 1},
+		{"NonNumericBound", "a", 30, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			smdb.ClearFilters()
+			results := smdb.SearchPropertyValueRange("temp", c.min, c.max)
+			if len(results) != c.expected {
+				t.Errorf("Expected %d matches, got %d: %v", c.expected, len(results), results)
+			}
+		})
+	}
+}
+
+// TestSearchNamePrefixAndRegex checks prefix and regex matching on names and labels
+func TestSearchNamePrefixAndRegex(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.foo_one":  map[string]interface{}{},
+		"kb1.person.foo_two":  map[string]interface{}{},
+		"kb1.org.bar":         map[string]interface{}{},
+		"kb1.org_unit.foobar": map[string]interface{}{},
+	})
+
+	if results := smdb.SearchNamePrefix("foo"); len(results) != 3 {
+		t.Errorf("Expected 3 names starting with foo, got %v", results)
+	}
+
+	// Prefix searches intersect with the current filter set
+	if results := smdb.SearchLabel("person"); len(results) != 2 {
+		t.Errorf("Expected 2 person rows after intersect, got %v", results)
+	}
+
+	smdb.ClearFilters()
+	results, err := smdb.SearchNameRegex(`^foo_(one|three)$`)
+	if err != nil {
+		t.Fatalf("Error searching by regex: %v", err)
+	}
+	if _, ok := results["kb1.person.foo_one"]; !ok || len(results) != 1 {
+		t.Errorf("Expected only foo_one, got %v", results)
+	}
+
+	smdb.ClearFilters()
+	if results := smdb.SearchLabelPrefix("org"); len(results) != 2 {
+		t.Errorf("Expected 2 labels starting with org, got %v", results)
+	}
+
+	smdb.ClearFilters()
+	results, err = smdb.SearchLabelRegex(`_unit$`)
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected 1 label matching _unit$, got %v, %v", results, err)
+	}
+
+	if _, err := smdb.SearchNameRegex(`(`); err == nil {
+		t.Error("Expected error for invalid name pattern")
+	}
+	if _, err := smdb.SearchLabelRegex(`[`); err == nil {
+		t.Error("Expected error for invalid label pattern")
+	}
+}
+
+// TestSearchOr checks OR clauses and AND-of-ORs over the filter results
+func TestSearchOr(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": map[string]interface{}{"active": true},
+		"kb1.person.bob":   map[string]interface{}{"active": false},
+		"kb1.org.acme":     map[string]interface{}{"active": true},
+		"kb1.place.home":   map[string]interface{}{"active": true},
+		"kb2.person.carol": map[string]interface{}{"active": true},
+		"kb2.org.globex":   map[string]interface{}{"active": true},
+	})
+
+	byLabel := func(label string) func(*SearchMemDB) {
+		return func(s *SearchMemDB) { s.SearchLabel(label) }
+	}
+
+	// label=person OR label=org within kb1
+	smdb.SearchKB("kb1")
+	results := smdb.Or(byLabel("person"), byLabel("org"))
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 rows, got %v", results)
+	}
+	if _, ok := results["kb1.place.home"]; ok {
+		t.Error("Did not expect kb1.place.home")
+	}
+
+	// (label=person OR label=org) AND (name=alice OR active=true)
+	smdb.ClearFilters()
+	smdb.Or(byLabel("person"), byLabel("org"))
+	results = smdb.Or(
+		func(s *SearchMemDB) { s.SearchName("alice") },
+		func(s *SearchMemDB) { s.SearchPropertyValue("active", true) },
+	)
+	expected := []string{"kb1.person.alice", "kb1.org.acme", "kb2.person.carol", "kb2.org.globex"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d rows, got %v", len(expected), results)
+	}
+	for _, key := range expected {
+		if _, ok := results[key]; !ok {
+			t.Errorf("Expected %s in results", key)
+		}
+	}
+
+	t.Run("UnionIntersect", func(t *testing.T) {
+		smdb.ClearFilters()
+		orgs := make(map[string]*TreeNode)
+		for key, value := range smdb.SearchLabel("org") {
+			orgs[key] = value
+		}
+		smdb.ClearFilters()
+
+		smdb.SearchKB("kb2")
+		smdb.SearchLabel("person")
+		if results := smdb.Union(orgs); len(results) != 3 {
+			t.Errorf("Expected kb2 person plus 2 orgs, got %v", results)
+		}
+		if results := smdb.Intersect(orgs); len(results) != 2 {
+			t.Errorf("Expected 2 orgs after intersect, got %v", results)
+		}
+	})
+}
+
+// TestSearchStartingPathDepth checks the depth bound over a 3-level tree
+func TestSearchStartingPathDepth(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.a":     map[string]interface{}{},
+		"kb1.a.b":   map[string]interface{}{},
+		"kb1.a.c":   map[string]interface{}{},
+		"kb1.a.b.d": map[string]interface{}{},
+		"kb1.e":     map[string]interface{}{},
+	})
+
+	cases := []struct {
+		maxDepth int
+		want     []string
+	}{
+		{0, []string{"kb1.a"}},
+		{1, []string{"kb1.a", "kb1.a.b", "kb1.a.c"}},
+		{-1, []string{"kb1.a", "kb1.a.b", "kb1.a.b.d", "kb1.a.c"}},
+	}
+	for _, c := range cases {
+		smdb.ClearFilters()
+		results, err := smdb.SearchStartingPathDepth("kb1.a", c.maxDepth)
+		if err != nil {
+			t.Fatalf("Error searching depth %d: %v", c.maxDepth, err)
+		}
+		got := []string{}
+		for path := range results {
+			got = append(got, path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Depth %d: expected %v, got %v", c.maxDepth, c.want, got)
+		}
+	}
+	if len(smdb.data) != 5 {
+		t.Errorf("Expected the store to keep 5 nodes, got %d", len(smdb.data))
+	}
+}
+
+// TestClearFiltersCopiesStore checks that the unfiltered results are a copy of
+// the store in both directions and that Or clauses do not see each other's unions
+func TestClearFiltersCopiesStore(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": 1,
+		"kb1.org.acme":     2,
+		"kb2.person.carol": 3,
+	})
+	extra := map[string]*TreeNode{"kb9.x.y": {Path: "kb9.x.y"}}
+
+	smdb.ClearFilters()
+	if results := smdb.Union(extra); len(results) != 4 {
+		t.Errorf("Expected 4 rows after union, got %v", results)
+	}
+	if smdb.HasPath("kb9.x.y") || smdb.Size() != 3 {
+		t.Error("Union after ClearFilters wrote into the store")
+	}
+
+	smdb.ClearFilters()
+	if count := smdb.Count(); count != 3 {
+		t.Errorf("Expected 3 rows after ClearFilters, got %d", count)
+	}
+
+	delete(smdb.FilterResults, "kb1.org.acme")
+	if !smdb.HasPath("kb1.org.acme") {
+		t.Error("Deleting from FilterResults removed the node from the store")
+	}
+	if err := smdb.Store("kb1.person.bob", 4, nil, nil); err != nil {
+		t.Fatalf("Error storing kb1.person.bob: %v", err)
+	}
+	if _, ok := smdb.FilterResults["kb1.person.bob"]; ok {
+		t.Error("A node stored after ClearFilters appeared in the filter results")
+	}
+	smdb.Delete("kb1.person.bob")
+
+	smdb.ClearFilters()
+	smdb.SearchKB("kb1")
+	results := smdb.Or(
+		func(s *SearchMemDB) { s.Union(extra) },
+		func(s *SearchMemDB) {
+			if _, ok := s.FilterResults["kb9.x.y"]; ok {
+				t.Error("Second Or clause saw the first clause's union")
+			}
+		},
+	)
+	if len(results) != 3 {
+		t.Errorf("Expected kb1 rows plus the union, got %v", results)
+	}
+}
+
+// BenchmarkClearFilters compares the presized copy with the growing copy it
+// replaced on a 10k node store; run with -benchmem to see the allocations
+func BenchmarkClearFilters(b *testing.B) {
+	smdb := &SearchMemDB{
+		BasicConstructDB: NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "knowledge_base"),
+	}
+	for i := 0; i < 10000; i++ {
+		path := fmt.Sprintf("kb%d.label%d.node%d", i%4, i%50, i)
+		if err := smdb.Store(path, i, nil, nil); err != nil {
+			b.Fatalf("Error storing %s: %v", path, err)
+		}
+	}
+	smdb.keys = smdb.generateDecodedKeys(smdb.data)
+
+	b.Run("ClearFilters", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			smdb.ClearFilters()
+			smdb.SearchLabel("label7")
+		}
+	})
+
+	b.Run("GrowingCopy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			smdb.FilterResults = make(map[string]*TreeNode)
+			for key, value := range smdb.data {
+				smdb.FilterResults[key] = value
+			}
+			smdb.SearchLabel("label7")
+		}
+	})
+}
+
+// TestShortPathsIndexed checks that 1- and 2-label paths are found by SearchKB
+func TestShortPathsIndexed(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1":              "root",
+		"kb1.header":       "header",
+		"kb1.person.alice": "alice",
+	})
+
+	results := smdb.SearchKB("kb1")
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 rows in kb1, got %v", results)
+	}
+	for _, key := range []string{"kb1", "kb1.header"} {
+		if _, ok := results[key]; !ok {
+			t.Errorf("Expected %s in kb1 results", key)
+		}
+	}
+
+	smdb.ClearFilters()
+	if results := smdb.SearchName("header"); len(results) != 0 {
+		t.Errorf("Did not expect a 2-label path to be indexed by name, got %v", results)
+	}
+}
+
+// TestCountAndFirstN checks Count and the sorted order of FirstN
+func TestCountAndFirstN(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.carol": 3,
+		"kb1.person.alice": 1,
+		"kb1.person.bob":   2,
+		"kb1.org.acme":     4,
+	})
+
+	smdb.SearchLabel("person")
+	if count := smdb.Count(); count != 3 {
+		t.Fatalf("Expected count 3, got %d", count)
+	}
+
+	first := smdb.FirstN(2)
+	if len(first) != 2 || first[0].Path != "kb1.person.alice" || first[1].Path != "kb1.person.bob" {
+		t.Errorf("Unexpected FirstN(2) result: %v", first)
+	}
+	if all := smdb.FirstN(10); len(all) != 3 || all[2].Path != "kb1.person.carol" {
+		t.Errorf("Expected all 3 rows in path order, got %v", all)
+	}
+	if none := smdb.FirstN(0); len(none) != 0 {
+		t.Errorf("Expected no rows for FirstN(0), got %v", none)
+	}
+}
+
+// TestResultsJSONGolden compares the serialized filter results with testdata
+func TestResultsJSONGolden(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.bob":          map[string]interface{}{"age": 41, "tags": []interface{}{"a", "b"}},
+		"kb1.person.alice":        map[string]interface{}{"age": 30},
+		"kb1.org_unit.acme_corp":  nil,
+		"kb1.place.home_base":     "1 Main St <rear>",
+		"kb2.person.not_selected": 1,
+	})
+	smdb.SearchKB("kb1")
+
+	got, err := smdb.ResultsJSON()
+	if err != nil {
+		t.Fatalf("ResultsJSON failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := smdb.MarshalResults(&buf); err != nil {
+		t.Fatalf("MarshalResults failed: %v", err)
+	}
+	if !bytes.Equal(got, buf.Bytes()) {
+		t.Errorf("ResultsJSON and MarshalResults differ:\n%s\n%s", got, buf.Bytes())
+	}
+
+	golden := filepath.Join("testdata", "search_results.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ResultsJSON mismatch\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+// TestFindDescriptions checks single-key, multi-key and all-keys lookups
+func TestFindDescriptions(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": map[string]interface{}{"description": "first"},
+		"kb1.person.bob":   map[string]interface{}{"age": 41},
+		"kb1.person.carol": "not a map",
+	})
+
+	single := smdb.FindDescriptions("kb1.person.alice")
+	if len(single) != 1 || single["kb1.person.alice"] != "first" {
+		t.Errorf("Unexpected single-key result: %v", single)
+	}
+	if missing := smdb.FindDescriptions("kb1.person.bob"); len(missing) != 1 || missing["kb1.person.bob"] != "" {
+		t.Errorf("Expected empty description for bob, got %v", missing)
+	}
+	if none := smdb.FindDescriptions("kb1.person.nobody"); len(none) != 0 {
+		t.Errorf("Expected no entry for a missing path, got %v", none)
+	}
+
+	multi := smdb.FindDescriptions([]string{"kb1.person.alice", "kb1.person.carol"})
+	if len(multi) != 2 || multi["kb1.person.alice"] != "first" || multi["kb1.person.carol"] != "" {
+		t.Errorf("Unexpected multi-key result: %v", multi)
+	}
+
+	all := smdb.FindDescriptions(nil)
+	if len(all) != 3 || all["kb1.person.alice"] != "first" || all["kb1.person.bob"] != "" {
+		t.Errorf("Unexpected all-keys result: %v", all)
+	}
+}
+
+// TestFindDescriptionsByLabelAndKB checks only the indexed nodes' descriptions are returned
+func TestFindDescriptionsByLabelAndKB(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": map[string]interface{}{"description": "alice"},
+		"kb1.person.bob":   map[string]interface{}{"age": 41},
+		"kb1.place.home":   map[string]interface{}{"description": "home"},
+		"kb2.person.carol": map[string]interface{}{"description": "carol"},
+	})
+
+	byLabel := smdb.FindDescriptionsByLabel("person")
+	want := map[string]string{"kb1.person.alice": "alice", "kb1.person.bob": "", "kb2.person.carol": "carol"}
+	if !reflect.DeepEqual(byLabel, want) {
+		t.Errorf("Expected %v by label, got %v", want, byLabel)
+	}
+
+	byKB := smdb.FindDescriptionsByKB("kb1")
+	want = map[string]string{"kb1.person.alice": "alice", "kb1.person.bob": "", "kb1.place.home": "home"}
+	if !reflect.DeepEqual(byKB, want) {
+		t.Errorf("Expected %v by kb, got %v", want, byKB)
+	}
+
+	if none := smdb.FindDescriptionsByLabel("missing"); len(none) != 0 {
+		t.Errorf("Expected no descriptions for an unknown label, got %v", none)
+	}
+	if none := smdb.FindDescriptionsByKB("kb3"); len(none) != 0 {
+		t.Errorf("Expected no descriptions for an unknown kb, got %v", none)
+	}
+}
+
+// TestPathLookups checks HasPath, GetAncestors and GetChildren over a small tree
+func TestPathLookups(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1":       nil,
+		"kb1.a":     nil,
+		"kb1.a.b.c": nil,
+		"kb1.a.x":   nil,
+		"kb1.a.y":   nil,
+		"kb1.a.y.z": nil,
+		"kb1.other": nil,
+		"kb2.a":     nil,
+	})
+
+	if !smdb.HasPath("kb1.a.b.c") || smdb.HasPath("kb1.a.b") {
+		t.Error("Unexpected HasPath result")
+	}
+
+	paths := func(nodes []*TreeNode) []string {
+		result := make([]string, len(nodes))
+		for i, node := range nodes {
+			result[i] = node.Path
+		}
+		return result
+	}
+	equal := func(got, want []string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// kb1.a.b is not stored, so it is skipped
+	if got := paths(smdb.GetAncestors("kb1.a.b.c")); !equal(got, []string{"kb1", "kb1.a"}) {
+		t.Errorf("Unexpected ancestors: %v", got)
+	}
+	if got := paths(smdb.GetAncestors("kb1")); len(got) != 0 {
+		t.Errorf("Expected no ancestors for a root, got %v", got)
+	}
+
+	if got := paths(smdb.GetChildren("kb1.a")); !equal(got, []string{"kb1.a.x", "kb1.a.y"}) {
+		t.Errorf("Unexpected children: %v", got)
+	}
+	if got := paths(smdb.GetChildren("kb1.a.x")); len(got) != 0 {
+		t.Errorf("Expected no children for a leaf, got %v", got)
+	}
+}
+
+// TestWalk checks depth-first and level-order visitation and that a visitor
+// error halts the walk
+func TestWalk(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1":                nil,
+		"kb1.hdr.a":          nil,
+		"kb1.hdr.a.info.x":   nil,
+		"kb1.hdr.a.info.y":   nil,
+		"kb1.hdr.a.info.y.z": nil,
+		"kb1.hdr.b":          nil,
+		"kb1.hdr.b.info.w":   nil,
+		"kb2.hdr.other":      nil,
+	})
+
+	type visit struct {
+		path  string
+		depth int
+	}
+	record := func(visits *[]visit) WalkFunc {
+		return func(path string, node *TreeNode, depth int) error {
+			if node == nil || node.Path != path {
+				t.Errorf("Unexpected node %+v for %s", node, path)
+			}
+			*visits = append(*visits, visit{path, depth})
+			return nil
+		}
+	}
+
+	var depthFirst []visit
+	if err := smdb.Walk("kb1", record(&depthFirst)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	wantDepthFirst := []visit{
+		{"kb1", 0},
+		{"kb1.hdr.a", 1},
+		{"kb1.hdr.a.info.x", 2},
+		{"kb1.hdr.a.info.y", 2},
+		{"kb1.hdr.a.info.y.z", 3},
+		{"kb1.hdr.b", 1},
+		{"kb1.hdr.b.info.w", 2},
+	}
+	if !reflect.DeepEqual(depthFirst, wantDepthFirst) {
+		t.Errorf("Unexpected depth-first order:\n got %v\nwant %v", depthFirst, wantDepthFirst)
+	}
+
+	var breadthFirst []visit
+	if err := smdb.WalkBreadthFirst("kb1", record(&breadthFirst)); err != nil {
+		t.Fatalf("WalkBreadthFirst failed: %v", err)
+	}
+	wantBreadthFirst := []visit{
+		{"kb1", 0},
+		{"kb1.hdr.a", 1},
+		{"kb1.hdr.b", 1},
+		{"kb1.hdr.a.info.x", 2},
+		{"kb1.hdr.a.info.y", 2},
+		{"kb1.hdr.b.info.w", 2},
+		{"kb1.hdr.a.info.y.z", 3},
+	}
+	if !reflect.DeepEqual(breadthFirst, wantBreadthFirst) {
+		t.Errorf("Unexpected breadth-first order:\n got %v\nwant %v", breadthFirst, wantBreadthFirst)
+	}
+
+	// kb1.hdr is not stored, so its stored descendants become the tops
+	var unstoredRoot []visit
+	if err := smdb.Walk("kb1.hdr", record(&unstoredRoot)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(unstoredRoot) != 6 || unstoredRoot[0] != (visit{"kb1.hdr.a", 0}) || unstoredRoot[4] != (visit{"kb1.hdr.b", 0}) {
+		t.Errorf("Unexpected walk of unstored root: %v", unstoredRoot)
+	}
+
+	// Walking the whole store, kb2.hdr.other is a second top
+	stop := errors.New("stop")
+	halts := []struct {
+		name    string
+		walk    func(string, WalkFunc) error
+		visited int
+	}{
+		{"Walk", smdb.Walk, 2},                         // kb1, kb1.hdr.a
+		{"WalkBreadthFirst", smdb.WalkBreadthFirst, 3}, // kb1, kb2.hdr.other, kb1.hdr.a
+	}
+	for _, h := range halts {
+		visited := 0
+		err := h.walk("", func(path string, node *TreeNode, depth int) error {
+			visited++
+			if path == "kb1.hdr.a" {
+				return stop
+			}
+			return nil
+		})
+		if err != stop {
+			t.Errorf("%s: expected the visitor error, got %v", h.name, err)
+		}
+		if visited != h.visited {
+			t.Errorf("%s: expected the walk to halt after %d visits, got %d", h.name, h.visited, visited)
+		}
+	}
+}
+
+// TestMergeTable checks nodes are tagged and indexed by table and duplicate paths are rejected
+func TestMergeTable(t *testing.T) {
+	smdb := &SearchMemDB{
+		BasicConstructDB: NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "table_a"),
+	}
+	load := func(table string, paths ...string) {
+		source := NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", table)
+		for _, path := range paths {
+			if err := source.Store(path, map[string]interface{}{"description": path}, nil, nil); err != nil {
+				t.Fatalf("Error storing %s: %v", path, err)
+			}
+		}
+		if err := smdb.mergeTable(table, source.data); err != nil {
+			t.Fatalf("Error merging %s: %v", table, err)
+		}
+	}
+	load("table_a", "kb1.header.a", "kb1.header.b")
+	load("table_b", "kb2.header.a", "kb2.item.c")
+	smdb.keys = smdb.generateDecodedKeys(smdb.data)
+	smdb.ClearFilters()
+
+	smdb.SearchLabel("header")
+	if got := sortedKeys(smdb.FilterResults); !reflect.DeepEqual(got, []string{"kb1.header.a", "kb1.header.b", "kb2.header.a"}) {
+		t.Errorf("Expected the label search to span both tables, got %v", got)
+	}
+
+	smdb.ClearFilters()
+	smdb.SearchTable("table_b")
+	if got := sortedKeys(smdb.FilterResults); !reflect.DeepEqual(got, []string{"kb2.header.a", "kb2.item.c"}) {
+		t.Errorf("Expected only table_b nodes, got %v", got)
+	}
+	if node, _ := smdb.GetNode("kb2.item.c"); node == nil || node.Table != "table_b" {
+		t.Errorf("Expected kb2.item.c tagged with table_b, got %+v", node)
+	}
+
+	duplicate := NewBasicConstructDB("localhost", 5432, "knowledge_base", "test", "", "table_c")
+	duplicate.Store("kb2.item.d", nil, nil, nil)
+	duplicate.Store("kb1.header.a", nil, nil, nil)
+	if err := smdb.mergeTable("table_c", duplicate.data); err == nil {
+		t.Error("Expected a path already held by table_a to be rejected")
+	}
+	if smdb.HasPath("kb2.item.d") {
+		t.Error("Expected a rejected merge to leave the store unchanged")
+	}
+}
+
+// sortedKeys returns the keys of results in order
+func sortedKeys(results map[string]*TreeNode) []string {
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestNewMultiSearchMemDB loads two tables and queries across both
+func TestNewMultiSearchMemDB(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		testDBHost, testDBPort, testDBUser, testDBPassword, testDBName)
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	tables := []string{testDBTable + "_a", testDBTable + "_b"}
+	dropTables := func() {
+		for _, table := range tables {
+			conn.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table))
+		}
+	}
+	dropTables()
+	defer dropTables()
+
+	statements := []string{"CREATE EXTENSION IF NOT EXISTS ltree"}
+	for i, table := range tables {
+		statements = append(statements,
+			fmt.Sprintf("CREATE TABLE %s (path LTREE UNIQUE, data JSON, created_at TIMESTAMPTZ, updated_at TIMESTAMPTZ)", table),
+			fmt.Sprintf(`INSERT INTO %s (path, data) VALUES ('kb%d.header.a', '{"description": "a"}')`, table, i+1))
+	}
+	for _, stmt := range statements {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing tables: %v", err)
+		}
+	}
+
+	smdb, err := NewMultiSearchMemDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, tables)
+	if err != nil {
+		t.Fatalf("Error loading tables: %v", err)
+	}
+	smdb.SearchName("a")
+	if got := sortedKeys(smdb.FilterResults); !reflect.DeepEqual(got, []string{"kb1.header.a", "kb2.header.a"}) {
+		t.Errorf("Expected a match from each table, got %v", got)
+	}
+	if len(smdb.GetTables()[tables[1]]) != 1 {
+		t.Errorf("Expected one node from %s, got %v", tables[1], smdb.GetTables())
+	}
+}
+
+// TestUpdateAndDeleteNode checks edits reach the store, the indexes and the
+// current filter results, and are counted as pending until Flush
+func TestUpdateAndDeleteNode(t *testing.T) {
+	smdb := newTestSearchMemDB(t, map[string]interface{}{
+		"kb1.person.alice": map[string]interface{}{"age": 30},
+		"kb1.person.bob":   map[string]interface{}{"age": 40},
+		"kb1.org.acme":     map[string]interface{}{"size": 10},
+	})
+
+	smdb.SearchLabel("person")
+	if err := smdb.UpdateNodeData("kb1.person.alice", map[string]interface{}{"age": 31}); err != nil {
+		t.Fatalf("Error updating node: %v", err)
+	}
+	if data, _ := smdb.Get("kb1.person.alice"); !reflect.DeepEqual(data, map[string]interface{}{"age": 31}) {
+		t.Errorf("Expected updated data in the store, got %v", data)
+	}
+	if node := smdb.FilterResults["kb1.person.alice"]; node == nil || !reflect.DeepEqual(node.Data, map[string]interface{}{"age": 31}) {
+		t.Errorf("Expected updated data in the filter results, got %+v", node)
+	}
+
+	if err := smdb.DeleteNode("kb1.person.bob"); err != nil {
+		t.Fatalf("Error deleting node: %v", err)
+	}
+	if got := sortedKeys(smdb.FilterResults); !reflect.DeepEqual(got, []string{"kb1.person.alice"}) {
+		t.Errorf("Expected the deleted node to leave the filter results, got %v", got)
+	}
+	if smdb.HasPath("kb1.person.bob") {
+		t.Error("Expected the deleted node to leave the store")
+	}
+	if _, exists := smdb.GetDecodedKeys()["kb1.person.bob"]; exists {
+		t.Error("Expected the deleted node to leave the decoded keys")
+	}
+	if _, exists := smdb.GetNames()["bob"]; exists {
+		t.Errorf("Expected the name index entry to be removed, got %v", smdb.GetNames())
+	}
+	if got := smdb.GetLabels()["person"]; !reflect.DeepEqual(got, []string{"kb1.person.alice"}) {
+		t.Errorf("Expected only alice under person, got %v", got)
+	}
+
+	smdb.ClearFilters()
+	if results := smdb.SearchKB("kb1"); len(results) != 2 {
+		t.Errorf("Expected 2 nodes in kb1 after the delete, got %v", sortedKeys(results))
+	}
+
+	if err := smdb.UpdateNodeData("kb1.person.bob", nil); err == nil {
+		t.Error("Expected updating a deleted node to fail")
+	}
+	if err := smdb.DeleteNode("kb1.person.bob"); err == nil {
+		t.Error("Expected deleting a missing node to fail")
+	}
+	if got := smdb.PendingChanges(); got != 2 {
+		t.Errorf("Expected 2 pending changes, got %d", got)
+	}
+}
+
+// TestFlush edits a loaded node, deletes another and checks Flush writes both
+// changes back to the table
+func TestFlush(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	dropTestTables(t)
+	defer dropTestTables(t)
+
+	source := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	source.Store("kb1.item.a", map[string]interface{}{"v": 1}, nil, nil)
+	source.Store("kb1.item.b", map[string]interface{}{"v": 2}, nil, nil)
+	source.Store("kb1.item.c", map[string]interface{}{"v": 3}, nil, nil)
+	if _, err := source.ExportToPostgresWithOptions(testDBTable, ExportOptions{CreateTable: true}); err != nil {
+		t.Fatalf("Error exporting test nodes: %v", err)
+	}
+
+	smdb, err := NewSearchMemDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	if err != nil {
+		t.Fatalf("Error loading SearchMemDB: %v", err)
+	}
+	if err := smdb.UpdateNodeData("kb1.item.a", map[string]interface{}{"v": 10}); err != nil {
+		t.Fatalf("Error updating node: %v", err)
+	}
+	if err := smdb.DeleteNode("kb1.item.c"); err != nil {
+		t.Fatalf("Error deleting node: %v", err)
+	}
+
+	written, err := smdb.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if written != 2 || smdb.PendingChanges() != 0 {
+		t.Errorf("Expected 2 rows written and nothing pending, got %d and %d", written, smdb.PendingChanges())
+	}
+	if node, _ := smdb.GetNode("kb1.item.a"); node == nil || node.UpdatedAt == nil {
+		t.Errorf("Expected updated_at to be set on the flushed node, got %+v", node)
+	}
+
+	imported := NewBasicConstructDB(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	if _, err := imported.ImportFromPostgres(testDBTable, "path", "data", "created_at", "updated_at"); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if paths := imported.GetAllPaths(); !reflect.DeepEqual(paths, []string{"kb1.item.a", "kb1.item.b"}) {
+		t.Errorf("Unexpected paths after flush %v", paths)
+	}
+	if data, _ := imported.Get("kb1.item.a"); !reflect.DeepEqual(data, map[string]interface{}{"v": float64(10)}) {
+		t.Errorf("Expected flushed data for kb1.item.a, got %v", data)
+	}
+
+	if written, err := smdb.Flush(); err != nil || written != 0 {
+		t.Errorf("Expected an empty flush to write nothing, got %d, %v", written, err)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/glenn-edgar/knowledge_base/kb_modules/kb_go/kb_memory/kb_memory_module
 
 go 1.24.4
+
+require github.com/lib/pq v1.10.9
@@ -324,7 +324,7 @@ func ExampleUsage() {
 	}
 
 	// Query using @> operator
-	fmt.Println("  b) Find all descendants of 'company.engineering' using @> operator:")
+	fmt.Println("  b) Find 'company.engineering' and its descendants using @> operator:")
 	results = tree.QueryByOperator("@>", "company.engineering", "")
 	for _, r := range results {
 		if dataMap, ok := r.Data.(map[string]interface{}); ok {
@@ -0,0 +1,55 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by the job queue, stream, status and RPC
+// components. Errors are wrapped with their context, so match them with
+// errors.Is rather than by comparing messages:
+//
+//	if _, err := jq.PushJobData(path, data, 0, 0); errors.Is(err, ErrQueueFull) {
+//		// every job slot for path is in use
+//	}
+var (
+	// ErrNotFound is returned when a node, record or job the call refers to
+	// does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrQueueFull is returned when a queue has no free slot for a new entry,
+	// or when PushRPCQueue would take a server path past MaxQueueDepth
+	ErrQueueFull = errors.New("queue is full")
+	// ErrTimeout is returned when a deadline passes before the call completes,
+	// including Postgres statement timeouts (see ErrStatementTimeout)
+	ErrTimeout = errors.New("timed out")
+	// ErrConflict is returned when a record is not in the state the call
+	// needs, or when lock contention or serialization failures outlast the
+	// retries
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is returned when an argument is rejected before the
+	// database is touched
+	ErrValidation = errors.New("invalid argument")
+)
+
+// contextError returns ctx's error, wrapped in ErrTimeout when its deadline
+// has passed; the context error stays in the chain
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// retriesExhausted reports the last error of a retry loop, matching
+// ErrConflict as well when it was a retryable lock or serialization failure
+func retriesExhausted(msg string, err error) error {
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrConflict, msg)
+	}
+	if isRetryableDBError(err) {
+		return fmt.Errorf("%w: %s: %w", ErrConflict, msg, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
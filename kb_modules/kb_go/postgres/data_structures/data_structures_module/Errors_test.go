@@ -0,0 +1,130 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TestValidationErrors checks that rejected arguments match ErrValidation in
+// each component, without a database
+func TestValidationErrors(t *testing.T) {
+	kb := &KBSearch{BaseTable: "knowledge_base"}
+	jq := NewKBJobQueue(kb, "knowledge_base")
+	ks := NewKBStream(kb, "knowledge_base")
+	ksd := NewKBStatusData(kb, "knowledge_base")
+	rpc := NewKBRPCServer(kb, "knowledge_base")
+	client := NewKBRPCClient(kb, "knowledge_base")
+	now := time.Now()
+
+	calls := map[string]func() error{
+		"PushJobData": func() error {
+			_, err := jq.PushJobData("", map[string]interface{}{}, 0, 0)
+			return err
+		},
+		"GetJobResult": func() error {
+			_, err := jq.GetJobResult(0)
+			return err
+		},
+		"PushStreamData": func() error {
+			_, err := ks.PushStreamData("kb1.stream", nil, 0, 0)
+			return err
+		},
+		"GetStreamWindow": func() error {
+			_, _, err := ks.GetStreamWindow("kb1.stream", now, now.Add(time.Minute), 0)
+			return err
+		},
+		"SetStatusData": func() error {
+			_, _, err := ksd.SetStatusData("", map[string]interface{}{}, 0, 0)
+			return err
+		},
+		"PushRPCQueue": func() error {
+			_, err := rpc.PushRPCQueue("not a path", "", "action", map[string]interface{}{}, "tag", 0, nil, 0, 0)
+			return err
+		},
+		"PushBatch": func() error {
+			_, err := rpc.PushBatch("kb1.server", []RPCRequest{{RPCAction: "action", RequestPayload: map[string]interface{}{}}})
+			return err
+		},
+		"WaitForReply": func() error {
+			_, err := client.WaitForReply(context.Background(), "kb1.client", "not a uuid")
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: expected ErrValidation, got %v", name, err)
+		}
+	}
+}
+
+// TestErrorSentinels checks the sentinels matched by errors built outside the
+// fmt.Errorf wraps
+func TestErrorSentinels(t *testing.T) {
+	var noMatch error = &NoMatchingRecordError{Message: "No matching record found with state = 'empty'"}
+	if !errors.Is(noMatch, ErrQueueFull) {
+		t.Errorf("Expected NoMatchingRecordError to match ErrQueueFull")
+	}
+	if !errors.Is(mapStatementTimeout(&pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}), ErrTimeout) {
+		t.Error("Expected a statement timeout to match ErrTimeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	if err := contextError(ctx); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected an expired context to match ErrTimeout and DeadlineExceeded, got %v", err)
+	}
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := contextError(cancelled); err != context.Canceled {
+		t.Errorf("Expected a cancelled context to return context.Canceled, got %v", err)
+	}
+
+	serialization := &pq.Error{Code: "40001"}
+	if err := retriesExhausted("failed after 3 attempts", serialization); !errors.Is(err, ErrConflict) || !errors.Is(err, serialization) {
+		t.Errorf("Expected exhausted serialization retries to match ErrConflict and keep the cause, got %v", err)
+	}
+	if err := retriesExhausted("failed after 3 attempts", ErrQueueFull); errors.Is(err, ErrConflict) || !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected a non-retryable last error to be kept without ErrConflict, got %v", err)
+	}
+
+	if !isUniqueViolation(fmt.Errorf("failed to update job slot: %w", &pq.Error{Code: "23505"})) {
+		t.Error("Expected a wrapped unique violation to be recognised")
+	}
+	if isUniqueViolation(serialization) || isUniqueViolation(nil) {
+		t.Error("Expected only unique violations to be recognised")
+	}
+}
+
+// TestJobQueueErrorSentinels checks the sentinels for representative job queue
+// failures against a database
+func TestJobQueueErrorSentinels(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 1)
+	defer jq.KBSearch.Disconnect()
+
+	pushed, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"task": "first"}, 0, 0)
+	if err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"task": "second"}, 1, time.Millisecond); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull pushing to a full queue, got %v", err)
+	}
+	if _, err := jq.GetJobResult(pushed.JobID + 1000); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing job, got %v", err)
+	}
+	if err := jq.MoveJob(pushed.JobID, "kb1.missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound moving to a path without slots, got %v", err)
+	}
+
+	if _, err := jq.PeakJobData("kb1.jobs", 0, 0); err != nil {
+		t.Fatalf("Error claiming job: %v", err)
+	}
+	if err := jq.MoveJob(pushed.JobID, "kb1.jobs"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict moving an active job, got %v", err)
+	}
+}
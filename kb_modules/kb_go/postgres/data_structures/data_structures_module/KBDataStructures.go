@@ -1,13 +1,15 @@
 package data_structures_module
 
 import (
-	//database/sql"
+	"context"
+	"database/sql"
 	"fmt"
+	"io"
 	//"log"
 	"time"
 
 	//"github.com/google/uuid"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 // KBDataStructures handles the data structures for the knowledge base
@@ -23,16 +25,46 @@ type KBDataStructures struct {
 	linkMountTable  *KBLinkMountTable
 }
 
-// NewKBDataStructures creates a new instance of KBDataStructures
-func NewKBDataStructures(host, port, dbname, user, password, database string) (*KBDataStructures, error) {
+// NewKBDataStructures creates a new instance of KBDataStructures.
+// statusOpts are passed to the status data component, e.g. WithStatusHistory.
+func NewKBDataStructures(host, port, dbname, user, password, database string, statusOpts ...StatusOption) (*KBDataStructures, error) {
 	// Initialize the query support (equivalent to KB_Search)
 	querySupport, err := NewKBSearch(host, port, dbname, user, password, database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create KB_Search: %w", err)
 	}
 
+	return newKBDataStructures(querySupport, database, statusOpts), nil
+}
+
+// NewKBDataStructuresFromURL creates a new instance of KBDataStructures from a
+// postgres:// URL or key=value connection string, such as a DATABASE_URL
+func NewKBDataStructuresFromURL(dsn, database string, statusOpts ...StatusOption) (*KBDataStructures, error) {
+	querySupport, err := NewKBSearchFromURL(dsn, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KB_Search: %w", err)
+	}
+
+	return newKBDataStructures(querySupport, database, statusOpts), nil
+}
+
+// NewKBDataStructuresFromDB creates a new instance of KBDataStructures on an
+// existing connection pool. Close and Disconnect leave db open. Call
+// SetListenDSN before using WatchStatus, WatchJobQueue, SubscribeStream or
+// PeekBlocking, which listen on a connection of their own.
+func NewKBDataStructuresFromDB(db *sql.DB, database string, statusOpts ...StatusOption) (*KBDataStructures, error) {
+	querySupport, err := NewKBSearchFromDB(db, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KB_Search: %w", err)
+	}
+
+	return newKBDataStructures(querySupport, database, statusOpts), nil
+}
+
+// newKBDataStructures builds every component on querySupport's connection
+func newKBDataStructures(querySupport *KBSearch, database string, statusOpts []StatusOption) *KBDataStructures {
 	// Initialize all components
-	statusData := NewKBStatusData(querySupport, database)
+	statusData := NewKBStatusData(querySupport, database, statusOpts...)
 	jobQueue := NewKBJobQueue(querySupport, database)
 	stream := NewKBStream(querySupport, database)
 	rpcClient := NewKBRPCClient(querySupport, database)
@@ -49,7 +81,233 @@ func NewKBDataStructures(host, port, dbname, user, password, database string) (*
 		rpcServer:      rpcServer,
 		linkTable:      linkTable,
 		linkMountTable: linkMountTable,
-	}, nil
+	}
+}
+
+// SetRetryPolicy applies policy to the status, job queue and stream components in
+// place of the maxRetries and retryDelay arguments of their write methods. A nil
+// policy restores the fixed-delay behaviour.
+func (kds *KBDataStructures) SetRetryPolicy(policy *RetryPolicy) {
+	kds.statusData.retryPolicy = policy
+	kds.jobQueue.RetryPolicy = policy
+	kds.stream.RetryPolicy = policy
+}
+
+// SetStatementTimeout limits how long searches and the record queries and
+// transactions of the status, job queue, stream and RPC components may run
+// before Postgres cancels them with ErrStatementTimeout. Each runs in a
+// transaction with a local statement_timeout, so other users of the pool are
+// unaffected. A component's own StatementTimeout, where it has one, takes
+// precedence. Zero removes the limit. To bound every query on the pool, open it
+// with OpenWithStatementTimeout instead.
+func (kds *KBDataStructures) SetStatementTimeout(timeout time.Duration) {
+	kds.querySupport.StatementTimeout = timeout
+}
+
+// SetStreamKeyCache caches the stream node lookups of FindStreamIDs and
+// FindStreamID for ttl, as WithStreamKeyCache does for a KBStream built
+// directly. Any cached lookups are discarded; zero turns caching off. It is safe
+// to call while lookups are running.
+func (kds *KBDataStructures) SetStreamKeyCache(ttl time.Duration) {
+	kds.stream.keyCache.reset(ttl)
+}
+
+// SetListenDSN sets the connection string the notification listeners connect
+// with, for an instance created with NewKBDataStructuresFromDB
+func (kds *KBDataStructures) SetListenDSN(dsn string) {
+	kds.querySupport.SetListenDSN(dsn)
+}
+
+// SetObserver sends operation latencies and queue depths from the status, job
+// queue, stream and RPC server components to observer. A nil observer turns
+// metrics off.
+func (kds *KBDataStructures) SetObserver(observer Observer) {
+	kds.statusData.observer = observer
+	kds.jobQueue.Observer = observer
+	kds.stream.Observer = observer
+	kds.rpcServer.Observer = observer
+}
+
+// SetLogger sends warnings from the status and job queue components to logger.
+// A nil logger discards them.
+func (kds *KBDataStructures) SetLogger(logger Logger) {
+	kds.statusData.logger = logger
+	kds.jobQueue.Logger = logger
+}
+
+// ComponentHealth is the health of one component in a HealthReport
+type ComponentHealth struct {
+	Name    string   `json:"name"`
+	Tables  []string `json:"tables"`
+	Healthy bool     `json:"healthy"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// HealthReport summarizes HealthCheck. Ready is true when the database answered
+// and every component's tables exist.
+type HealthReport struct {
+	Ready      bool              `json:"ready"`
+	Database   string            `json:"database"` // "ok" or the ping error
+	Components []ComponentHealth `json:"components"`
+	CheckedAt  time.Time         `json:"checked_at"`
+	Duration   time.Duration     `json:"duration"`
+}
+
+// healthTables lists the backing tables of each component, in report order
+func (kds *KBDataStructures) healthTables() []ComponentHealth {
+	statusTables := []string{kds.statusData.BaseTable}
+	if kds.statusData.history {
+		statusTables = append(statusTables, kds.statusData.HistoryTable)
+	}
+	return []ComponentHealth{
+		{Name: "query_support", Tables: []string{kds.querySupport.BaseTable}},
+		{Name: "status", Tables: statusTables},
+		{Name: "job_queue", Tables: []string{kds.jobQueue.BaseTable}},
+		{Name: "stream", Tables: []string{kds.stream.BaseTable}},
+		{Name: "rpc_client", Tables: []string{kds.rpcClient.BaseTable}},
+		{Name: "rpc_server", Tables: []string{kds.rpcServer.BaseTable}},
+		{Name: "link_table", Tables: []string{kds.linkTable.baseTable}},
+		{Name: "link_mount_table", Tables: []string{kds.linkMountTable.baseTable}},
+	}
+}
+
+// HealthCheck pings the database and confirms every component's backing table
+// exists, for use behind a readiness endpoint. Table existence is read from the
+// catalog in a single query, so the check never scans data. A missing table
+// marks its component unhealthy without failing the call; an error is returned
+// only when the database cannot be reached or ctx ends, in which case the
+// report is still filled in with every component unhealthy.
+func (kds *KBDataStructures) HealthCheck(ctx context.Context) (HealthReport, error) {
+	start := time.Now()
+	report := HealthReport{Components: kds.healthTables(), CheckedAt: start}
+	finish := func(err error) (HealthReport, error) {
+		if err != nil {
+			report.Database = err.Error()
+			for i := range report.Components {
+				report.Components[i].Healthy = false
+				report.Components[i].Error = "database unavailable"
+			}
+		}
+		report.Duration = time.Since(start)
+		return report, err
+	}
+
+	conn := kds.querySupport.conn
+	if !kds.querySupport.connected() {
+		return finish(fmt.Errorf("not connected to database"))
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		return finish(fmt.Errorf("error pinging database: %v", err))
+	}
+
+	names := []string{}
+	for _, component := range report.Components {
+		names = append(names, component.Tables...)
+	}
+	rows, err := conn.QueryContext(ctx,
+		"SELECT name, to_regclass(name) IS NOT NULL FROM unnest($1::text[]) AS name", pq.Array(names))
+	if err != nil {
+		return finish(fmt.Errorf("error checking tables: %v", err))
+	}
+	defer rows.Close()
+
+	exists := make(map[string]bool, len(names))
+	for rows.Next() {
+		var name string
+		var present bool
+		if err := rows.Scan(&name, &present); err != nil {
+			return finish(fmt.Errorf("error checking tables: %v", err))
+		}
+		exists[name] = present
+	}
+	if err := rows.Err(); err != nil {
+		return finish(fmt.Errorf("error checking tables: %v", err))
+	}
+
+	report.Database = "ok"
+	report.Ready = true
+	for i, component := range report.Components {
+		report.Components[i].Healthy = true
+		for _, table := range component.Tables {
+			if !exists[table] {
+				report.Components[i].Healthy = false
+				report.Components[i].Error = fmt.Sprintf("table %s does not exist", table)
+				report.Ready = false
+				break
+			}
+		}
+	}
+	return finish(nil)
+}
+
+// Maintain runs VACUUM (ANALYZE) and REINDEX on every component's backing
+// table that exists, reclaiming space left by churn and rebuilding the ltree
+// GiST indexes. Each statement runs on its own outside any transaction, as
+// VACUUM requires; ctx is checked between statements and cancels the one in
+// progress. REINDEX takes an exclusive lock, so run this in a quiet window.
+func (kds *KBDataStructures) Maintain(ctx context.Context) error {
+	conn := kds.querySupport.conn
+	if !kds.querySupport.connected() {
+		return fmt.Errorf("not connected to database")
+	}
+
+	names := []string{}
+	for _, component := range kds.healthTables() {
+		names = append(names, component.Tables...)
+	}
+	rows, err := conn.QueryContext(ctx,
+		"SELECT name FROM unnest($1::text[]) AS name WHERE to_regclass(name) IS NOT NULL", pq.Array(names))
+	if err != nil {
+		return fmt.Errorf("error checking tables: %v", err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("error checking tables: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error checking tables: %v", err)
+	}
+	rows.Close()
+
+	return kds.maintainTables(ctx, tables)
+}
+
+// MaintainStream runs VACUUM (ANALYZE) and REINDEX on the stream table only
+func (kds *KBDataStructures) MaintainStream(ctx context.Context) error {
+	return kds.maintainTables(ctx, []string{kds.stream.BaseTable})
+}
+
+// MaintainJobs runs VACUUM (ANALYZE) and REINDEX on the job queue table only
+func (kds *KBDataStructures) MaintainJobs(ctx context.Context) error {
+	return kds.maintainTables(ctx, []string{kds.jobQueue.BaseTable})
+}
+
+// maintainTables vacuums and reindexes each table in turn on the pool, never
+// inside a transaction
+func (kds *KBDataStructures) maintainTables(ctx context.Context, tables []string) error {
+	conn := kds.querySupport.conn
+	if !kds.querySupport.connected() {
+		return fmt.Errorf("not connected to database")
+	}
+
+	for _, table := range tables {
+		quoted := pq.QuoteIdentifier(table)
+		for _, stmt := range []string{"VACUUM (ANALYZE) " + quoted, "REINDEX TABLE " + quoted} {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("error maintaining table %s: %v", table, err)
+			}
+		}
+	}
+	return nil
 }
 
 // Query Support Methods (delegated to querySupport)
@@ -57,6 +315,22 @@ func (kds *KBDataStructures) ClearFilters() {
 	kds.querySupport.ClearFilters()
 }
 
+func (kds *KBDataStructures) SetIncludeDeleted(include bool) {
+	kds.querySupport.IncludeDeleted = include
+}
+
+func (kds *KBDataStructures) BuildQuery() (string, []interface{}) {
+	return kds.querySupport.BuildQuery()
+}
+
+func (kds *KBDataStructures) Explain() (string, error) {
+	return kds.querySupport.Explain()
+}
+
+func (kds *KBDataStructures) SearchKB(knowledgeBase string) {
+	kds.querySupport.SearchKB(knowledgeBase)
+}
+
 func (kds *KBDataStructures) SearchLabel(label string) {
 	kds.querySupport.SearchLabel(label)
 }
@@ -65,6 +339,14 @@ func (kds *KBDataStructures) SearchName(name string) {
 	kds.querySupport.SearchName(name)
 }
 
+func (kds *KBDataStructures) SearchNameLike(pattern string) {
+	kds.querySupport.SearchNameLike(pattern)
+}
+
+func (kds *KBDataStructures) SearchNameILike(pattern string) {
+	kds.querySupport.SearchNameILike(pattern)
+}
+
 func (kds *KBDataStructures) SearchPropertyKey(key string) {
 	kds.querySupport.SearchPropertyKey(key)
 }
@@ -73,6 +355,10 @@ func (kds *KBDataStructures) SearchPropertyValue(value string,property_value map
 	kds.querySupport.SearchPropertyValue(value,property_value)
 }
 
+func (kds *KBDataStructures) SearchPropertyContains(fragment map[string]interface{}) {
+	kds.querySupport.SearchPropertyContains(fragment)
+}
+
 func (kds *KBDataStructures) SearchHasLink() {
 	kds.querySupport.SearchHasLink()
 }
@@ -90,10 +376,38 @@ func (kds *KBDataStructures) SearchStartingPath(path string) {
 	kds.querySupport.SearchStartingPath(path)
 }
 
+func (kds *KBDataStructures) SearchStartingPathDepth(path string, maxDepth int) {
+	kds.querySupport.SearchStartingPathDepth(path, maxDepth)
+}
+
+func (kds *KBDataStructures) ExecuteKBSearchNodes() ([]Node, error) {
+	return kds.querySupport.ExecuteQueryNodes()
+}
+
+func (kds *KBDataStructures) ExecuteKBSearchCursor(fn func(Node) error) error {
+	return kds.querySupport.ExecuteQueryCursor(fn)
+}
+
+func (kds *KBDataStructures) ExportCSV(w io.Writer, columns []string) error {
+	return kds.querySupport.ExportCSV(w, columns)
+}
+
+func (kds *KBDataStructures) SelectKBSearch(fields ...string) error {
+	return kds.querySupport.Select(fields...)
+}
+
+func (kds *KBDataStructures) OrderKBSearch(column string, asc bool) error {
+	return kds.querySupport.OrderBy(column, asc)
+}
+
 func (kds *KBDataStructures) ExecuteKBSearch(property_value map[string]interface{}) ([]map[string]interface{}, error) {
 	return kds.querySupport.ExecuteQuery()
 }
 
+func (kds *KBDataStructures) GetResults() []map[string]interface{} {
+	return kds.querySupport.GetResults()
+}
+
 func (kds *KBDataStructures) FindDescription(row map[string]interface{}) map[string]string {
 	return kds.querySupport.FindDescription(row)
 }
@@ -118,6 +432,10 @@ func (kds *KBDataStructures) DecodeLinkNodes(path string) (string, [][]string, e
 	return kds.querySupport.DecodeLinkNodes(path)
 }
 
+func (kds *KBDataStructures) ResolveMountedPath(path string) ([]ResolvedSegment, error) {
+	return kds.querySupport.ResolveMountedPath(path)
+}
+
 
 
 
@@ -126,12 +444,20 @@ func (kds *KBDataStructures) DecodeLinkNodes(path string) (string, [][]string, e
 
 
 // Status Data Methods (delegated to statusData)
-func (kds *KBDataStructures) FindStatusNodeIDs(kb, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
-	return kds.statusData.FindNodeIDs(kb, nodeName, properties, nodePath)
+func (kds *KBDataStructures) FindStatusNodeID(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	return kds.statusData.FindNodeID(kb, nodeName, properties, nodePath, opts...)
+}
+
+func (kds *KBDataStructures) FindStatusNodeIDs(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
+	return kds.statusData.FindNodeIDs(kb, nodeName, properties, nodePath, opts...)
 }
 
 
 
+func (kds *KBDataStructures) FindStatusNodes(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]Node, error) {
+	return kds.statusData.FindNodes(kb, nodeName, properties, nodePath, opts...)
+}
+
 func (kds *KBDataStructures) GetStatusData(path string) (map[string]interface{},string, error) {
 	return kds.statusData.GetStatusData(path)
 }
@@ -140,14 +466,53 @@ func (kds *KBDataStructures) SetStatusData(path string, data map[string]interfac
 	return kds.statusData.SetStatusData(path, data,retryCount, retryDelay)
 }
 
+func (kds *KBDataStructures) GetMultipleStatusData(paths []string) (map[string]map[string]interface{}, error) {
+	return kds.statusData.GetMultipleStatusData(paths)
+}
+
+func (kds *KBDataStructures) GetStatusDataBatch(paths []string) (map[string]StatusRecord, error) {
+	return kds.statusData.GetStatusDataBatch(paths)
+}
+
+func (kds *KBDataStructures) SetMultipleStatusData(pathDataPairs map[string]map[string]interface{}, retryCount int, retryDelay time.Duration) (bool, string, map[string]string, error) {
+	return kds.statusData.SetMultipleStatusData(pathDataPairs, retryCount, retryDelay)
+}
+
+func (kds *KBDataStructures) SetMultipleStatusDataList(pathDataPairs []struct {
+	Path string
+	Data map[string]interface{}
+}, retryCount int, retryDelay time.Duration) (bool, string, map[string]string, error) {
+	return kds.statusData.SetMultipleStatusDataList(pathDataPairs, retryCount, retryDelay)
+}
+
+func (kds *KBDataStructures) SetStatusDataIfUnchanged(path string, expected, newData map[string]interface{}) (bool, error) {
+	return kds.statusData.SetStatusDataIfUnchanged(path, expected, newData)
+}
+
+func (kds *KBDataStructures) GetStatusHistory(path string, limit int, since *time.Time) ([]StatusRecord, error) {
+	return kds.statusData.GetStatusHistory(path, limit, since)
+}
+
+func (kds *KBDataStructures) WatchStatus(ctx context.Context, path string) (<-chan StatusRecord, error) {
+	return kds.statusData.WatchStatus(ctx, path)
+}
+
 // Job Queue Methods (delegated to jobQueue)
-func (kds *KBDataStructures) FindJobID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
-	return kds.jobQueue.FindJobID(kb, nodeName, properties, nodePath)
+func (kds *KBDataStructures) FindJobID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	return kds.jobQueue.FindJobID(kb, nodeName, properties, nodePath, opts...)
+}
+func (kds *KBDataStructures) FindJobIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
+	return kds.jobQueue.FindJobIDs(kb, nodeName, properties, nodePath, opts...)
 }
-func (kds *KBDataStructures) FindJobIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
-	return kds.jobQueue.FindJobIDs(kb, nodeName, properties, nodePath)
+
+
+func (kds *KBDataStructures) FindJobPaths(tableDictRows []map[string]interface{}) []string {
+	return kds.jobQueue.FindJobPaths(tableDictRows)
 }
 
+func (kds *KBDataStructures) GetQueueStats(path string) (QueueStats, error) {
+	return kds.jobQueue.GetQueueStats(path)
+}
 
 func (kds *KBDataStructures) GetQueuedNumber(jobPath string) (int, error) {
 	return kds.jobQueue.GetQueuedNumber(jobPath)
@@ -165,50 +530,138 @@ func (kds *KBDataStructures) MarkJobCompleted(jobID int, maxRetries int, retryDe
 	return kds.jobQueue.MarkJobCompleted(jobID, maxRetries, retryDelay)
 }
 
-func (kds *KBDataStructures) PushJobData(jobPath string, data map[string]interface{}, maxRetries int, retryDelay time.Duration) (*PushJobResult, error) {
-	return kds.jobQueue.PushJobData(jobPath, data, maxRetries, retryDelay)
+func (kds *KBDataStructures) MarkJobCompletedWithResult(jobID int, result map[string]interface{}, maxRetries int, retryDelay time.Duration) (*JobCompletionResult, error) {
+	return kds.jobQueue.MarkJobCompletedWithResult(jobID, result, maxRetries, retryDelay)
+}
+
+func (kds *KBDataStructures) MarkJobCompletedWithToken(jobID int, claimToken string, result map[string]interface{}, maxRetries int, retryDelay time.Duration) (*JobCompletionResult, error) {
+	return kds.jobQueue.MarkJobCompletedWithToken(jobID, claimToken, result, maxRetries, retryDelay)
+}
+
+func (kds *KBDataStructures) MarkJobsCompleted(jobIDs []int, maxRetries int, retryDelay time.Duration) ([]JobCompletionResult, error) {
+	return kds.jobQueue.MarkJobsCompleted(jobIDs, maxRetries, retryDelay)
+}
+
+func (kds *KBDataStructures) MarkJobsCompletedWithTokens(jobIDs []int, claimTokens []string, maxRetries int, retryDelay time.Duration) ([]JobCompletionResult, error) {
+	return kds.jobQueue.MarkJobsCompletedWithTokens(jobIDs, claimTokens, maxRetries, retryDelay)
+}
+
+func (kds *KBDataStructures) GetJobResult(jobID int) (map[string]interface{}, error) {
+	return kds.jobQueue.GetJobResult(jobID)
+}
+
+func (kds *KBDataStructures) PushJobData(jobPath string, data map[string]interface{}, maxRetries int, retryDelay time.Duration, opts ...PushOption) (*PushJobResult, error) {
+	return kds.jobQueue.PushJobData(jobPath, data, maxRetries, retryDelay, opts...)
+}
+
+func (kds *KBDataStructures) MigrateJobIdempotencyKey() error {
+	return kds.jobQueue.MigrateIdempotencyKey()
+}
+
+func (kds *KBDataStructures) MigrateJobClaimToken() error {
+	return kds.jobQueue.MigrateClaimToken()
+}
+
+func (kds *KBDataStructures) PushJobDataWithPriority(jobPath string, data map[string]interface{}, priority int, maxRetries int, retryDelay time.Duration, opts ...PushOption) (*PushJobResult, error) {
+	return kds.jobQueue.PushJobDataWithPriority(jobPath, data, priority, maxRetries, retryDelay, opts...)
+}
+
+func (kds *KBDataStructures) ReclaimStaleJobs(jobPath string, timeout time.Duration) (int, error) {
+	return kds.jobQueue.ReclaimStaleJobs(jobPath, timeout)
+}
+
+func (kds *KBDataStructures) MoveJob(jobID int, toJobPath string) error {
+	return kds.jobQueue.MoveJob(jobID, toJobPath)
+}
+
+func (kds *KBDataStructures) WatchJobQueue(ctx context.Context, jobPath string) (<-chan JobRecord, error) {
+	return kds.jobQueue.WatchJobQueue(ctx, jobPath)
 }
 
 func (kds *KBDataStructures) ListPendingJobs(jobPath string, limit *int, offset int) ([]JobRecord, error) {
 	return kds.jobQueue.ListPendingJobs(jobPath, limit, offset)
 }
 
+func (kds *KBDataStructures) ListPendingJobsPage(jobPath string, limit, offset int) ([]JobRecord, int, error) {
+	return kds.jobQueue.ListPendingJobsPage(jobPath, limit, offset)
+}
+
 func (kds *KBDataStructures) ListActiveJobs(jobPath string, limit *int, offset int) ([]JobRecord, error) {
 	return kds.jobQueue.ListActiveJobs(jobPath, limit, offset)
 }
 
+func (kds *KBDataStructures) ListActiveJobsPage(jobPath string, limit, offset int) ([]JobRecord, int, error) {
+	return kds.jobQueue.ListActiveJobsPage(jobPath, limit, offset)
+}
+
 func (kds *KBDataStructures) ClearJobQueue(jobPath string) (*ClearQueueResult, error) {
 	return kds.jobQueue.ClearJobQueue(jobPath)
 }
 
+func (kds *KBDataStructures) GetJobStatistics(jobPath string) (*JobStatistics, error) {
+	return kds.jobQueue.GetJobStatistics(jobPath)
+}
 
+func (kds *KBDataStructures) GetJobByID(jobID int) (*JobRecord, error) {
+	return kds.jobQueue.GetJobByID(jobID)
+}
 
-func (kds *KBDataStructures) FindStreamIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
-	return kds.stream.FindStreamIDs(kb, nodeName, properties, nodePath)
+
+
+func (kds *KBDataStructures) FindStreamIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
+	return kds.stream.FindStreamIDs(kb, nodeName, properties, nodePath, opts...)
 }
 // Stream Methods (delegated to stream)
 
 
-func (kds *KBDataStructures) FindStreamID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
-	return kds.stream.FindStreamID(kb, nodeName, properties, nodePath)
+func (kds *KBDataStructures) FindStreamID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	return kds.stream.FindStreamID(kb, nodeName, properties, nodePath, opts...)
 }
 
 func (kds *KBDataStructures) FindStreamTableKeys(nodeIDs []map[string]interface{}) ([]string) {
 	return kds.stream.FindStreamTableKeys(nodeIDs)
 }
 
-func (kds *KBDataStructures) PushStreamData(streamKey string, data map[string]interface{}, maxRetries int, retryDelay time.Duration) (*StreamPushResult, error) {
-	return kds.stream.PushStreamData(streamKey, data, maxRetries, retryDelay)
+func (kds *KBDataStructures) InvalidateStreamKey(nodePath string) {
+	kds.stream.InvalidateStreamKey(nodePath)
+}
+
+func (kds *KBDataStructures) PushStreamData(streamKey string, data map[string]interface{}, maxRetries int, retryDelay time.Duration, opts ...PushOption) (*StreamPushResult, error) {
+	return kds.stream.PushStreamData(streamKey, data, maxRetries, retryDelay, opts...)
+}
+
+func (kds *KBDataStructures) MigrateStreamIdempotencyKey() error {
+	return kds.stream.MigrateIdempotencyKey()
+}
+
+func (kds *KBDataStructures) SubscribeStream(ctx context.Context, streamKey string) (<-chan StreamRecord, error) {
+	return kds.stream.SubscribeStream(ctx, streamKey)
+}
+
+func (kds *KBDataStructures) GetLatestStreamData(path string) (*StreamRecord, error) {
+	return kds.stream.GetLatestStreamData(path)
 }
 
 func (kds *KBDataStructures) ListStreamData(path string, limit *int, offset int, recordedAfter, recordedBefore *time.Time, order string) ([]StreamRecord, error) {
 	return kds.stream.ListStreamData(path, limit, offset, recordedAfter, recordedBefore, order)
 }
 
+func (kds *KBDataStructures) ListStreamDataPage(path string, limit, offset int, recordedAfter, recordedBefore *time.Time, order string) ([]StreamRecord, int, error) {
+	return kds.stream.ListStreamDataPage(path, limit, offset, recordedAfter, recordedBefore, order)
+}
+
 func (kds *KBDataStructures) ClearStreamData(path string, olderThan *time.Time) *ClearResult{
 	return kds.stream.ClearStreamData(path, olderThan)
 }
 
+func (kds *KBDataStructures) DeleteStreamDataOlderThan(path string, cutoff time.Time) (int, error) {
+	return kds.stream.DeleteStreamDataOlderThan(path, cutoff)
+}
+
+func (kds *KBDataStructures) DeleteStreamDataKeepLast(path string, n int) (int, error) {
+	return kds.stream.DeleteStreamDataKeepLast(path, n)
+}
+
 func (kds *KBDataStructures) GetStreamDataCount(path string, includeInvalid bool) (int, error) {
 	return kds.stream.GetStreamDataCount(path, includeInvalid)
 }
@@ -217,14 +670,30 @@ func (kds *KBDataStructures) GetStreamDataRange(path string, startTime, endTime
 	return kds.stream.GetStreamDataRange(path, startTime, endTime)
 }
 
+func (kds *KBDataStructures) GetStreamWindow(path string, start, end time.Time, limit int) ([]StreamRecord, bool, error) {
+	return kds.stream.GetStreamWindow(path, start, end, limit)
+}
+
 func (kds *KBDataStructures) GetStreamStatistics(path string, includeInvalid bool) (*StreamStatistics, error){
 	return kds.stream.GetStreamStatistics(path, includeInvalid)
 }
 
+func (kds *KBDataStructures) GetStreamStats(path string) (StreamStats, error) {
+	return kds.stream.GetStreamStats(path)
+}
+
+func (kds *KBDataStructures) GetStreamAggregates(path string, bucket time.Duration, start, end time.Time, fn string) ([]StreamBucket, error) {
+	return kds.stream.GetStreamAggregates(path, bucket, start, end, fn)
+}
+
 func (kds *KBDataStructures) GetStreamDataByID(recordID int) (*StreamRecord, error) {
 	return kds.stream.GetStreamDataByID(recordID)
 }
 
+func (kds *KBDataStructures) GetStreamDataByIDs(streamKey string, ids []int) (map[int]map[string]interface{}, error) {
+	return kds.stream.GetStreamDataByIDs(streamKey, ids)
+}
+
 // RPC Client Methods (delegated to rpcClient)
 func (kds *KBDataStructures) FindRPCClientID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
 	return kds.rpcClient.FindRPCClientID(kb, nodeName, properties, nodePath)
@@ -259,6 +728,14 @@ func (kds *KBDataStructures) RPCClientPushAndClaimReplyData(clientPath string, r
 	return kds.rpcClient.PushAndClaimReplyData(clientPath, requestUUID, serverPath, rpcAction, transactionTag, replyData, maxRetries, retryDelay)
 }
 
+func (kds *KBDataStructures) RPCClientReclaimTimedOut(clientPath string, timeout time.Duration) (int, error) {
+	return kds.rpcClient.ReclaimTimedOut(clientPath, timeout)
+}
+
+func (kds *KBDataStructures) RPCClientWaitForReply(ctx context.Context, clientPath, requestID string) (map[string]interface{}, error) {
+	return kds.rpcClient.WaitForReply(ctx, clientPath, requestID)
+}
+
 func (kds *KBDataStructures) RPCClientListWaitingJobs(clientPath *string) ([]ReplyData, error) {
 	return kds.rpcClient.ListWaitingJobs(clientPath)
 }
@@ -280,6 +757,10 @@ func (kds *KBDataStructures) RPCServerListJobsJobTypes(serverPath, jobType strin
 	return kds.rpcServer.ListJobsJobTypes(serverPath, jobType)
 }
 
+func (kds *KBDataStructures) RPCServerCountJobsByStatus(serverPath string) (map[string]int, error) {
+	return kds.rpcServer.CountJobsByStatus(serverPath)
+}
+
 func (kds *KBDataStructures) RPCServerCountAllJobs(serverPath string) (*JobCounts, error) {
 	return kds.rpcServer.CountAllJobs( serverPath)
 }
@@ -300,15 +781,28 @@ func (kds *KBDataStructures) RPCServerCountJobsJobTypes(serverPath, jobType stri
 	return kds.rpcServer.CountJobsJobTypes(serverPath, jobType)
 }
 
+// RPCServerSetMaxQueueDepth caps the pending jobs per server path; zero means unlimited
+func (kds *KBDataStructures) RPCServerSetMaxQueueDepth(depth int) {
+	kds.rpcServer.MaxQueueDepth = depth
+}
+
 func (kds *KBDataStructures) RPCServerPushRPCQueue(serverPath, requestID, rpcAction string, requestPayload map[string]interface{},
 	transactionTag string, priority int, rpcClientQueue *string, maxRetries int, waitTime time.Duration) (map[string]interface{}, error) {
 	return kds.rpcServer.PushRPCQueue(serverPath, requestID, rpcAction, requestPayload, transactionTag, priority, rpcClientQueue, maxRetries, waitTime)
 }
 
+func (kds *KBDataStructures) RPCServerPushBatch(serverPath string, requests []RPCRequest) ([]map[string]interface{}, error) {
+	return kds.rpcServer.PushBatch(serverPath, requests)
+}
+
 func (kds *KBDataStructures) RPCServerPeakServerQueue(serverPath string, retries int, waitTime time.Duration) (map[string]interface{}, error) {
 	return kds.rpcServer.PeakServerQueue(serverPath,retries, waitTime)
 }
 
+func (kds *KBDataStructures) RPCServerPeekBlocking(ctx context.Context, serverPath string, maxWait time.Duration) (map[string]interface{}, error) {
+	return kds.rpcServer.PeekBlocking(ctx, serverPath, maxWait)
+}
+
 func (kds *KBDataStructures) RPCServerMarkJobCompletion(serverPath string, id int, maxRetries int, retryDelay time.Duration) (bool, error){
 	return kds.rpcServer.MarkJobCompletion(serverPath, id, maxRetries, retryDelay)
 }
@@ -322,6 +816,10 @@ func (kds *KBDataStructures) LinkTableFindRecordsByLinkName(linkName string, kb
 	return kds.linkTable.FindRecordsByLinkName(linkName, kb)
 }
 
+func (kds *KBDataStructures) LinkTableFindRecordsByLinkNameLike(pattern string, kb *string) ([]map[string]interface{}, error) {
+	return kds.linkTable.FindRecordsByLinkNameLike(pattern, kb)
+}
+
 func (kds *KBDataStructures) LinkTableFindRecordsByNodePath(nodePath string, kb *string) ([]map[string]interface{}, error) {
 	return kds.linkTable.FindRecordsByNodePath(nodePath, kb)
 }
@@ -330,15 +828,31 @@ func (kds *KBDataStructures) LinkTableFindAllLinkNames() ([]string, error) {
 	return kds.linkTable.FindAllLinkNames()
 }
 
+func (kds *KBDataStructures) LinkTableFindAllLinkNamesInKB(kb *string) ([]string, error) {
+	return kds.linkTable.FindAllLinkNamesInKB(kb)
+}
+
 func (kds *KBDataStructures) LinkTableFindAllNodeNames() ([]string, error) {
 	return kds.linkTable.FindAllNodeNames()
 }
 
+func (kds *KBDataStructures) LinkTableFindAllNodeNamesInKB(kb *string) ([]string, error) {
+	return kds.linkTable.FindAllNodeNamesInKB(kb)
+}
+
 // Link Mount Table Methods (delegated to linkMountTable)
 func (kds *KBDataStructures) LinkMountTableFindRecordsByLinkName(linkName string, kb *string) ([]map[string]interface{}, error) {
 	return kds.linkMountTable.FindRecordsByLinkName(linkName, kb)
 }
 
+func (kds *KBDataStructures) LinkMountTableFindRecordsByLinkNameLike(pattern string, kb *string) ([]map[string]interface{}, error) {
+	return kds.linkMountTable.FindRecordsByLinkNameLike(pattern, kb)
+}
+
+func (kds *KBDataStructures) LinkMountTableFindRecordsByMountPathMatch(lquery string, kb *string) ([]map[string]interface{}, error) {
+	return kds.linkMountTable.FindRecordsByMountPathMatch(lquery, kb)
+}
+
 func (kds *KBDataStructures) LinkMountTableFindRecordsByMountPath(mountPath string, kb *string) ([]map[string]interface{}, error) {
 	return kds.linkMountTable.FindRecordsByMountPath(mountPath, kb)
 }
@@ -351,8 +865,14 @@ func (kds *KBDataStructures) LinkMountTableFindAllMountPaths() ([]string, error)
 	return kds.linkMountTable.FindAllMountPaths()
 }
 
-// Disconnect closes the database connection
-func (kds *KBDataStructures) Disconnect() error {
+// Close closes the database connection. It is safe to call more than once;
+// later calls return nil.
+func (kds *KBDataStructures) Close() error {
 	return kds.querySupport.Disconnect()
 }
+
+// Disconnect closes the database connection; it is equivalent to Close
+func (kds *KBDataStructures) Disconnect() error {
+	return kds.Close()
+}
 	
@@ -0,0 +1,367 @@
+package data_structures_module
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// exerciseDelegates calls every KBDataStructures delegate with zero values.
+// It is never run against a database; it exists so that any drift between the
+// delegates and the component APIs becomes a compile error.
+func exerciseDelegates(kds *KBDataStructures) {
+	var (
+		s     string
+		i     int
+		d     time.Duration
+		t     time.Time
+		ps    *string
+		pi    *int
+		pt    *time.Time
+		props map[string]interface{}
+		rows  []map[string]interface{}
+	)
+
+	// Query support
+	kds.ClearFilters()
+	kds.SetIncludeDeleted(false)
+	kds.BuildQuery()
+	kds.Explain()
+	kds.SearchKB(s)
+	kds.SearchLabel(s)
+	kds.SearchName(s)
+	kds.SearchNameLike(s)
+	kds.SearchNameILike(s)
+	kds.SearchPropertyKey(s)
+	kds.SearchPropertyValue(s, nil)
+	kds.SearchPropertyContains(props)
+	kds.SearchHasLink()
+	kds.SearchHasLinkMount()
+	kds.SearchPath(s)
+	kds.SearchStartingPath(s)
+	kds.SearchStartingPathDepth(s, i)
+	kds.SelectKBSearch(s)
+	kds.OrderKBSearch(s, true)
+	kds.ExecuteKBSearch(props)
+	kds.ExecuteKBSearchNodes()
+	kds.ExportCSV(nil, []string{s})
+	kds.ExecuteKBSearchCursor(func(Node) error { return nil })
+	kds.GetResults()
+	kds.FindDescription(props)
+	kds.FindDescriptions(rows)
+	kds.FindDescriptionPaths(nil)
+	kds.FindDescriptionPath(s)
+	kds.FindPathValues(rows)
+	kds.DecodeLinkNodes(s)
+	kds.ResolveMountedPath(s)
+
+	// Status data
+	kds.FindStatusNodeID(ps, ps, props, ps)
+	kds.FindStatusNodeIDs(ps, ps, props, ps)
+	kds.FindStatusNodes(ps, ps, props, ps)
+	kds.GetStatusData(s)
+	kds.SetStatusData(s, props, i, d)
+	kds.GetMultipleStatusData(nil)
+	kds.GetStatusDataBatch(nil)
+	kds.SetMultipleStatusData(nil, i, d)
+	kds.SetMultipleStatusDataList(nil, i, d)
+	kds.SetStatusDataIfUnchanged(s, props, props)
+	kds.GetStatusHistory(s, i, pt)
+	kds.WatchStatus(context.Background(), s)
+
+	// Job queue
+	kds.FindJobID(ps, ps, props, ps)
+	kds.FindJobIDs(ps, ps, props, ps)
+	kds.FindJobPaths(rows)
+	kds.GetQueueStats(s)
+	kds.GetQueuedNumber(s)
+	kds.GetFreeNumber(s)
+	kds.PeakJobData(s, i, d)
+	kds.MarkJobCompleted(i, i, d)
+	kds.MarkJobCompletedWithResult(i, props, i, d)
+	kds.MarkJobCompletedWithToken(i, s, props, i, d)
+	kds.MarkJobsCompleted([]int{i}, i, d)
+	kds.MarkJobsCompletedWithTokens([]int{i}, []string{s}, i, d)
+	kds.GetJobResult(i)
+	kds.PushJobData(s, props, i, d, WithIdempotencyKey(s))
+	kds.MigrateJobIdempotencyKey()
+	kds.MigrateJobClaimToken()
+	kds.PushJobDataWithPriority(s, props, i, i, d)
+	kds.ReclaimStaleJobs(s, d)
+	kds.MoveJob(i, s)
+	kds.WatchJobQueue(context.Background(), s)
+	kds.ListPendingJobs(s, pi, i)
+	kds.ListPendingJobsPage(s, i, i)
+	kds.ListActiveJobs(s, pi, i)
+	kds.ListActiveJobsPage(s, i, i)
+	kds.ClearJobQueue(s)
+	kds.GetJobStatistics(s)
+	kds.GetJobByID(i)
+
+	// Stream
+	kds.FindStreamID(ps, ps, props, ps)
+	kds.FindStreamIDs(ps, ps, props, ps)
+	kds.FindStreamTableKeys(rows)
+	kds.InvalidateStreamKey(s)
+	kds.PushStreamData(s, props, i, d, WithIdempotencyKey(s))
+	kds.MigrateStreamIdempotencyKey()
+	kds.SubscribeStream(context.Background(), s)
+	kds.GetLatestStreamData(s)
+	kds.ListStreamData(s, pi, i, pt, pt, s)
+	kds.ListStreamDataPage(s, i, i, pt, pt, s)
+	kds.ClearStreamData(s, pt)
+	kds.DeleteStreamDataOlderThan(s, t)
+	kds.DeleteStreamDataKeepLast(s, i)
+	kds.GetStreamDataCount(s, false)
+	kds.GetStreamDataRange(s, t, t)
+	kds.GetStreamWindow(s, t, t, i)
+	kds.GetStreamStatistics(s, false)
+	kds.GetStreamStats(s)
+	kds.GetStreamAggregates(s, d, t, t, s)
+	kds.GetStreamDataByID(i)
+	kds.GetStreamDataByIDs(s, nil)
+
+	// RPC client
+	kds.FindRPCClientID(ps, ps, props, ps)
+	kds.FindRPCClientIDs(ps, ps, props, ps)
+	kds.FindRPCClientKeys(rows)
+	kds.RPCClientFindFreeSlots(s)
+	kds.RPCClientFindQueuedSlots(s)
+	kds.RPCClientPeakAndClaimReplyData(s, i, d)
+	kds.RPCClientClearReplyQueue(s, i, d)
+	kds.RPCClientPushAndClaimReplyData(s, s, s, s, s, props, i, d)
+	kds.RPCClientWaitForReply(context.Background(), s, s)
+	kds.RPCClientReclaimTimedOut(s, d)
+	kds.RPCClientListWaitingJobs(ps)
+
+	// RPC server
+	kds.FindRPCServerID(ps, ps, props, ps)
+	kds.FindRPCServerIDs(ps, ps, props, ps)
+	kds.FindRPCServerTableKeys(rows)
+	kds.RPCServerListJobsJobTypes(s, s)
+	kds.RPCServerCountJobsByStatus(s)
+	kds.RPCServerCountAllJobs(s)
+	kds.RPCServerCountEmptyJobs(s)
+	kds.RPCServerCountNewJobs(s)
+	kds.RPCServerCountProcessingJobs(s)
+	kds.RPCServerCountJobsJobTypes(s, s)
+	kds.RPCServerSetMaxQueueDepth(i)
+	kds.RPCServerPushRPCQueue(s, s, s, props, s, i, ps, i, d)
+	kds.RPCServerPushBatch(s, []RPCRequest{{RequestID: s, RPCClientQueue: ps}})
+	kds.RPCServerPeakServerQueue(s, i, d)
+	kds.RPCServerPeekBlocking(context.Background(), s, d)
+	kds.RPCServerMarkJobCompletion(s, i, i, d)
+	kds.RPCServerClearServerQueue(s, i, d)
+
+	// Link and link mount tables
+	kds.LinkTableFindRecordsByLinkName(s, ps)
+	kds.LinkTableFindRecordsByLinkNameLike(s, ps)
+	kds.LinkTableFindRecordsByNodePath(s, ps)
+	kds.LinkTableFindAllLinkNames()
+	kds.LinkTableFindAllLinkNamesInKB(ps)
+	kds.LinkTableFindAllNodeNames()
+	kds.LinkTableFindAllNodeNamesInKB(ps)
+	kds.LinkMountTableFindRecordsByLinkName(s, ps)
+	kds.LinkMountTableFindRecordsByLinkNameLike(s, ps)
+	kds.LinkMountTableFindRecordsByMountPathMatch(s, ps)
+	kds.LinkMountTableFindRecordsByMountPath(s, ps)
+	kds.LinkMountTableFindAllLinkNames()
+	kds.LinkMountTableFindAllMountPaths()
+
+	kds.SetRetryPolicy(ExponentialRetryPolicy(i, d, d))
+	kds.SetObserver(nil)
+	kds.SetLogger(nil)
+	kds.SetStatementTimeout(d)
+	kds.SetStreamKeyCache(d)
+	kds.SetListenDSN(s)
+	kds.HealthCheck(context.Background())
+	kds.Maintain(context.Background())
+	kds.MaintainStream(context.Background())
+	kds.MaintainJobs(context.Background())
+	kds.Close()
+	kds.Disconnect()
+}
+
+// TestDelegationWiring keeps the delegate surface in sync with the component APIs
+func TestDelegationWiring(t *testing.T) {
+	// Compiling exerciseDelegates is the check; calling it would need a live database.
+	_ = exerciseDelegates
+}
+
+// TestCloseIsIdempotent verifies that closing the data structures twice is a no-op
+func TestCloseIsIdempotent(t *testing.T) {
+	kds := &KBDataStructures{querySupport: setupTestSearch(t, 1)}
+
+	if err := kds.Close(); err != nil {
+		t.Fatalf("Error closing data structures: %v", err)
+	}
+	if err := kds.Close(); err != nil {
+		t.Errorf("Expected nil error on second Close, got %v", err)
+	}
+	if err := kds.Disconnect(); err != nil {
+		t.Errorf("Expected nil error on Disconnect after Close, got %v", err)
+	}
+	if _, err := kds.querySupport.GetConnAndCursor(); err == nil {
+		t.Error("Expected no connection after Close")
+	}
+}
+
+// TestNewKBDataStructuresFromDB shares one pool between two instances and checks
+// that closing either leaves the pool open
+func TestNewKBDataStructuresFromDB(t *testing.T) {
+	setupTestSearch(t, 1).Disconnect()
+
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+		url.PathEscape(testDBUser), url.PathEscape(testDBPassword), testDBHost, testDBPort, testDBName)
+	owner, err := NewKBSearchFromURL(dsn, testDBTable)
+	if err != nil {
+		t.Fatalf("Error connecting from URL: %v", err)
+	}
+	defer owner.Disconnect()
+	db, _ := owner.GetConnAndCursor()
+	if got := owner.connString(); got != dsn {
+		t.Errorf("Expected listeners to connect with %q, got %q", dsn, got)
+	}
+
+	first, err := NewKBDataStructuresFromDB(db, testDBTable)
+	if err != nil {
+		t.Fatalf("Error creating first instance: %v", err)
+	}
+	second, err := NewKBDataStructuresFromDB(db, testDBTable)
+	if err != nil {
+		t.Fatalf("Error creating second instance: %v", err)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Fatalf("Error closing first instance: %v", err)
+	}
+	if _, err := second.ExecuteKBSearchNodes(); err != nil {
+		t.Errorf("Expected second instance to keep working, got %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("Error closing second instance: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("Expected the injected pool to stay open, got %v", err)
+	}
+}
+
+// TestListenDSN checks that an instance on an injected pool refuses to listen
+// until it is given a connection string. sql.Open does not dial, so no
+// database is needed.
+func TestListenDSN(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening pool: %v", err)
+	}
+	defer db.Close()
+
+	kds, err := NewKBDataStructuresFromDB(db, testDBTable, WithStatusNotify())
+	if err != nil {
+		t.Fatalf("Error creating instance: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := kds.WatchStatus(ctx, "kb1.status1"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected WatchStatus to need a DSN, got %v", err)
+	}
+	if _, err := kds.WatchJobQueue(ctx, "kb1.job1"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected WatchJobQueue to need a DSN, got %v", err)
+	}
+	if _, err := kds.SubscribeStream(ctx, "kb1.stream1"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected SubscribeStream to need a DSN, got %v", err)
+	}
+
+	dsn := "postgres://user@localhost/unused?sslmode=disable"
+	kds.SetListenDSN(dsn)
+	if got := kds.querySupport.connString(); got != dsn {
+		t.Errorf("Expected listeners to connect with %q, got %q", dsn, got)
+	}
+}
+
+// TestHealthCheck creates every component table, drops the stream table and
+// expects only the stream component to be reported unhealthy
+func TestHealthCheck(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	kds, err := NewKBDataStructuresFromDB(kb.conn, testDBTable)
+	if err != nil {
+		t.Fatalf("Error creating data structures: %v", err)
+	}
+	defer kds.Close()
+
+	for _, component := range kds.healthTables() {
+		for _, table := range component.Tables {
+			if table == testDBTable {
+				continue
+			}
+			if _, err := kb.conn.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE; CREATE TABLE %s (id SERIAL)", table, table)); err != nil {
+				t.Fatalf("Error creating %s: %v", table, err)
+			}
+		}
+	}
+
+	report, err := kds.HealthCheck(context.Background())
+	if err != nil || !report.Ready {
+		t.Fatalf("Expected a ready report, got %+v, %v", report, err)
+	}
+
+	if _, err := kb.conn.Exec(fmt.Sprintf("DROP TABLE %s", kds.stream.BaseTable)); err != nil {
+		t.Fatalf("Error dropping stream table: %v", err)
+	}
+	report, err = kds.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatalf("Error checking health: %v", err)
+	}
+	if report.Ready || report.Database != "ok" {
+		t.Errorf("Expected a reachable but not ready report, got %+v", report)
+	}
+	for _, component := range report.Components {
+		if want := component.Name != "stream"; component.Healthy != want {
+			t.Errorf("Component %s: expected healthy=%v, got %+v", component.Name, want, component)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report, err := kds.HealthCheck(ctx); err == nil || report.Ready {
+		t.Errorf("Expected a cancelled check to fail, got %+v, %v", report, err)
+	}
+}
+
+// TestMaintain runs the maintenance methods against populated stream and job tables
+func TestMaintain(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream", 20)
+	defer ks.KBSearch.Disconnect()
+	jq := setupTestJobQueue(t, "kb1.jobs", 20)
+	defer jq.KBSearch.Disconnect()
+
+	kds, err := NewKBDataStructuresFromDB(ks.KBSearch.conn, testDBTable)
+	if err != nil {
+		t.Fatalf("Error creating data structures: %v", err)
+	}
+	defer kds.Close()
+
+	ctx := context.Background()
+	if err := kds.MaintainStream(ctx); err != nil {
+		t.Errorf("Error maintaining stream table: %v", err)
+	}
+	if err := kds.MaintainJobs(ctx); err != nil {
+		t.Errorf("Error maintaining job table: %v", err)
+	}
+	if err := kds.Maintain(ctx); err != nil {
+		t.Errorf("Error maintaining all tables: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := kds.Maintain(cancelled); err == nil {
+		t.Error("Expected a cancelled Maintain to fail")
+	}
+}
@@ -2,11 +2,17 @@ package data_structures_module
 
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // KBJobQueue handles job queue operations for the knowledge base
@@ -14,6 +20,25 @@ type KBJobQueue struct {
 	KBSearch  *KBSearch
 	conn      *sql.DB
 	BaseTable string
+	// VisibilityTimeout makes a claimed job eligible for PeakJobData again once
+	// it has been active this long without completing. Zero disables reclaiming.
+	VisibilityTimeout time.Duration
+	// WatchPollInterval is the fallback poll interval for WatchJobQueue; defaults to 1s
+	WatchPollInterval time.Duration
+	// RetryPolicy overrides the maxRetries and retryDelay arguments of
+	// PeakJobData, MarkJobCompleted and PushJobData
+	RetryPolicy *RetryPolicy
+	// Observer receives the latency of PushJobData and PeakJobData and the
+	// queue depth after each; nil disables metrics
+	Observer Observer
+	// Logger receives the errors WatchJobQueue cannot return, such as a failed
+	// claim or release; nil discards them
+	Logger Logger
+	// StatementTimeout makes Postgres cancel the queue's record queries and
+	// transactions that run longer than this, returning ErrStatementTimeout;
+	// zero falls back to the KBSearch's StatementTimeout
+	StatementTimeout time.Duration
+	keyColumn        keyColumn
 }
 
 // JobRecord represents a single job record
@@ -25,7 +50,11 @@ type JobRecord struct {
 	CompletedAt *time.Time             `json:"completed_at"`
 	IsActive    bool                   `json:"is_active"`
 	Valid       bool                   `json:"valid"`
+	Priority    int                    `json:"priority"`
 	Data        map[string]interface{} `json:"data"`
+	// ClaimToken is set on records delivered by WatchJobQueue; pass it to
+	// MarkJobCompletedWithToken
+	ClaimToken string `json:"claim_token,omitempty"`
 }
 
 // PeakJobResult represents the result of peeking at a job
@@ -34,6 +63,10 @@ type PeakJobResult struct {
 	Data       map[string]interface{} `json:"data"`
 	ScheduleAt *time.Time             `json:"schedule_at"`
 	StartedAt  *time.Time             `json:"started_at"`
+	Priority   int                    `json:"priority"`
+	// ClaimToken identifies this claim. Completing the job with it fails once
+	// the claim has expired and the job has been claimed again.
+	ClaimToken string `json:"claim_token"`
 }
 
 // JobCompletionResult represents the result of marking a job as completed
@@ -47,9 +80,131 @@ type JobCompletionResult struct {
 type PushJobResult struct {
 	JobID      int                    `json:"job_id"`
 	ScheduleAt *time.Time             `json:"schedule_at"`
+	Priority   int                    `json:"priority"`
 	Data       map[string]interface{} `json:"data"`
 }
 
+// PushOption configures a single PushJobData or PushStreamData call
+type PushOption func(*pushOptions)
+
+type pushOptions struct {
+	idempotencyKey string
+}
+
+// WithIdempotencyKey makes a push idempotent: if a record stored with key is
+// still in the table, the push is a no-op that returns that record instead of
+// writing a duplicate. The key is checked on every attempt of the retry loop, so
+// an attempt that committed before its error reached the caller is not
+// repeated. Keys live in the table's unique idempotency_key column and are
+// dropped when the slot holding them is reused; a table created without that
+// column needs MigrateIdempotencyKey first. An empty key disables the check.
+func WithIdempotencyKey(key string) PushOption {
+	return func(o *pushOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+func newPushOptions(opts []PushOption) pushOptions {
+	var o pushOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// keyParam binds the idempotency key, storing NULL when none is set
+func (o pushOptions) keyParam() interface{} {
+	if o.idempotencyKey == "" {
+		return nil
+	}
+	return o.idempotencyKey
+}
+
+// keyColumn records whether a table has the idempotency_key column. Tables
+// created before idempotency keys were supported lack it until
+// MigrateIdempotencyKey adds it.
+type keyColumn struct {
+	mu      sync.Mutex
+	checked bool
+	present bool
+}
+
+// exists reports whether table has the idempotency_key column, reading the
+// catalog on first use only
+func (c *keyColumn) exists(queryRow func(string, ...interface{}) *sql.Row, table string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checked {
+		return c.present, nil
+	}
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = ANY(current_schemas(false))
+			AND table_name = lower($1)
+			AND column_name = 'idempotency_key'
+		)`
+	if err := queryRow(query, table).Scan(&c.present); err != nil {
+		return false, fmt.Errorf("error checking %s for an idempotency_key column: %w", table, err)
+	}
+	c.checked = true
+	return c.present, nil
+}
+
+// assignment returns the SET clause item writing the push's key as parameter
+// param, and the argument to bind for it. A table without the column gets no
+// item, so pushes without a key keep working on it; a push with a key fails.
+func (c *keyColumn) assignment(queryRow func(string, ...interface{}) *sql.Row, table string, o pushOptions, param int) (string, []interface{}, error) {
+	present, err := c.exists(queryRow, table)
+	if err != nil {
+		return "", nil, err
+	}
+	if !present {
+		if o.idempotencyKey != "" {
+			return "", nil, fmt.Errorf("%w: %s has no idempotency_key column; add it with MigrateIdempotencyKey", ErrValidation, table)
+		}
+		return "", nil, nil
+	}
+	return fmt.Sprintf(", idempotency_key = $%d", param), []interface{}{o.keyParam()}, nil
+}
+
+// migrate adds the idempotency_key column to table unless it is already there
+func (c *keyColumn) migrate(conn *sql.DB, table string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS idempotency_key TEXT UNIQUE", table)
+	if _, err := conn.Exec(query); err != nil {
+		return fmt.Errorf("error adding idempotency_key column to %s: %w", table, err)
+	}
+	c.checked = true
+	c.present = true
+	return nil
+}
+
+// MigrateIdempotencyKey adds the idempotency_key column used by
+// WithIdempotencyKey to a job table created before it existed. It does nothing
+// when the column is already there.
+func (jq *KBJobQueue) MigrateIdempotencyKey() error {
+	return jq.keyColumn.migrate(jq.conn, jq.BaseTable)
+}
+
+// MigrateClaimToken adds the claimed_at and claim_token columns PeakJobData
+// writes to a job table created before claims expired. It does nothing when the
+// columns are already there.
+func (jq *KBJobQueue) MigrateClaimToken() error {
+	query := fmt.Sprintf(`
+		ALTER TABLE %s
+		ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS claim_token TEXT
+	`, jq.BaseTable)
+	if _, err := jq.conn.Exec(query); err != nil {
+		return fmt.Errorf("error adding claim columns to %s: %w", jq.BaseTable, err)
+	}
+	return nil
+}
+
 // ClearQueueResult represents the result of clearing the job queue
 type ClearQueueResult struct {
 	Success      bool                     `json:"success"`
@@ -77,69 +232,82 @@ func NewKBJobQueue(kbSearch *KBSearch, database string) *KBJobQueue {
 	}
 }
 
-// executeQuery executes a query and returns results as slice of maps
-func (jq *KBJobQueue) executeQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := jq.conn.Query(query, params...)
-	if err != nil {
-		return nil, err
+// log returns the configured Logger, or a no-op logger when none is set
+func (jq *KBJobQueue) log() Logger {
+	if jq.Logger == nil {
+		return noopLogger{}
 	}
-	defer rows.Close()
+	return jq.Logger
+}
 
-	return rowsToMaps(rows)
+// statementTimeout returns StatementTimeout, or the KBSearch's when it is zero
+func (jq *KBJobQueue) statementTimeout() time.Duration {
+	if jq.StatementTimeout > 0 || jq.KBSearch == nil {
+		return jq.StatementTimeout
+	}
+	return jq.KBSearch.StatementTimeout
+}
+
+// begin starts a transaction through beginWithTimeout under statementTimeout
+func (jq *KBJobQueue) begin() (*sql.Tx, error) {
+	return beginWithTimeout(jq.conn, jq.statementTimeout())
+}
+
+// executeQuery executes a query and returns results as slice of maps
+func (jq *KBJobQueue) executeQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
+	err := queryWithTimeout(jq.conn, jq.statementTimeout(), func(rows *sql.Rows) (err error) {
+		results, err = rowsToMaps(rows)
+		return err
+	}, query, params...)
+	return results, err
 }
 
 // executeSingle executes a query and returns a single result as a map
 func (jq *KBJobQueue) executeSingle(query string, params ...interface{}) (map[string]interface{}, error) {
-	rows, err := jq.conn.Query(query, params...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	var result map[string]interface{}
+	err := queryWithTimeout(jq.conn, jq.statementTimeout(), func(rows *sql.Rows) (err error) {
+		result, err = firstRowToMap(rows)
+		return err
+	}, query, params...)
+	return result, err
+}
+
+// findPushedJob returns the job stored with idempotency key, or nil if there is none
+func (jq *KBJobQueue) findPushedJob(queryRow func(string, ...interface{}) *sql.Row, key string) (*PushJobResult, error) {
+	query := fmt.Sprintf("SELECT id, schedule_at, priority, data FROM %s WHERE idempotency_key = $1", jq.BaseTable)
 
-	if !rows.Next() {
+	var jobID int
+	var scheduleAt sql.NullTime
+	var priority int
+	var dataStr sql.NullString
+	err := queryRow(query, key).Scan(&jobID, &scheduleAt, &priority, &dataStr)
+	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-
-	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error looking up idempotency key '%s': %w", key, err)
 	}
 
-	values := make([]interface{}, len(columns))
-	valuePointers := make([]interface{}, len(columns))
-	for i := range columns {
-		valuePointers[i] = &values[i]
+	result := &PushJobResult{JobID: jobID, Priority: priority}
+	if scheduleAt.Valid {
+		result.ScheduleAt = &scheduleAt.Time
 	}
-
-	if err := rows.Scan(valuePointers...); err != nil {
-		return nil, err
-	}
-
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		var v interface{}
-		val := values[i]
-		b, ok := val.([]byte)
-		if ok {
-			v = string(b)
-		} else {
-			v = val
-		}
-		result[col] = v
+	if dataStr.Valid {
+		json.Unmarshal([]byte(dataStr.String), &result.Data)
 	}
-
 	return result, nil
 }
 
 // FindJobID finds a single job id for given parameters
-func (jq *KBJobQueue) FindJobID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
-	results, err := jq.FindJobIDs(kb, nodeName, properties, nodePath)
+func (jq *KBJobQueue) FindJobID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	results, err := jq.FindJobIDs(kb, nodeName, properties, nodePath, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no job found matching parameters: name=%v, properties=%v, path=%v",
+		return nil, fmt.Errorf("%w: no job found matching parameters: name=%v, properties=%v, path=%v", ErrNotFound,
 			nodeName, properties, nodePath)
 	}
 	if len(results) > 1 {
@@ -151,7 +319,7 @@ func (jq *KBJobQueue) FindJobID(kb *string, nodeName *string, properties map[str
 }
 
 // FindJobIDs finds all job ids matching the given parameters
-func (jq *KBJobQueue) FindJobIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
+func (jq *KBJobQueue) FindJobIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
 	// Clear previous filters and build new query
 	jq.KBSearch.ClearFilters()
 	jq.KBSearch.SearchLabel("KB_JOB_QUEUE")
@@ -174,14 +342,18 @@ func (jq *KBJobQueue) FindJobIDs(kb *string, nodeName *string, properties map[st
 		jq.KBSearch.SearchPath(*nodePath)
 	}
 
+	for _, opt := range opts {
+		opt(jq.KBSearch)
+	}
+
 	// Execute query
 	nodeIDs, err := jq.KBSearch.ExecuteQuery()
 	if err != nil {
-		return nil, fmt.Errorf("error finding job IDs: %v", err)
+		return nil, fmt.Errorf("error finding job IDs: %w", err)
 	}
 
 	if len(nodeIDs) == 0 {
-		return nil, fmt.Errorf("no jobs found matching parameters: name=%v, properties=%v, path=%v",
+		return nil, fmt.Errorf("%w: no jobs found matching parameters: name=%v, properties=%v, path=%v", ErrNotFound,
 			nodeName, properties, nodePath)
 	}
 
@@ -204,68 +376,79 @@ func (jq *KBJobQueue) FindJobPaths(tableDictRows []map[string]interface{}) []str
 	return returnValues
 }
 
-// GetQueuedNumber counts the number of valid job entries for a given path
-func (jq *KBJobQueue) GetQueuedNumber(path string) (int, error) {
+// QueueStats is a consistent snapshot of the job slots for a path
+type QueueStats struct {
+	Queued int `json:"queued"` // valid jobs, including active ones
+	Free   int `json:"free"`   // slots without a valid job
+	Active int `json:"active"` // valid jobs claimed by a worker
+	Total  int `json:"total"`
+}
+
+// GetQueueStats counts the queued, free, active and total job slots for a path
+// in a single query, so the counts always describe the same moment
+func (jq *KBJobQueue) GetQueueStats(path string) (QueueStats, error) {
 	if path == "" {
-		return 0, fmt.Errorf("path cannot be empty")
+		return QueueStats{}, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) as count
+		SELECT
+			COUNT(*) FILTER (WHERE valid = TRUE) AS queued,
+			COUNT(*) FILTER (WHERE valid = FALSE) AS free,
+			COUNT(*) FILTER (WHERE valid = TRUE AND is_active = TRUE) AS active,
+			COUNT(*) AS total
 		FROM %s
 		WHERE path = $1
-		AND valid = TRUE
 	`, jq.BaseTable)
 
-	result, err := jq.executeSingle(query, path)
+	var stats QueueStats
+	err := jq.conn.QueryRow(query, path).Scan(&stats.Queued, &stats.Free, &stats.Active, &stats.Total)
 	if err != nil {
-		return 0, fmt.Errorf("error counting queued jobs for path '%s': %v", path, err)
+		return QueueStats{}, fmt.Errorf("error counting jobs for path '%s': %w", path, err)
 	}
 
-	if result == nil {
-		return 0, nil
-	}
+	return stats, nil
+}
 
-	if count, ok := result["count"].(int64); ok {
-		return int(count), nil
+// GetQueuedNumber counts the number of valid job entries for a given path
+func (jq *KBJobQueue) GetQueuedNumber(path string) (int, error) {
+	stats, err := jq.GetQueueStats(path)
+	if err != nil {
+		return 0, err
 	}
-
-	return 0, nil
+	return stats.Queued, nil
 }
 
 // GetFreeNumber counts the number of invalid job entries for a given path
 func (jq *KBJobQueue) GetFreeNumber(path string) (int, error) {
-	if path == "" {
-		return 0, fmt.Errorf("path cannot be empty")
-	}
-
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) as count
-		FROM %s
-		WHERE path = $1
-		AND valid = FALSE
-	`, jq.BaseTable)
-
-	result, err := jq.executeSingle(query, path)
+	stats, err := jq.GetQueueStats(path)
 	if err != nil {
-		return 0, fmt.Errorf("error counting free jobs for path '%s': %v", path, err)
+		return 0, err
 	}
+	return stats.Free, nil
+}
 
-	if result == nil {
-		return 0, nil
-	}
+// observe reports a job queue operation to the Observer, followed by the queue
+// depth of path when it succeeded
+func (jq *KBJobQueue) observe(op, path string, start time.Time, err *error) {
+	observeOp(jq.Observer, op, start, err)
+	observeDepth(jq.Observer, "job_queue", path, *err, jq.GetQueuedNumber)
+}
 
-	if count, ok := result["count"].(int64); ok {
-		return int(count), nil
-	}
+// claimRetryScale stretches the default retry delay after a found job could not
+// be marked claimed, giving the competing claim time to commit
+const claimRetryScale = 1.5
 
-	return 0, nil
-}
+// PeakJobData finds and claims the highest priority job for a path, earliest
+// scheduled first. The result carries a new claim token, which
+// MarkJobCompletedWithToken checks so that a worker whose claim expired cannot complete the job after
+// another worker has claimed it.
+func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.Duration) (result *PeakJobResult, err error) {
+	defer jq.observe("PeakJobData", path, time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
 
-// PeakJobData finds and claims the earliest scheduled job for a path
-func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.Duration) (*PeakJobResult, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	if maxRetries <= 0 {
@@ -275,26 +458,30 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 		retryDelay = time.Second
 	}
 
+	policy := jq.RetryPolicy.orLinear(maxRetries, retryDelay)
+	maxRetries = policy.attempts()
+
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Start transaction
-		tx, err := jq.conn.Begin()
+		tx, err := jq.begin()
 		if err != nil {
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				continue
 			}
-			return nil, fmt.Errorf("database error peeking job data for path '%s': %v", path, err)
+			return nil, fmt.Errorf("database error peeking job data for path '%s': %w", path, err)
 		}
 
 		// Find query
 		findQuery := fmt.Sprintf(`
-			SELECT id, data, schedule_at
+			SELECT id, data, schedule_at, priority
 			FROM %s
 			WHERE path = $1
 				AND valid = TRUE
-				AND is_active = FALSE
+				AND (is_active = FALSE
+					OR ($2::float8 > 0 AND claimed_at < NOW() - make_interval(secs => $2::float8)))
 				AND (schedule_at IS NULL OR schedule_at <= NOW())
-			ORDER BY schedule_at ASC NULLS FIRST
+			ORDER BY priority DESC, schedule_at ASC NULLS FIRST
 			FOR UPDATE SKIP LOCKED
 			LIMIT 1
 		`, jq.BaseTable)
@@ -302,15 +489,16 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 		var jobID int64
 		var dataStr string
 		var scheduleAt sql.NullTime
+		var priority int
 
-		err = tx.QueryRow(findQuery, path).Scan(&jobID, &dataStr, &scheduleAt)
+		err = tx.QueryRow(findQuery, path, jq.VisibilityTimeout.Seconds()).Scan(&jobID, &dataStr, &scheduleAt, &priority)
 		if err != nil {
 			tx.Rollback()
 			if err == sql.ErrNoRows {
 				return nil, nil
 			}
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				continue
 			}
 			return nil, err
@@ -320,19 +508,25 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 		updateQuery := fmt.Sprintf(`
 			UPDATE %s
 			SET started_at = NOW(),
+				claimed_at = NOW(),
+				claim_token = $2,
 				is_active = TRUE
 			WHERE id = $1
-				AND is_active = FALSE
 				AND valid = TRUE
 			RETURNING started_at
 		`, jq.BaseTable)
 
+		claimToken := uuid.New().String()
 		var startedAt time.Time
-		err = tx.QueryRow(updateQuery, jobID).Scan(&startedAt)
+		err = tx.QueryRow(updateQuery, jobID, claimToken).Scan(&startedAt)
 		if err != nil {
 			tx.Rollback()
-			if attempt < maxRetries-1 {
-				time.Sleep(time.Duration(float64(retryDelay) * 1.5))
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				if jq.RetryPolicy == nil {
+					policy.waitScaled(attempt+1, claimRetryScale)
+				} else {
+					policy.Wait(attempt + 1)
+				}
 				continue
 			}
 			return nil, err
@@ -340,8 +534,8 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 
 		// Commit transaction
 		if err := tx.Commit(); err != nil {
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				continue
 			}
 			return nil, err
@@ -350,13 +544,15 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 		// Parse JSON data
 		var data map[string]interface{}
 		if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
-			return nil, fmt.Errorf("error parsing job data: %v", err)
+			return nil, fmt.Errorf("error parsing job data: %w", err)
 		}
 
 		result := &PeakJobResult{
-			ID:        int(jobID),
-			Data:      data,
-			StartedAt: &startedAt,
+			ID:         int(jobID),
+			Data:       data,
+			StartedAt:  &startedAt,
+			Priority:   priority,
+			ClaimToken: claimToken,
 		}
 
 		if scheduleAt.Valid {
@@ -366,13 +562,45 @@ func (jq *KBJobQueue) PeakJobData(path string, maxRetries int, retryDelay time.D
 		return result, nil
 	}
 
-	return nil, fmt.Errorf("could not lock and claim a job for path='%s' after %d retries", path, maxRetries)
+	return nil, fmt.Errorf("%w: could not lock and claim a job for path='%s' after %d retries", ErrConflict, path, maxRetries)
 }
 
 // MarkJobCompleted marks a job as completed
 func (jq *KBJobQueue) MarkJobCompleted(jobID int, maxRetries int, retryDelay time.Duration) (*JobCompletionResult, error) {
+	return jq.MarkJobCompletedWithResult(jobID, nil, maxRetries, retryDelay)
+}
+
+// MarkJobCompletedWithResult marks a job as completed and stores result as the
+// job's output for GetJobResult; a nil result clears any stored output
+func (jq *KBJobQueue) MarkJobCompletedWithResult(jobID int, result map[string]interface{}, maxRetries int, retryDelay time.Duration) (*JobCompletionResult, error) {
+	return jq.completeJob(jobID, "", result, maxRetries, retryDelay)
+}
+
+// MarkJobCompletedWithToken marks a job as completed like
+// MarkJobCompletedWithResult, but only while it is still held under claimToken,
+// the token PeakJobData returned. It fails with ErrConflict once the claim has
+// expired and the job has been claimed again.
+func (jq *KBJobQueue) MarkJobCompletedWithToken(jobID int, claimToken string, result map[string]interface{}, maxRetries int, retryDelay time.Duration) (*JobCompletionResult, error) {
+	if claimToken == "" {
+		return nil, fmt.Errorf("%w: claim token cannot be empty", ErrValidation)
+	}
+	return jq.completeJob(jobID, claimToken, result, maxRetries, retryDelay)
+}
+
+// completeJob marks a job as completed, checking claimToken unless it is empty
+func (jq *KBJobQueue) completeJob(jobID int, claimToken string, result map[string]interface{}, maxRetries int, retryDelay time.Duration) (_ *JobCompletionResult, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if jobID <= 0 {
-		return nil, fmt.Errorf("job_id must be a valid positive integer")
+		return nil, fmt.Errorf("%w: job_id must be a valid positive integer", ErrValidation)
+	}
+
+	var resultJSON interface{}
+	if result != nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to marshal result: %w", ErrValidation, err)
+		}
+		resultJSON = string(b)
 	}
 
 	if maxRetries <= 0 {
@@ -382,12 +610,15 @@ func (jq *KBJobQueue) MarkJobCompleted(jobID int, maxRetries int, retryDelay tim
 		retryDelay = time.Second
 	}
 
+	policy := jq.RetryPolicy.orLinear(maxRetries, retryDelay)
+	maxRetries = policy.attempts()
+
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Start transaction
-		tx, err := jq.conn.Begin()
+		tx, err := jq.begin()
 		if err != nil {
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				continue
 			}
 			return nil, err
@@ -395,47 +626,55 @@ func (jq *KBJobQueue) MarkJobCompleted(jobID int, maxRetries int, retryDelay tim
 
 		// Lock query
 		lockQuery := fmt.Sprintf(`
-			SELECT id
+			SELECT id, claim_token
 			FROM %s
 			WHERE id = $1
 			FOR UPDATE NOWAIT
 		`, jq.BaseTable)
 
 		var lockedID int
-		err = tx.QueryRow(lockQuery, jobID).Scan(&lockedID)
+		var heldToken sql.NullString
+		err = tx.QueryRow(lockQuery, jobID).Scan(&lockedID, &heldToken)
 		if err != nil {
 			tx.Rollback()
 			if err == sql.ErrNoRows {
-				return nil, fmt.Errorf("no job found with id=%d", jobID)
+				return nil, fmt.Errorf("%w: no job found with id=%d", ErrNotFound, jobID)
 			}
-			if isLockError(err) && attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, isLockError) {
+				policy.Wait(attempt + 1)
 				continue
 			}
 			return nil, err
 		}
+		if claimToken != "" && heldToken.String != claimToken {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: job %d is no longer claimed with this token", ErrConflict, jobID)
+		}
 
 		// Update query
 		updateQuery := fmt.Sprintf(`
 			UPDATE %s
 			SET completed_at = NOW(),
+				claimed_at = NULL,
+				claim_token = NULL,
 				valid = FALSE,
-				is_active = FALSE
+				is_active = FALSE,
+				result = $2
 			WHERE id = $1
 			RETURNING id, completed_at
 		`, jq.BaseTable)
 
 		var completedAt time.Time
-		err = tx.QueryRow(updateQuery, jobID).Scan(&lockedID, &completedAt)
+		err = tx.QueryRow(updateQuery, jobID, resultJSON).Scan(&lockedID, &completedAt)
 		if err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("failed to mark job %d as completed", jobID)
+			return nil, fmt.Errorf("failed to mark job %d as completed: %w", jobID, err)
 		}
 
 		// Commit transaction
 		if err := tx.Commit(); err != nil {
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries-1 && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				continue
 			}
 			return nil, err
@@ -448,16 +687,119 @@ func (jq *KBJobQueue) MarkJobCompleted(jobID int, maxRetries int, retryDelay tim
 		}, nil
 	}
 
-	return nil, fmt.Errorf("could not lock job id=%d after %d attempts", jobID, maxRetries)
+	return nil, fmt.Errorf("%w: could not lock job id=%d after %d attempts", ErrConflict, jobID, maxRetries)
+}
+
+// MarkJobsCompleted marks several jobs as completed with a single UPDATE and
+// returns one result per id, in the order given. An id is reported with
+// Success false when no job has that id or the job is already completed, so
+// partially-missing batches are not an error. Stored results are cleared as in
+// MarkJobCompleted.
+func (jq *KBJobQueue) MarkJobsCompleted(jobIDs []int, maxRetries int, retryDelay time.Duration) ([]JobCompletionResult, error) {
+	return jq.MarkJobsCompletedWithTokens(jobIDs, make([]string, len(jobIDs)), maxRetries, retryDelay)
+}
+
+// MarkJobsCompletedWithTokens is MarkJobsCompleted with the claim token of each
+// job, in the same order, checked as in MarkJobCompletedWithToken. A job no
+// longer held under its token is reported with Success false; an empty token
+// skips the check for that job.
+func (jq *KBJobQueue) MarkJobsCompletedWithTokens(jobIDs []int, claimTokens []string, maxRetries int, retryDelay time.Duration) ([]JobCompletionResult, error) {
+	for _, jobID := range jobIDs {
+		if jobID <= 0 {
+			return nil, fmt.Errorf("%w: job_id must be a valid positive integer, got %d", ErrValidation, jobID)
+		}
+	}
+	if len(claimTokens) != len(jobIDs) {
+		return nil, fmt.Errorf("%w: got %d claim tokens for %d jobs", ErrValidation, len(claimTokens), len(jobIDs))
+	}
+	if len(jobIDs) == 0 {
+		return []JobCompletionResult{}, nil
+	}
+
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+
+	policy := jq.RetryPolicy.orLinear(maxRetries, retryDelay)
+	maxRetries = policy.attempts()
+
+	updateQuery := fmt.Sprintf(`
+		UPDATE %s AS j
+		SET completed_at = NOW(),
+			claimed_at = NULL,
+			claim_token = NULL,
+			valid = FALSE,
+			is_active = FALSE,
+			result = NULL
+		FROM unnest($1::int[], $2::text[]) AS c(id, claim_token)
+		WHERE j.id = c.id AND (j.valid OR j.is_active)
+			AND (c.claim_token = '' OR j.claim_token = c.claim_token)
+		RETURNING j.id, j.completed_at
+	`, jq.BaseTable)
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		completed, err := jq.markJobsCompleted(updateQuery, jobIDs, claimTokens)
+		if err != nil {
+			if attempt < maxRetries-1 && policy.retryable(err, isRetryableDBError) {
+				policy.Wait(attempt + 1)
+				continue
+			}
+			return nil, fmt.Errorf("failed to mark jobs as completed: %w", err)
+		}
+
+		results := make([]JobCompletionResult, len(jobIDs))
+		for i, jobID := range jobIDs {
+			results[i] = JobCompletionResult{JobID: jobID}
+			if completedAt, ok := completed[jobID]; ok {
+				results[i].Success = true
+				results[i].CompletedAt = &completedAt
+			}
+		}
+		return results, nil
+	}
+
+	return nil, fmt.Errorf("%w: could not mark jobs as completed after %d attempts", ErrConflict, maxRetries)
+}
+
+// markJobsCompleted runs the batch completion update and returns the completion
+// time of each job it changed
+func (jq *KBJobQueue) markJobsCompleted(updateQuery string, jobIDs []int, claimTokens []string) (map[int]time.Time, error) {
+	rows, err := jq.conn.Query(updateQuery, pq.Array(jobIDs), pq.Array(claimTokens))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := make(map[int]time.Time, len(jobIDs))
+	for rows.Next() {
+		var jobID int
+		var completedAt time.Time
+		if err := rows.Scan(&jobID, &completedAt); err != nil {
+			return nil, err
+		}
+		completed[jobID] = completedAt
+	}
+	return completed, rows.Err()
+}
+
+// PushJobData pushes new job data to an available slot with the default priority of 0
+func (jq *KBJobQueue) PushJobData(path string, data map[string]interface{}, maxRetries int, retryDelay time.Duration, opts ...PushOption) (*PushJobResult, error) {
+	return jq.PushJobDataWithPriority(path, data, 0, maxRetries, retryDelay, opts...)
 }
 
-// PushJobData pushes new job data to an available slot
-func (jq *KBJobQueue) PushJobData(path string, data map[string]interface{}, maxRetries int, retryDelay time.Duration) (*PushJobResult, error) {
+// PushJobDataWithPriority pushes new job data to an available slot; higher priorities are dequeued first
+func (jq *KBJobQueue) PushJobDataWithPriority(path string, data map[string]interface{}, priority int, maxRetries int, retryDelay time.Duration, opts ...PushOption) (result *PushJobResult, err error) {
+	defer jq.observe("PushJobData", path, time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 	if data == nil {
-		return nil, fmt.Errorf("data must be a valid map")
+		return nil, fmt.Errorf("%w: data must be a valid map", ErrValidation)
 	}
 
 	if maxRetries <= 0 {
@@ -467,9 +809,13 @@ func (jq *KBJobQueue) PushJobData(path string, data map[string]interface{}, maxR
 		retryDelay = time.Second
 	}
 
+	policy := jq.RetryPolicy.orLinear(maxRetries, retryDelay)
+	maxRetries = policy.attempts()
+	pushOpts := newPushOptions(opts)
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal data: %v", err)
+		return nil, fmt.Errorf("%w: failed to marshal data: %w", ErrValidation, err)
 	}
 
 	selectSQL := fmt.Sprintf(`
@@ -482,57 +828,89 @@ func (jq *KBJobQueue) PushJobData(path string, data map[string]interface{}, maxR
 		FOR UPDATE SKIP LOCKED
 	`, jq.BaseTable)
 
-	updateSQL := fmt.Sprintf(`
+	updateFormat := fmt.Sprintf(`
 		UPDATE %s
 		SET data = $1,
 			schedule_at = timezone('UTC', now()),
 			started_at = timezone('UTC', now()),
 			completed_at = timezone('UTC', now()),
 			valid = TRUE,
-			is_active = FALSE
+			is_active = FALSE,
+			claimed_at = NULL,
+			claim_token = NULL,
+			priority = $3,
+			result = NULL%%s
 		WHERE id = $2
 		RETURNING id, schedule_at, data
 	`, jq.BaseTable)
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		// Start transaction
-		tx, err := jq.conn.Begin()
+		tx, err := jq.begin()
 		if err != nil {
-			if attempt < maxRetries {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt)
 				continue
 			}
 			return nil, err
 		}
 
+		keySet, keyArgs, err := jq.keyColumn.assignment(tx.QueryRow, jq.BaseTable, pushOpts, 4)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		updateSQL := fmt.Sprintf(updateFormat, keySet)
+
+		// A job already pushed with this key is returned as is
+		if pushOpts.idempotencyKey != "" {
+			existing, err := jq.findPushedJob(tx.QueryRow, pushOpts.idempotencyKey)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if existing != nil {
+				tx.Rollback()
+				return existing, nil
+			}
+		}
+
 		// Select available slot
 		var jobID int64
 		err = tx.QueryRow(selectSQL, path).Scan(&jobID)
 		if err != nil {
 			tx.Rollback()
 			if err == sql.ErrNoRows {
-				return nil, fmt.Errorf("no available job slot for path '%s'", path)
+				return nil, fmt.Errorf("%w: no available job slot for path '%s'", ErrQueueFull, path)
 			}
-			if isLockError(err) && attempt < maxRetries {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries && policy.retryable(err, isLockError) {
+				policy.Wait(attempt)
 				continue
 			}
-			return nil, fmt.Errorf("error finding available job slot: %v", err)
+			return nil, fmt.Errorf("error finding available job slot: %w", err)
 		}
 
 		// Update the slot
 		var scheduleAt time.Time
 		var returnedData string
-		err = tx.QueryRow(updateSQL, string(jsonData), jobID).Scan(&jobID, &scheduleAt, &returnedData)
+		err = tx.QueryRow(updateSQL, append([]interface{}{string(jsonData), jobID, priority}, keyArgs...)...).Scan(&jobID, &scheduleAt, &returnedData)
 		if err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("failed to update job slot for path '%s'", path)
+			if isUniqueViolation(err) {
+				// A concurrent push with the same key committed first
+				existing, err := jq.findPushedJob(jq.conn.QueryRow, pushOpts.idempotencyKey)
+				if err == nil && existing == nil {
+					err = fmt.Errorf("%w: idempotency key '%s' collided but no job holds it", ErrConflict, pushOpts.idempotencyKey)
+				}
+				return existing, err
+			}
+			return nil, fmt.Errorf("failed to update job slot for path '%s': %w", path, err)
 		}
 
 		// Commit transaction
 		if err := tx.Commit(); err != nil {
-			if attempt < maxRetries {
-				time.Sleep(retryDelay)
+			if attempt < maxRetries && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt)
 				continue
 			}
 			return nil, err
@@ -547,97 +925,347 @@ func (jq *KBJobQueue) PushJobData(path string, data map[string]interface{}, maxR
 		return &PushJobResult{
 			JobID:      int(jobID),
 			ScheduleAt: &scheduleAt,
+			Priority:   priority,
 			Data:       parsedData,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("could not acquire lock for path '%s' after %d attempts", path, maxRetries)
+	return nil, fmt.Errorf("%w: could not acquire lock for path '%s' after %d attempts", ErrConflict, path, maxRetries)
 }
 
-// ListPendingJobs lists all pending jobs for a path
-func (jq *KBJobQueue) ListPendingJobs(path string, limit *int, offset int) ([]JobRecord, error) {
+// ReclaimStaleJobs returns jobs that have been claimed for longer than timeout
+// to the pending state, invalidating their claim tokens
+func (jq *KBJobQueue) ReclaimStaleJobs(path string, timeout time.Duration) (int, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("%w: timeout must be positive", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, data
-		FROM %s
+		UPDATE %s
+		SET is_active = FALSE,
+			claimed_at = NULL,
+			claim_token = NULL
 		WHERE path = $1
 		AND valid = TRUE
-		AND is_active = FALSE
-		ORDER BY schedule_at ASC
+		AND is_active = TRUE
+		AND claimed_at < NOW() - make_interval(secs => $2::float8)
 	`, jq.BaseTable)
 
-	params := []interface{}{path}
-	paramCount := 1
+	result, err := jq.conn.Exec(query, path, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error reclaiming stale jobs for path '%s': %w", path, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
 
-	if limit != nil && *limit > 0 {
-		paramCount++
-		query += fmt.Sprintf(" LIMIT $%d", paramCount)
-		params = append(params, *limit)
+// MoveJob moves the pending job jobID to toJobPath in a single transaction. The
+// job keeps its id and data; its path is re-pointed and its claim state reset.
+// To keep each path's slot count fixed, a free slot at toJobPath is handed back
+// to the job's old path in the same transaction. MoveJob fails if the job is
+// active or not queued, if toJobPath has no job slots, or if none is free.
+// Moving a job to its current path is a no-op.
+func (jq *KBJobQueue) MoveJob(jobID int, toJobPath string) (err error) {
+	defer mapStatementTimeoutTo(&err)
+	if toJobPath == "" {
+		return fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
-	if offset > 0 {
-		paramCount++
-		query += fmt.Sprintf(" OFFSET $%d", paramCount)
-		params = append(params, offset)
+	tx, err := jq.begin()
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	var fromPath string
+	var valid, isActive bool
+	lockQuery := fmt.Sprintf("SELECT path, valid, is_active FROM %s WHERE id = $1 FOR UPDATE", jq.BaseTable)
+	err = tx.QueryRow(lockQuery, jobID).Scan(&fromPath, &valid, &isActive)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: job with id %d not found", ErrNotFound, jobID)
+	}
+	if err != nil {
+		return fmt.Errorf("error locking job %d: %w", jobID, err)
+	}
+	if !valid {
+		return fmt.Errorf("%w: job %d is not queued", ErrConflict, jobID)
+	}
+	if isActive {
+		return fmt.Errorf("%w: job %d is active and cannot be moved", ErrConflict, jobID)
+	}
+	if fromPath == toJobPath {
+		return nil
+	}
+
+	var exists bool
+	existsQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE path = $1)", jq.BaseTable)
+	if err := tx.QueryRow(existsQuery, toJobPath).Scan(&exists); err != nil {
+		return fmt.Errorf("error checking job path '%s': %w", toJobPath, err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: job path '%s' does not exist", ErrNotFound, toJobPath)
+	}
+
+	var slotID int
+	slotQuery := fmt.Sprintf(`
+		SELECT id
+		FROM %s
+		WHERE path = $1
+		AND valid = FALSE
+		ORDER BY completed_at ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, jq.BaseTable)
+	err = tx.QueryRow(slotQuery, toJobPath).Scan(&slotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: no available job slot for path '%s'", ErrQueueFull, toJobPath)
+	}
+	if err != nil {
+		return fmt.Errorf("error finding available job slot: %w", err)
+	}
+
+	moveQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET path = $2,
+			is_active = FALSE,
+			claimed_at = NULL,
+			claim_token = NULL
+		WHERE id = $1
+	`, jq.BaseTable)
+	if _, err := tx.Exec(moveQuery, jobID, toJobPath); err != nil {
+		return fmt.Errorf("error moving job %d to '%s': %w", jobID, toJobPath, err)
+	}
+
+	slotUpdate := fmt.Sprintf("UPDATE %s SET path = $2 WHERE id = $1", jq.BaseTable)
+	if _, err := tx.Exec(slotUpdate, slotID, fromPath); err != nil {
+		return fmt.Errorf("error returning slot %d to '%s': %w", slotID, fromPath, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// WatchJobQueue delivers jobs for path as they become available, claiming each
+// with PeakJobData before it is sent so a job goes to exactly one subscriber even
+// when several watch the same path. It wakes on the job table's notify trigger and
+// also polls every WatchPollInterval, which picks up missed notifications, jobs
+// whose schedule_at comes due and jobs reclaimed after VisibilityTimeout. A job
+// claimed but not yet received when ctx is cancelled is returned to the queue.
+// The returned channel is closed when ctx is cancelled. Errors claiming or
+// releasing a job are reported to Logger and the watch carries on.
+func (jq *KBJobQueue) WatchJobQueue(ctx context.Context, path string) (<-chan JobRecord, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	pollInterval := jq.WatchPollInterval
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+
+	listener, err := jq.KBSearch.newListener()
+	if err != nil {
+		return nil, err
+	}
+	if err := listener.Listen(jq.BaseTable); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error listening on channel '%s': %w", jq.BaseTable, err)
+	}
+
+	out := make(chan JobRecord)
+
+	go func() {
+		defer close(out)
+		defer listener.Close()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		// Check the connection periodically so a silent drop is noticed
+		pingTicker := time.NewTicker(90 * time.Second)
+		defer pingTicker.Stop()
+
+		for {
+			// Claim and deliver until the queue is drained
+			for ctx.Err() == nil {
+				job, err := jq.PeakJobData(path, 0, 0)
+				if err != nil {
+					jq.log().Errorf("failed to claim job for path '%s': %v", path, err)
+					break
+				}
+				if job == nil {
+					break
+				}
+				record := JobRecord{
+					ID:         job.ID,
+					Path:       path,
+					ScheduleAt: job.ScheduleAt,
+					StartedAt:  job.StartedAt,
+					IsActive:   true,
+					Valid:      true,
+					Priority:   job.Priority,
+					Data:       job.Data,
+					ClaimToken: job.ClaimToken,
+				}
+				select {
+				case out <- record:
+				case <-ctx.Done():
+					if err := jq.releaseJob(job.ID, job.ClaimToken); err != nil {
+						jq.log().Errorf("failed to return job to path '%s': %v", path, err)
+					}
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				if n != nil && n.Extra != path {
+					continue
+				}
+			case <-ticker.C:
+			case <-pingTicker.C:
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// releaseJob returns a job to the pending state if it is still held under
+// claimToken, leaving it alone once another worker has claimed it
+func (jq *KBJobQueue) releaseJob(jobID int, claimToken string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET is_active = FALSE,
+			claimed_at = NULL,
+			claim_token = NULL
+		WHERE id = $1
+		AND valid = TRUE
+		AND is_active = TRUE
+		AND claim_token = $2
+	`, jq.BaseTable)
+
+	if _, err := jq.conn.Exec(query, jobID, claimToken); err != nil {
+		return fmt.Errorf("error releasing job %d: %w", jobID, err)
+	}
+	return nil
+}
+
+// ListPendingJobs lists all pending jobs for a path
+func (jq *KBJobQueue) ListPendingJobs(path string, limit *int, offset int) ([]JobRecord, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	query, params := jq.pendingJobsQuery(path)
+	query, params = appendLimitOffset(query, params, limit, offset)
 
 	rows, err := jq.executeQuery(query, params...)
 	if err != nil {
-		return nil, fmt.Errorf("error listing pending jobs for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error listing pending jobs for path '%s': %w", path, err)
 	}
 
 	return mapToJobRecords(rows), nil
 }
 
-// ListActiveJobs lists all active jobs for a path
-func (jq *KBJobQueue) ListActiveJobs(path string, limit *int, offset int) ([]JobRecord, error) {
+// ListPendingJobsPage returns one page of pending jobs for a path together with the total
+// number of pending jobs, read from the same snapshot. A limit of zero or less
+// returns every job from offset on.
+func (jq *KBJobQueue) ListPendingJobsPage(path string, limit, offset int) ([]JobRecord, int, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	query, params := jq.pendingJobsQuery(path)
+	rows, total, err := queryPage(jq.conn, query, params, &limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing pending jobs for path '%s': %w", path, err)
 	}
 
+	return mapToJobRecords(rows), total, nil
+}
+
+// pendingJobsQuery returns the unpaged query and parameters listing pending jobs for a path
+func (jq *KBJobQueue) pendingJobsQuery(path string) (string, []interface{}) {
 	query := fmt.Sprintf(`
-		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, data
+		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, priority, data
 		FROM %s
 		WHERE path = $1
 		AND valid = TRUE
-		AND is_active = TRUE
-		ORDER BY started_at ASC
+		AND is_active = FALSE
+		ORDER BY priority DESC, schedule_at ASC
 	`, jq.BaseTable)
+	return query, []interface{}{path}
+}
 
-	params := []interface{}{path}
-	paramCount := 1
-
-	if limit != nil && *limit > 0 {
-		paramCount++
-		query += fmt.Sprintf(" LIMIT $%d", paramCount)
-		params = append(params, *limit)
+// ListActiveJobs lists all active jobs for a path
+func (jq *KBJobQueue) ListActiveJobs(path string, limit *int, offset int) ([]JobRecord, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
-	if offset > 0 {
-		paramCount++
-		query += fmt.Sprintf(" OFFSET $%d", paramCount)
-		params = append(params, offset)
-	}
+	query, params := jq.activeJobsQuery(path)
+	query, params = appendLimitOffset(query, params, limit, offset)
 
 	rows, err := jq.executeQuery(query, params...)
 	if err != nil {
-		return nil, fmt.Errorf("error listing active jobs for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error listing active jobs for path '%s': %w", path, err)
 	}
 
 	return mapToJobRecords(rows), nil
 }
 
+// ListActiveJobsPage returns one page of active jobs for a path together with the total
+// number of active jobs, read from the same snapshot. A limit of zero or less
+// returns every job from offset on.
+func (jq *KBJobQueue) ListActiveJobsPage(path string, limit, offset int) ([]JobRecord, int, error) {
+	if path == "" {
+		return nil, 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	query, params := jq.activeJobsQuery(path)
+	rows, total, err := queryPage(jq.conn, query, params, &limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing active jobs for path '%s': %w", path, err)
+	}
+
+	return mapToJobRecords(rows), total, nil
+}
+
+// activeJobsQuery returns the unpaged query and parameters listing active jobs for a path
+func (jq *KBJobQueue) activeJobsQuery(path string) (string, []interface{}) {
+	query := fmt.Sprintf(`
+		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, priority, data
+		FROM %s
+		WHERE path = $1
+		AND valid = TRUE
+		AND is_active = TRUE
+		ORDER BY started_at ASC
+	`, jq.BaseTable)
+	return query, []interface{}{path}
+}
+
 // ClearJobQueue clears all jobs for a given path
-func (jq *KBJobQueue) ClearJobQueue(path string) (*ClearQueueResult, error) {
+func (jq *KBJobQueue) ClearJobQueue(path string) (_ *ClearQueueResult, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	// Start transaction
-	tx, err := jq.conn.Begin()
+	tx, err := jq.begin()
 	if err != nil {
 		return nil, err
 	}
@@ -646,7 +1274,7 @@ func (jq *KBJobQueue) ClearJobQueue(path string) (*ClearQueueResult, error) {
 	_, err = tx.Exec(fmt.Sprintf("LOCK TABLE %s IN EXCLUSIVE MODE", jq.BaseTable))
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error acquiring table lock: %v", err)
+		return nil, fmt.Errorf("error acquiring table lock: %w", err)
 	}
 
 	// Update query
@@ -657,7 +1285,8 @@ func (jq *KBJobQueue) ClearJobQueue(path string) (*ClearQueueResult, error) {
 			completed_at = NOW(),
 			is_active = $1,
 			valid = $2,
-			data = $3
+			data = $3,
+			result = NULL
 		WHERE path = $4
 		RETURNING id, completed_at
 	`, jq.BaseTable)
@@ -665,7 +1294,7 @@ func (jq *KBJobQueue) ClearJobQueue(path string) (*ClearQueueResult, error) {
 	rows, err := tx.Query(updateQuery, false, false, "{}", path)
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error clearing jobs: %v", err)
+		return nil, fmt.Errorf("error clearing jobs: %w", err)
 	}
 	defer rows.Close()
 
@@ -690,7 +1319,7 @@ func (jq *KBJobQueue) ClearJobQueue(path string) (*ClearQueueResult, error) {
 // GetJobStatistics gets comprehensive statistics for jobs at a given path
 func (jq *KBJobQueue) GetJobStatistics(path string) (*JobStatistics, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -708,7 +1337,7 @@ func (jq *KBJobQueue) GetJobStatistics(path string) (*JobStatistics, error) {
 
 	result, err := jq.executeSingle(query, path)
 	if err != nil {
-		return nil, fmt.Errorf("error getting job statistics for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error getting job statistics for path '%s': %w", path, err)
 	}
 
 	if result == nil {
@@ -721,18 +1350,18 @@ func (jq *KBJobQueue) GetJobStatistics(path string) (*JobStatistics, error) {
 // GetJobByID retrieves a specific job by its ID
 func (jq *KBJobQueue) GetJobByID(jobID int) (*JobRecord, error) {
 	if jobID <= 0 {
-		return nil, fmt.Errorf("job_id must be a valid positive integer")
+		return nil, fmt.Errorf("%w: job_id must be a valid positive integer", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, data
+		SELECT id, path, schedule_at, started_at, completed_at, is_active, valid, priority, data
 		FROM %s
 		WHERE id = $1
 	`, jq.BaseTable)
 
 	result, err := jq.executeSingle(query, jobID)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving job with id %d: %v", jobID, err)
+		return nil, fmt.Errorf("error retrieving job with id %d: %w", jobID, err)
 	}
 
 	if result == nil {
@@ -747,6 +1376,34 @@ func (jq *KBJobQueue) GetJobByID(jobID int) (*JobRecord, error) {
 	return nil, nil
 }
 
+// GetJobResult returns the output stored by MarkJobCompletedWithResult, or nil
+// if the job was completed without one or has been reused since
+func (jq *KBJobQueue) GetJobResult(jobID int) (map[string]interface{}, error) {
+	if jobID <= 0 {
+		return nil, fmt.Errorf("%w: job_id must be a valid positive integer", ErrValidation)
+	}
+
+	query := fmt.Sprintf("SELECT result FROM %s WHERE id = $1", jq.BaseTable)
+
+	var raw []byte
+	err := jq.conn.QueryRow(query, jobID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no job found with id=%d", ErrNotFound, jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving result for job %d: %w", jobID, err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error decoding result for job %d: %w", jobID, err)
+	}
+	return result, nil
+}
+
 // Helper functions
 
 // mapToJobRecords converts maps to JobRecord slice
@@ -777,6 +1434,9 @@ func mapToJobRecords(rows []map[string]interface{}) []JobRecord {
 		if valid, ok := row["valid"].(bool); ok {
 			record.Valid = valid
 		}
+		if priority, ok := row["priority"].(int64); ok {
+			record.Priority = int(priority)
+		}
 
 		// Handle data field
 		if dataStr, ok := row["data"].(string); ok {
@@ -821,6 +1481,12 @@ func mapToJobStatistics(m map[string]interface{}) *JobStatistics {
 	return stats
 }
 
+// isUniqueViolation checks if an error is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 // isLockError checks if an error is a lock-related error
 func isLockError(err error) bool {
 	if err == nil {
@@ -0,0 +1,553 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupTestJobQueue creates a job table with the notify trigger and slots free slots for path
+func setupTestJobQueue(t *testing.T, path string, slots int) *KBJobQueue {
+	t.Helper()
+
+	kb := setupTestSearch(t, 0)
+	jq := NewKBJobQueue(kb, testDBTable)
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", jq.BaseTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			path LTREE,
+			schedule_at TIMESTAMPTZ DEFAULT NOW(),
+			started_at TIMESTAMPTZ DEFAULT NOW(),
+			completed_at TIMESTAMPTZ DEFAULT NOW(),
+			claimed_at TIMESTAMPTZ,
+			claim_token TEXT,
+			is_active BOOLEAN DEFAULT FALSE,
+			valid BOOLEAN DEFAULT FALSE,
+			priority INTEGER DEFAULT 0,
+			data JSONB,
+			result JSONB,
+			idempotency_key TEXT UNIQUE
+		)`, jq.BaseTable),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.valid AND NOT NEW.is_active THEN
+				PERFORM pg_notify(TG_TABLE_NAME, NEW.path::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql`, jq.BaseTable),
+		fmt.Sprintf(`CREATE TRIGGER %s_notify_trigger AFTER INSERT OR UPDATE ON %s
+			FOR EACH ROW EXECUTE FUNCTION %s_notify()`, jq.BaseTable, jq.BaseTable, jq.BaseTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing job table: %v", err)
+		}
+	}
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (path) VALUES ($1)", jq.BaseTable)
+	for i := 0; i < slots; i++ {
+		if _, err := kb.conn.Exec(insertQuery, path); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error allocating job slots: %v", err)
+		}
+	}
+
+	return jq
+}
+
+// TestPeakJobDataPriority verifies high priority jobs are dequeued before older low priority jobs
+func TestPeakJobDataPriority(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 4)
+	defer jq.KBSearch.Disconnect()
+
+	pushes := []struct {
+		name     string
+		priority int
+	}{
+		{"low1", 0},
+		{"low2", 0},
+		{"high", 10},
+		{"medium", 5},
+	}
+	for _, p := range pushes {
+		if _, err := jq.PushJobDataWithPriority("kb1.jobs", map[string]interface{}{"name": p.name}, p.priority, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing %s: %v", p.name, err)
+		}
+		// Keep schedule_at strictly increasing
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expected := []string{"high", "medium", "low1", "low2"}
+	for _, want := range expected {
+		job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Error peeking job: %v", err)
+		}
+		if job == nil {
+			t.Fatalf("Expected job %s, got none", want)
+		}
+		if job.Data["name"] != want {
+			t.Errorf("Expected job %s, got %v", want, job.Data["name"])
+		}
+	}
+}
+
+// TestPeakJobDataVisibilityTimeout verifies an uncompleted claim reappears after the timeout
+func TestPeakJobDataVisibilityTimeout(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 2)
+	defer jq.KBSearch.Disconnect()
+	jq.VisibilityTimeout = 200 * time.Millisecond
+
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"name": "job1"}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+
+	first, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond)
+	if err != nil || first == nil {
+		t.Fatalf("Expected to claim job, got %v, %v", first, err)
+	}
+
+	// Still claimed within the timeout
+	if job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond); err != nil || job != nil {
+		t.Fatalf("Expected no job while claimed, got %v, %v", job, err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	again, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond)
+	if err != nil || again == nil {
+		t.Fatalf("Expected job to reappear after timeout, got %v, %v", again, err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("Expected job %d to reappear, got %d", first.ID, again.ID)
+	}
+	if again.ClaimToken == first.ClaimToken {
+		t.Fatal("Expected the new claim to have a new token")
+	}
+
+	// The expired claim can neither release nor complete the re-claimed job
+	if err := jq.releaseJob(first.ID, first.ClaimToken); err != nil {
+		t.Fatalf("Error releasing job: %v", err)
+	}
+	if job, err := jq.GetJobByID(first.ID); err != nil || !job.IsActive {
+		t.Errorf("Expected the stale release to leave the job claimed, got %+v, %v", job, err)
+	}
+	if _, err := jq.MarkJobCompletedWithToken(first.ID, first.ClaimToken, nil, 3, 10*time.Millisecond); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected the stale claim token to be rejected with ErrConflict, got %v", err)
+	}
+	if _, err := jq.MarkJobCompletedWithToken(again.ID, "", nil, 3, 10*time.Millisecond); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected an empty claim token to be rejected with ErrValidation, got %v", err)
+	}
+	if _, err := jq.MarkJobCompletedWithToken(again.ID, again.ClaimToken, nil, 3, 10*time.Millisecond); err != nil {
+		t.Errorf("Error completing job with the current claim token: %v", err)
+	}
+}
+
+// TestReclaimStaleJobs verifies the sweep returns stale claims to pending
+func TestReclaimStaleJobs(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 2)
+	defer jq.KBSearch.Disconnect()
+
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"name": "job1"}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+	if job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond); err != nil || job == nil {
+		t.Fatalf("Expected to claim job, got %v, %v", job, err)
+	}
+
+	if count, err := jq.ReclaimStaleJobs("kb1.jobs", time.Hour); err != nil || count != 0 {
+		t.Errorf("Expected nothing reclaimed yet, got %d, %v", count, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	count, err := jq.ReclaimStaleJobs("kb1.jobs", 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error reclaiming jobs: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 job reclaimed, got %d", count)
+	}
+
+	if job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond); err != nil || job == nil {
+		t.Errorf("Expected reclaimed job to be claimable, got %v, %v", job, err)
+	}
+}
+
+// TestListPendingJobsPage walks the pending jobs page by page and checks the total stays constant
+func TestListPendingJobsPage(t *testing.T) {
+	const jobs = 5
+	jq := setupTestJobQueue(t, "kb1.jobs", jobs)
+	defer jq.KBSearch.Disconnect()
+
+	for i := 0; i < jobs; i++ {
+		if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing job: %v", err)
+		}
+	}
+
+	seen := map[int]bool{}
+	for offset := 0; offset < jobs+2; offset += 2 {
+		page, total, err := jq.ListPendingJobsPage("kb1.jobs", 2, offset)
+		if err != nil {
+			t.Fatalf("Error listing page at offset %d: %v", offset, err)
+		}
+		if total != jobs {
+			t.Errorf("Offset %d: expected total %d, got %d", offset, jobs, total)
+		}
+		for _, job := range page {
+			seen[job.ID] = true
+		}
+	}
+	if len(seen) != jobs {
+		t.Errorf("Expected to page through %d distinct jobs, saw %d", jobs, len(seen))
+	}
+
+	active, total, err := jq.ListActiveJobsPage("kb1.jobs", 2, 0)
+	if err != nil {
+		t.Fatalf("Error listing active jobs: %v", err)
+	}
+	if len(active) != 0 || total != 0 {
+		t.Errorf("Expected no active jobs, got %d of %d", len(active), total)
+	}
+}
+
+// TestMarkJobCompletedWithResult verifies a completion result is stored and cleared on reuse
+func TestMarkJobCompletedWithResult(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 1)
+	defer jq.KBSearch.Disconnect()
+
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"name": "job1"}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+	job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond)
+	if err != nil || job == nil {
+		t.Fatalf("Expected to claim job, got %v, %v", job, err)
+	}
+
+	result := map[string]interface{}{"status": "ok", "count": float64(3)}
+	if _, err := jq.MarkJobCompletedWithResult(job.ID, result, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error completing job: %v", err)
+	}
+	got, err := jq.GetJobResult(job.ID)
+	if err != nil {
+		t.Fatalf("Error reading job result: %v", err)
+	}
+	if !reflect.DeepEqual(got, result) {
+		t.Errorf("Expected result %v, got %v", result, got)
+	}
+
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"name": "job2"}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+	if got, err := jq.GetJobResult(job.ID); err != nil || got != nil {
+		t.Errorf("Expected reused slot to have no result, got %v, %v", got, err)
+	}
+
+	if _, err := jq.MarkJobCompleted(job.ID, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error completing job: %v", err)
+	}
+	if got, err := jq.GetJobResult(job.ID); err != nil || got != nil {
+		t.Errorf("Expected no result after MarkJobCompleted, got %v, %v", got, err)
+	}
+}
+
+// TestMarkJobsCompleted verifies a batch reports missing and already-completed ids
+func TestMarkJobsCompleted(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 3)
+	defer jq.KBSearch.Disconnect()
+
+	ids := []int{}
+	tokens := []string{}
+	for i := 0; i < 3; i++ {
+		if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing job: %v", err)
+		}
+		job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond)
+		if err != nil || job == nil {
+			t.Fatalf("Expected to claim job, got %v, %v", job, err)
+		}
+		ids = append(ids, job.ID)
+		tokens = append(tokens, job.ClaimToken)
+	}
+
+	if _, err := jq.MarkJobCompleted(ids[0], 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error completing job: %v", err)
+	}
+
+	batch := []int{ids[0], ids[1], 999999, ids[2]}
+	results, err := jq.MarkJobsCompletedWithTokens(batch, []string{tokens[0], "stale", "", tokens[2]}, 3, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error completing jobs: %v", err)
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("Expected %d results, got %d", len(batch), len(results))
+	}
+	for i, want := range []bool{false, false, false, true} {
+		if results[i].JobID != batch[i] || results[i].Success != want {
+			t.Errorf("Result %d: expected id %d success=%v, got %+v", i, batch[i], want, results[i])
+		}
+		if want != (results[i].CompletedAt != nil) {
+			t.Errorf("Result %d: CompletedAt should be set only on success, got %+v", i, results[i])
+		}
+	}
+
+	// Without tokens the held job is completed unchecked
+	results, err = jq.MarkJobsCompleted([]int{ids[1]}, 3, 10*time.Millisecond)
+	if err != nil || len(results) != 1 || !results[0].Success {
+		t.Errorf("Expected job %d completed without a token, got %+v, %v", ids[1], results, err)
+	}
+
+	if _, err := jq.MarkJobsCompleted([]int{ids[1], 0}, 3, 10*time.Millisecond); err == nil {
+		t.Error("Expected a non-positive id to be rejected")
+	}
+	if _, err := jq.MarkJobsCompletedWithTokens([]int{ids[1]}, []string{}, 3, 10*time.Millisecond); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected mismatched claim tokens to be rejected, got %v", err)
+	}
+}
+
+// TestGetQueueStats checks the snapshot counts against a known seeded state
+func TestGetQueueStats(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 5)
+	defer jq.KBSearch.Disconnect()
+
+	for i := 0; i < 3; i++ {
+		if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing job: %v", err)
+		}
+	}
+	if job, err := jq.PeakJobData("kb1.jobs", 3, 10*time.Millisecond); err != nil || job == nil {
+		t.Fatalf("Expected to claim job, got %v, %v", job, err)
+	}
+
+	stats, err := jq.GetQueueStats("kb1.jobs")
+	if err != nil {
+		t.Fatalf("Error reading queue stats: %v", err)
+	}
+	want := QueueStats{Queued: 3, Free: 2, Active: 1, Total: 5}
+	if stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	if stats.Queued+stats.Free != stats.Total {
+		t.Errorf("Expected queued+free to equal total, got %+v", stats)
+	}
+
+	queued, err := jq.GetQueuedNumber("kb1.jobs")
+	if err != nil || queued != want.Queued {
+		t.Errorf("Expected GetQueuedNumber %d, got %d, %v", want.Queued, queued, err)
+	}
+	free, err := jq.GetFreeNumber("kb1.jobs")
+	if err != nil || free != want.Free {
+		t.Errorf("Expected GetFreeNumber %d, got %d, %v", want.Free, free, err)
+	}
+}
+
+// TestWatchJobQueue verifies two subscribers on one path receive each job exactly once
+func TestWatchJobQueue(t *testing.T) {
+	const jobs = 10
+	jq := setupTestJobQueue(t, "kb1.jobs", jobs)
+	defer jq.KBSearch.Disconnect()
+	jq.WatchPollInterval = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := jq.WatchJobQueue(ctx, "kb1.jobs")
+	if err != nil {
+		t.Fatalf("Error watching job queue: %v", err)
+	}
+	second, err := jq.WatchJobQueue(ctx, "kb1.jobs")
+	if err != nil {
+		t.Fatalf("Error watching job queue: %v", err)
+	}
+
+	for i := 0; i < jobs; i++ {
+		if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": i}, 0, 0); err != nil {
+			t.Fatalf("Error pushing job %d: %v", i, err)
+		}
+	}
+
+	seen := map[int]int{}
+	timeout := time.After(10 * time.Second)
+	for received := 0; received < jobs; received++ {
+		select {
+		case job := <-first:
+			seen[job.ID]++
+		case job := <-second:
+			seen[job.ID]++
+		case <-timeout:
+			t.Fatalf("Timed out after %d of %d jobs", received, jobs)
+		}
+	}
+
+	// Give the watchers a few poll cycles to deliver any duplicate
+	select {
+	case job := <-first:
+		t.Errorf("Unexpected extra delivery of job %d", job.ID)
+	case job := <-second:
+		t.Errorf("Unexpected extra delivery of job %d", job.ID)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if len(seen) != jobs {
+		t.Errorf("Expected %d distinct jobs, got %d", jobs, len(seen))
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("Job %d delivered %d times", id, count)
+		}
+	}
+}
+
+// TestWatchJobQueueLogsErrors drops the job table under a watch and expects
+// the failed claims to reach the Logger
+func TestWatchJobQueueLogsErrors(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 1)
+	defer jq.KBSearch.Disconnect()
+	jq.WatchPollInterval = 20 * time.Millisecond
+	logger := &recordingLogger{}
+	jq.Logger = logger
+
+	if _, err := jq.conn.Exec(fmt.Sprintf("DROP TABLE %s CASCADE", jq.BaseTable)); err != nil {
+		t.Fatalf("Error dropping job table: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := jq.WatchJobQueue(ctx, "kb1.jobs"); err != nil {
+		t.Fatalf("Error watching job queue: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if lines := logger.lines(); len(lines) > 0 {
+			if !strings.Contains(lines[0], "failed to claim job for path 'kb1.jobs'") {
+				t.Errorf("Unexpected log line: %s", lines[0])
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("Expected the failed claim to be logged")
+}
+
+// TestMoveJob moves a pending job to another path and checks it is listed only
+// there, that slot counts are unchanged and that invalid moves are rejected
+func TestMoveJob(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 2)
+	defer jq.KBSearch.Disconnect()
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (path) VALUES ('kb1.other'), ('kb1.other')", jq.BaseTable)
+	if _, err := jq.conn.Exec(insertQuery); err != nil {
+		t.Fatalf("Error allocating job slots: %v", err)
+	}
+
+	pushed, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"task": "route"}, 0, 0)
+	if err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+
+	if err := jq.MoveJob(pushed.JobID, "kb1.missing"); err == nil {
+		t.Error("Expected moving to a path without slots to fail")
+	}
+	if err := jq.MoveJob(pushed.JobID, "kb1.other"); err != nil {
+		t.Fatalf("Error moving job: %v", err)
+	}
+
+	if jobs, err := jq.ListPendingJobs("kb1.jobs", nil, 0); err != nil || len(jobs) != 0 {
+		t.Errorf("Expected no pending jobs under kb1.jobs, got %v, %v", jobs, err)
+	}
+	jobs, err := jq.ListPendingJobs("kb1.other", nil, 0)
+	if err != nil {
+		t.Fatalf("Error listing jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != pushed.JobID || jobs[0].Data["task"] != "route" {
+		t.Errorf("Expected job %d under kb1.other, got %+v", pushed.JobID, jobs)
+	}
+
+	for _, path := range []string{"kb1.jobs", "kb1.other"} {
+		if stats, err := jq.GetQueueStats(path); err != nil || stats.Total != 2 {
+			t.Errorf("Expected %s to keep 2 slots, got %+v, %v", path, stats, err)
+		}
+	}
+
+	if _, err := jq.PeakJobData("kb1.other", 0, 0); err != nil {
+		t.Fatalf("Error claiming job: %v", err)
+	}
+	if err := jq.MoveJob(pushed.JobID, "kb1.jobs"); err == nil {
+		t.Error("Expected moving an active job to fail")
+	}
+}
+
+// TestPushJobDataIdempotencyKey verifies a repeated push with the same key
+// returns the original job and stores a single record
+func TestPushJobDataIdempotencyKey(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 3)
+	defer jq.KBSearch.Disconnect()
+
+	first, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 1}, 0, 0, WithIdempotencyKey("order-42"))
+	if err != nil {
+		t.Fatalf("Error pushing job: %v", err)
+	}
+	second, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 2}, 0, 0, WithIdempotencyKey("order-42"))
+	if err != nil {
+		t.Fatalf("Error repeating push: %v", err)
+	}
+	if second.JobID != first.JobID || second.Data["n"] != float64(1) {
+		t.Errorf("Expected the original job %d, got %+v", first.JobID, second)
+	}
+
+	if queued, err := jq.GetQueuedNumber("kb1.jobs"); err != nil || queued != 1 {
+		t.Errorf("Expected 1 queued job, got %d, %v", queued, err)
+	}
+
+	// Pushes without a key are never deduplicated
+	for i := 0; i < 2; i++ {
+		if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 3}, 0, 0); err != nil {
+			t.Fatalf("Error pushing job without key: %v", err)
+		}
+	}
+	if queued, err := jq.GetQueuedNumber("kb1.jobs"); err != nil || queued != 3 {
+		t.Errorf("Expected 3 queued jobs, got %d, %v", queued, err)
+	}
+}
+
+// TestJobIdempotencyKeyMigration pushes to a job table created without the
+// idempotency_key column, then adds it with MigrateIdempotencyKey
+func TestJobIdempotencyKeyMigration(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.jobs", 3)
+	defer jq.KBSearch.Disconnect()
+
+	if _, err := jq.conn.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN idempotency_key", jq.BaseTable)); err != nil {
+		t.Fatalf("Error dropping column: %v", err)
+	}
+
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 1}, 0, 0); err != nil {
+		t.Fatalf("Expected a push without a key to work on the old table, got %v", err)
+	}
+	if _, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 2}, 0, 0, WithIdempotencyKey("order-42")); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a keyed push to need the column, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := jq.MigrateIdempotencyKey(); err != nil {
+			t.Fatalf("Error migrating (run %d): %v", i, err)
+		}
+	}
+	first, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 2}, 0, 0, WithIdempotencyKey("order-42"))
+	if err != nil {
+		t.Fatalf("Error pushing keyed job after migrating: %v", err)
+	}
+	second, err := jq.PushJobData("kb1.jobs", map[string]interface{}{"n": 3}, 0, 0, WithIdempotencyKey("order-42"))
+	if err != nil || second.JobID != first.JobID {
+		t.Errorf("Expected the original job %d, got %+v, %v", first.JobID, second, err)
+	}
+}
@@ -54,6 +54,73 @@ func (kmt *KBLinkMountTable) FindRecordsByLinkName(linkName string, kb *string)
 	return kmt.fetchAllRowsAsDictionaries(rows)
 }
 
+// FindRecordsByLinkNameLike finds records whose link_name matches pattern
+// case-insensitively, optionally filtered by knowledge_base. pattern is as for
+// KBLinkTable.FindRecordsByLinkNameLike.
+func (kmt *KBLinkMountTable) FindRecordsByLinkNameLike(pattern string, kb *string) ([]map[string]interface{}, error) {
+	var query string
+	var args []interface{}
+
+	if kb == nil {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE link_name ILIKE $1 ESCAPE '\'
+			ORDER BY link_name
+		`, kmt.baseTable)
+		args = []interface{}{likePattern(pattern)}
+	} else {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE link_name ILIKE $1 ESCAPE '\' AND knowledge_base = $2
+			ORDER BY link_name
+		`, kmt.baseTable)
+		args = []interface{}{likePattern(pattern), *kb}
+	}
+
+	rows, err := kmt.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return kmt.fetchAllRowsAsDictionaries(rows)
+}
+
+// FindRecordsByMountPathMatch finds records whose mount_path matches the ltree
+// lquery expression, such as "kb1.mounts.*", optionally filtered by knowledge_base
+func (kmt *KBLinkMountTable) FindRecordsByMountPathMatch(lquery string, kb *string) ([]map[string]interface{}, error) {
+	var query string
+	var args []interface{}
+
+	if kb == nil {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE mount_path ~ $1::lquery
+			ORDER BY mount_path
+		`, kmt.baseTable)
+		args = []interface{}{lquery}
+	} else {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE mount_path ~ $1::lquery AND knowledge_base = $2
+			ORDER BY mount_path
+		`, kmt.baseTable)
+		args = []interface{}{lquery, *kb}
+	}
+
+	rows, err := kmt.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return kmt.fetchAllRows(rows)
+}
+
 // FindRecordsByMountPath finds records by mount_path, optionally filtered by knowledge_base
 func (kmt *KBLinkMountTable) FindRecordsByMountPath(mountPath string, kb *string) ([]map[string]interface{}, error) {
 	var query string
@@ -53,6 +53,41 @@ func (kt *KBLinkTable) FindRecordsByLinkName(linkName string, kb *string) ([]map
 	return kt.fetchAllRows(rows)
 }
 
+// FindRecordsByLinkNameLike finds records whose link_name matches pattern
+// case-insensitively, optionally filtered by knowledge_base. In pattern "*"
+// matches any run of characters and "?" a single character, as in
+// KBSearch.SearchNameLike; "%", "_" and backslash are matched literally.
+func (kt *KBLinkTable) FindRecordsByLinkNameLike(pattern string, kb *string) ([]map[string]interface{}, error) {
+	var query string
+	var args []interface{}
+
+	if kb == nil {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE link_name ILIKE $1 ESCAPE '\'
+			ORDER BY link_name, parent_path
+		`, kt.baseTable)
+		args = []interface{}{likePattern(pattern)}
+	} else {
+		query = fmt.Sprintf(`
+			SELECT *
+			FROM %s
+			WHERE link_name ILIKE $1 ESCAPE '\' AND parent_node_kb = $2
+			ORDER BY link_name, parent_path
+		`, kt.baseTable)
+		args = []interface{}{likePattern(pattern), *kb}
+	}
+
+	rows, err := kt.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return kt.fetchAllRows(rows)
+}
+
 // FindRecordsByNodePath finds records by node_path, optionally filtered by knowledge_base
 func (kt *KBLinkTable) FindRecordsByNodePath(nodePath string, kb *string) ([]map[string]interface{}, error) {
 	var query string
@@ -85,9 +120,22 @@ func (kt *KBLinkTable) FindRecordsByNodePath(nodePath string, kb *string) ([]map
 
 // FindAllLinkNames gets all unique link names from the table
 func (kt *KBLinkTable) FindAllLinkNames() ([]string, error) {
-	query := fmt.Sprintf("SELECT DISTINCT link_name FROM %s ORDER BY link_name", kt.baseTable)
-	
-	rows, err := kt.conn.Query(query)
+	return kt.FindAllLinkNamesInKB(nil)
+}
+
+// FindAllLinkNamesInKB gets all unique link names from the table, optionally filtered by knowledge_base
+func (kt *KBLinkTable) FindAllLinkNamesInKB(kb *string) ([]string, error) {
+	var query string
+	var args []interface{}
+
+	if kb == nil {
+		query = fmt.Sprintf("SELECT DISTINCT link_name FROM %s ORDER BY link_name", kt.baseTable)
+	} else {
+		query = fmt.Sprintf("SELECT DISTINCT link_name FROM %s WHERE parent_node_kb = $1 ORDER BY link_name", kt.baseTable)
+		args = []interface{}{*kb}
+	}
+
+	rows, err := kt.conn.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -112,9 +160,22 @@ func (kt *KBLinkTable) FindAllLinkNames() ([]string, error) {
 
 // FindAllNodeNames gets all unique node paths from the table
 func (kt *KBLinkTable) FindAllNodeNames() ([]string, error) {
-	query := fmt.Sprintf("SELECT DISTINCT parent_path FROM %s ORDER BY parent_path", kt.baseTable)
-	
-	rows, err := kt.conn.Query(query)
+	return kt.FindAllNodeNamesInKB(nil)
+}
+
+// FindAllNodeNamesInKB gets all unique node paths from the table, optionally filtered by knowledge_base
+func (kt *KBLinkTable) FindAllNodeNamesInKB(kb *string) ([]string, error) {
+	var query string
+	var args []interface{}
+
+	if kb == nil {
+		query = fmt.Sprintf("SELECT DISTINCT parent_path FROM %s ORDER BY parent_path", kt.baseTable)
+	} else {
+		query = fmt.Sprintf("SELECT DISTINCT parent_path FROM %s WHERE parent_node_kb = $1 ORDER BY parent_path", kt.baseTable)
+		args = []interface{}{*kb}
+	}
+
+	rows, err := kt.conn.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
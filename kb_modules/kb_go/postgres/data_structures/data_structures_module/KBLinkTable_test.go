@@ -0,0 +1,164 @@
+package data_structures_module
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestFindAllScopedByKB checks the kb filter of FindAllLinkNamesInKB and
+// FindAllNodeNamesInKB and that nil returns links from every knowledge base
+func TestFindAllScopedByKB(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	setupTestLinks(t, kb, map[string]string{
+		"link_a": "kb1.node1",
+		"link_b": "kb1.node2",
+		"link_c": "kb2.node1",
+	}, nil)
+	kt := NewKBLinkTable(kb.conn, testDBTable)
+
+	kb1, kb2, missing := "kb1", "kb2", "kb3"
+	linkCases := []struct {
+		kb   *string
+		want []string
+	}{
+		{&kb1, []string{"link_a", "link_b"}},
+		{&kb2, []string{"link_c"}},
+		{&missing, nil},
+		{nil, []string{"link_a", "link_b", "link_c"}},
+	}
+	for _, c := range linkCases {
+		got, err := kt.FindAllLinkNamesInKB(c.kb)
+		if err != nil {
+			t.Fatalf("Error finding link names: %v", err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FindAllLinkNamesInKB(%v): expected %v, got %v", c.kb, c.want, got)
+		}
+	}
+
+	nodeCases := []struct {
+		kb   *string
+		want []string
+	}{
+		{&kb1, []string{"kb1.node1", "kb1.node2"}},
+		{&kb2, []string{"kb2.node1"}},
+		{nil, []string{"kb1.node1", "kb1.node2", "kb2.node1"}},
+	}
+	for _, c := range nodeCases {
+		got, err := kt.FindAllNodeNamesInKB(c.kb)
+		if err != nil {
+			t.Fatalf("Error finding node names: %v", err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FindAllNodeNamesInKB(%v): expected %v, got %v", c.kb, c.want, got)
+		}
+	}
+
+	// The unscoped calls keep returning the union across knowledge bases
+	if got, err := kt.FindAllLinkNames(); err != nil || !reflect.DeepEqual(got, linkCases[3].want) {
+		t.Errorf("FindAllLinkNames(): expected %v, got %v (err %v)", linkCases[3].want, got, err)
+	}
+	if got, err := kt.FindAllNodeNames(); err != nil || !reflect.DeepEqual(got, nodeCases[2].want) {
+		t.Errorf("FindAllNodeNames(): expected %v, got %v (err %v)", nodeCases[2].want, got, err)
+	}
+}
+
+// linkColumn collects column from each record, sorted so results do not depend
+// on the database collation
+func linkColumn(records []map[string]interface{}, column string) []string {
+	var values []string
+	for _, record := range records {
+		values = append(values, fmt.Sprint(record[column]))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// TestFindRecordsByLinkNameLike checks prefix matching, literal underscores and
+// that the kb scope still applies on both link tables
+func TestFindRecordsByLinkNameLike(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	setupTestLinks(t, kb, map[string]string{
+		"link_a": "kb1.node1",
+		"Link_b": "kb1.node2",
+		"linkc":  "kb1.node3",
+		"link_d": "kb2.node1",
+	}, map[string]string{
+		"link_a": "kb1.mounts.a",
+		"linkc":  "kb1.mounts.c",
+		"link_d": "kb2.mounts.d",
+	})
+	kt := NewKBLinkTable(kb.conn, testDBTable)
+	kmt := NewKBLinkMountTable(kb.conn, testDBTable)
+
+	kb1 := "kb1"
+	cases := []struct {
+		pattern    string
+		kb         *string
+		links      []string
+		linkMounts []string
+	}{
+		{"link_*", nil, []string{"Link_b", "link_a", "link_d"}, []string{"link_a", "link_d"}},
+		{"link_*", &kb1, []string{"Link_b", "link_a"}, []string{"link_a"}},
+		{"link?", &kb1, []string{"linkc"}, []string{"linkc"}},
+		{"link%", nil, nil, nil},
+	}
+	for _, c := range cases {
+		records, err := kt.FindRecordsByLinkNameLike(c.pattern, c.kb)
+		if err != nil {
+			t.Fatalf("Error finding links: %v", err)
+		}
+		if got := linkColumn(records, "link_name"); !reflect.DeepEqual(got, c.links) {
+			t.Errorf("FindRecordsByLinkNameLike(%q, %v): expected %v, got %v", c.pattern, c.kb, c.links, got)
+		}
+
+		records, err = kmt.FindRecordsByLinkNameLike(c.pattern, c.kb)
+		if err != nil {
+			t.Fatalf("Error finding link mounts: %v", err)
+		}
+		if got := linkColumn(records, "link_name"); !reflect.DeepEqual(got, c.linkMounts) {
+			t.Errorf("link mount FindRecordsByLinkNameLike(%q, %v): expected %v, got %v", c.pattern, c.kb, c.linkMounts, got)
+		}
+	}
+}
+
+// TestFindRecordsByMountPathMatch checks lquery matching on mount_path and the kb scope
+func TestFindRecordsByMountPathMatch(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	setupTestLinks(t, kb, nil, map[string]string{
+		"mount_a": "kb1.mounts.a",
+		"mount_b": "kb1.mounts.b.deep",
+		"mount_c": "kb1.other",
+		"mount_d": "kb2.mounts.d",
+	})
+	kmt := NewKBLinkMountTable(kb.conn, testDBTable)
+
+	kb1 := "kb1"
+	cases := []struct {
+		lquery string
+		kb     *string
+		want   []string
+	}{
+		{"kb1.mounts.*", nil, []string{"kb1.mounts.a", "kb1.mounts.b.deep"}},
+		{"*.mounts.*{1}", nil, []string{"kb1.mounts.a", "kb2.mounts.d"}},
+		{"*.mounts.*{1}", &kb1, []string{"kb1.mounts.a"}},
+		{"kb3.*", nil, nil},
+	}
+	for _, c := range cases {
+		records, err := kmt.FindRecordsByMountPathMatch(c.lquery, c.kb)
+		if err != nil {
+			t.Fatalf("Error finding mounts: %v", err)
+		}
+		if got := linkColumn(records, "mount_path"); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FindRecordsByMountPathMatch(%q, %v): expected %v, got %v", c.lquery, c.kb, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Node is a typed row of the knowledge base table
+type Node struct {
+	ID            int64                  `json:"id"`
+	KnowledgeBase string                 `json:"knowledge_base"`
+	Label         string                 `json:"label"`
+	Name          string                 `json:"name"`
+	Path          string                 `json:"path"`
+	Properties    map[string]interface{} `json:"properties"`
+	Data          map[string]interface{} `json:"data"`
+	HasLink       bool                   `json:"has_link"`
+	HasLinkMount  bool                   `json:"has_link_mount"`
+	DeletedAt     *time.Time             `json:"deleted_at,omitempty"`
+}
+
+// ToMap converts the node to the map form returned by the untyped query methods.
+// properties and data are returned as JSON strings, matching the raw column values.
+// deleted_at is only present for soft-deleted nodes.
+func (n Node) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"id":             n.ID,
+		"knowledge_base": n.KnowledgeBase,
+		"label":          n.Label,
+		"name":           n.Name,
+		"path":           n.Path,
+		"properties":     jsonColumnString(n.Properties),
+		"data":           jsonColumnString(n.Data),
+		"has_link":       n.HasLink,
+		"has_link_mount": n.HasLinkMount,
+	}
+	if n.DeletedAt != nil {
+		m["deleted_at"] = *n.DeletedAt
+	}
+	return m
+}
+
+// NodesToMaps converts a slice of nodes to their map form
+func NodesToMaps(nodes []Node) []map[string]interface{} {
+	results := make([]map[string]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		results = append(results, n.ToMap())
+	}
+	return results
+}
+
+// jsonColumnString encodes a JSON column value, returning nil for a NULL column
+func jsonColumnString(value map[string]interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// scanNodes converts SQL rows to a slice of nodes, matching columns by name
+func scanNodes(rows *sql.Rows) ([]Node, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []Node{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePointers := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePointers...); err != nil {
+			return nil, err
+		}
+
+		node, err := nodeFromColumns(columns, values)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// nodeFromColumns builds a node from scanned column values; unknown columns are ignored
+func nodeFromColumns(columns []string, values []interface{}) (Node, error) {
+	var node Node
+	for i, col := range columns {
+		val := values[i]
+		if b, ok := val.([]byte); ok {
+			val = string(b)
+		}
+		if val == nil {
+			continue
+		}
+
+		switch col {
+		case "id":
+			id, ok := val.(int64)
+			if !ok {
+				return node, fmt.Errorf("unexpected type %T for column id", val)
+			}
+			node.ID = id
+		case "knowledge_base":
+			node.KnowledgeBase, _ = val.(string)
+		case "label":
+			node.Label, _ = val.(string)
+		case "name":
+			node.Name, _ = val.(string)
+		case "path":
+			node.Path, _ = val.(string)
+		case "properties":
+			if err := decodeJSONColumn(col, val, &node.Properties); err != nil {
+				return node, err
+			}
+		case "data":
+			if err := decodeJSONColumn(col, val, &node.Data); err != nil {
+				return node, err
+			}
+		case "has_link":
+			node.HasLink, _ = val.(bool)
+		case "has_link_mount":
+			node.HasLinkMount, _ = val.(bool)
+		case "deleted_at":
+			if deletedAt, ok := val.(time.Time); ok {
+				node.DeletedAt = &deletedAt
+			}
+		}
+	}
+	return node, nil
+}
+
+// decodeJSONMap unmarshals a scanned JSON column into target, leaving target
+// nil when the column is NULL. It is the same helper as kb_construct's
+// decodeJSONMap, whose tests cover it.
+func decodeJSONMap(raw []byte, target *map[string]interface{}) error {
+	if len(raw) == 0 {
+		*target = nil
+		return nil
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// decodeJSONColumn unmarshals a JSON column value into target
+func decodeJSONColumn(col string, val interface{}, target *map[string]interface{}) error {
+	s, ok := val.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for column %s", val, col)
+	}
+	if err := json.Unmarshal([]byte(s), target); err != nil {
+		return fmt.Errorf("error decoding column %s: %v", col, err)
+	}
+	return nil
+}
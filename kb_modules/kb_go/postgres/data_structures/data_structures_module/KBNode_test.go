@@ -0,0 +1,80 @@
+package data_structures_module
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestNodeFromColumns checks that scanned column values populate a typed node
+func TestNodeFromColumns(t *testing.T) {
+	columns := []string{"id", "knowledge_base", "label", "name", "properties", "data", "has_link", "has_link_mount", "path", "extra"}
+	values := []interface{}{
+		int64(7), "kb1", "KB_STATUS_FIELD", "status1",
+		[]byte(`{"description":"a status node"}`), []byte(`{"value":1}`),
+		true, false, []byte("kb1.header.status1"), "ignored",
+	}
+
+	node, err := nodeFromColumns(columns, values)
+	if err != nil {
+		t.Fatalf("Error building node: %v", err)
+	}
+
+	if node.ID != 7 || node.KnowledgeBase != "kb1" || node.Label != "KB_STATUS_FIELD" || node.Name != "status1" {
+		t.Errorf("Unexpected scalar fields: %+v", node)
+	}
+	if node.Path != "kb1.header.status1" {
+		t.Errorf("Expected path kb1.header.status1, got %s", node.Path)
+	}
+	if node.Properties["description"] != "a status node" {
+		t.Errorf("Unexpected properties: %v", node.Properties)
+	}
+	if node.Data["value"] != float64(1) {
+		t.Errorf("Unexpected data: %v", node.Data)
+	}
+	if !node.HasLink || node.HasLinkMount {
+		t.Errorf("Unexpected link flags: %+v", node)
+	}
+}
+
+// TestNodeFromColumnsNull checks that NULL JSON columns leave nil maps
+func TestNodeFromColumnsNull(t *testing.T) {
+	node, err := nodeFromColumns([]string{"id", "properties", "data"}, []interface{}{int64(1), nil, nil})
+	if err != nil {
+		t.Fatalf("Error building node: %v", err)
+	}
+	if node.Properties != nil || node.Data != nil {
+		t.Errorf("Expected nil maps, got %v and %v", node.Properties, node.Data)
+	}
+	if m := node.ToMap(); m["properties"] != nil || m["data"] != nil {
+		t.Errorf("Expected nil JSON columns in map, got %v", m)
+	}
+}
+
+// TestNodeToMap checks the map form matches the untyped row layout
+func TestNodeToMap(t *testing.T) {
+	node := Node{
+		ID:         3,
+		Path:       "kb1.a",
+		Properties: map[string]interface{}{"description": "desc"},
+	}
+	m := node.ToMap()
+
+	if id, ok := m["id"].(int64); !ok || id != 3 {
+		t.Errorf("Expected int64 id 3, got %v", m["id"])
+	}
+
+	props, ok := m["properties"].(string)
+	if !ok {
+		t.Fatalf("Expected properties as JSON string, got %T", m["properties"])
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(props), &decoded); err != nil || decoded["description"] != "desc" {
+		t.Errorf("Unexpected properties JSON %s: %v", props, err)
+	}
+
+	// The untyped helpers keep working on the converted map
+	kb := &KBSearch{}
+	if desc := kb.FindDescription(m); desc["kb1.a"] != "desc" {
+		t.Errorf("Expected description 'desc', got %v", desc)
+	}
+}
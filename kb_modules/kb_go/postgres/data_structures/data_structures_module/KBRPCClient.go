@@ -2,6 +2,7 @@ package data_structures_module
 
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -17,6 +18,12 @@ type KBRPCClient struct {
 	KBSearch  *KBSearch
 	conn      *sql.DB
 	BaseTable string
+	// ReplyPollInterval is how often WaitForReply checks for a reply; defaults to 100ms
+	ReplyPollInterval time.Duration
+	// ClaimTimeout makes a slot claimed by PushAndClaimReplyData count as free in
+	// FindFreeSlots, and be reused by PushAndClaimReplyData, once its reply has
+	// gone unread this long. Zero disables it; see also ReclaimTimedOut.
+	ClaimTimeout time.Duration
 }
 
 // ReplyData represents a reply data record
@@ -48,6 +55,11 @@ func NewKBRPCClient(kbSearch *KBSearch, database string) *KBRPCClient {
 	}
 }
 
+// begin starts a transaction under the KBSearch's StatementTimeout
+func (client *KBRPCClient) begin() (*sql.Tx, error) {
+	return beginWithTimeout(client.conn, client.KBSearch.StatementTimeout)
+}
+
 // FindRPCClientID finds a single RPC client id for given parameters
 func (client *KBRPCClient) FindRPCClientID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
 	results, err := client.FindRPCClientIDs(kb, nodeName, properties, nodePath)
@@ -56,7 +68,7 @@ func (client *KBRPCClient) FindRPCClientID(kb *string, nodeName *string, propert
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no node found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
+		return nil, fmt.Errorf("%w: no node found matching path parameters: %v, %v, %v", ErrNotFound, nodeName, properties, nodePath)
 	}
 	if len(results) > 1 {
 		return nil, fmt.Errorf("multiple nodes found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
@@ -91,7 +103,7 @@ func (client *KBRPCClient) FindRPCClientIDs(kb *string, nodeName *string, proper
 	}
 
 	if len(nodeIDs) == 0 {
-		return nil, fmt.Errorf("no node found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
+		return nil, fmt.Errorf("%w: no node found matching path parameters: %v, %v, %v", ErrNotFound, nodeName, properties, nodePath)
 	}
 
 	return nodeIDs, nil
@@ -113,19 +125,20 @@ func (client *KBRPCClient) FindFreeSlots(clientPath string) (int, error) {
 	query := fmt.Sprintf(`
 		SELECT 
 			COUNT(*) as total_records,
-			COUNT(*) FILTER (WHERE is_new_result = FALSE) as free_slots
+			COUNT(*) FILTER (WHERE is_new_result = FALSE
+				OR ($2::float8 > 0 AND claimed_at < NOW() - make_interval(secs => $2::float8))) as free_slots
 		FROM %s 
 		WHERE client_path = $1
 	`, client.BaseTable)
 
 	var totalRecords, freeSlots int
-	err := client.conn.QueryRow(query, clientPath).Scan(&totalRecords, &freeSlots)
+	err := client.conn.QueryRow(query, clientPath, client.ClaimTimeout.Seconds()).Scan(&totalRecords, &freeSlots)
 	if err != nil {
-		return 0, fmt.Errorf("database error when finding free slots: %v", err)
+		return 0, fmt.Errorf("database error when finding free slots: %w", err)
 	}
 
 	if totalRecords == 0 {
-		return 0, fmt.Errorf("no records found for client_path: %s", clientPath)
+		return 0, fmt.Errorf("%w: no records found for client_path: %s", ErrNotFound, clientPath)
 	}
 
 	return freeSlots, nil
@@ -144,18 +157,19 @@ func (client *KBRPCClient) FindQueuedSlots(clientPath string) (int, error) {
 	var totalRecords, queuedSlots int
 	err := client.conn.QueryRow(query, clientPath).Scan(&totalRecords, &queuedSlots)
 	if err != nil {
-		return 0, fmt.Errorf("database error when finding queued slots: %v", err)
+		return 0, fmt.Errorf("database error when finding queued slots: %w", err)
 	}
 
 	if totalRecords == 0 {
-		return 0, fmt.Errorf("no records found for client_path: %s", clientPath)
+		return 0, fmt.Errorf("%w: no records found for client_path: %s", ErrNotFound, clientPath)
 	}
 
 	return queuedSlots, nil
 }
 
 // PeakAndClaimReplyData atomically fetches and marks the next available reply as processed
-func (client *KBRPCClient) PeakAndClaimReplyData(clientPath string, maxRetries int, retryDelay time.Duration) (*ReplyData, error) {
+func (client *KBRPCClient) PeakAndClaimReplyData(clientPath string, maxRetries int, retryDelay time.Duration) (_ *ReplyData, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if maxRetries <= 0 {
 		maxRetries = 3
 	}
@@ -165,14 +179,15 @@ func (client *KBRPCClient) PeakAndClaimReplyData(clientPath string, maxRetries i
 
 	attempt := 0
 	for attempt < maxRetries {
-		tx, err := client.conn.Begin()
+		tx, err := client.begin()
 		if err != nil {
-			return nil, fmt.Errorf("failed to begin transaction: %v", err)
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		updateQuery := fmt.Sprintf(`
 			UPDATE %s
-			SET is_new_result = FALSE
+			SET is_new_result = FALSE,
+				claimed_at = NULL
 			WHERE id = (
 				SELECT id
 				FROM %s
@@ -254,11 +269,12 @@ func (client *KBRPCClient) PeakAndClaimReplyData(clientPath string, maxRetries i
 		return mapToReplyData(result), nil
 	}
 
-	return nil, fmt.Errorf("could not lock a new-reply row after %d attempts", maxRetries)
+	return nil, fmt.Errorf("%w: could not lock a new-reply row after %d attempts", ErrConflict, maxRetries)
 }
 
 // ClearReplyQueue clears the reply queue by resetting records matching the specified client path
-func (client *KBRPCClient) ClearReplyQueue(clientPath string, maxRetries int, retryDelay time.Duration) (int, error) {
+func (client *KBRPCClient) ClearReplyQueue(clientPath string, maxRetries int, retryDelay time.Duration) (_ int, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if maxRetries <= 0 {
 		maxRetries = 3
 	}
@@ -268,9 +284,9 @@ func (client *KBRPCClient) ClearReplyQueue(clientPath string, maxRetries int, re
 
 	attempt := 0
 	for attempt < maxRetries {
-		tx, err := client.conn.Begin()
+		tx, err := client.begin()
 		if err != nil {
-			return 0, fmt.Errorf("failed to begin transaction: %v", err)
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		// Select and lock records
@@ -318,7 +334,8 @@ func (client *KBRPCClient) ClearReplyQueue(clientPath string, maxRetries int, re
 				server_path        = $2,
 				response_payload   = $3,
 				response_timestamp = NOW(),
-				is_new_result      = FALSE
+				is_new_result      = FALSE,
+				claimed_at         = NULL
 			WHERE id = $4
 		`, client.BaseTable)
 
@@ -343,12 +360,13 @@ func (client *KBRPCClient) ClearReplyQueue(clientPath string, maxRetries int, re
 		return updated, nil
 	}
 
-	return 0, fmt.Errorf("could not acquire lock after %d retries", maxRetries)
+	return 0, fmt.Errorf("%w: could not acquire lock after %d retries", ErrConflict, maxRetries)
 }
 
 // PushAndClaimReplyData atomically claims and updates the earliest matching record
 func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, serverPath, rpcAction, 
-	transactionTag string, replyData map[string]interface{}, maxRetries int, retryDelay time.Duration) error {
+	transactionTag string, replyData map[string]interface{}, maxRetries int, retryDelay time.Duration) (err error) {
+	defer mapStatementTimeoutTo(&err)
 	
 	if maxRetries <= 0 {
 		maxRetries = 3
@@ -359,12 +377,12 @@ func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, server
 
 	replyJSON, err := json.Marshal(replyData)
 	if err != nil {
-		return fmt.Errorf("failed to marshal reply data: %v", err)
+		return fmt.Errorf("%w: failed to marshal reply data: %w", ErrValidation, err)
 	}
 
 	var lastError error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
-		tx, err := client.conn.Begin()
+		tx, err := client.begin()
 		if err != nil {
 			lastError = err
 			continue
@@ -375,7 +393,8 @@ func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, server
 				SELECT id
 				FROM %s
 				WHERE client_path = $1
-				AND is_new_result = FALSE
+				AND (is_new_result = FALSE
+					OR ($7::float8 > 0 AND claimed_at < NOW() - make_interval(secs => $7::float8)))
 				ORDER BY response_timestamp ASC
 				FOR UPDATE SKIP LOCKED
 				LIMIT 1
@@ -387,7 +406,8 @@ func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, server
 				transaction_tag   = $5,
 				response_payload  = $6,
 				is_new_result     = TRUE,
-				response_timestamp = CURRENT_TIMESTAMP
+				response_timestamp = CURRENT_TIMESTAMP,
+				claimed_at        = CURRENT_TIMESTAMP
 			FROM candidate
 			WHERE %s.id = candidate.id
 			RETURNING %s.id
@@ -395,12 +415,12 @@ func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, server
 
 		var id int
 		err = tx.QueryRow(query, clientPath, requestUUID, serverPath, rpcAction, 
-			transactionTag, string(replyJSON)).Scan(&id)
+			transactionTag, string(replyJSON), client.ClaimTimeout.Seconds()).Scan(&id)
 		
 		if err != nil {
 			tx.Rollback()
 			if err == sql.ErrNoRows {
-				lastError = fmt.Errorf("no available record with is_new_result=FALSE found")
+				lastError = fmt.Errorf("%w: no available record with is_new_result=FALSE found", ErrQueueFull)
 			} else {
 				lastError = err
 			}
@@ -424,7 +444,102 @@ func (client *KBRPCClient) PushAndClaimReplyData(clientPath, requestUUID, server
 		return nil
 	}
 
-	return fmt.Errorf("failed after %d retries: %v", maxRetries, lastError)
+	return retriesExhausted(fmt.Sprintf("failed after %d retries", maxRetries), lastError)
+}
+
+// ReclaimTimedOut frees the slots of clientPath whose reply has gone unread for
+// longer than timeout, so a reply that is never collected does not hold its
+// slot forever. It returns the number of slots freed.
+func (client *KBRPCClient) ReclaimTimedOut(clientPath string, timeout time.Duration) (int, error) {
+	if clientPath == "" {
+		return 0, fmt.Errorf("%w: client path cannot be empty", ErrValidation)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("%w: timeout must be positive", ErrValidation)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET is_new_result = FALSE,
+			claimed_at = NULL
+		WHERE client_path = $1
+		AND is_new_result = TRUE
+		AND claimed_at < NOW() - make_interval(secs => $2::float8)
+	`, client.BaseTable)
+
+	result, err := client.conn.Exec(query, clientPath, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error reclaiming timed out slots for client path '%s': %w", clientPath, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// WaitForReply blocks until the reply for requestID arrives on clientPath, claims it and
+// returns its payload. Replies for other request IDs are left untouched. It returns
+// ctx.Err() if ctx is cancelled first, and an error matching both ErrTimeout and
+// context.DeadlineExceeded if ctx expires.
+func (client *KBRPCClient) WaitForReply(ctx context.Context, clientPath, requestID string) (map[string]interface{}, error) {
+	if clientPath == "" {
+		return nil, fmt.Errorf("%w: client path cannot be empty", ErrValidation)
+	}
+	if _, err := uuid.Parse(requestID); err != nil {
+		return nil, fmt.Errorf("%w: invalid request id '%s': %w", ErrValidation, requestID, err)
+	}
+
+	pollInterval := client.ReplyPollInterval
+	if pollInterval <= 0 {
+		pollInterval = 100 * time.Millisecond
+	}
+
+	claimQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET is_new_result = FALSE,
+			claimed_at = NULL
+		WHERE id = (
+			SELECT id
+			FROM %s
+			WHERE client_path = $1
+			AND request_id = $2
+			AND is_new_result = TRUE
+			ORDER BY response_timestamp ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING response_payload
+	`, client.BaseTable, client.BaseTable)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		var payloadStr string
+		err := client.conn.QueryRowContext(ctx, claimQuery, clientPath, requestID).Scan(&payloadStr)
+		if err == nil {
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
+				return nil, fmt.Errorf("error decoding reply payload for request '%s': %w", requestID, err)
+			}
+			return payload, nil
+		}
+		if err != sql.ErrNoRows {
+			if ctx.Err() != nil {
+				return nil, contextError(ctx)
+			}
+			return nil, fmt.Errorf("error waiting for reply to request '%s': %w", requestID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, contextError(ctx)
+		case <-ticker.C:
+		}
+	}
 }
 
 // ListWaitingJobs lists all rows where is_new_result is TRUE
@@ -453,7 +568,7 @@ func (client *KBRPCClient) ListWaitingJobs(clientPath *string) ([]ReplyData, err
 
 	rows, err := client.conn.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("database error when listing waiting jobs: %v", err)
+		return nil, fmt.Errorf("database error when listing waiting jobs: %w", err)
 	}
 	defer rows.Close()
 
@@ -0,0 +1,148 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// setupTestRPCClient creates an RPC client table with slots free reply slots for clientPath
+func setupTestRPCClient(t *testing.T, clientPath string, slots int) *KBRPCClient {
+	t.Helper()
+
+	kb := setupTestSearch(t, 0)
+	client := NewKBRPCClient(kb, testDBTable)
+	client.ReplyPollInterval = 10 * time.Millisecond
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", client.BaseTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			request_id UUID NOT NULL,
+			client_path ltree NOT NULL,
+			server_path ltree NOT NULL,
+			transaction_tag TEXT NOT NULL DEFAULT 'none',
+			rpc_action TEXT NOT NULL DEFAULT 'none',
+			response_payload JSONB NOT NULL,
+			response_timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			is_new_result BOOLEAN NOT NULL DEFAULT FALSE,
+			claimed_at TIMESTAMPTZ
+		)`, client.BaseTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing rpc client table: %v", err)
+		}
+	}
+
+	insertQuery := fmt.Sprintf(`INSERT INTO %s (request_id, client_path, server_path, response_payload)
+		VALUES ($1, $2, $2, '{}')`, client.BaseTable)
+	for i := 0; i < slots; i++ {
+		if _, err := kb.conn.Exec(insertQuery, uuid.New().String(), clientPath); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error allocating reply slots: %v", err)
+		}
+	}
+
+	return client
+}
+
+// TestWaitForReply verifies the matching reply is returned and other replies are left alone
+func TestWaitForReply(t *testing.T) {
+	client := setupTestRPCClient(t, "kb1.client", 4)
+	defer client.KBSearch.Disconnect()
+
+	wanted := uuid.New().String()
+	other := uuid.New().String()
+
+	if err := client.PushAndClaimReplyData("kb1.client", other, "kb1.server", "action", "tag",
+		map[string]interface{}{"for": "other"}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error pushing other reply: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.PushAndClaimReplyData("kb1.client", wanted, "kb1.server", "action", "tag",
+			map[string]interface{}{"for": "wanted"}, 3, 10*time.Millisecond)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload, err := client.WaitForReply(ctx, "kb1.client", wanted)
+	if err != nil {
+		t.Fatalf("Error waiting for reply: %v", err)
+	}
+	if payload["for"] != "wanted" {
+		t.Errorf("Expected wanted reply, got %v", payload)
+	}
+
+	waiting, err := client.ListWaitingJobs(nil)
+	if err != nil {
+		t.Fatalf("Error listing waiting jobs: %v", err)
+	}
+	if len(waiting) != 1 || waiting[0].RequestID != other {
+		t.Errorf("Expected only the other reply to remain, got %+v", waiting)
+	}
+}
+
+// TestWaitForReplyTimeout verifies the wait ends when the context expires
+func TestWaitForReplyTimeout(t *testing.T) {
+	client := setupTestRPCClient(t, "kb1.client", 1)
+	defer client.KBSearch.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.WaitForReply(ctx, "kb1.client", uuid.New().String()); !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestReclaimTimedOut verifies unread replies past the claim timeout free their slots
+func TestReclaimTimedOut(t *testing.T) {
+	client := setupTestRPCClient(t, "kb1.client", 2)
+	defer client.KBSearch.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		if err := client.PushAndClaimReplyData("kb1.client", uuid.New().String(), "kb1.server", "action", "tag",
+			map[string]interface{}{"n": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing reply: %v", err)
+		}
+	}
+	if free, err := client.FindFreeSlots("kb1.client"); err != nil || free != 0 {
+		t.Fatalf("Expected no free slots, got %d, %v", free, err)
+	}
+
+	if count, err := client.ReclaimTimedOut("kb1.client", time.Hour); err != nil || count != 0 {
+		t.Errorf("Expected nothing reclaimed before the timeout, got %d, %v", count, err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	client.ClaimTimeout = 100 * time.Millisecond
+	if free, err := client.FindFreeSlots("kb1.client"); err != nil || free != 2 {
+		t.Errorf("Expected timed out slots to count as free, got %d, %v", free, err)
+	}
+	client.ClaimTimeout = 0
+
+	count, err := client.ReclaimTimedOut("kb1.client", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error reclaiming slots: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 slots reclaimed, got %d", count)
+	}
+	if free, err := client.FindFreeSlots("kb1.client"); err != nil || free != 2 {
+		t.Errorf("Expected 2 free slots after reclaiming, got %d, %v", free, err)
+	}
+	if err := client.PushAndClaimReplyData("kb1.client", uuid.New().String(), "kb1.server", "action", "tag",
+		map[string]interface{}{"n": 3}, 3, 10*time.Millisecond); err != nil {
+		t.Errorf("Expected a reclaimed slot to accept a push, got %v", err)
+	}
+}
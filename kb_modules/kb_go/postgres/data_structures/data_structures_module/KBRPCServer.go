@@ -1,8 +1,10 @@
 package data_structures_module
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"regexp"
@@ -13,7 +15,8 @@ import (
 	"github.com/lib/pq"
 )
 
-// NoMatchingRecordError represents when no matching record is found
+// NoMatchingRecordError represents when no matching record is found. It is
+// returned when the RPC queue has no empty record left, so it matches ErrQueueFull.
 type NoMatchingRecordError struct {
 	Message string
 }
@@ -22,11 +25,24 @@ func (e *NoMatchingRecordError) Error() string {
 	return e.Message
 }
 
+// Unwrap lets errors.Is match ErrQueueFull
+func (e *NoMatchingRecordError) Unwrap() error {
+	return ErrQueueFull
+}
+
 // KBRPCServer handles RPC server operations for the knowledge base
 type KBRPCServer struct {
 	KBSearch  *KBSearch
 	conn      *sql.DB
 	BaseTable string
+	// PeekPollInterval is the fallback poll interval for PeekBlocking; defaults to 1s
+	PeekPollInterval time.Duration
+	// MaxQueueDepth caps the pending (new_job) records per server path that
+	// PushRPCQueue will accept; zero means unlimited
+	MaxQueueDepth int
+	// Observer receives the latency of PushRPCQueue and PeakServerQueue and the
+	// pending job count after each; nil disables metrics
+	Observer Observer
 }
 
 // RPCRecord represents a single RPC record
@@ -61,6 +77,11 @@ func NewKBRPCServer(kbSearch *KBSearch, database string) *KBRPCServer {
 	}
 }
 
+// begin starts a transaction under the KBSearch's StatementTimeout
+func (rpc *KBRPCServer) begin() (*sql.Tx, error) {
+	return beginWithTimeout(rpc.conn, rpc.KBSearch.StatementTimeout)
+}
+
 // FindRPCServerID finds a single RPC server id for given parameters
 func (rpc *KBRPCServer) FindRPCServerID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
 	results, err := rpc.FindRPCServerIDs(kb, nodeName, properties, nodePath)
@@ -69,7 +90,7 @@ func (rpc *KBRPCServer) FindRPCServerID(kb *string, nodeName *string, properties
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no node found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
+		return nil, fmt.Errorf("%w: no node found matching path parameters: %v, %v, %v", ErrNotFound, nodeName, properties, nodePath)
 	}
 	if len(results) > 1 {
 		return nil, fmt.Errorf("multiple nodes found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
@@ -104,7 +125,7 @@ func (rpc *KBRPCServer) FindRPCServerIDs(kb *string, nodeName *string, propertie
 	}
 
 	if len(nodeIDs) == 0 {
-		return nil, fmt.Errorf("no node found matching path parameters: %v, %v, %v", nodeName, properties, nodePath)
+		return nil, fmt.Errorf("%w: no node found matching path parameters: %v, %v, %v", ErrNotFound, nodeName, properties, nodePath)
 	}
 
 	return nodeIDs, nil
@@ -125,13 +146,13 @@ func (rpc *KBRPCServer) FindRPCServerTableKeys(keyData []map[string]interface{})
 func (rpc *KBRPCServer) ListJobsJobTypes(serverPath string, state string) ([]map[string]interface{}, error) {
 	// Validate server_path
 	if serverPath == "" || !rpc.isValidLTree(serverPath) {
-		return nil, fmt.Errorf("server_path must be a non-empty valid ltree string (e.g., 'root.node1')")
+		return nil, fmt.Errorf("%w: server_path must be a non-empty valid ltree string (e.g., 'root.node1')", ErrValidation)
 	}
 
 	// Validate state
 	allowedStates := map[string]bool{"empty": true, "new_job": true, "processing": true}
 	if !allowedStates[state] {
-		return nil, fmt.Errorf("state must be one of: empty, new_job, processing")
+		return nil, fmt.Errorf("%w: state must be one of: empty, new_job, processing", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -144,7 +165,7 @@ func (rpc *KBRPCServer) ListJobsJobTypes(serverPath string, state string) ([]map
 
 	rows, err := rpc.conn.Query(query, serverPath, state)
 	if err != nil {
-		return nil, fmt.Errorf("database error in list_jobs_job_types: %v", err)
+		return nil, fmt.Errorf("database error in list_jobs_job_types: %w", err)
 	}
 	defer rows.Close()
 
@@ -156,27 +177,59 @@ func (rpc *KBRPCServer) ListJobsJobTypes(serverPath string, state string) ([]map
 	return results, nil
 }
 
-// CountAllJobs counts all jobs by state for a server path
-func (rpc *KBRPCServer) CountAllJobs(serverPath string) (*JobCounts, error) {
-	emptyJobs, err := rpc.CountEmptyJobs(serverPath)
-	if err != nil {
-		return nil, err
+// rpcJobStates lists every state a server queue record can be in
+var rpcJobStates = []string{"empty", "new_job", "processing", "completed_job"}
+
+// CountJobsByStatus counts the jobs in every state for a server path with a single
+// GROUP BY query. States with no jobs are present with a zero count.
+func (rpc *KBRPCServer) CountJobsByStatus(serverPath string) (map[string]int, error) {
+	if serverPath == "" || !rpc.isValidLTree(serverPath) {
+		return nil, fmt.Errorf("%w: server_path must be a valid ltree format (e.g., 'root.node1.node2')", ErrValidation)
 	}
 
-	newJobs, err := rpc.CountNewJobs(serverPath)
+	query := fmt.Sprintf(`
+		SELECT state, COUNT(*) AS job_count
+		FROM %s
+		WHERE server_path = $1::ltree
+		GROUP BY state
+	`, rpc.BaseTable)
+
+	rows, err := rpc.conn.Query(query, serverPath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("database error in count_jobs_by_status: %w", err)
 	}
+	defer rows.Close()
 
-	processingJobs, err := rpc.CountProcessingJobs(serverPath)
+	counts := make(map[string]int, len(rpcJobStates))
+	for _, state := range rpcJobStates {
+		counts[state] = 0
+	}
+	for rows.Next() {
+		var state string
+		var count int
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, fmt.Errorf("database error in count_jobs_by_status: %w", err)
+		}
+		counts[state] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error in count_jobs_by_status: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountAllJobs counts all jobs by state for a server path
+func (rpc *KBRPCServer) CountAllJobs(serverPath string) (*JobCounts, error) {
+	counts, err := rpc.CountJobsByStatus(serverPath)
 	if err != nil {
 		return nil, err
 	}
 
 	return &JobCounts{
-		EmptyJobs:      emptyJobs,
-		NewJobs:        newJobs,
-		ProcessingJobs: processingJobs,
+		EmptyJobs:      counts["empty"],
+		NewJobs:        counts["new_job"],
+		ProcessingJobs: counts["processing"],
 	}, nil
 }
 
@@ -197,73 +250,127 @@ func (rpc *KBRPCServer) CountEmptyJobs(serverPath string) (int, error) {
 
 // CountJobsJobTypes counts jobs by type for a server path
 func (rpc *KBRPCServer) CountJobsJobTypes(serverPath string, state string) (int, error) {
-	if serverPath == "" || !rpc.isValidLTree(serverPath) {
-		return 0, fmt.Errorf("server_path must be a valid ltree format (e.g., 'root.node1.node2')")
-	}
-
 	validStates := map[string]bool{"empty": true, "new_job": true, "processing": true, "completed_job": true}
 	if !validStates[state] {
-		return 0, fmt.Errorf("state must be one of: empty, new_job, processing, completed_job")
+		return 0, fmt.Errorf("%w: state must be one of: empty, new_job, processing, completed_job", ErrValidation)
 	}
 
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) AS job_count
-		FROM %s
-		WHERE server_path = $1::ltree
-		  AND state = $2
-	`, rpc.BaseTable)
-
-	var count int
-	err := rpc.conn.QueryRow(query, serverPath, state).Scan(&count)
+	counts, err := rpc.CountJobsByStatus(serverPath)
 	if err != nil {
-		return 0, fmt.Errorf("database error in count_jobs_job_types: %v", err)
+		return 0, err
 	}
 
-	return count, nil
+	return counts[state], nil
 }
 
-// PushRPCQueue pushes a request to the RPC queue
-func (rpc *KBRPCServer) PushRPCQueue(serverPath, requestID, rpcAction string, requestPayload map[string]interface{},
-	transactionTag string, priority int, rpcClientQueue *string, maxRetries int, waitTime time.Duration) (map[string]interface{}, error) {
-
-	// Validate server_path
-	if serverPath == "" || !rpc.isValidLTree(serverPath) {
-		return nil, fmt.Errorf("server_path must be a valid ltree format (e.g. 'root.node1.node2')")
-	}
+// RPCRequest is one request enqueued by PushBatch
+type RPCRequest struct {
+	// RequestID must be a UUID; empty assigns a new one
+	RequestID      string
+	RPCAction      string
+	RequestPayload map[string]interface{}
+	TransactionTag string
+	Priority       int
+	// RPCClientQueue is the ltree path replies go to; nil for none
+	RPCClientQueue *string
+}
 
+// prepare validates req, assigns a request ID when absent and returns the
+// payload as JSON
+func (rpc *KBRPCServer) prepare(req *RPCRequest) ([]byte, error) {
 	// Validate request_id (UUID)
-	if requestID == "" {
-		requestID = uuid.New().String()
+	if req.RequestID == "" {
+		req.RequestID = uuid.New().String()
 	} else {
-		if _, err := uuid.Parse(requestID); err != nil {
-			return nil, fmt.Errorf("request_id must be a valid UUID string or empty")
+		if _, err := uuid.Parse(req.RequestID); err != nil {
+			return nil, fmt.Errorf("%w: request_id must be a valid UUID string or empty", ErrValidation)
 		}
 	}
 
 	// Validate rpc_action
-	if rpcAction == "" {
-		return nil, fmt.Errorf("rpc_action must be a non-empty string")
+	if req.RPCAction == "" {
+		return nil, fmt.Errorf("%w: rpc_action must be a non-empty string", ErrValidation)
 	}
 
 	// Validate request_payload
-	if requestPayload == nil {
-		return nil, fmt.Errorf("request_payload cannot be nil")
+	if req.RequestPayload == nil {
+		return nil, fmt.Errorf("%w: request_payload cannot be nil", ErrValidation)
 	}
 
 	// Validate transaction_tag
-	if transactionTag == "" {
-		return nil, fmt.Errorf("transaction_tag must be a non-empty string")
+	if req.TransactionTag == "" {
+		return nil, fmt.Errorf("%w: transaction_tag must be a non-empty string", ErrValidation)
 	}
 
 	// Validate rpc_client_queue
-	if rpcClientQueue != nil && (*rpcClientQueue == "" || !rpc.isValidLTree(*rpcClientQueue)) {
-		return nil, fmt.Errorf("rpc_client_queue must be nil or a valid ltree format")
+	if req.RPCClientQueue != nil && (*req.RPCClientQueue == "" || !rpc.isValidLTree(*req.RPCClientQueue)) {
+		return nil, fmt.Errorf("%w: rpc_client_queue must be nil or a valid ltree format", ErrValidation)
 	}
 
 	// Convert payload to JSON
-	payloadJSON, err := json.Marshal(requestPayload)
+	payloadJSON, err := json.Marshal(req.RequestPayload)
 	if err != nil {
-		return nil, fmt.Errorf("request_payload must be JSON-serializable: %v", err)
+		return nil, fmt.Errorf("%w: request_payload must be JSON-serializable: %w", ErrValidation, err)
+	}
+	return payloadJSON, nil
+}
+
+// PushRPCQueue pushes a request to the RPC queue. When MaxQueueDepth is set the
+// push fails with ErrQueueFull once the server path holds that many pending jobs.
+func (rpc *KBRPCServer) PushRPCQueue(serverPath, requestID, rpcAction string, requestPayload map[string]interface{},
+	transactionTag string, priority int, rpcClientQueue *string, maxRetries int, waitTime time.Duration) (record map[string]interface{}, err error) {
+	defer rpc.observe("PushRPCQueue", serverPath, time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
+	records, err := rpc.pushBatch(serverPath, []RPCRequest{{
+		RequestID:      requestID,
+		RPCAction:      rpcAction,
+		RequestPayload: requestPayload,
+		TransactionTag: transactionTag,
+		Priority:       priority,
+		RPCClientQueue: rpcClientQueue,
+	}}, maxRetries, waitTime)
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// PushBatch enqueues requests on serverPath in one transaction, so either all
+// are queued or none are. Requests without a RequestID are assigned one; the
+// caller's slice is not modified. The records are returned in request order.
+// The batch fails with NoMatchingRecordError when there are fewer empty slots
+// than requests, and with ErrQueueFull when it would take the server path past
+// MaxQueueDepth pending jobs.
+func (rpc *KBRPCServer) PushBatch(serverPath string, requests []RPCRequest) (records []map[string]interface{}, err error) {
+	defer rpc.observe("PushBatch", serverPath, time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
+	return rpc.pushBatch(serverPath, requests, 0, 0)
+}
+
+// pushBatch validates requests and enqueues them, retrying serialization
+// failures up to maxRetries times with exponential backoff from waitTime
+func (rpc *KBRPCServer) pushBatch(serverPath string, requests []RPCRequest, maxRetries int, waitTime time.Duration) ([]map[string]interface{}, error) {
+	// Validate server_path
+	if serverPath == "" || !rpc.isValidLTree(serverPath) {
+		return nil, fmt.Errorf("%w: server_path must be a valid ltree format (e.g. 'root.node1.node2')", ErrValidation)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%w: requests cannot be empty", ErrValidation)
+	}
+
+	requests = append([]RPCRequest(nil), requests...)
+	payloads := make([][]byte, len(requests))
+	for i := range requests {
+		payload, err := rpc.prepare(&requests[i])
+		if err != nil {
+			if len(requests) > 1 {
+				return nil, fmt.Errorf("request %d: %w", i, err)
+			}
+			return nil, err
+		}
+		payloads[i] = payload
 	}
 
 	if maxRetries <= 0 {
@@ -277,108 +384,153 @@ func (rpc *KBRPCServer) PushRPCQueue(serverPath, requestID, rpcAction string, re
 	attempt := 0
 
 	for attempt < maxRetries {
-		tx, err := rpc.conn.Begin()
+		records, err := rpc.pushBatchTx(serverPath, requests, payloads)
 		if err != nil {
-			return nil, fmt.Errorf("failed to begin transaction: %v", err)
-		}
-
-		// Set isolation level
-		_, err = tx.Exec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE")
-		if err != nil {
-			tx.Rollback()
+			if isSerializationError(err) && attempt < maxRetries-1 {
+				attempt++
+				sleepTime := minDuration(waitTime*time.Duration(1<<uint(attempt)), maxWait)
+				time.Sleep(sleepTime)
+				continue
+			}
 			return nil, err
 		}
+		return records, nil
+	}
 
-		// Acquire advisory lock
-		h := fnv.New32a()
-		h.Write([]byte(fmt.Sprintf("%s:%s", rpc.BaseTable, serverPath)))
-		lockKey := int64(h.Sum32())
-		
-		_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey)
-		if err != nil {
-			tx.Rollback()
-			return nil, err
-		}
+	return nil, fmt.Errorf("%w: failed to push to RPC queue after %d retries", ErrConflict, maxRetries)
+}
 
-		// Find earliest empty record
-		findQuery := fmt.Sprintf(`
-			SELECT id FROM %s
-			WHERE state = 'empty'
-			ORDER BY priority DESC, request_timestamp ASC
-			LIMIT 1
-			FOR UPDATE
+// pushBatchTx makes one attempt at pushBatch: under the server path lock it
+// claims an empty record per request and fills them in a serializable
+// transaction. Serialization failures are returned unwrapped so the caller can
+// retry them.
+func (rpc *KBRPCServer) pushBatchTx(serverPath string, requests []RPCRequest, payloads [][]byte) ([]map[string]interface{}, error) {
+	tx, err := rpc.begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Set isolation level
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"); err != nil {
+		return nil, err
+	}
+
+	// Acquire advisory lock
+	h := fnv.New32a()
+	h.Write([]byte(fmt.Sprintf("%s:%s", rpc.BaseTable, serverPath)))
+	lockKey := int64(h.Sum32())
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return nil, err
+	}
+
+	// Enforce the queue depth while holding the server path lock
+	if rpc.MaxQueueDepth > 0 {
+		depthQuery := fmt.Sprintf(`
+			SELECT COUNT(*) FROM %s
+			WHERE server_path = $1::ltree
+			  AND state = 'new_job'
 		`, rpc.BaseTable)
 
-		var recordID int
-		err = tx.QueryRow(findQuery).Scan(&recordID)
-		if err != nil {
-			tx.Rollback()
-			if err == sql.ErrNoRows {
-				return nil, &NoMatchingRecordError{Message: "No matching record found with state = 'empty'"}
-			}
-			return nil, err
+		var depth int
+		if err := tx.QueryRow(depthQuery, serverPath).Scan(&depth); err != nil {
+			return nil, fmt.Errorf("failed to read queue depth: %w", err)
+		}
+		if depth+len(requests) > rpc.MaxQueueDepth {
+			return nil, fmt.Errorf("%w: %s holds %d pending jobs", ErrQueueFull, serverPath, depth)
 		}
+	}
 
-		// Update the record
-		updateQuery := fmt.Sprintf(`
-			UPDATE %s
-			SET server_path = $1,
-				request_id = $2,
-				rpc_action = $3,
-				request_payload = $4,
-				transaction_tag = $5,
-				priority = $6,
-				rpc_client_queue = $7,
-				state = 'new_job',
-				request_timestamp = NOW() AT TIME ZONE 'UTC',
-				completed_timestamp = NULL
-			WHERE id = $8
-			RETURNING *
-		`, rpc.BaseTable)
+	// Find the earliest empty records, one per request
+	findQuery := fmt.Sprintf(`
+		SELECT id FROM %s
+		WHERE state = 'empty'
+		ORDER BY priority DESC, request_timestamp ASC
+		LIMIT $1
+		FOR UPDATE
+	`, rpc.BaseTable)
+
+	rows, err := tx.Query(findQuery, len(requests))
+	if err != nil {
+		return nil, err
+	}
+	var recordIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recordIDs = append(recordIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(recordIDs) == 0 {
+		return nil, &NoMatchingRecordError{Message: "No matching record found with state = 'empty'"}
+	}
+	if len(recordIDs) < len(requests) {
+		return nil, &NoMatchingRecordError{Message: fmt.Sprintf("Only %d records found with state = 'empty' for %d requests", len(recordIDs), len(requests))}
+	}
+
+	// Update the records
+	updateQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET server_path = $1,
+			request_id = $2,
+			rpc_action = $3,
+			request_payload = $4,
+			transaction_tag = $5,
+			priority = $6,
+			rpc_client_queue = $7,
+			state = 'new_job',
+			request_timestamp = NOW() AT TIME ZONE 'UTC',
+			completed_timestamp = NULL
+		WHERE id = $8
+		RETURNING *
+	`, rpc.BaseTable)
 
-		rows, err := tx.Query(updateQuery, serverPath, requestID, rpcAction, string(payloadJSON),
-			transactionTag, priority, rpcClientQueue, recordID)
+	records := make([]map[string]interface{}, 0, len(requests))
+	for i, req := range requests {
+		rows, err := tx.Query(updateQuery, serverPath, req.RequestID, req.RPCAction, string(payloads[i]),
+			req.TransactionTag, req.Priority, req.RPCClientQueue, recordIDs[i])
 		if err != nil {
-			tx.Rollback()
-			if isSerializationError(err) && attempt < maxRetries-1 {
-				attempt++
-				sleepTime := minDuration(waitTime*time.Duration(1<<uint(attempt)), maxWait)
-				time.Sleep(sleepTime)
-				continue
+			if isSerializationError(err) {
+				return nil, err
 			}
-			return nil, fmt.Errorf("failed to update record: %v", err)
+			return nil, fmt.Errorf("failed to update record: %w", err)
 		}
-		defer rows.Close()
-
 		results, err := rowsToMaps(rows)
+		rows.Close()
 		if err != nil {
-			tx.Rollback()
 			return nil, err
 		}
-
 		if len(results) == 0 {
-			tx.Rollback()
 			return nil, fmt.Errorf("failed to update record in RPC queue")
 		}
+		records = append(records, results[0])
+	}
 
-		if err := tx.Commit(); err != nil {
-			if isSerializationError(err) && attempt < maxRetries-1 {
-				attempt++
-				sleepTime := minDuration(waitTime*time.Duration(1<<uint(attempt)), maxWait)
-				time.Sleep(sleepTime)
-				continue
-			}
-			return nil, err
-		}
-
-		return results[0], nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+	return records, nil
+}
 
-	return nil, fmt.Errorf("failed to push to RPC queue after %d retries", maxRetries)
+// observe reports an RPC queue operation to the Observer, followed by the
+// pending job count of serverPath when it succeeded
+func (rpc *KBRPCServer) observe(op, serverPath string, start time.Time, err *error) {
+	observeOp(rpc.Observer, op, start, err)
+	observeDepth(rpc.Observer, "rpc_server", serverPath, *err, rpc.CountNewJobs)
 }
 
 // PeakServerQueue finds and processes one pending record from the server queue
-func (rpc *KBRPCServer) PeakServerQueue(serverPath string, retries int, waitTime time.Duration) (map[string]interface{}, error) {
+func (rpc *KBRPCServer) PeakServerQueue(serverPath string, retries int, waitTime time.Duration) (record map[string]interface{}, err error) {
+	defer rpc.observe("PeakServerQueue", serverPath, time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
 	if retries <= 0 {
 		retries = 5
 	}
@@ -388,9 +540,9 @@ func (rpc *KBRPCServer) PeakServerQueue(serverPath string, retries int, waitTime
 
 	attempt := 0
 	for attempt < retries {
-		tx, err := rpc.conn.Begin()
+		tx, err := rpc.begin()
 		if err != nil {
-			return nil, fmt.Errorf("failed to begin transaction: %v", err)
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		_, err = tx.Exec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE")
@@ -449,7 +601,7 @@ func (rpc *KBRPCServer) PeakServerQueue(serverPath string, retries int, waitTime
 				time.Sleep(waitTime * time.Duration(1<<uint(attempt)))
 				continue
 			}
-			return nil, fmt.Errorf("failed to update state to 'processing': %v", err)
+			return nil, fmt.Errorf("failed to update state to 'processing': %w", err)
 		}
 
 		if err := tx.Commit(); err != nil {
@@ -464,11 +616,64 @@ func (rpc *KBRPCServer) PeakServerQueue(serverPath string, retries int, waitTime
 		return record, nil
 	}
 
-	return nil, fmt.Errorf("failed to peak server queue after %d attempts", retries)
+	return nil, fmt.Errorf("%w: failed to peak server queue after %d attempts", ErrConflict, retries)
+}
+
+// PeekBlocking waits up to maxWait for a job on serverPath and claims it like PeakServerQueue.
+// It wakes on the queue's notify trigger and also polls every PeekPollInterval in case a
+// notification is missed. When maxWait passes it returns nil with no error; if ctx is
+// cancelled first it returns ctx.Err(), wrapped in ErrTimeout if ctx's deadline passed.
+func (rpc *KBRPCServer) PeekBlocking(ctx context.Context, serverPath string, maxWait time.Duration) (map[string]interface{}, error) {
+	record, err := rpc.PeakServerQueue(serverPath, 0, 0)
+	if err != nil || record != nil {
+		return record, err
+	}
+
+	pollInterval := rpc.PeekPollInterval
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+
+	listener, err := rpc.KBSearch.newListener()
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	// Without a listener we still make progress through polling
+	var notify <-chan *pq.Notification
+	if err := listener.Listen(rpc.BaseTable); err == nil {
+		notify = listener.Notify
+	}
+
+	deadline := time.NewTimer(maxWait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, contextError(ctx)
+		case <-deadline.C:
+			return nil, nil
+		case n := <-notify:
+			if n != nil && n.Extra != serverPath {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		record, err := rpc.PeakServerQueue(serverPath, 0, 0)
+		if err != nil || record != nil {
+			return record, err
+		}
+	}
 }
 
 // MarkJobCompletion marks a job as completed in the server queue
-func (rpc *KBRPCServer) MarkJobCompletion(serverPath string, id int, retries int, waitTime time.Duration) (bool, error) {
+func (rpc *KBRPCServer) MarkJobCompletion(serverPath string, id int, retries int, waitTime time.Duration) (_ bool, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if retries <= 0 {
 		retries = 5
 	}
@@ -478,9 +683,9 @@ func (rpc *KBRPCServer) MarkJobCompletion(serverPath string, id int, retries int
 
 	attempt := 0
 	for attempt < retries {
-		tx, err := rpc.conn.Begin()
+		tx, err := rpc.begin()
 		if err != nil {
-			return false, fmt.Errorf("failed to begin transaction: %v", err)
+			return false, fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		_, err = tx.Exec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE")
@@ -541,11 +746,12 @@ func (rpc *KBRPCServer) MarkJobCompletion(serverPath string, id int, retries int
 		return true, nil
 	}
 
-	return false, fmt.Errorf("failed to mark job as completed after %d attempts", retries)
+	return false, fmt.Errorf("%w: failed to mark job as completed after %d attempts", ErrConflict, retries)
 }
 
 // ClearServerQueue clears the reply queue by resetting records matching the specified server path
-func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retryDelay time.Duration) (int, error) {
+func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retryDelay time.Duration) (_ int, err error) {
+	defer mapStatementTimeoutTo(&err)
 	if maxRetries <= 0 {
 		maxRetries = 3
 	}
@@ -555,9 +761,9 @@ func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retr
 
 	retryCount := 0
 	for retryCount < maxRetries {
-		tx, err := rpc.conn.Begin()
+		tx, err := rpc.begin()
 		if err != nil {
-			return 0, fmt.Errorf("failed to begin transaction: %v", err)
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		// Try to lock records
@@ -575,7 +781,7 @@ func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retr
 				time.Sleep(retryDelay)
 				continue
 			}
-			return 0, fmt.Errorf("failed to acquire lock: %v", err)
+			return 0, fmt.Errorf("failed to acquire lock: %w", err)
 		}
 
 		// Update records
@@ -592,7 +798,7 @@ func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retr
 		result, err := tx.Exec(updateQuery, serverPath)
 		if err != nil {
 			tx.Rollback()
-			return 0, fmt.Errorf("failed to clear reply queue: %v", err)
+			return 0, fmt.Errorf("failed to clear reply queue: %w", err)
 		}
 
 		rowCount, err := result.RowsAffected()
@@ -608,7 +814,7 @@ func (rpc *KBRPCServer) ClearServerQueue(serverPath string, maxRetries int, retr
 		return int(rowCount), nil
 	}
 
-	return 0, fmt.Errorf("failed to acquire lock after %d attempts for server path: %s", maxRetries, serverPath)
+	return 0, fmt.Errorf("%w: failed to acquire lock after %d attempts for server path: %s", ErrConflict, maxRetries, serverPath)
 }
 
 // Helper methods
@@ -641,8 +847,8 @@ func isSerializationError(err error) bool {
 	if err == nil {
 		return false
 	}
-	pqErr, ok := err.(*pq.Error)
-	if !ok {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
 		return false
 	}
 	return pqErr.Code == "40001" || pqErr.Code == "40P01" // serialization_failure or deadlock_detected
@@ -0,0 +1,251 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupTestRPCServer creates an RPC server table with the notify trigger and empty slots for serverPath
+func setupTestRPCServer(t *testing.T, serverPath string, slots int) *KBRPCServer {
+	t.Helper()
+
+	kb := setupTestSearch(t, 0)
+	rpc := NewKBRPCServer(kb, testDBTable)
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", rpc.BaseTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			server_path LTREE NOT NULL,
+			request_id UUID NOT NULL DEFAULT gen_random_uuid(),
+			rpc_action TEXT NOT NULL DEFAULT 'none',
+			request_payload JSONB NOT NULL,
+			request_timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			transaction_tag TEXT NOT NULL,
+			state TEXT NOT NULL DEFAULT 'empty'
+				CHECK (state IN ('empty', 'new_job', 'processing')),
+			priority INTEGER NOT NULL DEFAULT 0,
+			processing_timestamp TIMESTAMPTZ DEFAULT NULL,
+			completed_timestamp TIMESTAMPTZ DEFAULT NULL,
+			rpc_client_queue LTREE
+		)`, rpc.BaseTable),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.state = 'new_job' THEN
+				PERFORM pg_notify(TG_TABLE_NAME, NEW.server_path::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql`, rpc.BaseTable),
+		fmt.Sprintf(`CREATE TRIGGER %s_notify_trigger AFTER INSERT OR UPDATE ON %s
+			FOR EACH ROW EXECUTE FUNCTION %s_notify()`, rpc.BaseTable, rpc.BaseTable, rpc.BaseTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing rpc server table: %v", err)
+		}
+	}
+
+	insertQuery := fmt.Sprintf(`INSERT INTO %s (server_path, request_payload, transaction_tag)
+		VALUES ($1, '{}', 'none')`, rpc.BaseTable)
+	for i := 0; i < slots; i++ {
+		if _, err := kb.conn.Exec(insertQuery, serverPath); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error allocating server slots: %v", err)
+		}
+	}
+
+	return rpc
+}
+
+// TestPeekBlocking verifies a job pushed mid-wait wakes the waiter
+func TestPeekBlocking(t *testing.T) {
+	rpc := setupTestRPCServer(t, "kb1.server", 2)
+	defer rpc.KBSearch.Disconnect()
+	// A long poll interval shows the wake-up came from the notification
+	rpc.PeekPollInterval = time.Minute
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		rpc.PushRPCQueue("kb1.server", "", "do_work", map[string]interface{}{"n": 1}, "tag1", 0, nil, 3, 10*time.Millisecond)
+	}()
+
+	start := time.Now()
+	record, err := rpc.PeekBlocking(context.Background(), "kb1.server", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Error peeking: %v", err)
+	}
+	if record == nil {
+		t.Fatal("Expected a job, got none")
+	}
+	if record["rpc_action"] != "do_work" {
+		t.Errorf("Expected do_work, got %v", record["rpc_action"])
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Errorf("Expected notification wake-up, waited %v", time.Since(start))
+	}
+}
+
+// TestPeekBlockingTimeout verifies an empty queue yields no job and no error
+func TestPeekBlockingTimeout(t *testing.T) {
+	rpc := setupTestRPCServer(t, "kb1.server", 1)
+	defer rpc.KBSearch.Disconnect()
+
+	record, err := rpc.PeekBlocking(context.Background(), "kb1.server", 100*time.Millisecond)
+	if err != nil || record != nil {
+		t.Errorf("Expected nil job and nil error on timeout, got %v, %v", record, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rpc.PeekBlocking(ctx, "kb1.server", time.Second); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestCountJobsByStatus verifies every state is reported and the counts sum to the job total
+func TestCountJobsByStatus(t *testing.T) {
+	const slots = 4
+	rpc := setupTestRPCServer(t, "kb1.server", slots)
+	defer rpc.KBSearch.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		if _, err := rpc.PushRPCQueue("kb1.server", "", "do_work", map[string]interface{}{"n": i}, "tag1", 0, nil, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing job: %v", err)
+		}
+	}
+	if _, err := rpc.PeakServerQueue("kb1.server", 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error claiming job: %v", err)
+	}
+
+	counts, err := rpc.CountJobsByStatus("kb1.server")
+	if err != nil {
+		t.Fatalf("Error counting jobs: %v", err)
+	}
+	for _, state := range rpcJobStates {
+		if _, ok := counts[state]; !ok {
+			t.Errorf("Expected state %s in counts", state)
+		}
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total != slots {
+		t.Errorf("Expected counts to sum to %d, got %d (%v)", slots, total, counts)
+	}
+	if counts["empty"] != 2 || counts["new_job"] != 1 || counts["processing"] != 1 || counts["completed_job"] != 0 {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+
+	all, err := rpc.CountAllJobs("kb1.server")
+	if err != nil {
+		t.Fatalf("Error counting all jobs: %v", err)
+	}
+	if all.EmptyJobs != counts["empty"] || all.NewJobs != counts["new_job"] || all.ProcessingJobs != counts["processing"] {
+		t.Errorf("CountAllJobs %+v disagrees with %v", all, counts)
+	}
+}
+
+// TestPushBatch enqueues three requests atomically and checks that a batch
+// with too few empty slots or an invalid request queues nothing
+func TestPushBatch(t *testing.T) {
+	rpc := setupTestRPCServer(t, "kb1.server", 4)
+	defer rpc.KBSearch.Disconnect()
+
+	clientQueue := "kb1.client"
+	explicitID := "1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+	requests := []RPCRequest{
+		{RPCAction: "first", RequestPayload: map[string]interface{}{"n": 1}, TransactionTag: "tag1"},
+		{RequestID: explicitID, RPCAction: "second", RequestPayload: map[string]interface{}{"n": 2}, TransactionTag: "tag1", RPCClientQueue: &clientQueue},
+		{RPCAction: "third", RequestPayload: map[string]interface{}{"n": 3}, TransactionTag: "tag1", Priority: 2},
+	}
+	records, err := rpc.PushBatch("kb1.server", requests)
+	if err != nil {
+		t.Fatalf("Error pushing batch: %v", err)
+	}
+	if len(records) != len(requests) {
+		t.Fatalf("Expected %d records, got %d", len(requests), len(records))
+	}
+	ids := map[interface{}]bool{}
+	for i, record := range records {
+		if record["rpc_action"] != requests[i].RPCAction || record["state"] != "new_job" {
+			t.Errorf("Record %d: expected %s as new_job, got %v", i, requests[i].RPCAction, record)
+		}
+		ids[record["request_id"]] = true
+	}
+	if len(ids) != 3 || records[1]["request_id"] != explicitID {
+		t.Errorf("Expected distinct request IDs keeping %s, got %v", explicitID, ids)
+	}
+	if requests[0].RequestID != "" {
+		t.Error("Expected the caller's requests to be left unchanged")
+	}
+
+	t.Run("TooFewSlots", func(t *testing.T) {
+		_, err := rpc.PushBatch("kb1.server", requests[:2])
+		var noMatch *NoMatchingRecordError
+		if !errors.As(err, &noMatch) {
+			t.Errorf("Expected NoMatchingRecordError, got %v", err)
+		}
+	})
+
+	t.Run("InvalidRequest", func(t *testing.T) {
+		invalid := []RPCRequest{requests[0], {RPCAction: "", RequestPayload: map[string]interface{}{}, TransactionTag: "tag1"}}
+		if _, err := rpc.PushBatch("kb1.server", invalid); err == nil {
+			t.Error("Expected a batch with an invalid request to fail")
+		}
+	})
+
+	if count, err := rpc.CountNewJobs("kb1.server"); err != nil || count != 3 {
+		t.Errorf("Expected only the first batch queued, got %d, %v", count, err)
+	}
+}
+
+// TestPushRPCQueueMaxDepth fires concurrent pushes past the cap and expects exactly the cap to succeed
+func TestPushRPCQueueMaxDepth(t *testing.T) {
+	const maxDepth = 3
+	const pushes = 8
+	rpc := setupTestRPCServer(t, "kb1.server", pushes)
+	defer rpc.KBSearch.Disconnect()
+	rpc.MaxQueueDepth = maxDepth
+
+	var wg sync.WaitGroup
+	errs := make(chan error, pushes)
+	for i := 0; i < pushes; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_, err := rpc.PushRPCQueue("kb1.server", "", "do_work", map[string]interface{}{"n": n}, "tag1", 0, nil, 10, 10*time.Millisecond)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrQueueFull):
+			t.Errorf("Expected ErrQueueFull, got %v", err)
+		}
+	}
+	if succeeded != maxDepth {
+		t.Errorf("Expected %d pushes to succeed, got %d", maxDepth, succeeded)
+	}
+
+	count, err := rpc.CountNewJobs("kb1.server")
+	if err != nil {
+		t.Fatalf("Error counting new jobs: %v", err)
+	}
+	if count != maxDepth {
+		t.Errorf("Expected %d queued jobs, got %d", maxDepth, count)
+	}
+}
@@ -1,12 +1,18 @@
 package data_structures_module
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	//"github.com/lib/pq"
+	"github.com/lib/pq"
 	//_ "github.com/lib/pq"
 )
 
@@ -30,38 +36,130 @@ type KBSearch struct {
 	Filters        []Filter
 	Results        []map[string]interface{}
 	PathValues     map[string]interface{}
-	conn           *sql.DB
+	// IncludeDeleted makes searches return soft-deleted nodes as well
+	IncludeDeleted bool
+	// StatementTimeout makes Postgres cancel searches, and the status and RPC
+	// transactions built on this KBSearch, that run longer than this, returning
+	// ErrStatementTimeout; zero leaves the connection's setting. The job queue
+	// and stream use it when their own StatementTimeout is zero.
+	StatementTimeout time.Duration
+	conn             *sql.DB
+	dsn              string   // connection string for notification listeners; built from the fields when empty
+	sharedConn       bool     // conn was injected and is not closed by Disconnect
+	closed           bool     // Disconnect was called; conn is kept so later queries fail instead of panicking
+	selectFields     []string // projection set by Select; nil returns whole rows
+	orderBy          []orderKey
+	deletedColumn    *deletedColumn // shared with clones, which search the same table
+}
+
+// orderKey is one sort key added by OrderBy
+type orderKey struct {
+	column string
+	asc    bool
+}
+
+// orderColumns are the node columns OrderBy accepts; properties and data are
+// JSON and have no ordering
+var orderColumns = map[string]bool{
+	"id":             true,
+	"knowledge_base": true,
+	"label":          true,
+	"name":           true,
+	"has_link":       true,
+	"has_link_mount": true,
+	"path":           true,
+	"deleted_at":     true,
 }
 
 // NewKBSearch creates a new KBSearch instance and connects to the database
 func NewKBSearch(host, port, dbname, user, password, database string) (*KBSearch, error) {
-	kb := &KBSearch{
+	kb := newKBSearch(database)
+	kb.Host = host
+	kb.Port = port
+	kb.DBName = dbname
+	kb.User = user
+	kb.Password = password
+
+	if err := kb.connect(); err != nil {
+		return nil, err
+	}
+
+	return kb, nil
+}
+
+// NewKBSearchFromURL creates a new KBSearch from a postgres:// URL or key=value
+// connection string, such as a DATABASE_URL
+func NewKBSearchFromURL(dsn, database string) (*KBSearch, error) {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	kb := newKBSearch(database)
+	kb.conn = conn
+	kb.dsn = dsn
+	return kb, nil
+}
+
+// NewKBSearchFromDB creates a new KBSearch on an existing connection pool. The
+// KBSearch does not take ownership of db: Disconnect leaves it open. A pool
+// carries no connection string, so the methods that LISTEN for notifications
+// fail until one is given with SetListenDSN.
+func NewKBSearchFromDB(db *sql.DB, database string) (*KBSearch, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db cannot be nil")
+	}
+
+	kb := newKBSearch(database)
+	kb.conn = db
+	kb.sharedConn = true
+	return kb, nil
+}
+
+// newKBSearch returns an unconnected KBSearch for the database tables
+func newKBSearch(database string) *KBSearch {
+	return &KBSearch{
 		Path:           []string{},
-		Host:           host,
-		Port:           port,
-		DBName:         dbname,
-		User:           user,
-		Password:       password,
 		BaseTable:      database,
 		LinkTable:      database + "_link",
 		LinkMountTable: database + "_link_mount",
 		Filters:        []Filter{},
 		PathValues:     make(map[string]interface{}),
+		deletedColumn:  &deletedColumn{},
 	}
+}
 
-	if err := kb.connect(); err != nil {
-		return nil, err
+// SetListenDSN sets the connection string used to open notification listeners,
+// for a KBSearch created with NewKBSearchFromDB
+func (kb *KBSearch) SetListenDSN(dsn string) {
+	kb.dsn = dsn
+}
+
+// connString returns the PostgreSQL connection string for this instance
+func (kb *KBSearch) connString() string {
+	if kb.dsn != "" {
+		return kb.dsn
 	}
+	return fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
+		kb.Host, kb.Port, kb.DBName, kb.User, kb.Password)
+}
 
-	return kb, nil
+// newListener returns a notification listener on its own connection. It fails
+// when kb wraps a pool with no connection string set.
+func (kb *KBSearch) newListener() (*pq.Listener, error) {
+	if kb.dsn == "" && kb.Host == "" {
+		return nil, fmt.Errorf("%w: no connection string for notifications; call SetListenDSN on a KBSearch created from a pool", ErrValidation)
+	}
+	return pq.NewListener(kb.connString(), 100*time.Millisecond, 10*time.Second, nil), nil
 }
 
 // connect establishes a connection to the PostgreSQL database
 func (kb *KBSearch) connect() error {
-	connStr := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
-		kb.Host, kb.Port, kb.DBName, kb.User, kb.Password)
-
-	conn, err := sql.Open("postgres", connStr)
+	conn, err := sql.Open("postgres", kb.connString())
 	if err != nil {
 		return fmt.Errorf("error connecting to database: %v", err)
 	}
@@ -75,26 +173,187 @@ func (kb *KBSearch) connect() error {
 	return nil
 }
 
-// Disconnect closes the database connection
+// Disconnect closes the database connection. It is safe to call more than
+// once; later calls return nil. A pool passed to NewKBSearchFromDB is released
+// but left open. The closed pool stays attached, so a query made after
+// Disconnect returns an error rather than dereferencing a nil connection.
 func (kb *KBSearch) Disconnect() error {
-	if kb.conn != nil {
-		return kb.conn.Close()
+	if kb.conn == nil || kb.closed {
+		return nil
+	}
+	kb.closed = true
+	if kb.sharedConn {
+		return nil
+	}
+	if err := kb.conn.Close(); err != nil {
+		return fmt.Errorf("error closing database connection: %v", err)
 	}
 	return nil
 }
 
+// Clone returns a copy of kb whose filters can be extended without affecting
+// kb, so several queries can branch from a shared base:
+//
+//	base.SearchKB("kb1")
+//	people, places := base.Clone(), base.Clone()
+//	people.SearchLabel("person")
+//	places.SearchLabel("place")
+//
+// The filters, their parameter maps, Path and PathValues are copied; Results
+// starts empty. The clone shares kb's *sql.DB: its Disconnect releases the
+// clone without closing the pool, and closing kb closes it for both.
+func (kb *KBSearch) Clone() *KBSearch {
+	clone := *kb
+	clone.sharedConn = true
+	clone.Results = nil
+
+	clone.Filters = make([]Filter, len(kb.Filters))
+	for i, filter := range kb.Filters {
+		params := make(map[string]interface{}, len(filter.Params))
+		for name, value := range filter.Params {
+			params[name] = value
+		}
+		clone.Filters[i] = Filter{Condition: filter.Condition, Params: params}
+	}
+
+	clone.Path = append([]string(nil), kb.Path...)
+	clone.selectFields = append([]string(nil), kb.selectFields...)
+	clone.orderBy = append([]orderKey(nil), kb.orderBy...)
+	clone.PathValues = make(map[string]interface{}, len(kb.PathValues))
+	for key, value := range kb.PathValues {
+		clone.PathValues[key] = value
+	}
+
+	return &clone
+}
+
+// connected reports whether kb has a connection that Disconnect has not released
+func (kb *KBSearch) connected() bool {
+	return kb.conn != nil && !kb.closed
+}
+
+// query runs query through queryWithTimeout under StatementTimeout
+func (kb *KBSearch) query(scan func(*sql.Rows) error, query string, params ...interface{}) error {
+	return queryWithTimeout(kb.conn, kb.StatementTimeout, scan, query, params...)
+}
+
+// queryRow runs query through queryRowWithTimeout under StatementTimeout
+func (kb *KBSearch) queryRow(query string, params []interface{}, dest ...interface{}) error {
+	return queryRowWithTimeout(kb.conn, kb.StatementTimeout, query, params, dest...)
+}
+
+// begin starts a transaction through beginWithTimeout under StatementTimeout
+func (kb *KBSearch) begin() (*sql.Tx, error) {
+	return beginWithTimeout(kb.conn, kb.StatementTimeout)
+}
+
+// appendLimitOffset adds LIMIT and OFFSET clauses to query, numbering their
+// parameters after those already in params
+func appendLimitOffset(query string, params []interface{}, limit *int, offset int) (string, []interface{}) {
+	if limit != nil && *limit > 0 {
+		params = append(params, *limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(params))
+	}
+
+	if offset > 0 {
+		params = append(params, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(params))
+	}
+
+	return query, params
+}
+
+// queryPage runs query with LIMIT and OFFSET applied, plus a count of all rows
+// the unpaged query matches. Both run in one read-only REPEATABLE READ
+// transaction so the total and the page see the same snapshot.
+func queryPage(conn *sql.DB, query string, params []interface{}, limit *int, offset int) ([]map[string]interface{}, int, error) {
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var total int
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS unpaged", query)
+	if err := tx.QueryRow(countQuery, params...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	pageQuery, pageParams := appendLimitOffset(query, params, limit, offset)
+	rows, err := tx.Query(pageQuery, pageParams...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results, err := rowsToMaps(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
 // GetConnAndCursor returns the database connection
 func (kb *KBSearch) GetConnAndCursor() (*sql.DB, error) {
-	if kb.conn == nil {
+	if !kb.connected() {
 		return nil, fmt.Errorf("not connected to database. Call connect() first")
 	}
 	return kb.conn, nil
 }
 
-// ClearFilters clears all filters and resets the query state
+// ClearFilters clears all filters and resets the query state, including any
+// projection set by Select and ordering set by OrderBy
 func (kb *KBSearch) ClearFilters() {
 	kb.Filters = []Filter{}
 	kb.Results = nil
+	kb.selectFields = nil
+	kb.orderBy = nil
+}
+
+// OrderBy adds column as the next sort key of the query, ascending when asc is
+// set. Each call adds a key after the earlier ones. Without OrderBy results are
+// ordered by path; path is also added as the last key when not ordered on, so
+// rows that tie on the chosen columns still come back in a stable order.
+func (kb *KBSearch) OrderBy(column string, asc bool) error {
+	if !orderColumns[column] {
+		return fmt.Errorf("invalid order column %q", column)
+	}
+	for _, key := range kb.orderBy {
+		if key.column == column {
+			return fmt.Errorf("already ordered by %q", column)
+		}
+	}
+
+	kb.orderBy = append(kb.orderBy, orderKey{column: column, asc: asc})
+	return nil
+}
+
+// orderClause returns the ORDER BY clause for the keys added by OrderBy, with
+// each column qualified by prefix
+func (kb *KBSearch) orderClause(prefix string) string {
+	keys := kb.orderBy
+	hasPath := false
+	for _, key := range keys {
+		hasPath = hasPath || key.column == "path"
+	}
+	if !hasPath {
+		keys = append(keys[:len(keys):len(keys)], orderKey{column: "path", asc: true})
+	}
+
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "DESC"
+		if key.asc {
+			direction = "ASC"
+		}
+		terms[i] = prefix + key.column + " " + direction
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
 }
 
 // SearchKB adds a filter to search for rows matching the specified knowledge_base
@@ -121,6 +380,48 @@ func (kb *KBSearch) SearchName(name string) {
 	})
 }
 
+// SearchNameLike adds a case-sensitive LIKE filter on name. In pattern, "*"
+// matches any run of characters and "?" a single character; "%", "_" and
+// backslash are matched literally, so user input can be passed through
+// unchanged. For type-ahead use SearchNameILike("abc*").
+func (kb *KBSearch) SearchNameLike(pattern string) {
+	kb.searchNamePattern("LIKE", pattern)
+}
+
+// SearchNameILike adds a case-insensitive ILIKE filter on name; pattern is as for SearchNameLike
+func (kb *KBSearch) SearchNameILike(pattern string) {
+	kb.searchNamePattern("ILIKE", pattern)
+}
+
+// searchNamePattern adds a name filter using the LIKE or ILIKE operator with the
+// pattern translated by likePattern and bound as a parameter
+func (kb *KBSearch) searchNamePattern(operator, pattern string) {
+	kb.Filters = append(kb.Filters, Filter{
+		Condition: "name " + operator + " $name_pattern ESCAPE '\\'",
+		Params:    map[string]interface{}{"name_pattern": likePattern(pattern)},
+	})
+}
+
+// likePattern converts a "*" and "?" wildcard pattern to a LIKE pattern,
+// escaping the LIKE metacharacters already present in it
+func likePattern(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '%', '_', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
 // SearchPropertyKey adds a filter to search for rows where properties contains the key
 func (kb *KBSearch) SearchPropertyKey(key string) {
 	kb.Filters = append(kb.Filters, Filter{
@@ -129,8 +430,18 @@ func (kb *KBSearch) SearchPropertyKey(key string) {
 	})
 }
 
-// SearchPropertyValue adds a filter to search for rows where properties contains the key-value pair
+// SearchPropertyValue adds a filter to search for rows where properties contains the key-value pair.
+// A plain key, including one containing dots, matches a top-level property with
+// the @> containment operator. A JSON pointer key ("/config/region") matches a
+// nested property: string values are compared with the #>> text extraction
+// operator and other values with #> as jsonb. The key path is bound as a text[]
+// parameter, never interpolated into the SQL.
 func (kb *KBSearch) SearchPropertyValue(key string, value interface{}) {
+	if keyPath, nested := propertyKeyPath(key); nested {
+		kb.searchNestedPropertyValue(keyPath, value)
+		return
+	}
+
 	jsonObject := map[string]interface{}{key: value}
 	jsonBytes, _ := json.Marshal(jsonObject)
 
@@ -140,6 +451,53 @@ func (kb *KBSearch) SearchPropertyValue(key string, value interface{}) {
 	})
 }
 
+// SearchPropertyContains adds a filter to search for rows whose properties contain
+// fragment, using the jsonb @> containment operator so every key in fragment must
+// match. On a JSONB table this is served by the GIN index on properties. Nested
+// objects in fragment match nested properties; an empty fragment matches every row.
+func (kb *KBSearch) SearchPropertyContains(fragment map[string]interface{}) {
+	if fragment == nil {
+		fragment = map[string]interface{}{}
+	}
+	jsonBytes, _ := json.Marshal(fragment)
+
+	kb.Filters = append(kb.Filters, Filter{
+		Condition: "properties::jsonb @> $property_fragment::jsonb",
+		Params:    map[string]interface{}{"property_fragment": string(jsonBytes)},
+	})
+}
+
+// propertyKeyPath splits a JSON pointer property key into its path elements.
+// It reports false for any other key, which names a top-level property.
+func propertyKeyPath(key string) ([]string, bool) {
+	if strings.HasPrefix(key, "/") {
+		parts := strings.Split(key[1:], "/")
+		for i, part := range parts {
+			// RFC 6901 escapes: ~1 is "/" and ~0 is "~"
+			parts[i] = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		}
+		return parts, true
+	}
+	return nil, false
+}
+
+// searchNestedPropertyValue adds a filter matching the property at keyPath against value
+func (kb *KBSearch) searchNestedPropertyValue(keyPath []string, value interface{}) {
+	if text, ok := value.(string); ok {
+		kb.Filters = append(kb.Filters, Filter{
+			Condition: "properties::jsonb #>> $property_path::text[] = $property_value",
+			Params:    map[string]interface{}{"property_path": pq.Array(keyPath), "property_value": text},
+		})
+		return
+	}
+
+	jsonBytes, _ := json.Marshal(value)
+	kb.Filters = append(kb.Filters, Filter{
+		Condition: "properties::jsonb #> $property_path::text[] = $property_value::jsonb",
+		Params:    map[string]interface{}{"property_path": pq.Array(keyPath), "property_value": string(jsonBytes)},
+	})
+}
+
 // SearchStartingPath adds a filter to search for descendants of the specified path
 func (kb *KBSearch) SearchStartingPath(startingPath string) {
 	kb.Filters = append(kb.Filters, Filter{
@@ -148,6 +506,20 @@ func (kb *KBSearch) SearchStartingPath(startingPath string) {
 	})
 }
 
+// SearchStartingPathDepth adds a filter to search for the specified path and its
+// descendants at most maxDepth levels below it: 0 keeps just the path, 1 adds
+// its direct children. A negative maxDepth is unbounded, like SearchStartingPath.
+func (kb *KBSearch) SearchStartingPathDepth(startingPath string, maxDepth int) {
+	if maxDepth < 0 {
+		kb.SearchStartingPath(startingPath)
+		return
+	}
+	kb.Filters = append(kb.Filters, Filter{
+		Condition: "path <@ $starting_path::ltree AND nlevel(path) - nlevel($starting_path::ltree) <= $max_depth",
+		Params:    map[string]interface{}{"starting_path": startingPath, "max_depth": maxDepth},
+	})
+}
+
 // SearchPath adds a filter to search for rows matching the LTREE path expression
 func (kb *KBSearch) SearchPath(pathExpression string) {
 	kb.Filters = append(kb.Filters, Filter{
@@ -172,29 +544,89 @@ func (kb *KBSearch) SearchHasLinkMount() {
 	})
 }
 
-// ExecuteQuery executes the progressive query with all added filters using CTEs
-func (kb *KBSearch) ExecuteQuery() ([]map[string]interface{}, error) {
-	if kb.conn == nil {
-		return nil, fmt.Errorf("not connected to database")
+// FindOption adds a filter to the node lookups of the status, job and stream
+// components (FindNodeIDs, FindJobIDs, FindStreamIDs and their variants)
+type FindOption func(*KBSearch)
+
+// WithHasLink keeps nodes whose has_link flag equals hasLink
+func WithHasLink(hasLink bool) FindOption {
+	return func(kb *KBSearch) {
+		kb.Filters = append(kb.Filters, Filter{
+			Condition: "has_link = $has_link",
+			Params:    map[string]interface{}{"has_link": hasLink},
+		})
+	}
+}
+
+// WithHasLinkMount keeps nodes whose has_link_mount flag equals hasLinkMount
+func WithHasLinkMount(hasLinkMount bool) FindOption {
+	return func(kb *KBSearch) {
+		kb.Filters = append(kb.Filters, Filter{
+			Condition: "has_link_mount = $has_link_mount",
+			Params:    map[string]interface{}{"has_link_mount": hasLinkMount},
+		})
+	}
+}
+
+// deletedColumn records whether the main table has the deleted_at column.
+// Tables created before soft-delete support lack it until
+// KnowledgeBaseManager.MigrateSoftDelete adds it.
+type deletedColumn struct {
+	mu      sync.Mutex
+	checked bool
+	present bool
+}
+
+// exists reports whether table has the deleted_at column, reading the catalog
+// on first use only. Without a connection, or when the catalog cannot be read,
+// the column is assumed to be there and the check is retried on the next call.
+func (c *deletedColumn) exists(conn *sql.DB, table string) bool {
+	if c == nil || conn == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checked {
+		return c.present
+	}
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = ANY(current_schemas(false))
+			AND table_name = lower($1)
+			AND column_name = 'deleted_at'
+		)`
+	if err := conn.QueryRow(query, table).Scan(&c.present); err != nil {
+		return true
+	}
+	c.checked = true
+	return c.present
+}
+
+// liveNodes returns the condition hiding soft-deleted nodes, joined by prefix, or
+// nothing when IncludeDeleted is set or the table has no deleted_at column
+func (kb *KBSearch) liveNodes(prefix string) string {
+	if kb.IncludeDeleted {
+		return ""
+	}
+	if kb.connected() && !kb.deletedColumn.exists(kb.conn, kb.BaseTable) {
+		return ""
 	}
+	return prefix + "deleted_at IS NULL"
+}
 
+// BuildQuery returns the progressive CTE query composed from the accumulated
+// filters and its positional parameters, without executing it. Soft-deleted
+// nodes are excluded unless IncludeDeleted is set or the table predates
+// soft-delete support, and rows are sorted as set
+// by OrderBy. Named parameters within a filter are numbered in alphabetical order.
+func (kb *KBSearch) BuildQuery() (string, []interface{}) {
 	columnStr := "*"
 
-	// If no filters, execute simple query
+	// If no filters, build simple query
 	if len(kb.Filters) == 0 {
-		query := fmt.Sprintf("SELECT %s FROM %s", columnStr, kb.BaseTable)
-		rows, err := kb.conn.Query(query)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-
-		results, err := kb.rowsToMaps(rows)
-		if err != nil {
-			return nil, err
-		}
-		kb.Results = results
-		return results, nil
+		return fmt.Sprintf("SELECT %s FROM %s%s%s", columnStr, kb.BaseTable, kb.liveNodes(" WHERE "), kb.orderClause("")), nil
 	}
 
 	// Build CTE query
@@ -203,19 +635,25 @@ func (kb *KBSearch) ExecuteQuery() ([]map[string]interface{}, error) {
 	paramCounter := 1
 
 	// Initial CTE
-	cteParts = append(cteParts, fmt.Sprintf("base_data AS (SELECT %s FROM %s)", columnStr, kb.BaseTable))
+	cteParts = append(cteParts, fmt.Sprintf("base_data AS (SELECT %s FROM %s%s)", columnStr, kb.BaseTable, kb.liveNodes(" WHERE ")))
 
 	// Process each filter
 	for i, filter := range kb.Filters {
 		condition := filter.Condition
 		params := filter.Params
 
+		paramNames := make([]string, 0, len(params))
+		for paramName := range params {
+			paramNames = append(paramNames, paramName)
+		}
+		sort.Strings(paramNames)
+
 		// Replace parameter placeholders with positional parameters
-		for paramName, paramValue := range params {
+		for _, paramName := range paramNames {
 			placeholder := "$" + paramName
 			newPlaceholder := fmt.Sprintf("$%d", paramCounter)
 			condition = strings.Replace(condition, placeholder, newPlaceholder, -1)
-			paramSlice = append(paramSlice, paramValue)
+			paramSlice = append(paramSlice, params[paramName])
 			paramCounter++
 		}
 
@@ -226,9 +664,7 @@ func (kb *KBSearch) ExecuteQuery() ([]map[string]interface{}, error) {
 		}
 
 		var cteQuery string
-		if condition != "" && len(params) > 0 {
-			cteQuery = fmt.Sprintf("%s AS (SELECT %s FROM %s WHERE %s)", cteName, columnStr, prevCTE, condition)
-		} else if condition != "" {
+		if condition != "" {
 			cteQuery = fmt.Sprintf("%s AS (SELECT %s FROM %s WHERE %s)", cteName, columnStr, prevCTE, condition)
 		} else {
 			cteQuery = fmt.Sprintf("%s AS (SELECT %s FROM %s)", cteName, columnStr, prevCTE)
@@ -240,63 +676,200 @@ func (kb *KBSearch) ExecuteQuery() ([]map[string]interface{}, error) {
 	// Build final query
 	withClause := "WITH " + strings.Join(cteParts, ",\n")
 	finalSelect := fmt.Sprintf("SELECT %s FROM filter_%d", columnStr, len(kb.Filters)-1)
-	finalQuery := fmt.Sprintf("%s\n%s", withClause, finalSelect)
+	return fmt.Sprintf("%s\n%s%s", withClause, finalSelect, kb.orderClause("")), paramSlice
+}
 
-	// Execute query
-	rows, err := kb.conn.Query(finalQuery, paramSlice...)
-	if err != nil {
-		return nil, fmt.Errorf("error executing query: %v\nQuery: %s\nParams: %v", err, finalQuery, paramSlice)
+// Explain returns the plan PostgreSQL chooses for the query BuildQuery composes.
+// The query is planned with EXPLAIN (ANALYZE false), so it is not executed.
+func (kb *KBSearch) Explain() (string, error) {
+	if !kb.connected() {
+		return "", fmt.Errorf("not connected to database")
 	}
-	defer rows.Close()
 
-	results, err := kb.rowsToMaps(rows)
+	finalQuery, paramSlice := kb.BuildQuery()
+
+	lines := []string{}
+	err := kb.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+		return rows.Err()
+	}, "EXPLAIN (ANALYZE false) "+finalQuery, paramSlice...)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("error explaining query: %w\nQuery: %s\nParams: %v", err, finalQuery, paramSlice)
 	}
 
-	kb.Results = results
-	return results, nil
+	return strings.Join(lines, "\n"), nil
 }
 
-// rowsToMaps converts SQL rows to slice of maps
-func (kb *KBSearch) rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
-	columns, err := rows.Columns()
+// ExecuteQueryNodes executes the progressive query with all added filters and
+// returns typed nodes. Columns that are not Node fields are dropped and Results
+// is not updated; use ExecuteQuery for whole rows.
+func (kb *KBSearch) ExecuteQueryNodes() ([]Node, error) {
+	if !kb.connected() {
+		return nil, fmt.Errorf("not connected to database")
+	}
+
+	finalQuery, paramSlice := kb.BuildQuery()
+
+	// Execute query
+	var nodes []Node
+	err := kb.query(func(rows *sql.Rows) (err error) {
+		nodes, err = scanNodes(rows)
+		return err
+	}, finalQuery, paramSlice...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error executing query: %w\nQuery: %s\nParams: %v", err, finalQuery, paramSlice)
+	}
+	return nodes, nil
+}
+
+// ErrStopIteration can be returned from an ExecuteQueryCursor callback to stop early without error
+var ErrStopIteration = errors.New("stop iteration")
+
+// ExecuteQueryCursor executes the progressive query and calls fn for each row as it is read.
+// Rows are not materialized, so the query holds a database connection open until fn has
+// seen the last row, returns an error, or returns ErrStopIteration. Results is not updated.
+// StatementTimeout covers the time fn spends on the rows as well.
+func (kb *KBSearch) ExecuteQueryCursor(fn func(Node) error) error {
+	if !kb.connected() {
+		return fmt.Errorf("not connected to database")
 	}
 
-	results := []map[string]interface{}{}
+	finalQuery, paramSlice := kb.BuildQuery()
+
+	var fnErr error
+	err := kb.query(func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
 
-	for rows.Next() {
-		// Create a slice of interface{} to hold the values
 		values := make([]interface{}, len(columns))
 		valuePointers := make([]interface{}, len(columns))
-
 		for i := range columns {
 			valuePointers[i] = &values[i]
 		}
 
-		if err := rows.Scan(valuePointers...); err != nil {
-			return nil, err
-		}
+		for rows.Next() {
+			if err := rows.Scan(valuePointers...); err != nil {
+				return err
+			}
+
+			node, err := nodeFromColumns(columns, values)
+			if err != nil {
+				return err
+			}
 
-		// Create a map for this row
-		entry := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				v = string(b)
-			} else {
-				v = val
+			if err := fn(node); err != nil {
+				if errors.Is(err, ErrStopIteration) {
+					return nil
+				}
+				fnErr = err
+				return err
 			}
-			entry[col] = v
 		}
 
-		results = append(results, entry)
+		return rows.Err()
+	}, finalQuery, paramSlice...)
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("error executing query: %w\nQuery: %s\nParams: %v", err, finalQuery, paramSlice)
+	}
+	return nil
+}
+
+// ExecuteQuery executes the progressive query with all added filters using CTEs.
+// After Select, each result map holds only the selected fields.
+func (kb *KBSearch) ExecuteQuery() ([]map[string]interface{}, error) {
+	if len(kb.selectFields) > 0 {
+		return kb.executeProjection()
+	}
+	if !kb.connected() {
+		return nil, fmt.Errorf("not connected to database")
+	}
+
+	finalQuery, paramSlice := kb.BuildQuery()
+
+	// Execute query
+	var results []map[string]interface{}
+	err := kb.query(func(rows *sql.Rows) (err error) {
+		results, err = rowsToMaps(rows)
+		return err
+	}, finalQuery, paramSlice...)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w\nQuery: %s\nParams: %v", err, finalQuery, paramSlice)
+	}
+
+	kb.Results = results
+	return results, nil
+}
+
+// selectKeyPattern is the allowlist for property keys named in Select
+var selectKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Select limits the maps returned by ExecuteQuery to fields, so large data
+// columns need not be read. A field naming a node column (id, knowledge_base,
+// label, name, properties, data, has_link, has_link_mount, path, deleted_at,
+// created_at, updated_at) is returned as that column; any other field is read from properties with ->>
+// and returned as text, or nil when the key is missing. Property keys must be
+// plain identifiers (letters, digits and underscores). Select with no fields
+// restores whole rows. Filters are unaffected, and ExecuteQueryNodes always
+// returns whole nodes.
+func (kb *KBSearch) Select(fields ...string) error {
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if !csvNodeColumns[field] && !selectKeyPattern.MatchString(field) {
+			return fmt.Errorf("invalid select field %q: property keys must be letters, digits and underscores", field)
+		}
+		if seen[field] {
+			return fmt.Errorf("duplicate select field %q", field)
+		}
+		seen[field] = true
+	}
+
+	if len(fields) == 0 {
+		kb.selectFields = nil
+		return nil
+	}
+	kb.selectFields = append([]string(nil), fields...)
+	return nil
+}
+
+// executeProjection runs the accumulated query with the select list built from
+// selectFields and stores the projected rows in Results
+func (kb *KBSearch) executeProjection() ([]map[string]interface{}, error) {
+	if !kb.connected() {
+		return nil, fmt.Errorf("not connected to database")
+	}
+
+	finalQuery, paramSlice := kb.BuildQuery()
+	exprs := make([]string, len(kb.selectFields))
+	for i, field := range kb.selectFields {
+		if csvNodeColumns[field] {
+			exprs[i] = "q." + field
+			continue
+		}
+		paramSlice = append(paramSlice, field)
+		exprs[i] = fmt.Sprintf("q.properties::jsonb ->> $%d AS %s", len(paramSlice), pq.QuoteIdentifier(field))
 	}
+	projectQuery := fmt.Sprintf("SELECT %s FROM (%s) AS q%s", strings.Join(exprs, ", "), finalQuery, kb.orderClause("q."))
 
+	var results []map[string]interface{}
+	err := kb.query(func(rows *sql.Rows) (err error) {
+		results, err = rowsToMaps(rows)
+		return err
+	}, projectQuery, paramSlice...)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w\nQuery: %s\nParams: %v", err, projectQuery, paramSlice)
+	}
+	kb.Results = results
 	return results, nil
 }
 
@@ -399,22 +972,22 @@ func (kb *KBSearch) FindDescriptionPath(path string) (map[string]interface{}, er
 
 	returnValues := make(map[string]interface{})
 
-	query := fmt.Sprintf("SELECT path, data FROM %s WHERE path = $1", kb.BaseTable)
-	rows, err := kb.conn.Query(query, path)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving data for path: %v", err)
-	}
-	defer rows.Close()
-
+	query := fmt.Sprintf("SELECT path, data FROM %s WHERE path = $1%s", kb.BaseTable, kb.liveNodes(" AND "))
 	found := false
-	for rows.Next() {
-		var dbPath string
-		var data interface{}
-		if err := rows.Scan(&dbPath, &data); err != nil {
-			return nil, err
+	err := kb.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var dbPath string
+			var data interface{}
+			if err := rows.Scan(&dbPath, &data); err != nil {
+				return err
+			}
+			returnValues[dbPath] = data
+			found = true
 		}
-		returnValues[dbPath] = data
-		found = true
+		return nil
+	}, query, path)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving data for path: %w", err)
 	}
 
 	// Add nil for path not found
@@ -426,56 +999,34 @@ func (kb *KBSearch) FindDescriptionPath(path string) (map[string]interface{}, er
 }
 
 // FindDescriptionPaths finds data for multiple specified paths in the knowledge base
+// with a single query. The result holds one single-entry map per input path, in
+// input order; a path that does not exist maps to nil.
 func (kb *KBSearch) FindDescriptionPaths(paths []string) ([]map[string]interface{}, error) {
 	if len(paths) == 0 {
 		return []map[string]interface{}{}, nil
 	}
 
-	returnValues := []map[string]interface{}{}
-
-	var rows *sql.Rows
-	var err error
-
-	if len(paths) == 1 {
-		// Single path optimization
-		query := fmt.Sprintf("SELECT path, data FROM %s WHERE path = $1", kb.BaseTable)
-		rows, err = kb.conn.Query(query, paths[0])
-	} else {
-		// Build query with multiple placeholders
-		placeholders := make([]string, len(paths))
-		args := make([]interface{}, len(paths))
-		for i, path := range paths {
-			placeholders[i] = fmt.Sprintf("$%d", i+1)
-			args[i] = path
+	query := fmt.Sprintf("SELECT path, data FROM %s WHERE path = ANY($1::ltree[])%s", kb.BaseTable, kb.liveNodes(" AND "))
+	found := make(map[string]interface{}, len(paths))
+	err := kb.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var path string
+			var data interface{}
+			if err := rows.Scan(&path, &data); err != nil {
+				return err
+			}
+			found[path] = data
 		}
-
-		query := fmt.Sprintf("SELECT path, data FROM %s WHERE path IN (%s)",
-			kb.BaseTable, strings.Join(placeholders, ","))
-		rows, err = kb.conn.Query(query, args...)
-	}
-
+		return rows.Err()
+	}, query, pq.Array(paths))
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving data for paths: %v", err)
-	}
-	defer rows.Close()
-
-	foundPaths := make(map[string]bool)
-
-	for rows.Next() {
-		var path string
-		var data interface{}
-		if err := rows.Scan(&path, &data); err != nil {
-			return nil, err
-		}
-		returnValues = append(returnValues, map[string]interface{}{path: data})
-		foundPaths[path] = true
+		return nil, fmt.Errorf("error retrieving data for paths: %w", err)
 	}
 
-	// Add nil for paths not found
+	// Preserve input order, with nil for paths not found
+	returnValues := make([]map[string]interface{}, 0, len(paths))
 	for _, path := range paths {
-		if !foundPaths[path] {
-			returnValues = append(returnValues, map[string]interface{}{path: nil})
-		}
+		returnValues = append(returnValues, map[string]interface{}{path: found[path]})
 	}
 
 	return returnValues, nil
@@ -514,3 +1065,72 @@ func (kb *KBSearch) DecodeLinkNodes(path string) (string, [][]string, error) {
 	return kbName, result, nil
 }
 
+
+// ResolvedSegment is one link hop taken by ResolveMountedPath
+type ResolvedSegment struct {
+	LinkName      string // link followed at this hop
+	ParentPath    string // linked node the path passed through
+	KnowledgeBase string // knowledge base the link is mounted in
+	MountPath     string // mount point of the link
+	ResolvedPath  string // path after substituting MountPath for ParentPath
+}
+
+// ResolveMountedPath follows the links on path into the knowledge bases they are
+// mounted in. At each hop the deepest linked ancestor of the current path is
+// replaced by the mount_path of its link, and the remainder of the path is kept.
+// Resolution repeats until no linked ancestor remains; the last segment's
+// ResolvedPath is the fully resolved path. A path with no links yields no
+// segments. Following the same link twice is reported as a cycle.
+func (kb *KBSearch) ResolveMountedPath(path string) ([]ResolvedSegment, error) {
+	if !kb.connected() {
+		return nil, fmt.Errorf("not connected to database")
+	}
+	if path == "" {
+		return nil, fmt.Errorf("path must be a non-empty string")
+	}
+
+	linkQuery := fmt.Sprintf(`
+		SELECT link_name, parent_path::text
+		FROM %s
+		WHERE parent_path @> $1::ltree
+		ORDER BY nlevel(parent_path) DESC, link_name
+		LIMIT 1
+	`, kb.LinkTable)
+	mountQuery := fmt.Sprintf(`
+		SELECT knowledge_base, mount_path::text
+		FROM %s
+		WHERE link_name = $1
+	`, kb.LinkMountTable)
+
+	segments := []ResolvedSegment{}
+	visited := map[string]bool{}
+	current := path
+
+	for {
+		var segment ResolvedSegment
+		err := kb.queryRow(linkQuery, []interface{}{current}, &segment.LinkName, &segment.ParentPath)
+		if err == sql.ErrNoRows {
+			return segments, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error finding link for path %s: %w", current, err)
+		}
+
+		if visited[segment.LinkName] {
+			return nil, fmt.Errorf("mount cycle detected: link %s is reached again while resolving %s", segment.LinkName, path)
+		}
+		visited[segment.LinkName] = true
+
+		err = kb.queryRow(mountQuery, []interface{}{segment.LinkName}, &segment.KnowledgeBase, &segment.MountPath)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("link %s at %s has no mount point", segment.LinkName, segment.ParentPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error finding mount for link %s: %w", segment.LinkName, err)
+		}
+
+		segment.ResolvedPath = segment.MountPath + strings.TrimPrefix(current, segment.ParentPath)
+		segments = append(segments, segment)
+		current = segment.ResolvedPath
+	}
+}
@@ -0,0 +1,119 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// csvNodeColumns are the node table columns ExportCSV selects directly; any
+// other column name is read from properties
+var csvNodeColumns = map[string]bool{
+	"id":             true,
+	"knowledge_base": true,
+	"label":          true,
+	"name":           true,
+	"properties":     true,
+	"data":           true,
+	"has_link":       true,
+	"has_link_mount": true,
+	"path":           true,
+	"deleted_at":     true,
+	"created_at":     true,
+	"updated_at":     true,
+}
+
+// defaultCSVColumns is used by ExportCSV when no columns are given
+var defaultCSVColumns = []string{"id", "knowledge_base", "label", "name", "path"}
+
+// csvSelect builds the select list for ExportCSV over columns, binding property
+// keys as parameters numbered after the first offset
+func csvSelect(columns []string, offset int) (string, []interface{}) {
+	exprs := make([]string, len(columns))
+	params := []interface{}{}
+	for i, column := range columns {
+		if csvNodeColumns[column] {
+			exprs[i] = fmt.Sprintf("q.%s::text", column)
+			continue
+		}
+		if keyPath, nested := propertyKeyPath(column); nested {
+			params = append(params, pq.Array(keyPath))
+			exprs[i] = fmt.Sprintf("q.properties::jsonb #>> $%d::text[]", offset+len(params))
+		} else {
+			params = append(params, column)
+			exprs[i] = fmt.Sprintf("q.properties::jsonb ->> $%d", offset+len(params))
+		}
+	}
+	return strings.Join(exprs, ", "), params
+}
+
+// ExportCSV runs the accumulated query and writes the matching nodes to w as
+// CSV: a header row of columns, then one line per node. A column naming a node
+// column (id, knowledge_base, label, name, properties, data, has_link,
+// has_link_mount, path, deleted_at, created_at, updated_at) is written as text;
+// any other name is read from properties with ->>, or #>> for a JSON pointer
+// key as in SearchPropertyValue. NULLs and missing keys are written as empty
+// fields. With no columns, id, knowledge_base, label, name and path are
+// written. Rows are streamed as they are read, so the query holds a database
+// connection open until the export finishes. Results is not updated.
+func (kb *KBSearch) ExportCSV(w io.Writer, columns []string) error {
+	if !kb.connected() {
+		return fmt.Errorf("not connected to database")
+	}
+	if len(columns) == 0 {
+		columns = defaultCSVColumns
+	}
+
+	finalQuery, paramSlice := kb.BuildQuery()
+	selectList, columnParams := csvSelect(columns, len(paramSlice))
+	exportQuery := fmt.Sprintf("SELECT %s FROM (%s) AS q%s", selectList, finalQuery, kb.orderClause("q."))
+	paramSlice = append(paramSlice, columnParams...)
+
+	writer := csv.NewWriter(w)
+	headerWritten := false
+	err := kb.query(func(rows *sql.Rows) error {
+		if err := writer.Write(columns); err != nil {
+			return fmt.Errorf("error writing CSV header: %v", err)
+		}
+		headerWritten = true
+
+		values := make([]sql.NullString, len(columns))
+		valuePointers := make([]interface{}, len(columns))
+		for i := range values {
+			valuePointers[i] = &values[i]
+		}
+		record := make([]string, len(columns))
+
+		for rows.Next() {
+			if err := rows.Scan(valuePointers...); err != nil {
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			for i, value := range values {
+				record[i] = value.String // empty when NULL
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV row: %v", err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error reading rows: %w", err)
+		}
+		return nil
+	}, exportQuery, paramSlice...)
+	if err != nil && !headerWritten {
+		return fmt.Errorf("error executing query: %w\nQuery: %s\nParams: %v", err, exportQuery, paramSlice)
+	}
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %v", err)
+	}
+	return nil
+}
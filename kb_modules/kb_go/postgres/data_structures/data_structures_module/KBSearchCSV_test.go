@@ -0,0 +1,48 @@
+package data_structures_module
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// TestCSVSelect checks node columns and property keys map to the right expressions
+func TestCSVSelect(t *testing.T) {
+	selectList, params := csvSelect([]string{"path", "color", "/config/region"}, 2)
+
+	want := "q.path::text, q.properties::jsonb ->> $3, q.properties::jsonb #>> $4::text[]"
+	if selectList != want {
+		t.Errorf("Expected select list %q, got %q", want, selectList)
+	}
+	if len(params) != 2 || params[0] != "color" {
+		t.Errorf("Unexpected params %v", params)
+	}
+}
+
+// TestExportCSV checks quoting, NULL handling and property flattening
+func TestExportCSV(t *testing.T) {
+	kb := setupTestSearch(t, 3)
+	defer kb.Disconnect()
+
+	insertQuery := fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, properties, data, path)
+		VALUES ('kb1', 'special', 'node4', $1, '{}', 'kb1.node4')`, testDBTable)
+	if _, err := kb.conn.Exec(insertQuery, `{"description": "say \"hi\", please", "color": "red"}`); err != nil {
+		t.Fatalf("Error inserting node: %v", err)
+	}
+
+	kb.SearchKB("kb1")
+	var buf bytes.Buffer
+	if err := kb.ExportCSV(&buf, []string{"path", "label", "description", "color"}); err != nil {
+		t.Fatalf("Error exporting CSV: %v", err)
+	}
+
+	want := `path,label,description,color
+kb1.node1,odd,node 1,
+kb1.node2,even,node 2,
+kb1.node3,odd,node 3,
+kb1.node4,special,"say ""hi"", please",red
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
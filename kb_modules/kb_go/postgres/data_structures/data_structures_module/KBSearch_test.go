@@ -0,0 +1,928 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test database configuration
+var (
+	testDBHost     = "localhost"
+	testDBPort     = "5432"
+	testDBName     = "knowledge_base"
+	testDBUser     = "gedgar"
+	testDBTable    = "knowledge_base_ds_test" // Use a different table for testing
+	testDBPassword = os.Getenv("POSTGRES_PASSWORD")
+)
+
+// setupTestSearch creates a KBSearch over a freshly created test table holding count synthetic nodes
+func setupTestSearch(t *testing.T, count int) *KBSearch {
+	t.Helper()
+
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	kb, err := NewKBSearch(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable)
+	if err != nil {
+		t.Fatalf("Error creating KBSearch: %v", err)
+	}
+
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS ltree",
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", testDBTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			knowledge_base VARCHAR NOT NULL,
+			label VARCHAR NOT NULL,
+			name VARCHAR NOT NULL,
+			properties JSON,
+			data JSON,
+			has_link BOOLEAN DEFAULT FALSE,
+			has_link_mount BOOLEAN DEFAULT FALSE,
+			path LTREE UNIQUE,
+			deleted_at TIMESTAMPTZ
+		)`, testDBTable),
+		fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, properties, data, path)
+			SELECT 'kb1', CASE WHEN g %% 2 = 0 THEN 'even' ELSE 'odd' END, 'node' || g,
+				json_build_object('description', 'node ' || g), json_build_object('value', g),
+				('kb1.node' || g)::ltree
+			FROM generate_series(1, $1) AS g`, testDBTable),
+	}
+	for i, stmt := range statements {
+		var err error
+		if i == len(statements)-1 {
+			_, err = kb.conn.Exec(stmt, count)
+		} else {
+			_, err = kb.conn.Exec(stmt)
+		}
+		if err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing test table: %v", err)
+		}
+	}
+
+	return kb
+}
+
+// TestExecuteQueryRows checks that ExecuteQuery returns whole rows, including
+// columns Node has no field for, with JSON columns as their raw text
+func TestExecuteQueryRows(t *testing.T) {
+	kb := setupTestSearch(t, 2)
+	defer kb.Disconnect()
+
+	if _, err := kb.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN created_at TIMESTAMPTZ DEFAULT NOW()", testDBTable)); err != nil {
+		t.Fatalf("Error adding column: %v", err)
+	}
+	var rawProperties string
+	if err := kb.conn.QueryRow(fmt.Sprintf("SELECT properties FROM %s WHERE path = 'kb1.node1'", testDBTable)).Scan(&rawProperties); err != nil {
+		t.Fatalf("Error reading properties: %v", err)
+	}
+
+	kb.SearchPath("kb1.node1")
+	results, err := kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(results))
+	}
+	if _, ok := results[0]["created_at"]; !ok {
+		t.Errorf("Expected created_at in the row, got %v", results[0])
+	}
+	if results[0]["properties"] != rawProperties {
+		t.Errorf("Expected properties %q, got %v", rawProperties, results[0]["properties"])
+	}
+	if !reflect.DeepEqual(kb.GetResults(), results) {
+		t.Errorf("Expected Results to hold the rows, got %v", kb.GetResults())
+	}
+}
+
+// TestExecuteQueryCursor streams a large synthetic result one row at a time
+func TestExecuteQueryCursor(t *testing.T) {
+	const total = 100000
+	kb := setupTestSearch(t, total)
+	defer kb.Disconnect()
+
+	kb.ClearFilters()
+	kb.SearchLabel("even")
+
+	seen := 0
+	err := kb.ExecuteQueryCursor(func(n Node) error {
+		if n.Label != "even" {
+			return fmt.Errorf("unexpected label %s", n.Label)
+		}
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error iterating cursor: %v", err)
+	}
+	if seen != total/2 {
+		t.Errorf("Expected %d rows, got %d", total/2, seen)
+	}
+	if kb.Results != nil {
+		t.Errorf("Expected cursor not to materialize Results")
+	}
+
+	t.Run("StopEarly", func(t *testing.T) {
+		seen := 0
+		err := kb.ExecuteQueryCursor(func(n Node) error {
+			seen++
+			if seen == 10 {
+				return ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected nil error on stop, got %v", err)
+		}
+		if seen != 10 {
+			t.Errorf("Expected to stop after 10 rows, got %d", seen)
+		}
+	})
+
+	t.Run("CallbackError", func(t *testing.T) {
+		boom := errors.New("boom")
+		err := kb.ExecuteQueryCursor(func(n Node) error { return boom })
+		if !errors.Is(err, boom) {
+			t.Errorf("Expected callback error to propagate, got %v", err)
+		}
+	})
+}
+
+// TestPropertyKeyPath checks how property keys are split into nested paths
+func TestPropertyKeyPath(t *testing.T) {
+	cases := []struct {
+		key    string
+		path   []string
+		nested bool
+	}{
+		{"region", nil, false},
+		{"config.region", nil, false},
+		{"/config/region", []string{"config", "region"}, true},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}, true},
+		{"/dotted.key", []string{"dotted.key"}, true},
+	}
+	for _, c := range cases {
+		path, nested := propertyKeyPath(c.key)
+		if nested != c.nested || fmt.Sprint(path) != fmt.Sprint(c.path) {
+			t.Errorf("propertyKeyPath(%q) = %v, %v; want %v, %v", c.key, path, nested, c.path, c.nested)
+		}
+	}
+}
+
+// TestSearchNestedPropertyValue matches rows on a nested property field
+func TestSearchNestedPropertyValue(t *testing.T) {
+	kb := setupTestSearch(t, 4)
+	defer kb.Disconnect()
+
+	_, err := kb.conn.Exec(fmt.Sprintf(`UPDATE %s
+		SET properties = json_build_object('config', json_build_object('region', CASE WHEN id %% 2 = 0 THEN 'us' ELSE 'eu' END, 'replicas', id), 'config.region', 'dotted')`,
+		testDBTable))
+	if err != nil {
+		t.Fatalf("Error seeding nested properties: %v", err)
+	}
+
+	t.Run("NestedField", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyValue("/config/region", "us")
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 2 {
+			t.Errorf("Expected 2 nodes in region us, got %d", len(nodes))
+		}
+	})
+
+	t.Run("NestedPointerNumber", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyValue("/config/replicas", 3)
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 1 {
+			t.Errorf("Expected 1 node with 3 replicas, got %d", len(nodes))
+		}
+	})
+
+	t.Run("MissingNestedField", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyValue("/config/zone", "us")
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 0 {
+			t.Errorf("Expected no nodes for a missing nested field, got %d", len(nodes))
+		}
+	})
+
+	t.Run("TopLevelField", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyValue("config", map[string]interface{}{"region": "eu"})
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 2 {
+			t.Errorf("Expected 2 nodes in region eu, got %d", len(nodes))
+		}
+	})
+
+	t.Run("DottedTopLevelKey", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyValue("config.region", "dotted")
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 4 {
+			t.Errorf("Expected a dotted key to match the top-level property on 4 nodes, got %d", len(nodes))
+		}
+	})
+}
+
+// TestSearchPropertyContains matches rows on a multi-key properties fragment
+func TestSearchPropertyContains(t *testing.T) {
+	kb := setupTestSearch(t, 4)
+	defer kb.Disconnect()
+
+	_, err := kb.conn.Exec(fmt.Sprintf(`UPDATE %s
+		SET properties = json_build_object('color', CASE WHEN id %% 2 = 0 THEN 'red' ELSE 'blue' END, 'size', id, 'tags', json_build_array('a'))`,
+		testDBTable))
+	if err != nil {
+		t.Fatalf("Error seeding properties: %v", err)
+	}
+
+	t.Run("TwoKeys", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyContains(map[string]interface{}{"color": "red", "size": 2})
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 1 || nodes[0].Properties["size"] != float64(2) {
+			t.Errorf("Expected the single red node of size 2, got %+v", nodes)
+		}
+	})
+
+	t.Run("NestedArray", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyContains(map[string]interface{}{"color": "blue", "tags": []interface{}{"a"}})
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 2 {
+			t.Errorf("Expected 2 blue nodes tagged a, got %d", len(nodes))
+		}
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		kb.ClearFilters()
+		kb.SearchPropertyContains(map[string]interface{}{"color": "red", "size": 3})
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		if len(nodes) != 0 {
+			t.Errorf("Expected no nodes, got %d", len(nodes))
+		}
+	})
+}
+
+// TestBuildQuery checks the composed SQL and argument order without a database
+func TestBuildQuery(t *testing.T) {
+	kb := &KBSearch{BaseTable: "knowledge_base"}
+
+	query, args := kb.BuildQuery()
+	if query != "SELECT * FROM knowledge_base WHERE deleted_at IS NULL ORDER BY path ASC" || args != nil {
+		t.Errorf("Unexpected unfiltered query %q with args %v", query, args)
+	}
+
+	kb.SearchLabel("even")
+	kb.SearchName("node2")
+
+	query, args = kb.BuildQuery()
+	want := "WITH base_data AS (SELECT * FROM knowledge_base WHERE deleted_at IS NULL),\n" +
+		"filter_0 AS (SELECT * FROM base_data WHERE label = $1),\n" +
+		"filter_1 AS (SELECT * FROM filter_0 WHERE name = $2)\n" +
+		"SELECT * FROM filter_1 ORDER BY path ASC"
+	if query != want {
+		t.Errorf("Expected query:\n%s\ngot:\n%s", want, query)
+	}
+	if fmt.Sprint(args) != fmt.Sprint([]interface{}{"even", "node2"}) {
+		t.Errorf("Expected args [even node2], got %v", args)
+	}
+
+	kb.IncludeDeleted = true
+	kb.ClearFilters()
+	if query, _ := kb.BuildQuery(); query != "SELECT * FROM knowledge_base ORDER BY path ASC" {
+		t.Errorf("Unexpected query with IncludeDeleted %q", query)
+	}
+
+	if err := kb.OrderBy("properties", true); err == nil {
+		t.Error("Expected ordering by a JSON column to be rejected")
+	}
+	if err := kb.OrderBy("label", false); err != nil {
+		t.Fatalf("Error ordering by label: %v", err)
+	}
+	if err := kb.OrderBy("label", true); err == nil {
+		t.Error("Expected a repeated order column to be rejected")
+	}
+	if query, _ := kb.BuildQuery(); query != "SELECT * FROM knowledge_base ORDER BY label DESC, path ASC" {
+		t.Errorf("Unexpected ordered query %q", query)
+	}
+}
+
+// TestExplain checks that the plan for a filtered query is returned
+func TestExplain(t *testing.T) {
+	kb := setupTestSearch(t, 10)
+	defer kb.Disconnect()
+
+	kb.ClearFilters()
+	kb.SearchLabel("even")
+	plan, err := kb.Explain()
+	if err != nil {
+		t.Fatalf("Error explaining query: %v", err)
+	}
+	if !strings.Contains(plan, testDBTable) {
+		t.Errorf("Expected plan to mention %s, got:\n%s", testDBTable, plan)
+	}
+}
+
+// setupTestLinks recreates the link and link mount tables with the given rows.
+// links maps link name to parent path; mounts maps link name to mount path.
+func setupTestLinks(t *testing.T, kb *KBSearch, links, mounts map[string]string) {
+	t.Helper()
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", kb.LinkTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", kb.LinkMountTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			link_name VARCHAR NOT NULL,
+			parent_node_kb VARCHAR NOT NULL,
+			parent_path LTREE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(link_name, parent_node_kb, parent_path)
+		)`, kb.LinkTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			link_name VARCHAR NOT NULL UNIQUE,
+			knowledge_base VARCHAR NOT NULL,
+			mount_path LTREE NOT NULL,
+			description VARCHAR,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(knowledge_base, mount_path)
+		)`, kb.LinkMountTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing link tables: %v", err)
+		}
+	}
+
+	for linkName, parentPath := range links {
+		_, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (link_name, parent_node_kb, parent_path)
+			VALUES ($1, split_part($2, '.', 1), $2::ltree)`, kb.LinkTable), linkName, parentPath)
+		if err != nil {
+			t.Fatalf("Error adding link %s: %v", linkName, err)
+		}
+	}
+	for linkName, mountPath := range mounts {
+		_, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (link_name, knowledge_base, mount_path)
+			VALUES ($1, split_part($2, '.', 1), $2::ltree)`, kb.LinkMountTable), linkName, mountPath)
+		if err != nil {
+			t.Fatalf("Error adding mount %s: %v", linkName, err)
+		}
+	}
+}
+
+// TestResolveMountedPath follows a single mount hop and rejects a cyclic configuration
+func TestResolveMountedPath(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	t.Run("SingleHop", func(t *testing.T) {
+		setupTestLinks(t, kb,
+			map[string]string{"shared": "kb1.system.shared"},
+			map[string]string{"shared": "kb2.library.common"})
+
+		segments, err := kb.ResolveMountedPath("kb1.system.shared.config.region")
+		if err != nil {
+			t.Fatalf("Error resolving path: %v", err)
+		}
+		if len(segments) != 1 {
+			t.Fatalf("Expected 1 hop, got %d: %+v", len(segments), segments)
+		}
+		want := ResolvedSegment{
+			LinkName:      "shared",
+			ParentPath:    "kb1.system.shared",
+			KnowledgeBase: "kb2",
+			MountPath:     "kb2.library.common",
+			ResolvedPath:  "kb2.library.common.config.region",
+		}
+		if segments[0] != want {
+			t.Errorf("Expected %+v, got %+v", want, segments[0])
+		}
+
+		segments, err = kb.ResolveMountedPath("kb1.system.other")
+		if err != nil || len(segments) != 0 {
+			t.Errorf("Expected no hops for an unlinked path, got %v, %v", segments, err)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		setupTestLinks(t, kb,
+			map[string]string{"to_b": "kb1.a", "to_a": "kb2.b"},
+			map[string]string{"to_b": "kb2.b", "to_a": "kb1.a"})
+
+		if _, err := kb.ResolveMountedPath("kb1.a.leaf"); err == nil || !strings.Contains(err.Error(), "cycle") {
+			t.Errorf("Expected a mount cycle error, got %v", err)
+		}
+	})
+}
+
+// TestFindDescriptionPaths fetches a mix of existing and missing paths in input order
+func TestFindDescriptionPaths(t *testing.T) {
+	kb := setupTestSearch(t, 3)
+	defer kb.Disconnect()
+
+	paths := []string{"kb1.node3", "kb1.missing", "kb1.node1", "kb1.node9"}
+	results, err := kb.FindDescriptionPaths(paths)
+	if err != nil {
+		t.Fatalf("Error finding description paths: %v", err)
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("Expected %d results, got %d", len(paths), len(results))
+	}
+
+	for i, path := range paths {
+		data, ok := results[i][path]
+		if !ok {
+			t.Errorf("Result %d: expected key %s, got %v", i, path, results[i])
+			continue
+		}
+		absent := path == "kb1.missing" || path == "kb1.node9"
+		if absent && data != nil {
+			t.Errorf("Expected nil marker for %s, got %v", path, data)
+		}
+		if !absent && data == nil {
+			t.Errorf("Expected data for %s, got nil", path)
+		}
+	}
+}
+
+// TestSearchExcludesDeleted checks tombstoned nodes are hidden unless IncludeDeleted is set
+func TestSearchExcludesDeleted(t *testing.T) {
+	kb := setupTestSearch(t, 4)
+	defer kb.Disconnect()
+
+	if _, err := kb.conn.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NOW() WHERE path = 'kb1.node2'", testDBTable)); err != nil {
+		t.Fatalf("Error tombstoning node: %v", err)
+	}
+
+	kb.ClearFilters()
+	kb.SearchLabel("even")
+	results, err := kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 1 || results[0]["path"] != "kb1.node4" {
+		t.Errorf("Expected only kb1.node4, got %v", results)
+	}
+	if data, _ := kb.FindDescriptionPath("kb1.node2"); data["kb1.node2"] != nil {
+		t.Errorf("Expected no description for a deleted node, got %v", data)
+	}
+
+	kb.IncludeDeleted = true
+	results, err = kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 nodes with IncludeDeleted, got %d", len(results))
+	}
+}
+
+// TestSearchWithoutDeletedColumn checks that a table created before soft-delete
+// support can still be searched
+func TestSearchWithoutDeletedColumn(t *testing.T) {
+	kb := setupTestSearch(t, 4)
+	defer kb.Disconnect()
+
+	if _, err := kb.conn.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN deleted_at", testDBTable)); err != nil {
+		t.Fatalf("Error dropping deleted_at: %v", err)
+	}
+
+	kb.SearchLabel("even")
+	results, err := kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 even nodes, got %d", len(results))
+	}
+	if data, err := kb.FindDescriptionPath("kb1.node2"); err != nil || data["kb1.node2"] == nil {
+		t.Errorf("Expected a description for kb1.node2, got %v, %v", data, err)
+	}
+}
+
+// TestSearchStartingPathDepth checks the depth bound over a 3-level tree
+func TestSearchStartingPathDepth(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	paths := []string{"kb1.a", "kb1.a.b", "kb1.a.c", "kb1.a.b.d", "kb1.e"}
+	for _, path := range paths {
+		_, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, path)
+			VALUES ('kb1', 'item', $1, $1::ltree)`, testDBTable), path)
+		if err != nil {
+			t.Fatalf("Error adding %s: %v", path, err)
+		}
+	}
+
+	cases := []struct {
+		maxDepth int
+		want     []string
+	}{
+		{0, []string{"kb1.a"}},
+		{1, []string{"kb1.a", "kb1.a.b", "kb1.a.c"}},
+		{-1, []string{"kb1.a", "kb1.a.b", "kb1.a.b.d", "kb1.a.c"}},
+	}
+	for _, c := range cases {
+		kb.ClearFilters()
+		kb.SearchStartingPathDepth("kb1.a", c.maxDepth)
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query at depth %d: %v", c.maxDepth, err)
+		}
+		got := []string{}
+		for _, node := range nodes {
+			got = append(got, node.Path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Depth %d: expected %v, got %v", c.maxDepth, c.want, got)
+		}
+	}
+}
+
+// TestFindWithLinkFlags checks the has_link and has_link_mount options narrow each component's lookup
+func TestFindWithLinkFlags(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	labels := []string{"KB_STATUS_FIELD", "KB_JOB_QUEUE", "KB_STREAM_FIELD"}
+	for _, label := range labels {
+		for _, node := range []struct {
+			name                  string
+			hasLink, hasLinkMount bool
+		}{
+			{"plain", false, false},
+			{"linked", true, false},
+			{"mounted", false, true},
+			{"both", true, true},
+		} {
+			_, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, has_link, has_link_mount, path)
+				VALUES ('kb1', $1, $2, $3, $4, ('kb1.' || lower($1) || '.' || $2)::ltree)`, testDBTable),
+				label, node.name, node.hasLink, node.hasLinkMount)
+			if err != nil {
+				t.Fatalf("Error adding %s %s: %v", label, node.name, err)
+			}
+		}
+	}
+
+	status := NewKBStatusData(kb, testDBTable)
+	jobs := NewKBJobQueue(kb, testDBTable)
+	streams := NewKBStream(kb, testDBTable)
+	finders := map[string]func(opts ...FindOption) ([]map[string]interface{}, error){
+		"status": func(opts ...FindOption) ([]map[string]interface{}, error) {
+			return status.FindNodeIDs(nil, nil, nil, nil, opts...)
+		},
+		"job": func(opts ...FindOption) ([]map[string]interface{}, error) {
+			return jobs.FindJobIDs(nil, nil, nil, nil, opts...)
+		},
+		"stream": func(opts ...FindOption) ([]map[string]interface{}, error) {
+			return streams.FindStreamIDs(nil, nil, nil, nil, opts...)
+		},
+	}
+
+	cases := []struct {
+		name string
+		opts []FindOption
+		want []string
+	}{
+		{"NoFilter", nil, []string{"both", "linked", "mounted", "plain"}},
+		{"HasLink", []FindOption{WithHasLink(true)}, []string{"both", "linked"}},
+		{"NoLink", []FindOption{WithHasLink(false)}, []string{"mounted", "plain"}},
+		{"HasLinkMount", []FindOption{WithHasLinkMount(true)}, []string{"both", "mounted"}},
+		{"LinkWithoutMount", []FindOption{WithHasLink(true), WithHasLinkMount(false)}, []string{"linked"}},
+	}
+	for component, find := range finders {
+		for _, c := range cases {
+			rows, err := find(c.opts...)
+			if err != nil {
+				t.Fatalf("%s %s: error finding nodes: %v", component, c.name, err)
+			}
+			got := []string{}
+			for _, row := range rows {
+				got = append(got, fmt.Sprint(row["name"]))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s %s: expected %v, got %v", component, c.name, c.want, got)
+			}
+		}
+	}
+}
+
+// TestLikePattern checks wildcard translation and escaping of LIKE metacharacters
+func TestLikePattern(t *testing.T) {
+	cases := map[string]string{
+		"abc*":    "abc%",
+		"a?c":     "a_c",
+		"100%":    `100\%`,
+		"snake_*": `snake\_%`,
+		`back\`:   `back\\`,
+	}
+	for in, want := range cases {
+		if got := likePattern(in); got != want {
+			t.Errorf("likePattern(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+// TestSearchNameLike checks case-insensitive matching and literal % and _
+func TestSearchNameLike(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+
+	for _, name := range []string{"Alpha", "alphabet", "al_pha", "alXpha", "50%off", "50 off"} {
+		_, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, path)
+			VALUES ('kb1', 'item', $1, ('kb1.n' || md5($1))::ltree)`, testDBTable), name)
+		if err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+
+	names := func(search func()) []string {
+		t.Helper()
+		kb.ClearFilters()
+		search()
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		found := []string{}
+		for _, node := range nodes {
+			found = append(found, node.Name)
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	cases := []struct {
+		name   string
+		search func()
+		want   []string
+	}{
+		{"ILikePrefix", func() { kb.SearchNameILike("alpha*") }, []string{"Alpha", "alphabet"}},
+		{"LikeIsCaseSensitive", func() { kb.SearchNameLike("alpha*") }, []string{"alphabet"}},
+		{"UnderscoreIsLiteral", func() { kb.SearchNameILike("al_pha") }, []string{"al_pha"}},
+		{"QuestionMarkWildcard", func() { kb.SearchNameILike("al?pha") }, []string{"al_pha", "alXpha"}},
+		{"PercentIsLiteral", func() { kb.SearchNameILike("50%*") }, []string{"50%off"}},
+	}
+	for _, c := range cases {
+		if got := names(c.search); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+// TestClone forks a kb-scoped base query two ways and runs all three
+func TestClone(t *testing.T) {
+	kb := setupTestSearch(t, 6)
+	defer kb.Disconnect()
+
+	kb.ClearFilters()
+	kb.SearchKB("kb1")
+	even, odd := kb.Clone(), kb.Clone()
+	even.SearchLabel("even")
+	odd.SearchLabel("odd")
+	odd.SearchName("node3")
+
+	counts := map[string]int{}
+	for name, search := range map[string]*KBSearch{"base": kb, "even": even, "odd": odd} {
+		nodes, err := search.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing %s query: %v", name, err)
+		}
+		counts[name] = len(nodes)
+	}
+	if counts["base"] != 6 || counts["even"] != 3 || counts["odd"] != 1 {
+		t.Errorf("Unexpected result counts %v", counts)
+	}
+	if len(kb.Filters) != 1 {
+		t.Errorf("Expected the base to keep 1 filter, got %d", len(kb.Filters))
+	}
+
+	odd.Filters[0].Params["knowledge_base"] = "kb2"
+	if kb.Filters[0].Params["knowledge_base"] != "kb1" {
+		t.Error("Changing a clone's filter parameters changed the base")
+	}
+
+	if err := even.Disconnect(); err != nil {
+		t.Fatalf("Error disconnecting clone: %v", err)
+	}
+	if _, err := kb.ExecuteQueryNodes(); err != nil {
+		t.Errorf("Expected the base to keep its connection, got %v", err)
+	}
+}
+
+// TestSelect checks that ExecuteQuery returns only the selected columns and
+// property keys, and that unsafe field names are rejected
+func TestSelect(t *testing.T) {
+	kb := setupTestSearch(t, 3)
+	defer kb.Disconnect()
+
+	for _, field := range []string{"", "x; DROP TABLE nodes", "description'", "a.b"} {
+		if err := kb.Select(field); err == nil {
+			t.Errorf("Expected select field %q to be rejected", field)
+		}
+	}
+	if err := kb.Select("path", "path"); err == nil {
+		t.Error("Expected a duplicate select field to be rejected")
+	}
+
+	if err := kb.Select("path", "description", "missing"); err != nil {
+		t.Fatalf("Error selecting fields: %v", err)
+	}
+	kb.SearchKB("kb1")
+	results, err := kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	want := []string{"description", "missing", "path"}
+	for _, row := range results {
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("Expected keys %v, got %v", want, keys)
+		}
+		if row["description"] != "node "+strings.TrimPrefix(fmt.Sprint(row["path"]), "kb1.node") {
+			t.Errorf("Expected description to match path, got %v for %v", row["description"], row["path"])
+		}
+		if row["missing"] != nil {
+			t.Errorf("Expected nil for a missing key, got %v", row["missing"])
+		}
+	}
+
+	// Timestamps are node columns, not property keys
+	if _, err := kb.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN created_at TIMESTAMPTZ DEFAULT NOW()", testDBTable)); err != nil {
+		t.Fatalf("Error adding column: %v", err)
+	}
+	if err := kb.Select("path", "created_at"); err != nil {
+		t.Fatalf("Error selecting fields: %v", err)
+	}
+	results, err = kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	for _, row := range results {
+		if _, ok := row["created_at"].(time.Time); !ok {
+			t.Errorf("Expected created_at as a time, got %T %v", row["created_at"], row["created_at"])
+		}
+	}
+
+	// Select with no fields restores whole rows
+	if err := kb.Select(); err != nil {
+		t.Fatalf("Error clearing selection: %v", err)
+	}
+	results, err = kb.ExecuteQuery()
+	if err != nil {
+		t.Fatalf("Error executing query: %v", err)
+	}
+	if len(results) != 3 || results[0]["data"] == nil {
+		t.Errorf("Expected whole rows after clearing the selection, got %v", results)
+	}
+}
+
+// TestOrderBy checks that results come back in the same order on every run,
+// by path by default and by the OrderBy keys when set
+func TestOrderBy(t *testing.T) {
+	kb := setupTestSearch(t, 20)
+	defer kb.Disconnect()
+
+	// Shuffle the physical row order so an unordered scan would not match path order
+	if _, err := kb.conn.Exec(fmt.Sprintf("UPDATE %s SET name = name WHERE id %% 3 = 0", testDBTable)); err != nil {
+		t.Fatalf("Error updating rows: %v", err)
+	}
+
+	paths := func() []string {
+		t.Helper()
+		nodes, err := kb.ExecuteQueryNodes()
+		if err != nil {
+			t.Fatalf("Error executing query: %v", err)
+		}
+		result := make([]string, len(nodes))
+		for i, node := range nodes {
+			result[i] = node.Path
+		}
+		return result
+	}
+
+	kb.SearchKB("kb1")
+	first := paths()
+	if !sort.StringsAreSorted(first) {
+		t.Errorf("Expected results ordered by path by default, got %v", first)
+	}
+	for run := 0; run < 5; run++ {
+		if got := paths(); !reflect.DeepEqual(got, first) {
+			t.Fatalf("Run %d returned %v, expected %v", run, got, first)
+		}
+	}
+
+	if err := kb.OrderBy("label", true); err != nil {
+		t.Fatalf("Error ordering by label: %v", err)
+	}
+	ordered := paths()
+	for run := 0; run < 5; run++ {
+		if got := paths(); !reflect.DeepEqual(got, ordered) {
+			t.Fatalf("Run %d returned %v, expected %v", run, got, ordered)
+		}
+	}
+	// Even labels sort first, each group by path
+	if len(ordered) != 20 || ordered[0] != "kb1.node10" || ordered[10] != "kb1.node1" {
+		t.Errorf("Expected label then path order, got %v", ordered)
+	}
+}
+
+// TestQueriesAfterDisconnect verifies that queries on a disconnected KBSearch
+// return errors instead of panicking. sql.Open does not dial, so no database
+// is needed.
+func TestQueriesAfterDisconnect(t *testing.T) {
+	conn, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening pool: %v", err)
+	}
+	kb := newKBSearch(testDBTable)
+	kb.conn = conn
+	if err := kb.Disconnect(); err != nil {
+		t.Fatalf("Error disconnecting: %v", err)
+	}
+	ksd := NewKBStatusData(kb, testDBTable)
+
+	calls := map[string]func() error{
+		"FindDescriptionPath": func() error {
+			_, err := kb.FindDescriptionPath("kb1.node1")
+			return err
+		},
+		"FindDescriptionPaths": func() error {
+			_, err := kb.FindDescriptionPaths([]string{"kb1.node1"})
+			return err
+		},
+		"ExecuteQuery": func() error {
+			_, err := kb.ExecuteQuery()
+			return err
+		},
+		"GetConnAndCursor": func() error {
+			_, err := kb.GetConnAndCursor()
+			return err
+		},
+		"GetStatusData": func() error {
+			_, _, err := ksd.GetStatusData("kb1.status1")
+			return err
+		},
+		"GetMultipleStatusData": func() error {
+			_, err := ksd.GetMultipleStatusData([]string{"kb1.status1"})
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); err == nil {
+			t.Errorf("Expected %s to fail after Disconnect", name)
+		}
+	}
+	if err := kb.Disconnect(); err != nil {
+		t.Errorf("Expected nil error on second Disconnect, got %v", err)
+	}
+}
@@ -1,17 +1,86 @@
 package data_structures_module
 
 import (
+	"context"
+	"crypto/md5"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
 // KBStatusData handles the status data for the knowledge base
 type KBStatusData struct {
-	KBSearch  *KBSearch
-	BaseTable string
+	KBSearch     *KBSearch
+	BaseTable    string
+	HistoryTable string
+	history      bool
+	maxHistory   int
+	logger       Logger
+	retryPolicy  *RetryPolicy
+	observer     Observer
+	notify       bool
+}
+
+// StatusOption configures optional KBStatusData behaviour
+type StatusOption func(*KBStatusData)
+
+// WithStatusHistory records every SetStatusData write in the status history table.
+// maxHistory limits the rows kept per path; zero keeps everything.
+func WithStatusHistory(maxHistory int) StatusOption {
+	return func(ksd *KBStatusData) {
+		ksd.history = true
+		ksd.maxHistory = maxHistory
+	}
+}
+
+// WithStatusLogger sets the Logger used for warnings such as undecodable status rows
+func WithStatusLogger(logger Logger) StatusOption {
+	return func(ksd *KBStatusData) {
+		ksd.logger = logger
+	}
+}
+
+// WithStatusObserver sets the Observer that receives the latency of
+// SetStatusData and SetMultipleStatusData
+func WithStatusObserver(observer Observer) StatusOption {
+	return func(ksd *KBStatusData) {
+		ksd.observer = observer
+	}
+}
+
+// WithStatusRetryPolicy sets the RetryPolicy used by SetStatusData and
+// SetMultipleStatusData in place of their retryCount and retryDelay arguments
+func WithStatusRetryPolicy(policy *RetryPolicy) StatusOption {
+	return func(ksd *KBStatusData) {
+		ksd.retryPolicy = policy
+	}
+}
+
+// WithStatusNotify sends a NOTIFY on the path's channel in the same transaction
+// as every status write, so WatchStatus can deliver changes without polling
+func WithStatusNotify() StatusOption {
+	return func(ksd *KBStatusData) {
+		ksd.notify = true
+	}
+}
+
+// log returns the configured Logger, or a no-op logger when none is set
+func (ksd *KBStatusData) log() Logger {
+	if ksd.logger == nil {
+		return noopLogger{}
+	}
+	return ksd.logger
+}
+
+// StatusRecord represents a single historical status value
+type StatusRecord struct {
+	Path       string                 `json:"path"`
+	Data       map[string]interface{} `json:"data"`
+	RecordedAt time.Time              `json:"recorded_at"`
 }
 
 // StatusDataResult represents the result of status data operations
@@ -29,22 +98,27 @@ type MultipleStatusResult struct {
 }
 
 // NewKBStatusData creates a new KBStatusData instance
-func NewKBStatusData(kbSearch *KBSearch, database string) *KBStatusData {
-	return &KBStatusData{
-		KBSearch:  kbSearch,
-		BaseTable: fmt.Sprintf("%s_status", database),
+func NewKBStatusData(kbSearch *KBSearch, database string, opts ...StatusOption) *KBStatusData {
+	ksd := &KBStatusData{
+		KBSearch:     kbSearch,
+		BaseTable:    fmt.Sprintf("%s_status", database),
+		HistoryTable: fmt.Sprintf("%s_status_history", database),
 	}
+	for _, opt := range opts {
+		opt(ksd)
+	}
+	return ksd
 }
 
 // FindNodeID finds a single node id for given parameters
-func (ksd *KBStatusData) FindNodeID(kb, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
-	results, err := ksd.FindNodeIDs(kb, nodeName, properties, nodePath)
+func (ksd *KBStatusData) FindNodeID(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	results, err := ksd.FindNodeIDs(kb, nodeName, properties, nodePath, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no node found matching parameters: kb=%v, name=%v, properties=%v, path=%v",
+		return nil, fmt.Errorf("%w: no node found matching parameters: kb=%v, name=%v, properties=%v, path=%v", ErrNotFound,
 			kb, nodeName, properties, nodePath)
 	}
 	if len(results) > 1 {
@@ -56,7 +130,44 @@ func (ksd *KBStatusData) FindNodeID(kb, nodeName *string, properties map[string]
 }
 
 // FindNodeIDs finds all node ids matching the given parameters
-func (ksd *KBStatusData) FindNodeIDs(kb, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
+func (ksd *KBStatusData) FindNodeIDs(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
+	ksd.searchNodes(kb, nodeName, properties, nodePath, opts)
+
+	// Execute query and get results
+	nodeIDs, err := ksd.KBSearch.ExecuteQuery()
+	if err != nil {
+		return nil, fmt.Errorf("error finding node IDs: %w", err)
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, fmt.Errorf("%w: no nodes found matching parameters: kb=%v, name=%v, properties=%v, path=%v", ErrNotFound,
+			kb, nodeName, properties, nodePath)
+	}
+
+	return nodeIDs, nil
+}
+
+// FindNodes finds all status nodes matching the given parameters as typed nodes
+func (ksd *KBStatusData) FindNodes(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]Node, error) {
+	ksd.searchNodes(kb, nodeName, properties, nodePath, opts)
+
+	// Execute query and get results
+	nodes, err := ksd.KBSearch.ExecuteQueryNodes()
+	if err != nil {
+		return nil, fmt.Errorf("error finding node IDs: %w", err)
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: no nodes found matching parameters: kb=%v, name=%v, properties=%v, path=%v", ErrNotFound,
+			kb, nodeName, properties, nodePath)
+	}
+
+	return nodes, nil
+}
+
+// searchNodes replaces the KBSearch filters with those selecting status nodes
+// that match the given parameters
+func (ksd *KBStatusData) searchNodes(kb, nodeName *string, properties map[string]interface{}, nodePath *string, opts []FindOption) {
 	// Clear previous filters and build new query
 	ksd.KBSearch.ClearFilters()
 	ksd.KBSearch.SearchLabel("KB_STATUS_FIELD")
@@ -79,24 +190,15 @@ func (ksd *KBStatusData) FindNodeIDs(kb, nodeName *string, properties map[string
 		ksd.KBSearch.SearchPath(*nodePath)
 	}
 
-	// Execute query and get results
-	nodeIDs, err := ksd.KBSearch.ExecuteQuery()
-	if err != nil {
-		return nil, fmt.Errorf("error finding node IDs: %v", err)
+	for _, opt := range opts {
+		opt(ksd.KBSearch)
 	}
-
-	if len(nodeIDs) == 0 {
-		return nil, fmt.Errorf("no nodes found matching parameters: kb=%v, name=%v, properties=%v, path=%v",
-			kb, nodeName, properties, nodePath)
-	}
-
-	return nodeIDs, nil
 }
 
 // GetStatusData retrieves status data for a given path
 func (ksd *KBStatusData) GetStatusData(path string) (map[string]interface{}, string, error) {
 	if path == "" {
-		return nil, "", fmt.Errorf("path cannot be empty")
+		return nil, "", fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -106,22 +208,20 @@ func (ksd *KBStatusData) GetStatusData(path string) (map[string]interface{}, str
 		LIMIT 1
 	`, ksd.BaseTable)
 
-	row := ksd.KBSearch.conn.QueryRow(query, path)
-
-	var dataStr string
+	var dataJSON []byte
 	var pathValue string
-	err := row.Scan(&dataStr, &pathValue)
+	err := ksd.KBSearch.queryRow(query, []interface{}{path}, &dataJSON, &pathValue)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, "", fmt.Errorf("no data found for path: %s", path)
+			return nil, "", fmt.Errorf("%w: no data found for path: %s", ErrNotFound, path)
 		}
-		return nil, "", fmt.Errorf("error retrieving status data for path '%s': %v", path, err)
+		return nil, "", fmt.Errorf("error retrieving status data for path '%s': %w", path, err)
 	}
 
-	// Parse JSON data
+	// Parse JSON data; a NULL column yields a nil map
 	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
-		return nil, "", fmt.Errorf("failed to decode JSON data for path '%s': %v", path, err)
+	if err := decodeJSONMap(dataJSON, &data); err != nil {
+		return nil, "", fmt.Errorf("failed to decode JSON data for path '%s': %w", path, err)
 	}
 
 	return data, pathValue, nil
@@ -147,57 +247,114 @@ func (ksd *KBStatusData) GetMultipleStatusData(paths []string) (map[string]map[s
 		WHERE path IN (%s)
 	`, ksd.BaseTable, joinStrings(placeholders, ","))
 
-	rows, err := ksd.KBSearch.conn.Query(query, args...)
+	dataDict := make(map[string]map[string]interface{})
+
+	err := ksd.KBSearch.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var dataJSON []byte
+			var pathValue string
+			if err := rows.Scan(&dataJSON, &pathValue); err != nil {
+				continue
+			}
+
+			// Parse JSON data
+			var data map[string]interface{}
+			if err := decodeJSONMap(dataJSON, &data); err != nil {
+				// Log warning but continue
+				ksd.log().Errorf("failed to decode JSON for path '%s': %v", pathValue, err)
+				continue
+			}
+
+			dataDict[pathValue] = data
+		}
+		return nil
+	}, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving multiple status data: %v", err)
+		return nil, fmt.Errorf("error retrieving multiple status data: %w", err)
 	}
-	defer rows.Close()
 
-	dataDict := make(map[string]map[string]interface{})
+	return dataDict, nil
+}
 
-	for rows.Next() {
-		var dataStr string
-		var pathValue string
-		if err := rows.Scan(&dataStr, &pathValue); err != nil {
-			continue
+// GetStatusDataBatch retrieves status data for paths in a single query. Records
+// are keyed by path, with Path holding the stored path GetStatusData returns;
+// paths with no status row are omitted. RecordedAt is left zero since the status
+// table keeps no timestamp.
+func (ksd *KBStatusData) GetStatusDataBatch(paths []string) (map[string]StatusRecord, error) {
+	records := make(map[string]StatusRecord)
+	if len(paths) == 0 {
+		return records, nil
+	}
+	for _, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 		}
+	}
 
-		// Parse JSON data
-		var data map[string]interface{}
-		if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
-			// Log warning but continue
-			fmt.Printf("Warning: Failed to decode JSON for path '%s'\n", pathValue)
-			continue
-		}
+	query := fmt.Sprintf(`
+		SELECT data, path
+		FROM %s
+		WHERE path = ANY($1::ltree[])
+	`, ksd.BaseTable)
 
-		dataDict[pathValue] = data
+	var decodeErr error
+	err := ksd.KBSearch.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var dataJSON []byte
+			var pathValue string
+			if err := rows.Scan(&dataJSON, &pathValue); err != nil {
+				return fmt.Errorf("error scanning status data: %w", err)
+			}
+
+			// Parse JSON data; a NULL column yields a nil map
+			var data map[string]interface{}
+			if err := decodeJSONMap(dataJSON, &data); err != nil {
+				decodeErr = fmt.Errorf("failed to decode JSON data for path '%s': %w", pathValue, err)
+				return decodeErr
+			}
+
+			records[pathValue] = StatusRecord{Path: pathValue, Data: data}
+		}
+		return rows.Err()
+	}, query, pq.Array(paths))
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving status data batch: %w", err)
 	}
 
-	return dataDict, nil
+	return records, nil
 }
 
 // SetStatusData updates status data for a given path with retry logic
-func (ksd *KBStatusData) SetStatusData(path string, data map[string]interface{}, retryCount int, retryDelay time.Duration) (bool, string, error) {
+func (ksd *KBStatusData) SetStatusData(path string, data map[string]interface{}, retryCount int, retryDelay time.Duration) (ok bool, message string, err error) {
+	defer observeOp(ksd.observer, "SetStatusData", time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
 	// Input validation
 	if path == "" {
-		return false, "", fmt.Errorf("path cannot be empty")
+		return false, "", fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 	if data == nil {
-		return false, "", fmt.Errorf("data must be a valid map")
+		return false, "", fmt.Errorf("%w: data must be a valid map", ErrValidation)
 	}
 	if retryCount < 0 {
-		return false, "", fmt.Errorf("retry count must be non-negative")
+		return false, "", fmt.Errorf("%w: retry count must be non-negative", ErrValidation)
 	}
 	if retryDelay < 0 {
-		return false, "", fmt.Errorf("retry delay must be non-negative")
+		return false, "", fmt.Errorf("%w: retry delay must be non-negative", ErrValidation)
 	}
 
 	// Convert data to JSON once
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		return false, "", fmt.Errorf("failed to marshal data to JSON: %v", err)
+		return false, "", fmt.Errorf("%w: failed to marshal data to JSON: %w", ErrValidation, err)
 	}
 
+	policy := ksd.retryPolicy.orLinear(retryCount+1, retryDelay)
+	retryCount = policy.attempts() - 1
+
 	// Prepare the UPSERT query
 	upsertQuery := fmt.Sprintf(`
 		INSERT INTO %s (path, data)
@@ -212,11 +369,11 @@ func (ksd *KBStatusData) SetStatusData(path string, data map[string]interface{},
 
 	for attempt <= retryCount {
 		// Start transaction
-		tx, err := ksd.KBSearch.conn.Begin()
+		tx, err := ksd.KBSearch.begin()
 		if err != nil {
 			lastError = err
-			if attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
@@ -227,26 +384,32 @@ func (ksd *KBStatusData) SetStatusData(path string, data map[string]interface{},
 		var returnedPath string
 		var wasInserted bool
 		err = tx.QueryRow(upsertQuery, path, string(jsonData)).Scan(&returnedPath, &wasInserted)
+		if err == nil {
+			err = ksd.recordHistory(tx, path, string(jsonData))
+		}
+		if err == nil {
+			err = ksd.notifyChange(tx, path)
+		}
 		
 		if err != nil {
 			tx.Rollback()
 			lastError = err
 			
 			// Check if it's a transient error
-			if isTransientError(err) && attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(err, isTransientError) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
 			
-			return false, "", fmt.Errorf("error setting status data for path '%s': %v", path, err)
+			return false, "", fmt.Errorf("error setting status data for path '%s': %w", path, err)
 		}
 
 		// Commit transaction
 		if err := tx.Commit(); err != nil {
 			lastError = err
-			if attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
@@ -262,41 +425,117 @@ func (ksd *KBStatusData) SetStatusData(path string, data map[string]interface{},
 
 	// If we've exhausted all retries
 	errorMsg := fmt.Sprintf("Failed to set status data for path '%s' after %d attempts", path, retryCount+1)
-	if lastError != nil {
-		errorMsg += fmt.Sprintf(": %v", lastError)
+	return false, "", retriesExhausted(errorMsg, lastError)
+}
+
+// SetStatusDataIfUnchanged writes newData only if the stored value still equals expected.
+// Values are compared as JSONB, so key order and whitespace do not matter. The
+// status table holds a {} row for every status node from construction, so the
+// first swap on a path expects an empty map; a nil expected value only succeeds
+// for a path that has no row. It returns false without error when the stored
+// value no longer matches.
+func (ksd *KBStatusData) SetStatusDataIfUnchanged(path string, expected, newData map[string]interface{}) (_ bool, err error) {
+	defer mapStatementTimeoutTo(&err)
+	if path == "" {
+		return false, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if newData == nil {
+		return false, fmt.Errorf("%w: data must be a valid map", ErrValidation)
+	}
+
+	newJSON, err := json.Marshal(newData)
+	if err != nil {
+		return false, fmt.Errorf("%w: failed to marshal data to JSON: %w", ErrValidation, err)
+	}
+
+	var query string
+	params := []interface{}{path, string(newJSON)}
+	if expected == nil {
+		query = fmt.Sprintf(`
+			INSERT INTO %s (path, data)
+			VALUES ($1, $2)
+			ON CONFLICT (path) DO NOTHING
+			RETURNING path
+		`, ksd.BaseTable)
+	} else {
+		expectedJSON, err := json.Marshal(expected)
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to marshal expected data to JSON: %w", ErrValidation, err)
+		}
+		query = fmt.Sprintf(`
+			UPDATE %s
+			SET data = $2
+			WHERE path = $1
+			AND data::jsonb = $3::jsonb
+			RETURNING path
+		`, ksd.BaseTable)
+		params = append(params, string(expectedJSON))
+	}
+
+	tx, err := ksd.KBSearch.begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var returnedPath string
+	err = tx.QueryRow(query, params...).Scan(&returnedPath)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error setting status data for path '%s': %w", path, err)
+	}
+
+	if err := ksd.recordHistory(tx, path, string(newJSON)); err != nil {
+		return false, err
+	}
+	if err := ksd.notifyChange(tx, path); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
 	}
-	return false, "", fmt.Errorf(errorMsg)
+
+	return true, nil
 }
 
 // SetMultipleStatusData updates multiple path-data pairs in a single transaction
-func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[string]interface{}, retryCount int, retryDelay time.Duration) (bool, string, map[string]string, error) {
+func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[string]interface{}, retryCount int, retryDelay time.Duration) (ok bool, message string, errs map[string]string, err error) {
+	defer observeOp(ksd.observer, "SetMultipleStatusData", time.Now(), &err)
+	defer mapStatementTimeoutTo(&err)
+
 	if len(pathDataPairs) == 0 {
-		return false, "", nil, fmt.Errorf("pathDataPairs cannot be empty")
+		return false, "", nil, fmt.Errorf("%w: pathDataPairs cannot be empty", ErrValidation)
 	}
 	if retryCount < 0 {
-		return false, "", nil, fmt.Errorf("retry count must be non-negative")
+		return false, "", nil, fmt.Errorf("%w: retry count must be non-negative", ErrValidation)
 	}
 	if retryDelay < 0 {
-		return false, "", nil, fmt.Errorf("retry delay must be non-negative")
+		return false, "", nil, fmt.Errorf("%w: retry delay must be non-negative", ErrValidation)
 	}
 
 	// Validate and prepare JSON data
 	jsonPairs := make(map[string]string)
 	for path, data := range pathDataPairs {
 		if path == "" {
-			return false, "", nil, fmt.Errorf("path cannot be empty")
+			return false, "", nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 		}
 		if data == nil {
-			return false, "", nil, fmt.Errorf("data for path '%s' must be a valid map", path)
+			return false, "", nil, fmt.Errorf("%w: data for path '%s' must be a valid map", ErrValidation, path)
 		}
 
 		jsonData, err := json.Marshal(data)
 		if err != nil {
-			return false, "", nil, fmt.Errorf("failed to marshal data for path '%s': %v", path, err)
+			return false, "", nil, fmt.Errorf("%w: failed to marshal data for path '%s': %w", ErrValidation, path, err)
 		}
 		jsonPairs[path] = string(jsonData)
 	}
 
+	policy := ksd.retryPolicy.orLinear(retryCount+1, retryDelay)
+	retryCount = policy.attempts() - 1
+
 	// Prepare the UPSERT query
 	upsertQuery := fmt.Sprintf(`
 		INSERT INTO %s (path, data)
@@ -313,11 +552,11 @@ func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[stri
 		results := make(map[string]string)
 		
 		// Start transaction
-		tx, err := ksd.KBSearch.conn.Begin()
+		tx, err := ksd.KBSearch.begin()
 		if err != nil {
 			lastError = err
-			if attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
@@ -330,6 +569,12 @@ func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[stri
 			var returnedPath string
 			var wasInserted bool
 			err := tx.QueryRow(upsertQuery, path, jsonData).Scan(&returnedPath, &wasInserted)
+			if err == nil {
+				err = ksd.recordHistory(tx, path, jsonData)
+			}
+			if err == nil {
+				err = ksd.notifyChange(tx, path)
+			}
 			
 			if err != nil {
 				results[path] = "failed"
@@ -347,8 +592,8 @@ func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[stri
 		if !allSuccess {
 			tx.Rollback()
 			lastError = fmt.Errorf("some operations failed")
-			if attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(lastError, retryAlways) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
@@ -358,8 +603,8 @@ func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[stri
 		// Commit transaction
 		if err := tx.Commit(); err != nil {
 			lastError = err
-			if attempt < retryCount {
-				time.Sleep(retryDelay)
+			if attempt < retryCount && policy.retryable(err, retryAlways) {
+				policy.Wait(attempt + 1)
 				attempt++
 				continue
 			}
@@ -378,10 +623,7 @@ func (ksd *KBStatusData) SetMultipleStatusData(pathDataPairs map[string]map[stri
 
 	// If we've exhausted all retries
 	errorMsg := fmt.Sprintf("Failed to set multiple status data after %d attempts", retryCount+1)
-	if lastError != nil {
-		errorMsg += fmt.Sprintf(": %v", lastError)
-	}
-	return false, "", nil, fmt.Errorf(errorMsg)
+	return false, "", nil, retriesExhausted(errorMsg, lastError)
 }
 
 // SetMultipleStatusDataList is an alternative method that accepts a list of path-data pairs
@@ -398,6 +640,184 @@ func (ksd *KBStatusData) SetMultipleStatusDataList(pathDataPairs []struct {
 	return ksd.SetMultipleStatusData(pairsMap, retryCount, retryDelay)
 }
 
+// recordHistory appends a history row for path and prunes it to maxHistory when history is enabled
+func (ksd *KBStatusData) recordHistory(tx *sql.Tx, path string, jsonData string) error {
+	if !ksd.history {
+		return nil
+	}
+
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO %s (path, data)
+		VALUES ($1, $2)
+	`, ksd.HistoryTable)
+
+	if _, err := tx.Exec(insertQuery, path, jsonData); err != nil {
+		return fmt.Errorf("error recording status history: %w", err)
+	}
+
+	if ksd.maxHistory <= 0 {
+		return nil
+	}
+
+	pruneQuery := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE path = $1
+		AND id NOT IN (
+			SELECT id FROM %s
+			WHERE path = $1
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT $2
+		)
+	`, ksd.HistoryTable, ksd.HistoryTable)
+
+	if _, err := tx.Exec(pruneQuery, path, ksd.maxHistory); err != nil {
+		return fmt.Errorf("error pruning status history: %w", err)
+	}
+
+	return nil
+}
+
+// statusChannel returns the notification channel for path. The table name and
+// path are hashed together because channel names are limited to 63 bytes, so
+// the name is 39 bytes whatever the table is called.
+func (ksd *KBStatusData) statusChannel(path string) string {
+	return fmt.Sprintf("status_%x", md5.Sum([]byte(ksd.BaseTable+"\x00"+path)))
+}
+
+// notifyChange queues a notification for path when notifications are enabled;
+// it is delivered when tx commits
+func (ksd *KBStatusData) notifyChange(tx *sql.Tx, path string) error {
+	if !ksd.notify {
+		return nil
+	}
+	if _, err := tx.Exec("SELECT pg_notify($1, $2)", ksd.statusChannel(path), path); err != nil {
+		return fmt.Errorf("error notifying status change: %w", err)
+	}
+	return nil
+}
+
+// WatchStatus delivers the status data of path each time it is written, until
+// ctx is cancelled and the channel is closed. It requires WithStatusNotify.
+// Writes are coalesced: a consumer that falls behind receives only the latest
+// value, so a slow consumer never holds up the listener or the writers. The
+// value is re-read after the listener reconnects in case a write was missed.
+func (ksd *KBStatusData) WatchStatus(ctx context.Context, path string) (<-chan StatusRecord, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if !ksd.notify {
+		return nil, fmt.Errorf("%w: status notifications are not enabled", ErrValidation)
+	}
+
+	channel := ksd.statusChannel(path)
+	listener, err := ksd.KBSearch.newListener()
+	if err != nil {
+		return nil, err
+	}
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error listening on channel '%s': %w", channel, err)
+	}
+
+	out := make(chan StatusRecord)
+
+	go func() {
+		defer close(out)
+		defer listener.Close()
+
+		var pending *StatusRecord
+		for {
+			// Only offer a record once there is one to send
+			var send chan<- StatusRecord
+			var next StatusRecord
+			if pending != nil {
+				send = out
+				next = *pending
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+
+			case send <- next:
+				pending = nil
+
+			case n := <-listener.Notify:
+				// A nil notification means the connection was re-established
+				if n != nil && n.Extra != path {
+					continue
+				}
+				data, _, err := ksd.GetStatusData(path)
+				if err != nil {
+					ksd.log().Errorf("failed to read status for path '%s': %v", path, err)
+					continue
+				}
+				pending = &StatusRecord{Path: path, Data: data, RecordedAt: time.Now()}
+
+			case <-time.After(90 * time.Second):
+				// Check the connection periodically so a silent drop is noticed
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// GetStatusHistory returns recorded status values for a path, newest first.
+// limit <= 0 returns all rows; since restricts results to values recorded at or after it.
+func (ksd *KBStatusData) GetStatusHistory(path string, limit int, since *time.Time) ([]StatusRecord, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if !ksd.history {
+		return nil, fmt.Errorf("%w: status history is not enabled", ErrValidation)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT path, data, recorded_at
+		FROM %s
+		WHERE path = $1
+	`, ksd.HistoryTable)
+
+	params := []interface{}{path}
+	if since != nil {
+		params = append(params, *since)
+		query += fmt.Sprintf(" AND recorded_at >= $%d", len(params))
+	}
+	query += " ORDER BY recorded_at DESC, id DESC"
+	if limit > 0 {
+		params = append(params, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(params))
+	}
+
+	records := []StatusRecord{}
+	var decodeErr error
+	err := ksd.KBSearch.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var record StatusRecord
+			var dataJSON []byte
+			if err := rows.Scan(&record.Path, &dataJSON, &record.RecordedAt); err != nil {
+				return fmt.Errorf("error scanning status history: %w", err)
+			}
+			if err := decodeJSONMap(dataJSON, &record.Data); err != nil {
+				decodeErr = fmt.Errorf("failed to decode JSON data for path '%s': %w", path, err)
+				return decodeErr
+			}
+			records = append(records, record)
+		}
+		return rows.Err()
+	}, query, params...)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving status history for path '%s': %w", path, err)
+	}
+
+	return records, nil
+}
+
 // Helper functions
 
 // joinStrings joins strings with a separator
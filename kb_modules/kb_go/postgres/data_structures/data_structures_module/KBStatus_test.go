@@ -0,0 +1,336 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupTestStatus creates the status and status history tables for a KBStatusData
+func setupTestStatus(t *testing.T, opts ...StatusOption) *KBStatusData {
+	t.Helper()
+
+	kb := setupTestSearch(t, 0)
+	ksd := NewKBStatusData(kb, testDBTable, opts...)
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", ksd.BaseTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			data JSON,
+			path LTREE UNIQUE
+		)`, ksd.BaseTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", ksd.HistoryTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			path LTREE NOT NULL,
+			data JSON,
+			recorded_at TIMESTAMPTZ DEFAULT NOW()
+		)`, ksd.HistoryTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing status tables: %v", err)
+		}
+	}
+
+	return ksd
+}
+
+// TestGetStatusHistory verifies history is recorded newest-first and pruned to MaxHistory
+func TestGetStatusHistory(t *testing.T) {
+	ksd := setupTestStatus(t, WithStatusHistory(3))
+	defer ksd.KBSearch.Disconnect()
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 5; i++ {
+		if _, _, err := ksd.SetStatusData("kb1.status1", map[string]interface{}{"seq": i}, 0, 0); err != nil {
+			t.Fatalf("Error setting status data: %v", err)
+		}
+	}
+
+	history, err := ksd.GetStatusHistory("kb1.status1", 0, &start)
+	if err != nil {
+		t.Fatalf("Error getting status history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history rows after pruning, got %d", len(history))
+	}
+	for i, record := range history {
+		if seq, _ := record.Data["seq"].(float64); int(seq) != 4-i {
+			t.Errorf("Expected seq %d at position %d, got %v", 4-i, i, record.Data["seq"])
+		}
+	}
+
+	limited, err := ksd.GetStatusHistory("kb1.status1", 1, nil)
+	if err != nil || len(limited) != 1 {
+		t.Errorf("Expected 1 row with limit, got %d, %v", len(limited), err)
+	}
+}
+
+// TestGetStatusHistoryDisabled verifies history is opt-in
+func TestGetStatusHistoryDisabled(t *testing.T) {
+	ksd := &KBStatusData{}
+	if _, err := ksd.GetStatusHistory("kb1.status1", 0, nil); err == nil {
+		t.Error("Expected error when status history is not enabled")
+	}
+}
+
+// TestSetStatusDataIfUnchanged verifies compare-and-swap semantics
+func TestSetStatusDataIfUnchanged(t *testing.T) {
+	ksd := setupTestStatus(t)
+	defer ksd.KBSearch.Disconnect()
+
+	// Rows are pre-created with {} as ConstructStatusTable does
+	path := "kb1.status1"
+	insert := fmt.Sprintf("INSERT INTO %s (data, path) VALUES ('{}', $1)", ksd.BaseTable)
+	if _, err := ksd.KBSearch.conn.Exec(insert, path); err != nil {
+		t.Fatalf("Error pre-creating status row: %v", err)
+	}
+	v1 := map[string]interface{}{"count": 1, "state": "idle"}
+	v2 := map[string]interface{}{"count": 2, "state": "busy"}
+
+	// The pre-created row is not missing, and does not hold v2
+	if ok, err := ksd.SetStatusDataIfUnchanged(path, nil, v1); err != nil || ok {
+		t.Fatalf("Expected nil expected to fail on the pre-created row, got %v, %v", ok, err)
+	}
+	if ok, err := ksd.SetStatusDataIfUnchanged(path, v2, v1); err != nil || ok {
+		t.Fatalf("Expected mismatch to return false, got %v, %v", ok, err)
+	}
+
+	// The first swap expects the pre-created empty value
+	if ok, err := ksd.SetStatusDataIfUnchanged(path, map[string]interface{}{}, v1); err != nil || !ok {
+		t.Fatalf("Expected first swap from {} to succeed, got %v, %v", ok, err)
+	}
+	if ok, err := ksd.SetStatusDataIfUnchanged(path, map[string]interface{}{}, v2); err != nil || ok {
+		t.Fatalf("Expected a second swap from {} to fail, got %v, %v", ok, err)
+	}
+
+	// Matching expected value (key order irrelevant) is accepted
+	expected := map[string]interface{}{"state": "idle", "count": 1}
+	if ok, err := ksd.SetStatusDataIfUnchanged(path, expected, v2); err != nil || !ok {
+		t.Fatalf("Expected matching swap to succeed, got %v, %v", ok, err)
+	}
+
+	data, _, err := ksd.GetStatusData(path)
+	if err != nil {
+		t.Fatalf("Error getting status data: %v", err)
+	}
+	if data["state"] != "busy" {
+		t.Errorf("Expected state busy, got %v", data["state"])
+	}
+
+	// A path without a row is only written when nil is expected
+	if ok, err := ksd.SetStatusDataIfUnchanged("kb1.status2", map[string]interface{}{}, v1); err != nil || ok {
+		t.Errorf("Expected a swap on a missing row to fail, got %v, %v", ok, err)
+	}
+	if ok, err := ksd.SetStatusDataIfUnchanged("kb1.status2", nil, v1); err != nil || !ok {
+		t.Errorf("Expected nil expected to create the missing row, got %v, %v", ok, err)
+	}
+}
+
+// recordingLogger captures Errorf output for tests; it may be shared with a
+// watch goroutine, so access errors through lines
+type recordingLogger struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+// lines returns a copy of the captured output
+func (l *recordingLogger) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.errors...)
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {}
+func (l *recordingLogger) Infof(format string, args ...interface{})  {}
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// TestWithStatusLogger checks that GetMultipleStatusData reports an undecodable
+// row to an injected logger, and that the logger defaults to no-op
+func TestWithStatusLogger(t *testing.T) {
+	if _, ok := (&KBStatusData{}).log().(noopLogger); !ok {
+		t.Error("Expected the no-op logger by default")
+	}
+
+	logger := &recordingLogger{}
+	ksd := setupTestStatus(t, WithStatusLogger(logger))
+	defer ksd.KBSearch.Disconnect()
+
+	insert := fmt.Sprintf("INSERT INTO %s (data, path) VALUES ('{\"ok\": true}', 'kb1.good'), ('[1, 2]', 'kb1.bad')", ksd.BaseTable)
+	if _, err := ksd.KBSearch.conn.Exec(insert); err != nil {
+		t.Fatalf("Error inserting status rows: %v", err)
+	}
+
+	data, err := ksd.GetMultipleStatusData([]string{"kb1.good", "kb1.bad"})
+	if err != nil {
+		t.Fatalf("Error getting status data: %v", err)
+	}
+	if _, ok := data["kb1.bad"]; ok || len(data) != 1 {
+		t.Errorf("Expected only kb1.good to be returned, got %v", data)
+	}
+
+	lines := logger.lines()
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "failed to decode JSON for path 'kb1.bad': ") {
+		t.Errorf("Expected one decode error for kb1.bad, got %q", lines)
+	}
+}
+
+// TestWatchStatus sets status from another goroutine and receives the final value on the watch channel
+func TestWatchStatus(t *testing.T) {
+	ksd := setupTestStatus(t, WithStatusNotify())
+	defer ksd.KBSearch.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := ksd.WatchStatus(ctx, "kb1.status1")
+	if err != nil {
+		t.Fatalf("Error watching status: %v", err)
+	}
+
+	const writes = 5
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < writes; i++ {
+			if _, _, err := ksd.SetStatusData("kb1.status1", map[string]interface{}{"seq": i}, 0, 0); err != nil {
+				errs <- err
+				return
+			}
+			if _, _, err := ksd.SetStatusData("kb1.other", map[string]interface{}{"seq": i}, 0, 0); err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}()
+	if err := <-errs; err != nil {
+		t.Fatalf("Error setting status: %v", err)
+	}
+
+	// Rapid writes may be coalesced, but the last value must arrive
+	received := 0
+	for {
+		select {
+		case record := <-updates:
+			received++
+			if record.Path != "kb1.status1" {
+				t.Fatalf("Expected updates for kb1.status1 only, got %s", record.Path)
+			}
+			if seq, _ := record.Data["seq"].(float64); int(seq) == writes-1 {
+				if received > writes {
+					t.Errorf("Expected at most %d updates, got %d", writes, received)
+				}
+				cancel()
+				if _, ok := <-updates; ok {
+					t.Error("Expected channel to be closed after cancel")
+				}
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the final status after %d updates", received)
+		}
+	}
+}
+
+// TestWatchStatusRequiresNotify checks WatchStatus fails without WithStatusNotify
+func TestWatchStatusRequiresNotify(t *testing.T) {
+	ksd := NewKBStatusData(&KBSearch{}, testDBTable)
+	if _, err := ksd.WatchStatus(context.Background(), "kb1.status1"); err == nil {
+		t.Error("Expected an error when notifications are not enabled")
+	}
+}
+
+// TestStatusChannel checks channel names fit Postgres's 63-byte identifier
+// limit for long table names and differ by table and path
+func TestStatusChannel(t *testing.T) {
+	long := NewKBStatusData(&KBSearch{}, strings.Repeat("t", 63))
+	short := NewKBStatusData(&KBSearch{}, testDBTable)
+
+	channel := long.statusChannel("kb1.status1")
+	if len(channel) > 63 {
+		t.Errorf("Expected a channel of at most 63 bytes, got %d: %s", len(channel), channel)
+	}
+	if channel == long.statusChannel("kb1.status2") {
+		t.Error("Expected paths to get different channels")
+	}
+	if channel == short.statusChannel("kb1.status1") {
+		t.Error("Expected tables to get different channels")
+	}
+}
+
+// TestGetStatusDataNull reads a status row whose data column is NULL
+func TestGetStatusDataNull(t *testing.T) {
+	ksd := setupTestStatus(t)
+	defer ksd.KBSearch.Disconnect()
+
+	if _, err := ksd.KBSearch.conn.Exec(fmt.Sprintf("INSERT INTO %s (path, data) VALUES ('kb1.status1', NULL)", ksd.BaseTable)); err != nil {
+		t.Fatalf("Error adding status row: %v", err)
+	}
+
+	data, path, err := ksd.GetStatusData("kb1.status1")
+	if err != nil || path != "kb1.status1" || data != nil {
+		t.Errorf("Expected nil data for kb1.status1, got %v, %q, %v", data, path, err)
+	}
+	multi, err := ksd.GetMultipleStatusData([]string{"kb1.status1"})
+	if err != nil {
+		t.Fatalf("Error reading multiple status data: %v", err)
+	}
+	if data, ok := multi["kb1.status1"]; !ok || data != nil {
+		t.Errorf("Expected kb1.status1 with nil data, got %v", multi)
+	}
+}
+
+// TestGetStatusDataBatch fetches a mix of existing and missing paths
+func TestGetStatusDataBatch(t *testing.T) {
+	ksd := setupTestStatus(t)
+	defer ksd.KBSearch.Disconnect()
+
+	stmt := fmt.Sprintf(`INSERT INTO %s (path, data) VALUES
+		('kb1.status1', '{"value": 1}'),
+		('kb1.status2', '{"value": 2}'),
+		('kb1.status3', NULL)`, ksd.BaseTable)
+	if _, err := ksd.KBSearch.conn.Exec(stmt); err != nil {
+		t.Fatalf("Error adding status rows: %v", err)
+	}
+
+	records, err := ksd.GetStatusDataBatch([]string{"kb1.status1", "kb1.missing", "kb1.status2", "kb1.status3"})
+	if err != nil {
+		t.Fatalf("Error reading status data batch: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d: %v", len(records), records)
+	}
+	if _, ok := records["kb1.missing"]; ok {
+		t.Error("Expected kb1.missing to be omitted")
+	}
+	for _, path := range []string{"kb1.status1", "kb1.status2"} {
+		data, wantPath, err := ksd.GetStatusData(path)
+		if err != nil {
+			t.Fatalf("Error reading status data for %s: %v", path, err)
+		}
+		record := records[path]
+		if record.Path != wantPath || fmt.Sprint(record.Data) != fmt.Sprint(data) {
+			t.Errorf("Expected %s with %v, got %+v", wantPath, data, record)
+		}
+	}
+	if record, ok := records["kb1.status3"]; !ok || record.Data != nil {
+		t.Errorf("Expected kb1.status3 with nil data, got %+v", record)
+	}
+
+	if records, err := ksd.GetStatusDataBatch(nil); err != nil || len(records) != 0 {
+		t.Errorf("Expected no records for no paths, got %v, %v", records, err)
+	}
+	if _, err := ksd.GetStatusDataBatch([]string{"kb1.status1", ""}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation for an empty path, got %v", err)
+	}
+}
@@ -1,10 +1,14 @@
 package data_structures_module
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // KBStream handles stream data for the knowledge base
@@ -12,6 +16,16 @@ type KBStream struct {
 	KBSearch  *KBSearch
 	conn      *sql.DB
 	BaseTable string
+	// RetryPolicy overrides the maxRetries and retryDelay arguments of PushStreamData
+	RetryPolicy *RetryPolicy
+	// Observer receives the latency of PushStreamData; nil disables metrics
+	Observer Observer
+	// StatementTimeout makes Postgres cancel the stream's record queries that
+	// run longer than this, returning ErrStatementTimeout; zero falls back to
+	// the KBSearch's StatementTimeout
+	StatementTimeout time.Duration
+	keyCache         *streamKeyCache
+	keyColumn        keyColumn
 }
 
 // StreamRecord represents a single stream record
@@ -61,78 +75,69 @@ type StreamStatistics struct {
 	AvgIntervalSeconds      *float64      `json:"avg_interval_seconds,omitempty"`
 }
 
-// NewKBStream creates a new KBStream instance
-func NewKBStream(kbSearch *KBSearch, database string) *KBStream {
-	return &KBStream{
+// StreamStats summarises the valid records of a stream path. Gaps are the times
+// between consecutive records, so a large MaxGapSeconds indicates an ingestion
+// stall. For an empty stream every field is zero.
+type StreamStats struct {
+	Count              int       `json:"count"`
+	FirstAt            time.Time `json:"first_at"`
+	LastAt             time.Time `json:"last_at"`
+	AvgIntervalSeconds float64   `json:"avg_interval_seconds"`
+	MaxGapSeconds      float64   `json:"max_gap_seconds"`
+}
+
+// NewKBStream creates a new KBStream instance. opts enable optional behaviour
+// such as WithStreamKeyCache.
+func NewKBStream(kbSearch *KBSearch, database string, opts ...StreamOption) *KBStream {
+	ks := &KBStream{
 		KBSearch:  kbSearch,
 		conn:      kbSearch.conn,
 		BaseTable: fmt.Sprintf("%s_stream", database),
+		keyCache:  newStreamKeyCache(0),
 	}
+	for _, opt := range opts {
+		opt(ks)
+	}
+	return ks
 }
 
-// executeQuery executes a query and returns results as slice of maps
-func (ks *KBStream) executeQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := ks.conn.Query(query, params...)
-	if err != nil {
-		return nil, err
+// statementTimeout returns StatementTimeout, or the KBSearch's when it is zero
+func (ks *KBStream) statementTimeout() time.Duration {
+	if ks.StatementTimeout > 0 || ks.KBSearch == nil {
+		return ks.StatementTimeout
 	}
-	defer rows.Close()
+	return ks.KBSearch.StatementTimeout
+}
 
-	return rowsToMaps(rows)
+// executeQuery executes a query and returns results as slice of maps
+func (ks *KBStream) executeQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
+	err := queryWithTimeout(ks.conn, ks.statementTimeout(), func(rows *sql.Rows) (err error) {
+		results, err = rowsToMaps(rows)
+		return err
+	}, query, params...)
+	return results, err
 }
 
 // executeSingle executes a query and returns a single result as a map
 func (ks *KBStream) executeSingle(query string, params ...interface{}) (map[string]interface{}, error) {
-	rows, err := ks.conn.Query(query, params...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		return nil, nil
-	}
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	values := make([]interface{}, len(columns))
-	valuePointers := make([]interface{}, len(columns))
-	for i := range columns {
-		valuePointers[i] = &values[i]
-	}
-
-	if err := rows.Scan(valuePointers...); err != nil {
-		return nil, err
-	}
-
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		var v interface{}
-		val := values[i]
-		b, ok := val.([]byte)
-		if ok {
-			v = string(b)
-		} else {
-			v = val
-		}
-		result[col] = v
-	}
-
-	return result, nil
+	var result map[string]interface{}
+	err := queryWithTimeout(ks.conn, ks.statementTimeout(), func(rows *sql.Rows) (err error) {
+		result, err = firstRowToMap(rows)
+		return err
+	}, query, params...)
+	return result, err
 }
 
 // FindStreamID finds a single stream node id for given parameters
-func (ks *KBStream) FindStreamID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) (map[string]interface{}, error) {
-	results, err := ks.FindStreamIDs(kb, nodeName, properties, nodePath)
+func (ks *KBStream) FindStreamID(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) (map[string]interface{}, error) {
+	results, err := ks.FindStreamIDs(kb, nodeName, properties, nodePath, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no stream node found matching parameters: name=%v, properties=%v, path=%v", 
+		return nil, fmt.Errorf("%w: no stream node found matching parameters: name=%v, properties=%v, path=%v", ErrNotFound, 
 			nodeName, properties, nodePath)
 	}
 	if len(results) > 1 {
@@ -143,8 +148,21 @@ func (ks *KBStream) FindStreamID(kb *string, nodeName *string, properties map[st
 	return results[0], nil
 }
 
-// FindStreamIDs finds all stream node ids matching the given parameters
-func (ks *KBStream) FindStreamIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string) ([]map[string]interface{}, error) {
+// FindStreamIDs finds all stream node ids matching the given parameters. With
+// WithStreamKeyCache a lookup without opts is served from the cache until its
+// ttl elapses or InvalidateStreamKey drops it; a cached lookup leaves the
+// KBSearch filters and Results untouched.
+func (ks *KBStream) FindStreamIDs(kb *string, nodeName *string, properties map[string]interface{}, nodePath *string, opts ...FindOption) ([]map[string]interface{}, error) {
+	cacheKey, cached := "", false
+	if len(opts) == 0 && ks.keyCache.enabled() {
+		cacheKey, cached = streamLookupKey(kb, nodeName, properties, nodePath)
+	}
+	if cached {
+		if rows, ok := ks.keyCache.get(cacheKey); ok {
+			return rows, nil
+		}
+	}
+
 	// Clear previous filters
 	ks.KBSearch.ClearFilters()
 	ks.KBSearch.SearchLabel("KB_STREAM_FIELD")
@@ -167,17 +185,28 @@ func (ks *KBStream) FindStreamIDs(kb *string, nodeName *string, properties map[s
 		ks.KBSearch.SearchPath(*nodePath)
 	}
 
+	for _, opt := range opts {
+		opt(ks.KBSearch)
+	}
+
 	// Execute query
 	nodeIDs, err := ks.KBSearch.ExecuteQuery()
 	if err != nil {
-		return nil, fmt.Errorf("error finding stream node IDs: %v", err)
+		return nil, fmt.Errorf("error finding stream node IDs: %w", err)
 	}
 
 	if len(nodeIDs) == 0 {
-		return nil, fmt.Errorf("no stream nodes found matching parameters: name=%v, properties=%v, path=%v", 
+		return nil, fmt.Errorf("%w: no stream nodes found matching parameters: name=%v, properties=%v, path=%v", ErrNotFound, 
 			nodeName, properties, nodePath)
 	}
 
+	if cached {
+		paths := ks.FindStreamTableKeys(nodeIDs)
+		if nodePath != nil {
+			paths = append(paths, *nodePath)
+		}
+		ks.keyCache.put(cacheKey, paths, nodeIDs)
+	}
 	return nodeIDs, nil
 }
 
@@ -198,12 +227,14 @@ func (ks *KBStream) FindStreamTableKeys(keyData []map[string]interface{}) []stri
 }
 
 // PushStreamData finds the oldest record for the given path and updates it with new data
-func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, maxRetries int, retryDelay time.Duration) (*StreamPushResult, error) {
+func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, maxRetries int, retryDelay time.Duration, opts ...PushOption) (result *StreamPushResult, err error) {
+	defer observeOp(ks.Observer, "PushStreamData", time.Now(), &err)
+
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 	if data == nil {
-		return nil, fmt.Errorf("data must be a valid map")
+		return nil, fmt.Errorf("%w: data must be a valid map", ErrValidation)
 	}
 
 	if maxRetries <= 0 {
@@ -213,7 +244,23 @@ func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, max
 		retryDelay = time.Second
 	}
 
+	policy := ks.RetryPolicy.orLinear(maxRetries, retryDelay)
+	maxRetries = policy.attempts()
+	pushOpts := newPushOptions(opts)
+	keySet, keyArgs, err := ks.keyColumn.assignment(ks.conn.QueryRow, ks.BaseTable, pushOpts, 3)
+	if err != nil {
+		return nil, err
+	}
+
 	for attempt := 1; attempt <= maxRetries; attempt++ {
+		// A record already pushed with this key is returned as is
+		if pushOpts.idempotencyKey != "" {
+			existing, err := ks.findPushedRecord(pushOpts.idempotencyKey)
+			if err != nil || existing != nil {
+				return existing, err
+			}
+		}
+
 		// Check if records exist
 		countQuery := fmt.Sprintf(`
 			SELECT COUNT(*) as count
@@ -232,7 +279,7 @@ func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, max
 		}
 
 		if count == 0 {
-			return nil, fmt.Errorf("no records found for path='%s'. Records must be pre-allocated for stream tables", path)
+			return nil, fmt.Errorf("%w: no records found for path='%s'. Records must be pre-allocated for stream tables", ErrNotFound, path)
 		}
 
 		// Try to lock the oldest record
@@ -253,10 +300,10 @@ func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, max
 		if row == nil {
 			// All rows are locked
 			if attempt < maxRetries {
-				time.Sleep(retryDelay)
+				policy.Wait(attempt)
 				continue
 			}
-			return nil, fmt.Errorf("could not lock any row for path='%s' after %d attempts", path, maxRetries)
+			return nil, fmt.Errorf("%w: could not lock any row for path='%s' after %d attempts", ErrConflict, path, maxRetries)
 		}
 
 		recordID := row["id"].(int64)
@@ -266,19 +313,27 @@ func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, max
 		// Update the record
 		jsonData, err := json.Marshal(data)
 		if err != nil {
-			return nil, fmt.Errorf("error marshaling data: %v", err)
+			return nil, fmt.Errorf("%w: error marshaling data: %w", ErrValidation, err)
 		}
 
 		updateQuery := fmt.Sprintf(`
 			UPDATE %s
 			SET data = $1,
 			    recorded_at = NOW(),
-			    valid = TRUE
+			    valid = TRUE%s
 			WHERE id = $2
 			RETURNING id, path, recorded_at, data, valid
-		`, ks.BaseTable)
-
-		updatedRow, err := ks.executeSingle(updateQuery, string(jsonData), recordID)
+		`, ks.BaseTable, keySet)
+
+		updatedRow, err := ks.executeSingle(updateQuery, append([]interface{}{string(jsonData), recordID}, keyArgs...)...)
+		if isUniqueViolation(err) {
+			// A concurrent push with the same key committed first
+			existing, err := ks.findPushedRecord(pushOpts.idempotencyKey)
+			if err == nil && existing == nil {
+				err = fmt.Errorf("%w: idempotency key '%s' collided but no record holds it", ErrConflict, pushOpts.idempotencyKey)
+			}
+			return existing, err
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -310,10 +365,45 @@ func (ks *KBStream) PushStreamData(path string, data map[string]interface{}, max
 	return nil, fmt.Errorf("unexpected error in push_stream_data")
 }
 
+// MigrateIdempotencyKey adds the idempotency_key column used by
+// WithIdempotencyKey to a stream table created before it existed. It does
+// nothing when the column is already there.
+func (ks *KBStream) MigrateIdempotencyKey() error {
+	return ks.keyColumn.migrate(ks.conn, ks.BaseTable)
+}
+
+// findPushedRecord returns the record stored with idempotency key as a push
+// result, or nil if there is none
+func (ks *KBStream) findPushedRecord(key string) (*StreamPushResult, error) {
+	query := fmt.Sprintf(`
+		SELECT id, path, recorded_at, data, valid
+		FROM %s
+		WHERE idempotency_key = $1
+	`, ks.BaseTable)
+
+	row, err := ks.executeSingle(query, key)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up idempotency key '%s': %w", key, err)
+	}
+	if row == nil {
+		return nil, nil
+	}
+
+	record := mapToStreamRecord(row)
+	return &StreamPushResult{
+		ID:         record.ID,
+		Path:       record.Path,
+		RecordedAt: record.RecordedAt,
+		Data:       record.Data,
+		Valid:      record.Valid,
+		Operation:  "idempotent_replay",
+	}, nil
+}
+
 // GetLatestStreamData gets the most recent valid stream data for a given path
 func (ks *KBStream) GetLatestStreamData(path string) (*StreamRecord, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -326,7 +416,7 @@ func (ks *KBStream) GetLatestStreamData(path string) (*StreamRecord, error) {
 
 	result, err := ks.executeSingle(query, path)
 	if err != nil {
-		return nil, fmt.Errorf("error getting latest stream data for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error getting latest stream data for path '%s': %w", path, err)
 	}
 
 	if result == nil {
@@ -339,7 +429,7 @@ func (ks *KBStream) GetLatestStreamData(path string) (*StreamRecord, error) {
 // GetStreamDataCount counts the number of stream entries for a given path
 func (ks *KBStream) GetStreamDataCount(path string, includeInvalid bool) (int, error) {
 	if path == "" {
-		return 0, fmt.Errorf("path cannot be empty")
+		return 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	var query string
@@ -359,7 +449,7 @@ func (ks *KBStream) GetStreamDataCount(path string, includeInvalid bool) (int, e
 
 	result, err := ks.executeSingle(query, path)
 	if err != nil {
-		return 0, fmt.Errorf("error counting stream data for path '%s': %v", path, err)
+		return 0, fmt.Errorf("error counting stream data for path '%s': %w", path, err)
 	}
 
 	if result == nil {
@@ -429,14 +519,75 @@ func (ks *KBStream) ClearStreamData(path string, olderThan *time.Time) *ClearRes
 	}
 }
 
-// ListStreamData lists valid stream data for a given path with filtering and pagination
-func (ks *KBStream) ListStreamData(path string, limit *int, offset int, recordedAfter, recordedBefore *time.Time, order string) ([]StreamRecord, error) {
+// DeleteStreamDataOlderThan removes the records of streamKey recorded before
+// cutoff and returns how many were removed. Stream rows are preallocated slots,
+// so removed records are marked invalid (as ClearStreamData does) and their
+// slots are reused by PushStreamData.
+func (ks *KBStream) DeleteStreamDataOlderThan(streamKey string, cutoff time.Time) (int, error) {
+	if streamKey == "" {
+		return 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET valid = FALSE
+		WHERE path = $1 AND valid = TRUE AND recorded_at < $2
+	`, ks.BaseTable)
+
+	result, err := ks.conn.Exec(query, streamKey, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting stream data older than %v for path '%s': %w", cutoff, streamKey, err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// DeleteStreamDataKeepLast removes all but the newest n records of streamKey
+// and returns how many were removed. Like DeleteStreamDataOlderThan, removed
+// records are marked invalid.
+func (ks *KBStream) DeleteStreamDataKeepLast(streamKey string, n int) (int, error) {
+	if streamKey == "" {
+		return 0, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%w: number of records to keep must be non-negative, got %d", ErrValidation, n)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET valid = FALSE
+		WHERE path = $1 AND valid = TRUE
+		AND id NOT IN (
+			SELECT id FROM %s
+			WHERE path = $1 AND valid = TRUE
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT $2
+		)
+	`, ks.BaseTable, ks.BaseTable)
+
+	result, err := ks.conn.Exec(query, streamKey, n)
+	if err != nil {
+		return 0, fmt.Errorf("error trimming stream data for path '%s' to %d records: %w", streamKey, n, err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// streamDataQuery returns the unpaged query and parameters listing valid stream
+// data for a path within the optional time bounds
+func (ks *KBStream) streamDataQuery(path string, recordedAfter, recordedBefore *time.Time, order string) (string, []interface{}, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return "", nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	if order != "ASC" && order != "DESC" {
-		return nil, fmt.Errorf("order must be 'ASC' or 'DESC'")
+		return "", nil, fmt.Errorf("%w: order must be 'ASC' or 'DESC'", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -461,22 +612,20 @@ func (ks *KBStream) ListStreamData(path string, limit *int, offset int, recorded
 	}
 
 	query += fmt.Sprintf(" ORDER BY recorded_at %s", order)
+	return query, params, nil
+}
 
-	if limit != nil && *limit > 0 {
-		paramCount++
-		query += fmt.Sprintf(" LIMIT $%d", paramCount)
-		params = append(params, *limit)
-	}
-
-	if offset > 0 {
-		paramCount++
-		query += fmt.Sprintf(" OFFSET $%d", paramCount)
-		params = append(params, offset)
+// ListStreamData lists valid stream data for a given path with filtering and pagination
+func (ks *KBStream) ListStreamData(path string, limit *int, offset int, recordedAfter, recordedBefore *time.Time, order string) ([]StreamRecord, error) {
+	query, params, err := ks.streamDataQuery(path, recordedAfter, recordedBefore, order)
+	if err != nil {
+		return nil, err
 	}
+	query, params = appendLimitOffset(query, params, limit, offset)
 
 	rows, err := ks.executeQuery(query, params...)
 	if err != nil {
-		return nil, fmt.Errorf("error listing stream data for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error listing stream data for path '%s': %w", path, err)
 	}
 
 	results := []StreamRecord{}
@@ -487,16 +636,38 @@ func (ks *KBStream) ListStreamData(path string, limit *int, offset int, recorded
 	return results, nil
 }
 
+// ListStreamDataPage returns one page of valid stream data for a path together
+// with the total number of records matching the time bounds, read from the same
+// snapshot. A limit of zero or less returns every record from offset on.
+func (ks *KBStream) ListStreamDataPage(path string, limit, offset int, recordedAfter, recordedBefore *time.Time, order string) ([]StreamRecord, int, error) {
+	query, params, err := ks.streamDataQuery(path, recordedAfter, recordedBefore, order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, total, err := queryPage(ks.conn, query, params, &limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing stream data for path '%s': %w", path, err)
+	}
+
+	results := []StreamRecord{}
+	for _, row := range rows {
+		results = append(results, *mapToStreamRecord(row))
+	}
+
+	return results, total, nil
+}
+
 // GetStreamDataRange gets valid stream data within a specific time range
 func (ks *KBStream) GetStreamDataRange(path string, startTime, endTime time.Time) ([]StreamRecord, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 	if startTime.IsZero() || endTime.IsZero() {
-		return nil, fmt.Errorf("both start_time and end_time must be provided")
+		return nil, fmt.Errorf("%w: both start_time and end_time must be provided", ErrValidation)
 	}
 	if !startTime.Before(endTime) {
-		return nil, fmt.Errorf("start_time must be before end_time")
+		return nil, fmt.Errorf("%w: start_time must be before end_time", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -511,7 +682,7 @@ func (ks *KBStream) GetStreamDataRange(path string, startTime, endTime time.Time
 
 	rows, err := ks.executeQuery(query, path, startTime, endTime)
 	if err != nil {
-		return nil, fmt.Errorf("error getting stream data range for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error getting stream data range for path '%s': %w", path, err)
 	}
 
 	results := []StreamRecord{}
@@ -522,10 +693,54 @@ func (ks *KBStream) GetStreamDataRange(path string, startTime, endTime time.Time
 	return results, nil
 }
 
+// GetStreamWindow returns up to limit valid records recorded in the half-open
+// window [start, end), oldest first, so adjacent windows never share a record.
+// hasMore reports that the window held more than limit records and the result
+// was truncated.
+func (ks *KBStream) GetStreamWindow(streamKey string, start, end time.Time, limit int) (records []StreamRecord, hasMore bool, err error) {
+	if streamKey == "" {
+		return nil, false, fmt.Errorf("%w: stream key cannot be empty", ErrValidation)
+	}
+	if !start.Before(end) {
+		return nil, false, fmt.Errorf("%w: start must be before end", ErrValidation)
+	}
+	if limit <= 0 {
+		return nil, false, fmt.Errorf("%w: limit must be positive", ErrValidation)
+	}
+
+	// Fetch one extra row to learn whether the window was truncated
+	query := fmt.Sprintf(`
+		SELECT id, path, recorded_at, data, valid
+		FROM %s
+		WHERE path = $1
+		AND recorded_at >= $2
+		AND recorded_at < $3
+		AND valid = TRUE
+		ORDER BY recorded_at ASC, id ASC
+		LIMIT $4
+	`, ks.BaseTable)
+
+	rows, err := ks.executeQuery(query, streamKey, start, end, limit+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting stream window for path '%s': %w", streamKey, err)
+	}
+
+	if len(rows) > limit {
+		rows = rows[:limit]
+		hasMore = true
+	}
+	records = []StreamRecord{}
+	for _, row := range rows {
+		records = append(records, *mapToStreamRecord(row))
+	}
+
+	return records, hasMore, nil
+}
+
 // GetStreamStatistics gets comprehensive statistics for stream data at a given path
 func (ks *KBStream) GetStreamStatistics(path string, includeInvalid bool) (*StreamStatistics, error) {
 	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
 	}
 
 	var query string
@@ -539,10 +754,14 @@ func (ks *KBStream) GetStreamStatistics(path string, includeInvalid bool) (*Stre
 				MAX(CASE WHEN valid = TRUE THEN recorded_at END) as latest_valid_recorded,
 				MIN(recorded_at) as earliest_recorded_overall,
 				MAX(recorded_at) as latest_recorded_overall,
-				AVG(EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at)))) as avg_interval_seconds_all,
-				AVG(CASE WHEN valid = TRUE THEN EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at))) END) as avg_interval_seconds_valid
-			FROM %s
-			WHERE path = $1
+				AVG(interval_seconds) as avg_interval_seconds_all,
+				AVG(CASE WHEN valid = TRUE THEN interval_seconds END) as avg_interval_seconds_valid
+			FROM (
+				SELECT valid, recorded_at,
+					EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at)))::float8 AS interval_seconds
+				FROM %s
+				WHERE path = $1
+			) AS intervals
 		`, ks.BaseTable)
 	} else {
 		query = fmt.Sprintf(`
@@ -550,15 +769,19 @@ func (ks *KBStream) GetStreamStatistics(path string, includeInvalid bool) (*Stre
 				COUNT(*) as valid_records,
 				MIN(recorded_at) as earliest_recorded,
 				MAX(recorded_at) as latest_recorded,
-				AVG(EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at)))) as avg_interval_seconds
-			FROM %s
-			WHERE path = $1 AND valid = TRUE
+				AVG(interval_seconds) as avg_interval_seconds
+			FROM (
+				SELECT recorded_at,
+					EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at)))::float8 AS interval_seconds
+				FROM %s
+				WHERE path = $1 AND valid = TRUE
+			) AS intervals
 		`, ks.BaseTable)
 	}
 
 	result, err := ks.executeSingle(query, path)
 	if err != nil {
-		return nil, fmt.Errorf("error getting stream statistics for path '%s': %v", path, err)
+		return nil, fmt.Errorf("error getting stream statistics for path '%s': %w", path, err)
 	}
 
 	if result == nil {
@@ -577,10 +800,44 @@ func (ks *KBStream) GetStreamStatistics(path string, includeInvalid bool) (*Stre
 	return mapToStreamStatistics(result, includeInvalid), nil
 }
 
+// GetStreamStats computes StreamStats over the valid records of path in a single
+// query. An empty stream returns zero values rather than an error.
+func (ks *KBStream) GetStreamStats(path string) (StreamStats, error) {
+	if path == "" {
+		return StreamStats{}, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			MIN(recorded_at),
+			MAX(recorded_at),
+			COALESCE(AVG(gap_seconds), 0),
+			COALESCE(MAX(gap_seconds), 0)
+		FROM (
+			SELECT recorded_at,
+				EXTRACT(EPOCH FROM (recorded_at - LAG(recorded_at) OVER (ORDER BY recorded_at)))::float8 AS gap_seconds
+			FROM %s
+			WHERE path = $1 AND valid = TRUE
+		) AS gaps
+	`, ks.BaseTable)
+
+	var stats StreamStats
+	var firstAt, lastAt sql.NullTime
+	err := ks.conn.QueryRow(query, path).Scan(&stats.Count, &firstAt, &lastAt, &stats.AvgIntervalSeconds, &stats.MaxGapSeconds)
+	if err != nil {
+		return StreamStats{}, fmt.Errorf("error getting stream stats for path '%s': %w", path, err)
+	}
+	stats.FirstAt = firstAt.Time
+	stats.LastAt = lastAt.Time
+
+	return stats, nil
+}
+
 // GetStreamDataByID retrieves a specific stream record by its ID
 func (ks *KBStream) GetStreamDataByID(recordID int) (*StreamRecord, error) {
 	if recordID <= 0 {
-		return nil, fmt.Errorf("record_id must be a valid positive integer")
+		return nil, fmt.Errorf("%w: record_id must be a valid positive integer", ErrValidation)
 	}
 
 	query := fmt.Sprintf(`
@@ -591,7 +848,7 @@ func (ks *KBStream) GetStreamDataByID(recordID int) (*StreamRecord, error) {
 
 	result, err := ks.executeSingle(query, recordID)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving stream record with id %d: %v", recordID, err)
+		return nil, fmt.Errorf("error retrieving stream record with id %d: %w", recordID, err)
 	}
 
 	if result == nil {
@@ -601,6 +858,245 @@ func (ks *KBStream) GetStreamDataByID(recordID int) (*StreamRecord, error) {
 	return mapToStreamRecord(result), nil
 }
 
+// GetStreamDataByIDs retrieves the records of streamKey with the given ids in a
+// single query. The result is keyed by id; ids that do not exist, or belong to
+// another stream, are absent.
+func (ks *KBStream) GetStreamDataByIDs(streamKey string, ids []int) (map[int]map[string]interface{}, error) {
+	if streamKey == "" {
+		return nil, fmt.Errorf("%w: stream key cannot be empty", ErrValidation)
+	}
+
+	results := make(map[int]map[string]interface{}, len(ids))
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, path, recorded_at, data, valid
+		FROM %s
+		WHERE path = $1 AND id = ANY($2)
+	`, ks.BaseTable)
+
+	rows, err := ks.executeQuery(query, streamKey, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving stream records for path '%s': %w", streamKey, err)
+	}
+
+	for _, row := range rows {
+		if id, ok := row["id"].(int64); ok {
+			results[int(id)] = row
+		}
+	}
+
+	return results, nil
+}
+
+// StreamBucket is one time bucket of a stream aggregate
+type StreamBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	// Value holds the avg/min/max result; nil for count or when the bucket has no numeric values
+	Value *float64 `json:"value,omitempty"`
+}
+
+// parseAggregateFunction splits an aggregate spec into the SQL function and JSON field.
+// Accepted forms are "count", "avg:<field>", "min:<field>" and "max:<field>".
+func parseAggregateFunction(fn string) (string, string, error) {
+	if fn == "count" {
+		return "COUNT", "", nil
+	}
+
+	parts := strings.SplitN(fn, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("%w: invalid aggregate '%s': use count, avg:<field>, min:<field> or max:<field>", ErrValidation, fn)
+	}
+
+	switch parts[0] {
+	case "avg":
+		return "AVG", parts[1], nil
+	case "min":
+		return "MIN", parts[1], nil
+	case "max":
+		return "MAX", parts[1], nil
+	}
+	return "", "", fmt.Errorf("%w: unsupported aggregate function '%s'", ErrValidation, parts[0])
+}
+
+// GetStreamAggregates rolls up valid stream records in [start, end) into fixed-width time buckets.
+// fn selects the aggregate (see parseAggregateFunction); buckets without records are
+// returned with a zero count so the series has no gaps.
+func (ks *KBStream) GetStreamAggregates(streamKey string, bucket time.Duration, start, end time.Time, fn string) ([]StreamBucket, error) {
+	if streamKey == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrValidation)
+	}
+	if bucket <= 0 {
+		return nil, fmt.Errorf("%w: bucket must be positive", ErrValidation)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: start must not be after end", ErrValidation)
+	}
+
+	aggregate, field, err := parseAggregateFunction(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if !start.Before(end) {
+		return []StreamBucket{}, nil
+	}
+
+	valueExpr := "NULL::float8"
+	if field != "" {
+		valueExpr = fmt.Sprintf("%s(d.value)", aggregate)
+	}
+
+	query := fmt.Sprintf(`
+		WITH buckets AS (
+			SELECT generate_series(
+				to_timestamp(floor(extract(epoch FROM $2::timestamptz) / $4::float8) * $4::float8),
+				$3::timestamptz - interval '1 microsecond',
+				make_interval(secs => $4::float8)
+			) AS bucket_start
+		),
+		samples AS (
+			SELECT
+				to_timestamp(floor(extract(epoch FROM recorded_at) / $4::float8) * $4::float8) AS bucket_start,
+				CASE WHEN jsonb_typeof(data -> $5) = 'number' THEN (data ->> $5)::float8 END AS value
+			FROM %s
+			WHERE path = $1
+			AND valid = TRUE
+			AND recorded_at >= $2
+			AND recorded_at < $3
+		)
+		SELECT b.bucket_start, COUNT(d.bucket_start) AS count, %s AS value
+		FROM buckets b
+		LEFT JOIN samples d ON d.bucket_start = b.bucket_start
+		GROUP BY b.bucket_start
+		ORDER BY b.bucket_start ASC
+	`, ks.BaseTable, valueExpr)
+
+	rows, err := ks.conn.Query(query, streamKey, start, end, bucket.Seconds(), field)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating stream data for path '%s': %w", streamKey, err)
+	}
+	defer rows.Close()
+
+	buckets := []StreamBucket{}
+	for rows.Next() {
+		var b StreamBucket
+		var value sql.NullFloat64
+		if err := rows.Scan(&b.Start, &b.Count, &value); err != nil {
+			return nil, fmt.Errorf("error scanning stream aggregate: %w", err)
+		}
+		if value.Valid {
+			v := value.Float64
+			b.Value = &v
+		}
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stream aggregates: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// streamNotification is the payload sent by the stream table notify trigger
+type streamNotification struct {
+	ID   int    `json:"id"`
+	Path string `json:"path"`
+}
+
+// SubscribeStream delivers new valid records for streamKey as they are pushed.
+// It listens on the stream table's notification channel, which is fed by the
+// trigger installed with the stream table. The listener reconnects on connection
+// loss and replays records pushed while disconnected. The returned channel is
+// closed when ctx is cancelled.
+func (ks *KBStream) SubscribeStream(ctx context.Context, streamKey string) (<-chan StreamRecord, error) {
+	if streamKey == "" {
+		return nil, fmt.Errorf("%w: stream key cannot be empty", ErrValidation)
+	}
+
+	listener, err := ks.KBSearch.newListener()
+	if err != nil {
+		return nil, err
+	}
+	if err := listener.Listen(ks.BaseTable); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error listening on channel '%s': %w", ks.BaseTable, err)
+	}
+
+	out := make(chan StreamRecord)
+
+	go func() {
+		defer close(out)
+		defer listener.Close()
+
+		var lastRecordedAt time.Time
+
+		send := func(record StreamRecord) bool {
+			select {
+			case out <- record:
+				lastRecordedAt = record.RecordedAt
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case n := <-listener.Notify:
+				// A nil notification means the connection was re-established;
+				// catch up on anything pushed while the listener was down
+				if n == nil {
+					if lastRecordedAt.IsZero() {
+						continue
+					}
+					records, err := ks.ListStreamData(streamKey, nil, 0, &lastRecordedAt, nil, "ASC")
+					if err != nil {
+						continue
+					}
+					for _, record := range records {
+						if !record.RecordedAt.After(lastRecordedAt) {
+							continue
+						}
+						if !send(record) {
+							return
+						}
+					}
+					continue
+				}
+
+				var payload streamNotification
+				if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+					continue
+				}
+				if payload.Path != streamKey {
+					continue
+				}
+
+				record, err := ks.GetStreamDataByID(payload.ID)
+				if err != nil || record == nil || !record.Valid {
+					continue
+				}
+				if !send(*record) {
+					return
+				}
+
+			case <-time.After(90 * time.Second):
+				// Check the connection periodically so a silent drop is noticed
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return out, nil
+}
+
 // Helper functions
 
 // rowsToMaps converts SQL rows to slice of maps (reused from KBSearch)
@@ -643,6 +1139,44 @@ func rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
 	return results, nil
 }
 
+// firstRowToMap converts the first row of rows to a map, or returns nil when
+// there are no rows
+func firstRowToMap(rows *sql.Rows) (map[string]interface{}, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePointers := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePointers[i] = &values[i]
+	}
+
+	if err := rows.Scan(valuePointers...); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{})
+	for i, col := range columns {
+		var v interface{}
+		val := values[i]
+		b, ok := val.([]byte)
+		if ok {
+			v = string(b)
+		} else {
+			v = val
+		}
+		result[col] = v
+	}
+
+	return result, nil
+}
+
 // mapToStreamRecord converts a map to StreamRecord
 func mapToStreamRecord(m map[string]interface{}) *StreamRecord {
 	record := &StreamRecord{}
@@ -0,0 +1,141 @@
+package data_structures_module
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// StreamOption configures optional KBStream behaviour
+type StreamOption func(*KBStream)
+
+// WithStreamKeyCache makes FindStreamIDs and FindStreamID remember the rows
+// found for each lookup for ttl, so hot paths skip the node query. Lookups
+// given FindOptions are not cached. Entries are not told about changes to the
+// node table; call InvalidateStreamKey after moving or deleting a stream node.
+// A ttl of zero or less leaves caching off.
+func WithStreamKeyCache(ttl time.Duration) StreamOption {
+	return func(ks *KBStream) {
+		ks.keyCache.reset(ttl)
+	}
+}
+
+// streamKeyEntry is the result of one stream node lookup and when it stops
+// being used
+type streamKeyEntry struct {
+	rows    []map[string]interface{}
+	paths   []string // node paths the lookup named or returned
+	expires time.Time
+}
+
+// streamKeyCache maps stream node lookups to the rows they returned. It is
+// safe for concurrent use, including reset while lookups are running; a nil
+// cache or a zero ttl caches nothing.
+type streamKeyCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]streamKeyEntry
+	now     func() time.Time
+}
+
+// newStreamKeyCache returns a cache holding entries for ttl
+func newStreamKeyCache(ttl time.Duration) *streamKeyCache {
+	c := &streamKeyCache{now: time.Now}
+	c.reset(ttl)
+	return c
+}
+
+// reset sets the ttl and discards every entry
+func (c *streamKeyCache) reset(ttl time.Duration) {
+	c.mu.Lock()
+	c.ttl = ttl
+	c.entries = make(map[string]streamKeyEntry)
+	c.mu.Unlock()
+}
+
+// enabled reports whether lookups are being cached
+func (c *streamKeyCache) enabled() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl > 0
+}
+
+// get returns a copy of the unexpired rows cached for key
+func (c *streamKeyCache) get(key string) ([]map[string]interface{}, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+	return copyRows(entry.rows), true
+}
+
+// put caches a copy of rows for key until the ttl elapses. paths are the node
+// paths invalidate matches the entry by.
+func (c *streamKeyCache) put(key string, paths []string, rows []map[string]interface{}) {
+	c.mu.Lock()
+	if c.ttl > 0 {
+		c.entries[key] = streamKeyEntry{rows: copyRows(rows), paths: paths, expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+}
+
+// invalidate drops the entries naming or returning path, or every entry when
+// path is empty
+func (c *streamKeyCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if path == "" {
+		c.entries = make(map[string]streamKeyEntry)
+		return
+	}
+	for key, entry := range c.entries {
+		for _, entryPath := range entry.paths {
+			if entryPath == path {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// streamLookupKey returns the cache key of a FindStreamIDs lookup, or false when
+// the properties cannot be encoded
+func streamLookupKey(kb, nodeName *string, properties map[string]interface{}, nodePath *string) (string, bool) {
+	key, err := json.Marshal(struct {
+		KB         *string                `json:"kb"`
+		Name       *string                `json:"name"`
+		Properties map[string]interface{} `json:"properties"`
+		Path       *string                `json:"path"`
+	}{kb, nodeName, properties, nodePath})
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// copyRows returns a copy of rows whose maps can be changed without touching
+// the originals
+func copyRows(rows []map[string]interface{}) []map[string]interface{} {
+	copied := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied[i] = make(map[string]interface{}, len(row))
+		for column, value := range row {
+			copied[i][column] = value
+		}
+	}
+	return copied
+}
+
+// InvalidateStreamKey drops the cached lookups that named or returned the
+// stream node at nodePath, so the next FindStreamIDs reads them again. An empty
+// nodePath clears the whole cache. It does nothing when caching is off.
+func (ks *KBStream) InvalidateStreamKey(nodePath string) {
+	if ks.keyCache != nil {
+		ks.keyCache.invalidate(nodePath)
+	}
+}
@@ -0,0 +1,586 @@
+package data_structures_module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupTestStream creates a stream table with the notify trigger and preallocated rows for path
+func setupTestStream(t *testing.T, path string, length int) *KBStream {
+	t.Helper()
+
+	kb := setupTestSearch(t, 0)
+	ks := NewKBStream(kb, testDBTable)
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", ks.BaseTable),
+		fmt.Sprintf(`CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			path LTREE,
+			recorded_at TIMESTAMPTZ DEFAULT NOW(),
+			valid BOOLEAN DEFAULT FALSE,
+			data JSONB,
+			idempotency_key TEXT UNIQUE
+		)`, ks.BaseTable),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.valid THEN
+				PERFORM pg_notify(TG_TABLE_NAME, json_build_object('id', NEW.id, 'path', NEW.path::text)::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql`, ks.BaseTable),
+		fmt.Sprintf(`CREATE TRIGGER %s_notify_trigger AFTER INSERT OR UPDATE ON %s
+			FOR EACH ROW EXECUTE FUNCTION %s_notify()`, ks.BaseTable, ks.BaseTable, ks.BaseTable),
+	}
+	for _, stmt := range statements {
+		if _, err := kb.conn.Exec(stmt); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preparing stream table: %v", err)
+		}
+	}
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (path, recorded_at) VALUES ($1, NOW() - INTERVAL '1 day')", ks.BaseTable)
+	for i := 0; i < length; i++ {
+		if _, err := kb.conn.Exec(insertQuery, path); err != nil {
+			kb.Disconnect()
+			t.Fatalf("Error preallocating stream rows: %v", err)
+		}
+	}
+
+	return ks
+}
+
+// TestSubscribeStream verifies pushed records are delivered and the channel closes on cancel
+func TestSubscribeStream(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 4)
+	defer ks.KBSearch.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records, err := ks.SubscribeStream(ctx, "kb1.stream1")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing stream data: %v", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case record := <-records:
+			if seq, _ := record.Data["seq"].(float64); int(seq) != i {
+				t.Errorf("Expected seq %d, got %v", i, record.Data["seq"])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for record %d", i)
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-records:
+		if ok {
+			t.Error("Expected channel to be closed after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for channel to close")
+	}
+}
+
+// TestParseAggregateFunction checks the accepted aggregate specs
+func TestParseAggregateFunction(t *testing.T) {
+	cases := []struct {
+		fn, aggregate, field string
+		ok                   bool
+	}{
+		{"count", "COUNT", "", true},
+		{"avg:temperature", "AVG", "temperature", true},
+		{"min:temperature", "MIN", "temperature", true},
+		{"max:temperature", "MAX", "temperature", true},
+		{"avg", "", "", false},
+		{"avg:", "", "", false},
+		{"sum:temperature", "", "", false},
+	}
+	for _, c := range cases {
+		aggregate, field, err := parseAggregateFunction(c.fn)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got err=%v", c.fn, c.ok, err)
+			continue
+		}
+		if c.ok && (aggregate != c.aggregate || field != c.field) {
+			t.Errorf("%s: expected %s/%s, got %s/%s", c.fn, c.aggregate, c.field, aggregate, field)
+		}
+	}
+}
+
+// TestGetStreamAggregates covers an empty range and a multi-bucket range with gaps
+func TestGetStreamAggregates(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 4)
+	defer ks.KBSearch.Disconnect()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	samples := []struct {
+		offset time.Duration
+		value  float64
+	}{
+		{10 * time.Second, 1},
+		{20 * time.Second, 3},
+		{130 * time.Second, 10},
+	}
+	for i, sample := range samples {
+		query := fmt.Sprintf(`UPDATE %s SET valid = TRUE, recorded_at = $1, data = $2
+			WHERE id = (SELECT id FROM %s WHERE path = $3 ORDER BY id LIMIT 1 OFFSET $4)`, ks.BaseTable, ks.BaseTable)
+		data := fmt.Sprintf(`{"value": %v}`, sample.value)
+		if _, err := ks.conn.Exec(query, base.Add(sample.offset), data, "kb1.stream1", i); err != nil {
+			t.Fatalf("Error writing sample: %v", err)
+		}
+	}
+
+	t.Run("EmptyRange", func(t *testing.T) {
+		start := base.Add(time.Hour)
+		buckets, err := ks.GetStreamAggregates("kb1.stream1", time.Minute, start, start.Add(3*time.Minute), "count")
+		if err != nil {
+			t.Fatalf("Error aggregating: %v", err)
+		}
+		if len(buckets) != 3 {
+			t.Fatalf("Expected 3 zero buckets, got %d", len(buckets))
+		}
+		for _, b := range buckets {
+			if b.Count != 0 {
+				t.Errorf("Expected zero count, got %d at %v", b.Count, b.Start)
+			}
+		}
+	})
+
+	t.Run("MultiBucket", func(t *testing.T) {
+		buckets, err := ks.GetStreamAggregates("kb1.stream1", time.Minute, base, base.Add(3*time.Minute), "avg:value")
+		if err != nil {
+			t.Fatalf("Error aggregating: %v", err)
+		}
+		if len(buckets) != 3 {
+			t.Fatalf("Expected 3 buckets, got %d", len(buckets))
+		}
+
+		expectedCounts := []int{2, 0, 1}
+		expectedValues := []float64{2, 0, 10}
+		for i, b := range buckets {
+			if b.Count != expectedCounts[i] {
+				t.Errorf("Bucket %d: expected count %d, got %d", i, expectedCounts[i], b.Count)
+			}
+			if expectedCounts[i] == 0 {
+				if b.Value != nil {
+					t.Errorf("Bucket %d: expected nil value, got %v", i, *b.Value)
+				}
+				continue
+			}
+			if b.Value == nil || *b.Value != expectedValues[i] {
+				t.Errorf("Bucket %d: expected value %v, got %v", i, expectedValues[i], b.Value)
+			}
+		}
+	})
+}
+
+// seedStreamAges marks every row of path valid, recorded 1..n hours ago in id order
+func seedStreamAges(t *testing.T, ks *KBStream, path string) {
+	t.Helper()
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET valid = TRUE, data = '{}',
+			recorded_at = NOW() - (ages.n * INTERVAL '1 hour')
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n FROM %s WHERE path = $1) AS ages
+		WHERE %s.id = ages.id`, ks.BaseTable, ks.BaseTable, ks.BaseTable)
+	if _, err := ks.conn.Exec(query, path); err != nil {
+		t.Fatalf("Error seeding stream: %v", err)
+	}
+}
+
+// TestDeleteStreamDataOlderThan checks that only records before the cutoff are removed
+func TestDeleteStreamDataOlderThan(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 6)
+	defer ks.KBSearch.Disconnect()
+	seedStreamAges(t, ks, "kb1.stream1")
+
+	// Records are 1..6 hours old; remove the four older than 2.5 hours
+	removed, err := ks.DeleteStreamDataOlderThan("kb1.stream1", time.Now().Add(-150*time.Minute))
+	if err != nil {
+		t.Fatalf("DeleteStreamDataOlderThan failed: %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("Expected 4 records removed, got %d", removed)
+	}
+
+	count, err := ks.GetStreamDataCount("kb1.stream1", false)
+	if err != nil {
+		t.Fatalf("GetStreamDataCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 records left, got %d", count)
+	}
+
+	if _, err := ks.DeleteStreamDataOlderThan("", time.Now()); err == nil {
+		t.Error("Expected error for empty path")
+	}
+}
+
+// TestDeleteStreamDataKeepLast checks that only the newest n records are kept
+func TestDeleteStreamDataKeepLast(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 6)
+	defer ks.KBSearch.Disconnect()
+	seedStreamAges(t, ks, "kb1.stream1")
+
+	removed, err := ks.DeleteStreamDataKeepLast("kb1.stream1", 3)
+	if err != nil {
+		t.Fatalf("DeleteStreamDataKeepLast failed: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 records removed, got %d", removed)
+	}
+
+	// The newest records are the first three ids
+	records, err := ks.ListStreamData("kb1.stream1", nil, 0, nil, nil, "ASC")
+	if err != nil {
+		t.Fatalf("ListStreamData failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records left, got %d", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].RecordedAt.Before(records[i-1].RecordedAt) {
+			t.Errorf("Expected records in ascending order")
+		}
+	}
+	if time.Since(records[0].RecordedAt) > 3*time.Hour+time.Minute {
+		t.Errorf("Expected only records from the last 3 hours, oldest is %v", records[0].RecordedAt)
+	}
+
+	if removed, err := ks.DeleteStreamDataKeepLast("kb1.stream1", 10); err != nil || removed != 0 {
+		t.Errorf("Expected nothing removed when keeping more than exist, got %d, %v", removed, err)
+	}
+	if _, err := ks.DeleteStreamDataKeepLast("kb1.stream1", -1); err == nil {
+		t.Error("Expected error for negative n")
+	}
+}
+
+// TestListStreamDataPage checks the total stays constant across pages
+func TestListStreamDataPage(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 5)
+	defer ks.KBSearch.Disconnect()
+	seedStreamAges(t, ks, "kb1.stream1")
+
+	for _, offset := range []int{0, 2, 4, 6} {
+		records, total, err := ks.ListStreamDataPage("kb1.stream1", 2, offset, nil, nil, "DESC")
+		if err != nil {
+			t.Fatalf("ListStreamDataPage failed at offset %d: %v", offset, err)
+		}
+		if total != 5 {
+			t.Errorf("Offset %d: expected total 5, got %d", offset, total)
+		}
+		want := 2
+		if offset >= 4 {
+			want = 5 - offset
+			if want < 0 {
+				want = 0
+			}
+		}
+		if len(records) != want {
+			t.Errorf("Offset %d: expected %d records, got %d", offset, want, len(records))
+		}
+	}
+}
+
+// TestGetStreamDataByIDs fetches a mix of present and absent ids
+func TestGetStreamDataByIDs(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 3)
+	defer ks.KBSearch.Disconnect()
+
+	// id 4 belongs to another stream
+	if _, err := ks.conn.Exec(fmt.Sprintf("INSERT INTO %s (path) VALUES ('kb1.stream2')", ks.BaseTable)); err != nil {
+		t.Fatalf("Error adding second stream: %v", err)
+	}
+
+	records, err := ks.GetStreamDataByIDs("kb1.stream1", []int{1, 3, 4, 42})
+	if err != nil {
+		t.Fatalf("GetStreamDataByIDs failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 records, got %d: %v", len(records), records)
+	}
+	for _, id := range []int{1, 3} {
+		if records[id] == nil {
+			t.Errorf("Expected record %d", id)
+		}
+	}
+	for _, id := range []int{4, 42} {
+		if _, ok := records[id]; ok {
+			t.Errorf("Expected record %d to be absent", id)
+		}
+	}
+
+	if records, err := ks.GetStreamDataByIDs("kb1.stream1", nil); err != nil || len(records) != 0 {
+		t.Errorf("Expected no records for no ids, got %v, %v", records, err)
+	}
+}
+
+// TestGetStreamStats checks zero values for an empty stream and that a
+// deliberate gap shows up as MaxGapSeconds
+func TestGetStreamStats(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 5)
+	defer ks.KBSearch.Disconnect()
+
+	stats, err := ks.GetStreamStats("kb1.stream1")
+	if err != nil {
+		t.Fatalf("Error getting stats for empty stream: %v", err)
+	}
+	if stats != (StreamStats{}) {
+		t.Errorf("Expected zero stats for empty stream, got %+v", stats)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 10 * time.Second, 20 * time.Second, 320 * time.Second}
+	for i, offset := range offsets {
+		query := fmt.Sprintf(`UPDATE %s SET valid = TRUE, recorded_at = $1, data = '{}'
+			WHERE id = (SELECT id FROM %s WHERE path = $2 ORDER BY id LIMIT 1 OFFSET $3)`, ks.BaseTable, ks.BaseTable)
+		if _, err := ks.conn.Exec(query, base.Add(offset), "kb1.stream1", i); err != nil {
+			t.Fatalf("Error writing record: %v", err)
+		}
+	}
+
+	stats, err = ks.GetStreamStats("kb1.stream1")
+	if err != nil {
+		t.Fatalf("Error getting stats: %v", err)
+	}
+	if stats.Count != len(offsets) {
+		t.Errorf("Expected count %d, got %d", len(offsets), stats.Count)
+	}
+	if !stats.FirstAt.Equal(base) || !stats.LastAt.Equal(base.Add(320*time.Second)) {
+		t.Errorf("Unexpected range %v - %v", stats.FirstAt, stats.LastAt)
+	}
+	if stats.MaxGapSeconds != 300 {
+		t.Errorf("Expected max gap 300s, got %v", stats.MaxGapSeconds)
+	}
+	if want := 320.0 / 3; stats.AvgIntervalSeconds < want-0.001 || stats.AvgIntervalSeconds > want+0.001 {
+		t.Errorf("Expected average interval %v, got %v", want, stats.AvgIntervalSeconds)
+	}
+
+	if _, err := ks.GetStreamStatistics("kb1.stream1", true); err != nil {
+		t.Errorf("Error getting stream statistics: %v", err)
+	}
+}
+
+// TestGetStreamWindow checks an empty window, the half-open bounds and truncation
+func TestGetStreamWindow(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 6)
+	defer ks.KBSearch.Disconnect()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		query := fmt.Sprintf(`UPDATE %s SET valid = TRUE, recorded_at = $1, data = $2
+			WHERE id = (SELECT id FROM %s WHERE path = $3 ORDER BY id LIMIT 1 OFFSET $4)`, ks.BaseTable, ks.BaseTable)
+		if _, err := ks.conn.Exec(query, base.Add(time.Duration(i)*time.Minute), fmt.Sprintf(`{"seq": %d}`, i), "kb1.stream1", i); err != nil {
+			t.Fatalf("Error writing record: %v", err)
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		records, hasMore, err := ks.GetStreamWindow("kb1.stream1", base.Add(-time.Hour), base, 10)
+		if err != nil {
+			t.Fatalf("Error getting window: %v", err)
+		}
+		if len(records) != 0 || hasMore {
+			t.Errorf("Expected an empty window, got %d records, hasMore %v", len(records), hasMore)
+		}
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		// The end bound is exclusive, so the record at 4 minutes is left out
+		records, hasMore, err := ks.GetStreamWindow("kb1.stream1", base, base.Add(4*time.Minute), 10)
+		if err != nil {
+			t.Fatalf("Error getting window: %v", err)
+		}
+		if len(records) != 4 || hasMore {
+			t.Errorf("Expected 4 records and no more, got %d, hasMore %v", len(records), hasMore)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		records, hasMore, err := ks.GetStreamWindow("kb1.stream1", base, base.Add(time.Hour), 3)
+		if err != nil {
+			t.Fatalf("Error getting window: %v", err)
+		}
+		if len(records) != 3 || !hasMore {
+			t.Fatalf("Expected 3 records and more, got %d, hasMore %v", len(records), hasMore)
+		}
+		for i, record := range records {
+			if record.Data["seq"] != float64(i) {
+				t.Errorf("Expected record %d in ascending order, got %v", i, record.Data)
+			}
+		}
+	})
+
+	if _, _, err := ks.GetStreamWindow("kb1.stream1", base, base, 10); err == nil {
+		t.Error("Expected an empty range to be rejected")
+	}
+	if _, _, err := ks.GetStreamWindow("kb1.stream1", base, base.Add(time.Hour), 0); err == nil {
+		t.Error("Expected a non-positive limit to be rejected")
+	}
+}
+
+// TestPushStreamDataIdempotencyKey verifies a repeated push with the same key
+// returns the original record and stores a single record
+func TestPushStreamDataIdempotencyKey(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 3)
+	defer ks.KBSearch.Disconnect()
+
+	first, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": 1}, 3, 10*time.Millisecond, WithIdempotencyKey("reading-7"))
+	if err != nil {
+		t.Fatalf("Error pushing stream data: %v", err)
+	}
+	second, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": 2}, 3, 10*time.Millisecond, WithIdempotencyKey("reading-7"))
+	if err != nil {
+		t.Fatalf("Error repeating push: %v", err)
+	}
+	if second.ID != first.ID || second.Operation != "idempotent_replay" || second.Data["seq"] != float64(1) {
+		t.Errorf("Expected the original record %d, got %+v", first.ID, second)
+	}
+
+	stats, err := ks.GetStreamStats("kb1.stream1")
+	if err != nil {
+		t.Fatalf("Error getting stats: %v", err)
+	}
+	if stats.Count != 1 {
+		t.Errorf("Expected 1 stored record, got %d", stats.Count)
+	}
+}
+
+// TestStreamIdempotencyKeyMigration pushes to a stream table created without
+// the idempotency_key column, then adds it with MigrateIdempotencyKey
+func TestStreamIdempotencyKeyMigration(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 3)
+	defer ks.KBSearch.Disconnect()
+
+	if _, err := ks.conn.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN idempotency_key", ks.BaseTable)); err != nil {
+		t.Fatalf("Error dropping column: %v", err)
+	}
+
+	if _, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": 1}, 3, 10*time.Millisecond); err != nil {
+		t.Fatalf("Expected a push without a key to work on the old table, got %v", err)
+	}
+	if _, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": 2}, 3, 10*time.Millisecond, WithIdempotencyKey("reading-7")); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a keyed push to need the column, got %v", err)
+	}
+
+	if err := ks.MigrateIdempotencyKey(); err != nil {
+		t.Fatalf("Error migrating: %v", err)
+	}
+	if _, err := ks.PushStreamData("kb1.stream1", map[string]interface{}{"seq": 2}, 3, 10*time.Millisecond, WithIdempotencyKey("reading-7")); err != nil {
+		t.Errorf("Error pushing keyed record after migrating: %v", err)
+	}
+}
+
+// TestStreamKeyCacheExpiry checks that cached lookups expire after the ttl,
+// are dropped by the node paths they named or returned, and survive concurrent
+// use and reset, without a database
+func TestStreamKeyCacheExpiry(t *testing.T) {
+	var off *streamKeyCache
+	if off.enabled() || newStreamKeyCache(0).enabled() {
+		t.Error("Expected no caching for a nil cache or a zero ttl")
+	}
+
+	now := time.Now()
+	cache := newStreamKeyCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	rowA := []map[string]interface{}{{"path": "kb1.a"}}
+	cache.put("lookup-a", []string{"kb1.a"}, rowA)
+	cache.put("lookup-b", []string{"kb1.b", "kb1.c"}, []map[string]interface{}{{"path": "kb1.b"}})
+	rows, ok := cache.get("lookup-a")
+	if !ok || len(rows) != 1 || rows[0]["path"] != "kb1.a" {
+		t.Errorf("Expected the cached row for kb1.a, got %v, %v", rows, ok)
+	}
+	rows[0]["path"] = "changed"
+	if rows, _ := cache.get("lookup-a"); rows[0]["path"] != "kb1.a" {
+		t.Error("Expected cached rows to be copied")
+	}
+
+	cache.invalidate("kb1.c")
+	if _, ok := cache.get("lookup-b"); ok {
+		t.Error("Expected the lookup that named kb1.c to be invalidated")
+	}
+	if _, ok := cache.get("lookup-a"); !ok {
+		t.Error("Expected the kb1.a lookup to stay cached")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("lookup-a"); ok {
+		t.Error("Expected the kb1.a lookup to expire after the ttl")
+	}
+
+	cache.put("lookup-a", []string{"kb1.a"}, rowA)
+	cache.invalidate("")
+	if _, ok := cache.get("lookup-a"); ok {
+		t.Error("Expected an empty path to clear the cache")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.put("lookup-a", []string{"kb1.a"}, rowA)
+			cache.get("lookup-a")
+			cache.invalidate("kb1.a")
+			cache.reset(time.Duration(i) * time.Minute)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestFindStreamIDsCache populates the lookup cache, moves the stream node,
+// and checks the stale row is served until InvalidateStreamKey refreshes it
+func TestFindStreamIDsCache(t *testing.T) {
+	kb := setupTestSearch(t, 0)
+	defer kb.Disconnect()
+	ks := NewKBStream(kb, testDBTable, WithStreamKeyCache(time.Hour))
+
+	if _, err := kb.conn.Exec(fmt.Sprintf(`INSERT INTO %s (knowledge_base, label, name, path)
+		VALUES ('kb1', 'KB_STREAM_FIELD', 'stream1', 'kb1.stream1')`, testDBTable)); err != nil {
+		t.Fatalf("Error adding stream node: %v", err)
+	}
+
+	name := "stream1"
+	lookup := func() ([]string, error) {
+		rows, err := ks.FindStreamIDs(nil, &name, nil, nil)
+		return ks.FindStreamTableKeys(rows), err
+	}
+	keys, err := lookup()
+	if err != nil || len(keys) != 1 || keys[0] != "kb1.stream1" {
+		t.Fatalf("Expected key kb1.stream1, got %v, %v", keys, err)
+	}
+
+	if _, err := kb.conn.Exec(fmt.Sprintf("UPDATE %s SET path = 'kb1.stream2' WHERE path = 'kb1.stream1'", testDBTable)); err != nil {
+		t.Fatalf("Error moving stream node: %v", err)
+	}
+	if keys, err := lookup(); err != nil || len(keys) != 1 || keys[0] != "kb1.stream1" {
+		t.Errorf("Expected the cached key before invalidation, got %v, %v", keys, err)
+	}
+	if _, err := ks.FindStreamIDs(nil, &name, nil, nil, WithHasLink(false)); err != nil {
+		t.Errorf("Error finding stream with options: %v", err)
+	} else if keys := ks.FindStreamTableKeys(kb.Results); len(keys) != 1 || keys[0] != "kb1.stream2" {
+		t.Errorf("Expected a lookup with options to bypass the cache, got %v", keys)
+	}
+
+	ks.InvalidateStreamKey("kb1.stream1")
+	if keys, err := lookup(); err != nil || len(keys) != 1 || keys[0] != "kb1.stream2" {
+		t.Errorf("Expected key kb1.stream2 after invalidation, got %v, %v", keys, err)
+	}
+	if row, err := ks.FindStreamID(nil, &name, nil, nil); err != nil || row["path"] != "kb1.stream2" {
+		t.Errorf("Expected FindStreamID to share the refreshed lookup, got %v, %v", row, err)
+	}
+}
@@ -0,0 +1,17 @@
+package data_structures_module
+
+// Logger receives diagnostic output from the data structures. Library code
+// never writes to stdout; inject a Logger with WithStatusLogger, KBJobQueue.Logger
+// or KBDataStructures.SetLogger to see warnings.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards all output and is the default Logger
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Infof(format string, args ...interface{})  {}
+func (noopLogger) Errorf(format string, args ...interface{}) {}
@@ -0,0 +1,48 @@
+package data_structures_module
+
+import "time"
+
+// Observer receives metrics from the data structures, e.g. to feed Prometheus
+// histograms and gauges. Set it through the Observer field of the job queue,
+// stream and RPC server components, WithStatusObserver, or
+// KBDataStructures.SetObserver. Callbacks run synchronously on the calling
+// goroutine and must not block.
+type Observer interface {
+	// ObserveOp reports one call of the named operation, such as "PushJobData",
+	// with its duration including retries and the error it returned, if any
+	ObserveOp(name string, dur time.Duration, err error)
+	// ObserveQueueDepth reports the number of queued jobs on path of the named
+	// queue ("job_queue" or "rpc_server") after a successful push or peek
+	ObserveQueueDepth(queue, path string, depth int)
+}
+
+// noopObserver discards all metrics and is the default Observer
+type noopObserver struct{}
+
+func (noopObserver) ObserveOp(name string, dur time.Duration, err error) {}
+func (noopObserver) ObserveQueueDepth(queue, path string, depth int)     {}
+
+// observerOrNoop returns o, or a no-op observer when o is nil
+func observerOrNoop(o Observer) Observer {
+	if o == nil {
+		return noopObserver{}
+	}
+	return o
+}
+
+// observeOp reports the operation started at start with the error *err holds
+// when the deferred call runs
+func observeOp(o Observer, name string, start time.Time, err *error) {
+	observerOrNoop(o).ObserveOp(name, time.Since(start), *err)
+}
+
+// observeDepth counts the queue depth with count and reports it, skipping the
+// query when no observer is set or the operation failed
+func observeDepth(o Observer, queue, path string, err error, count func(string) (int, error)) {
+	if o == nil || err != nil {
+		return
+	}
+	if depth, countErr := count(path); countErr == nil {
+		o.ObserveQueueDepth(queue, path, depth)
+	}
+}
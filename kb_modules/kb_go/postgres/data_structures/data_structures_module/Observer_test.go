@@ -0,0 +1,108 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+)
+
+// observedOp is one ObserveOp call
+type observedOp struct {
+	name string
+	err  error
+}
+
+// recordingObserver keeps every callback it receives
+type recordingObserver struct {
+	mu     sync.Mutex
+	ops    []observedOp
+	depths map[string]int
+}
+
+func (o *recordingObserver) ObserveOp(name string, dur time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = append(o.ops, observedOp{name, err})
+}
+
+func (o *recordingObserver) ObserveQueueDepth(queue, path string, depth int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.depths == nil {
+		o.depths = map[string]int{}
+	}
+	o.depths[queue+":"+path] = depth
+}
+
+// TestObserverReportsFailures checks each instrumented operation reports its name
+// and error when it fails, using a closed connection so no database is needed
+func TestObserverReportsFailures(t *testing.T) {
+	conn, err := sql.Open("postgres", "host=localhost sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening connection: %v", err)
+	}
+	conn.Close()
+
+	observer := &recordingObserver{}
+	noRetry := LinearRetryPolicy(1, 0)
+	kb := &KBSearch{conn: conn}
+	jq := &KBJobQueue{KBSearch: kb, conn: conn, BaseTable: "job", RetryPolicy: noRetry, Observer: observer}
+	ks := &KBStream{KBSearch: kb, conn: conn, BaseTable: "stream", RetryPolicy: noRetry, Observer: observer}
+	rpc := &KBRPCServer{KBSearch: kb, conn: conn, BaseTable: "rpc", Observer: observer}
+	ksd := NewKBStatusData(kb, "status", WithStatusObserver(observer), WithStatusRetryPolicy(noRetry))
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"PushJobData", func() error { _, err := jq.PushJobData("kb1.job", map[string]interface{}{}, 1, 0); return err }},
+		{"PeakJobData", func() error { _, err := jq.PeakJobData("kb1.job", 1, 0); return err }},
+		{"PushStreamData", func() error { _, err := ks.PushStreamData("", map[string]interface{}{}, 1, 0); return err }},
+		{"SetStatusData", func() error { _, _, err := ksd.SetStatusData("kb1.status", map[string]interface{}{}, 0, 0); return err }},
+		{"PushRPCQueue", func() error {
+			_, err := rpc.PushRPCQueue("kb1.server", "", "do_work", map[string]interface{}{}, "tag", 0, nil, 1, 0)
+			return err
+		}},
+		{"PeakServerQueue", func() error { _, err := rpc.PeakServerQueue("kb1.server", 1, 0); return err }},
+	}
+	for _, c := range calls {
+		if err := c.call(); err == nil {
+			t.Fatalf("%s: expected an error", c.name)
+		}
+	}
+
+	if len(observer.ops) != len(calls) {
+		t.Fatalf("Expected %d observed operations, got %d: %v", len(calls), len(observer.ops), observer.ops)
+	}
+	for i, c := range calls {
+		if observer.ops[i].name != c.name || observer.ops[i].err == nil {
+			t.Errorf("Expected %s with an error, got %+v", c.name, observer.ops[i])
+		}
+	}
+	if len(observer.depths) != 0 {
+		t.Errorf("Expected no queue depth after failures, got %v", observer.depths)
+	}
+}
+
+// TestObserverReportsQueueDepth checks successful pushes report latency and depth
+func TestObserverReportsQueueDepth(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.job", 3)
+	defer jq.KBSearch.Disconnect()
+
+	observer := &recordingObserver{}
+	jq.Observer = observer
+
+	for i := 0; i < 2; i++ {
+		if _, err := jq.PushJobData("kb1.job", map[string]interface{}{"n": i}, 3, 10*time.Millisecond); err != nil {
+			t.Fatalf("Error pushing job: %v", err)
+		}
+	}
+
+	if len(observer.ops) != 2 || observer.ops[1] != (observedOp{"PushJobData", nil}) {
+		t.Errorf("Expected two successful PushJobData observations, got %v", observer.ops)
+	}
+	if depth := observer.depths["job_queue:kb1.job"]; depth != 2 {
+		t.Errorf("Expected queue depth 2, got %d", depth)
+	}
+}
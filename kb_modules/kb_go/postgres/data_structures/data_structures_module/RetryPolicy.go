@@ -0,0 +1,150 @@
+package data_structures_module
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy controls how often a component retries a transaction and how long
+// it waits between attempts. The delay before retry n (1-based) is
+// BaseDelay * Multiplier^(n-1), capped at MaxDelay and spread by Jitter.
+//
+// The job queue, stream and status components accept a policy through their
+// RetryPolicy field. When it is nil they build a fixed-delay policy from their
+// maxRetries and retryDelay arguments, which is the historical behaviour,
+// including the 1.5x wait after PeakJobData fails to mark a found job claimed.
+type RetryPolicy struct {
+	// MaxRetries is the total number of attempts, matching the maxRetries arguments
+	MaxRetries int
+	// BaseDelay is the wait before the first retry
+	BaseDelay time.Duration
+	// Multiplier scales the delay after each retry; values below 1 mean a fixed delay
+	Multiplier float64
+	// MaxDelay caps the computed delay; zero means no cap
+	MaxDelay time.Duration
+	// Jitter randomizes each delay by up to this fraction in either direction (0..1)
+	Jitter float64
+	// Retryable decides whether an error is worth retrying; nil keeps each
+	// component's own checks
+	Retryable func(error) bool
+
+	// sleep replaces time.Sleep in tests
+	sleep func(time.Duration)
+}
+
+// LinearRetryPolicy returns a policy that waits delay between each of maxRetries attempts
+func LinearRetryPolicy(maxRetries int, delay time.Duration) *RetryPolicy {
+	return &RetryPolicy{MaxRetries: maxRetries, BaseDelay: delay, Multiplier: 1}
+}
+
+// ExponentialRetryPolicy returns a policy that doubles baseDelay after each attempt,
+// capped at maxDelay, with 20% jitter
+func ExponentialRetryPolicy(maxRetries int, baseDelay, maxDelay time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries: maxRetries,
+		BaseDelay:  baseDelay,
+		Multiplier: 2,
+		MaxDelay:   maxDelay,
+		Jitter:     0.2,
+	}
+}
+
+// orLinear returns p, or a linear policy built from the loose retry arguments when p is nil
+func (p *RetryPolicy) orLinear(maxRetries int, delay time.Duration) *RetryPolicy {
+	if p != nil {
+		return p
+	}
+	return LinearRetryPolicy(maxRetries, delay)
+}
+
+// attempts returns the number of attempts allowed, at least one
+func (p *RetryPolicy) attempts() int {
+	if p.MaxRetries < 1 {
+		return 1
+	}
+	return p.MaxRetries
+}
+
+// Delay returns the wait before retry n, where n counts the failed attempts so far
+func (p *RetryPolicy) Delay(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+
+	delay := float64(p.BaseDelay)
+	if p.Multiplier > 1 {
+		delay *= math.Pow(p.Multiplier, float64(n-1))
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// Wait sleeps for Delay(n)
+func (p *RetryPolicy) Wait(n int) {
+	p.waitScaled(n, 1)
+}
+
+// waitScaled sleeps for Delay(n) multiplied by factor
+func (p *RetryPolicy) waitScaled(n int, factor float64) {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	sleep(time.Duration(float64(p.Delay(n)) * factor))
+}
+
+// retryable reports whether err should be retried, using the policy's predicate
+// when set and the component's own check otherwise
+func (p *RetryPolicy) retryable(err error, fallback func(error) bool) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return fallback(err)
+}
+
+// Do calls fn until it succeeds, returns an error the policy does not retry, or
+// the attempts are exhausted, waiting between attempts. fn receives the 1-based
+// attempt number. The last error is returned.
+func (p *RetryPolicy) Do(fn func(attempt int) error) error {
+	var err error
+	for attempt := 1; attempt <= p.attempts(); attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+		if !p.retryable(err, isRetryableDBError) || attempt == p.attempts() {
+			return err
+		}
+		p.Wait(attempt)
+	}
+	return err
+}
+
+// retryAlways treats every error as retryable; it is the fallback for call sites
+// that historically retried unconditionally
+func retryAlways(error) bool {
+	return true
+}
+
+// isRetryableDBError reports lock contention, serialization failures and deadlocks.
+// Postgres errors are judged by SQLSTATE alone, so a genuine failure such as a
+// unique violation is not retried even when its message mentions a lock; other
+// errors fall back to matching the message.
+func isRetryableDBError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return isSerializationError(err) || pqErr.Code == "55P03" // lock_not_available
+	}
+	return isLockError(err)
+}
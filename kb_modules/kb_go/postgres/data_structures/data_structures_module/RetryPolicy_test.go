@@ -0,0 +1,174 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// recordSleeps makes policy record its waits instead of sleeping
+func recordSleeps(policy *RetryPolicy) *[]time.Duration {
+	delays := []time.Duration{}
+	policy.sleep = func(d time.Duration) { delays = append(delays, d) }
+	return &delays
+}
+
+// sameDelays reports whether got matches want exactly
+func sameDelays(got, want []time.Duration) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestRetryPolicyDelaySchedule checks the linear, exponential and capped schedules
+func TestRetryPolicyDelaySchedule(t *testing.T) {
+	linear := LinearRetryPolicy(4, 10*time.Millisecond)
+	exponential := &RetryPolicy{MaxRetries: 5, BaseDelay: 10 * time.Millisecond, Multiplier: 2, MaxDelay: 50 * time.Millisecond}
+
+	cases := []struct {
+		name   string
+		policy *RetryPolicy
+		want   []time.Duration
+	}{
+		{"Linear", linear, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}},
+		{"ExponentialCapped", exponential, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}},
+	}
+	for _, c := range cases {
+		got := []time.Duration{}
+		for n := 1; n < c.policy.MaxRetries; n++ {
+			got = append(got, c.policy.Delay(n))
+		}
+		if !sameDelays(got, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+
+	jittered := ExponentialRetryPolicy(3, 100*time.Millisecond, time.Second)
+	for i := 0; i < 100; i++ {
+		if d := jittered.Delay(2); d < 160*time.Millisecond || d > 240*time.Millisecond {
+			t.Fatalf("Expected jittered delay within 20%% of 200ms, got %v", d)
+		}
+	}
+}
+
+// TestRetryPolicyWaitScaled checks the scaled wait used after a failed job claim
+func TestRetryPolicyWaitScaled(t *testing.T) {
+	policy := LinearRetryPolicy(3, 10*time.Millisecond)
+	delays := recordSleeps(policy)
+
+	policy.waitScaled(1, claimRetryScale)
+	policy.Wait(2)
+	want := []time.Duration{15 * time.Millisecond, 10 * time.Millisecond}
+	if !sameDelays(*delays, want) {
+		t.Errorf("Expected delays %v, got %v", want, *delays)
+	}
+}
+
+// TestRetryPolicyDo counts attempts and waits under a forced serialization failure
+func TestRetryPolicyDo(t *testing.T) {
+	serializationFailure := &pq.Error{Code: "40001"}
+
+	policy := &RetryPolicy{MaxRetries: 4, BaseDelay: 5 * time.Millisecond, Multiplier: 3}
+	delays := recordSleeps(policy)
+
+	attempts := 0
+	err := policy.Do(func(attempt int) error {
+		attempts++
+		if attempt != attempts {
+			t.Errorf("Expected attempt %d, got %d", attempts, attempt)
+		}
+		return serializationFailure
+	})
+	if err != serializationFailure {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+	want := []time.Duration{5 * time.Millisecond, 15 * time.Millisecond, 45 * time.Millisecond}
+	if !sameDelays(*delays, want) {
+		t.Errorf("Expected delays %v, got %v", want, *delays)
+	}
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		attempts := 0
+		boom := errors.New("boom")
+		err := policy.Do(func(int) error { attempts++; return boom })
+		if err != boom || attempts != 1 {
+			t.Errorf("Expected one attempt returning boom, got %d attempts and %v", attempts, err)
+		}
+	})
+
+	t.Run("SucceedsAfterRetry", func(t *testing.T) {
+		attempts := 0
+		err := policy.Do(func(attempt int) error {
+			attempts++
+			if attempt < 3 {
+				return serializationFailure
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("Expected success on attempt 3, got %d attempts and %v", attempts, err)
+		}
+	})
+}
+
+// TestIsRetryableDBError checks Postgres errors are judged by SQLSTATE, including when wrapped
+func TestIsRetryableDBError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"SerializationFailure", &pq.Error{Code: "40001"}, true},
+		{"Deadlock", fmt.Errorf("error committing: %w", &pq.Error{Code: "40P01"}), true},
+		{"LockNotAvailable", &pq.Error{Code: "55P03"}, true},
+		{"UniqueViolation", &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint \"idx_block\""}, false},
+		{"LockMessage", errors.New("database is locked"), true},
+		{"Other", errors.New("boom"), false},
+	}
+	for _, c := range cases {
+		if got := isRetryableDBError(c.err); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+// TestJobQueueUsesRetryPolicy forces every transaction to fail and checks the
+// component honours the policy's attempts, predicate and delay schedule
+func TestJobQueueUsesRetryPolicy(t *testing.T) {
+	conn, err := sql.Open("postgres", "host=localhost sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening connection: %v", err)
+	}
+	conn.Close()
+
+	policy := &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, Multiplier: 2}
+	delays := recordSleeps(policy)
+	checked := 0
+	policy.Retryable = func(error) bool { checked++; return true }
+
+	jq := &KBJobQueue{conn: conn, BaseTable: "knowledge_base_job", RetryPolicy: policy}
+	if _, err := jq.PushJobData("kb1.job", map[string]interface{}{}, 10, time.Hour); err == nil {
+		t.Fatal("Expected PushJobData to fail on a closed connection")
+	}
+
+	if checked != 2 {
+		t.Errorf("Expected the predicate to be consulted for 2 retries, got %d", checked)
+	}
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond}
+	if !sameDelays(*delays, want) {
+		t.Errorf("Expected delays %v, got %v", want, *delays)
+	}
+}
@@ -0,0 +1,163 @@
+package data_structures_module
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrStatementTimeout is returned when Postgres cancels a query that ran past
+// its statement_timeout. It matches ErrTimeout.
+var ErrStatementTimeout = fmt.Errorf("statement %w", ErrTimeout)
+
+// statementTimeoutSQL returns the SET command for timeout, in whole milliseconds
+// as Postgres expects; local limits it to the current transaction
+func statementTimeoutSQL(timeout time.Duration, local bool) string {
+	scope := ""
+	if local {
+		scope = "LOCAL "
+	}
+	return fmt.Sprintf("SET %sstatement_timeout = %d", scope, timeout.Milliseconds())
+}
+
+// isStatementTimeout reports whether err is Postgres cancelling a query for
+// exceeding statement_timeout, as opposed to a cancel requested by the client
+func isStatementTimeout(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "57014" && strings.Contains(pqErr.Message, "statement timeout")
+}
+
+// mapStatementTimeout wraps a statement timeout in ErrStatementTimeout, keeping
+// the driver error in the chain; other errors, and timeouts already mapped, are
+// returned unchanged
+func mapStatementTimeout(err error) error {
+	if isStatementTimeout(err) && !errors.Is(err, ErrStatementTimeout) {
+		return fmt.Errorf("%w: %w", ErrStatementTimeout, err)
+	}
+	return err
+}
+
+// mapStatementTimeoutTo applies mapStatementTimeout to *err. Methods deferring
+// it report a timeout raised anywhere in their transaction, whether from a
+// component limit or a pool opened with OpenWithStatementTimeout.
+func mapStatementTimeoutTo(err *error) {
+	*err = mapStatementTimeout(*err)
+}
+
+// beginWithTimeout begins a transaction on conn; when timeout is positive the
+// transaction carries a local statement_timeout, so the limit does not leak to
+// other users of the shared pool
+func beginWithTimeout(conn *sql.DB, timeout time.Duration) (*sql.Tx, error) {
+	tx, err := conn.Begin()
+	if err != nil || timeout <= 0 {
+		return tx, err
+	}
+	if _, err := tx.Exec(statementTimeoutSQL(timeout, true)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting statement timeout: %w", err)
+	}
+	return tx, nil
+}
+
+// queryWithTimeout runs query on conn and passes the rows to scan. When timeout
+// is positive the query runs in its own transaction from beginWithTimeout.
+// Errors from the query and from scan are passed through mapStatementTimeout.
+func queryWithTimeout(conn *sql.DB, timeout time.Duration, scan func(*sql.Rows) error, query string, params ...interface{}) error {
+	if timeout <= 0 {
+		rows, err := conn.Query(query, params...)
+		if err != nil {
+			return mapStatementTimeout(err)
+		}
+		defer rows.Close()
+		return mapStatementTimeout(scan(rows))
+	}
+
+	tx, err := beginWithTimeout(conn, timeout)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, params...)
+	if err != nil {
+		return mapStatementTimeout(err)
+	}
+	defer rows.Close()
+	if err := scan(rows); err != nil {
+		return mapStatementTimeout(err)
+	}
+	rows.Close()
+	return mapStatementTimeout(tx.Commit())
+}
+
+// queryRowWithTimeout is queryWithTimeout for a single row scanned into dest,
+// returning sql.ErrNoRows when the query yields none
+func queryRowWithTimeout(conn *sql.DB, timeout time.Duration, query string, params []interface{}, dest ...interface{}) error {
+	return queryWithTimeout(conn, timeout, func(rows *sql.Rows) error {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return sql.ErrNoRows
+		}
+		return rows.Scan(dest...)
+	}, query, params...)
+}
+
+// timeoutConnector opens pq connections and sets statement_timeout on each one
+type timeoutConnector struct {
+	driver.Connector
+	timeout time.Duration
+}
+
+// Connect opens a connection and applies the statement timeout to it
+func (c timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("driver connection cannot execute statements")
+	}
+	if _, err := execer.ExecContext(ctx, statementTimeoutSQL(c.timeout, false), nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting statement timeout: %v", err)
+	}
+	return conn, nil
+}
+
+// OpenWithStatementTimeout opens a connection pool for dsn in which every
+// connection runs SET statement_timeout, so any query on it that runs longer
+// than timeout is cancelled by Postgres. Pass the pool to
+// NewKBDataStructuresFromDB to apply the limit to every component at once;
+// searches and the component transactions report its cancellations as
+// ErrStatementTimeout. SetStatementTimeout limits components on a shared pool
+// instead.
+func OpenWithStatementTimeout(dsn string, timeout time.Duration) (*sql.DB, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("statement timeout must be positive")
+	}
+
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection string: %v", err)
+	}
+	db := sql.OpenDB(timeoutConnector{Connector: connector, timeout: timeout})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+	return db, nil
+}
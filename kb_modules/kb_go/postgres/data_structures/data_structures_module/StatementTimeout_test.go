@@ -0,0 +1,114 @@
+package data_structures_module
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestStatementTimeout runs pg_sleep past a component timeout and checks
+// Postgres cancels it promptly without changing the pooled connection
+func TestStatementTimeout(t *testing.T) {
+	ks := setupTestStream(t, "kb1.stream1", 1)
+	defer ks.KBSearch.Disconnect()
+
+	const timeout = 100 * time.Millisecond
+	ks.StatementTimeout = timeout
+
+	checkStatementTimeout(t, "executeQuery", func() error {
+		_, err := ks.executeQuery("SELECT pg_sleep(5)")
+		return err
+	})
+
+	// The limit is local to the component's transaction, not the pooled connection
+	var setting string
+	if err := ks.conn.QueryRow("SHOW statement_timeout").Scan(&setting); err != nil || setting != "0" {
+		t.Errorf("Expected the pool's statement_timeout unchanged, got %q, %v", setting, err)
+	}
+
+	if _, err := OpenWithStatementTimeout("", 0); err == nil {
+		t.Error("Expected a non-positive timeout to be rejected")
+	}
+}
+
+// TestStatementTimeoutPaths blocks the node and job tables behind a lock and
+// checks a search and a job claim are cancelled with ErrStatementTimeout, both
+// under KBSearch.StatementTimeout and on a pool from OpenWithStatementTimeout
+func TestStatementTimeoutPaths(t *testing.T) {
+	jq := setupTestJobQueue(t, "kb1.job1", 1)
+	defer jq.KBSearch.Disconnect()
+
+	const timeout = 100 * time.Millisecond
+	unlock := lockTables(t, jq.conn, jq.KBSearch.BaseTable, jq.BaseTable)
+	defer unlock()
+
+	checkPaths := func(t *testing.T, kb *KBSearch) {
+		t.Helper()
+		checkStatementTimeout(t, "ExecuteQuery", func() error {
+			_, err := kb.ExecuteQuery()
+			return err
+		})
+		queue := NewKBJobQueue(kb, testDBTable)
+		checkStatementTimeout(t, "PeakJobData", func() error {
+			_, err := queue.PeakJobData("kb1.job1", 1, time.Millisecond)
+			return err
+		})
+	}
+
+	t.Run("Component", func(t *testing.T) {
+		jq.KBSearch.StatementTimeout = timeout
+		defer func() { jq.KBSearch.StatementTimeout = 0 }()
+		checkPaths(t, jq.KBSearch)
+	})
+
+	t.Run("Pool", func(t *testing.T) {
+		dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+			url.PathEscape(testDBUser), url.PathEscape(testDBPassword), testDBHost, testDBPort, testDBName)
+		db, err := OpenWithStatementTimeout(dsn, timeout)
+		if err != nil {
+			t.Fatalf("Error opening pool: %v", err)
+		}
+		defer db.Close()
+
+		kb, err := NewKBSearchFromDB(db, testDBTable)
+		if err != nil {
+			t.Fatalf("Error creating KBSearch: %v", err)
+		}
+		checkPaths(t, kb)
+	})
+}
+
+// lockTables holds an ACCESS EXCLUSIVE lock on tables until the returned func
+// is called, so queries against them wait until their statement timeout
+func lockTables(t *testing.T, conn *sql.DB, tables ...string) func() {
+	t.Helper()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatalf("Error beginning lock transaction: %v", err)
+	}
+	for _, table := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS EXCLUSIVE MODE", table)); err != nil {
+			tx.Rollback()
+			t.Fatalf("Error locking %s: %v", table, err)
+		}
+	}
+	return func() { tx.Rollback() }
+}
+
+// checkStatementTimeout checks fn fails promptly with ErrStatementTimeout
+func checkStatementTimeout(t *testing.T, op string, fn func() error) {
+	t.Helper()
+
+	start := time.Now()
+	err := fn()
+	if !errors.Is(err, ErrStatementTimeout) {
+		t.Errorf("Expected %s to fail with ErrStatementTimeout, got %v", op, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected %s cancelled promptly, took %v", op, elapsed)
+	}
+}
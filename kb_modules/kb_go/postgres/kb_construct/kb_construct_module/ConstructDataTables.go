@@ -18,9 +18,9 @@ type ConstructDataTables struct {
 }
 
 // NewConstructDataTables creates a new instance with all table constructors
-func NewConstructDataTables(host string, port int, dbname, user, password, database string) (*ConstructDataTables, error) {
+func NewConstructDataTables(host string, port int, dbname, user, password, database string, opts ...ManagerOption) (*ConstructDataTables, error) {
 	// Create the base knowledge base constructor
-	kb, err := NewConstructKB(host, port, dbname, user, password, database)
+	kb, err := NewConstructKB(host, port, dbname, user, password, database, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating ConstructKB: %w", err)
 	}
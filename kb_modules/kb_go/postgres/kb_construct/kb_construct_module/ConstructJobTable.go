@@ -2,7 +2,6 @@ package kb_construct_module
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 
 	_ "github.com/lib/pq"
@@ -61,9 +60,14 @@ func (cjt *ConstructJobTable) setupSchema() error {
 			schedule_at TIMESTAMPTZ DEFAULT NOW(),
 			started_at TIMESTAMPTZ DEFAULT NOW(),
 			completed_at TIMESTAMPTZ DEFAULT NOW(),
+			claimed_at TIMESTAMPTZ,
+			claim_token TEXT,
 			is_active BOOLEAN DEFAULT FALSE,
 			valid BOOLEAN DEFAULT FALSE,
-			data JSONB
+			priority INTEGER DEFAULT 0,
+			data JSONB,
+			result JSONB,
+			idempotency_key TEXT UNIQUE
 		);`, cjt.tableName)
 
 	if _, err := cjt.conn.Exec(createTableQuery); err != nil {
@@ -96,6 +100,10 @@ func (cjt *ConstructJobTable) setupSchema() error {
 		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_active_schedule ON %s (is_active, schedule_at);",
 			cjt.tableName, cjt.tableName),
 
+		// Composite index for priority-ordered dequeue
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_path_priority ON %s (path, priority DESC, schedule_at);",
+			cjt.tableName, cjt.tableName),
+
 		// Index on started_at
 		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_started_at ON %s (started_at);",
 			cjt.tableName, cjt.tableName),
@@ -111,7 +119,31 @@ func (cjt *ConstructJobTable) setupSchema() error {
 		}
 	}
 
-	fmt.Printf("Job table '%s' created with optimized indexes.\n", cjt.tableName)
+	// Notify waiting workers whenever a job becomes available
+	notifyFunctionQuery := fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.valid AND NOT NEW.is_active THEN
+				PERFORM pg_notify(TG_TABLE_NAME, NEW.path::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;`, cjt.tableName)
+
+	if _, err := cjt.conn.Exec(notifyFunctionQuery); err != nil {
+		return fmt.Errorf("error creating notify function: %w", err)
+	}
+
+	notifyTriggerQuery := fmt.Sprintf(`
+		CREATE TRIGGER %s_notify_trigger
+		AFTER INSERT OR UPDATE ON %s
+		FOR EACH ROW EXECUTE FUNCTION %s_notify();`, cjt.tableName, cjt.tableName, cjt.tableName)
+
+	if _, err := cjt.conn.Exec(notifyTriggerQuery); err != nil {
+		return fmt.Errorf("error creating notify trigger: %w", err)
+	}
+
+	cjt.constructKB.logger.Infof("Job table '%s' created with optimized indexes.", cjt.tableName)
 	return nil
 }
 
@@ -127,7 +159,7 @@ func (cjt *ConstructJobTable) AddJobField(jobKey string, jobLength int, descript
 		return nil, fmt.Errorf("error adding info node: %w", err)
 	}
 
-	fmt.Printf("Added job field '%s' with properties: %v and data: %v\n", jobKey, properties, data)
+	cjt.constructKB.logger.Infof("Added job field '%s' with properties: %v and data: %v", jobKey, properties, data)
 
 	result := &JobFieldResult{
 		Job:        "success",
@@ -141,8 +173,8 @@ func (cjt *ConstructJobTable) AddJobField(jobKey string, jobLength int, descript
 
 // manageJobTable manages the number of records to match specified job lengths
 func (cjt *ConstructJobTable) manageJobTable(specifiedJobPaths []string, specifiedJobLength []int) error {
-	fmt.Printf("specified_job_paths: %v\n", specifiedJobPaths)
-	fmt.Printf("specified_job_length: %v\n", specifiedJobLength)
+	cjt.constructKB.logger.Debugf("specified_job_paths: %v", specifiedJobPaths)
+	cjt.constructKB.logger.Debugf("specified_job_length: %v", specifiedJobLength)
 
 	// Begin transaction
 	tx, err := cjt.conn.Begin()
@@ -161,7 +193,7 @@ func (cjt *ConstructJobTable) manageJobTable(specifiedJobPaths []string, specifi
 		if err := tx.QueryRow(countQuery, path).Scan(&currentCount); err != nil {
 			return fmt.Errorf("error counting records for path %s: %w", path, err)
 		}
-		fmt.Printf("current_count: %d\n", currentCount)
+		cjt.constructKB.logger.Debugf("current_count: %d", currentCount)
 
 		diff := targetLength - currentCount
 
@@ -200,7 +232,7 @@ func (cjt *ConstructJobTable) manageJobTable(specifiedJobPaths []string, specifi
 		return fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	fmt.Println("Job table management completed.")
+	cjt.constructKB.logger.Infof("Job table management completed.")
 	return nil
 }
 
@@ -268,7 +300,7 @@ func (cjt *ConstructJobTable) CheckInstallation() error {
 		}
 		uniqueJobPaths = append(uniqueJobPaths, path)
 	}
-	fmt.Printf("unique_job_paths: %v\n", uniqueJobPaths)
+	cjt.constructKB.logger.Debugf("unique_job_paths: %v", uniqueJobPaths)
 
 	// Get specified paths from knowledge_table
 	knowledgeQuery := fmt.Sprintf(`
@@ -293,7 +325,7 @@ func (cjt *ConstructJobTable) CheckInstallation() error {
 		}
 
 		var properties map[string]interface{}
-		if err := json.Unmarshal(propertiesJSON, &properties); err != nil {
+		if err := decodeJSONMap(propertiesJSON, &properties); err != nil {
 			return fmt.Errorf("error unmarshaling properties: %w", err)
 		}
 
@@ -307,8 +339,8 @@ func (cjt *ConstructJobTable) CheckInstallation() error {
 		}
 	}
 
-	fmt.Printf("specified_job_paths: %v\n", specifiedJobPaths)
-	fmt.Printf("specified_job_length: %v\n", specifiedJobLength)
+	cjt.constructKB.logger.Debugf("specified_job_paths: %v", specifiedJobPaths)
+	cjt.constructKB.logger.Debugf("specified_job_length: %v", specifiedJobLength)
 
 	// Find invalid paths (in job_table but not in knowledge_base)
 	invalidJobPaths := findDifference(uniqueJobPaths, specifiedJobPaths)
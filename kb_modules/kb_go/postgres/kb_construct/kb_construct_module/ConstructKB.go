@@ -17,7 +17,7 @@ type ConstructKB struct {
 }
 
 // NewConstructKB creates a new instance of ConstructKB
-func NewConstructKB(host string, port int, dbname, user, password, tableName string) (*ConstructKB, error) {
+func NewConstructKB(host string, port int, dbname, user, password, tableName string, opts ...ManagerOption) (*ConstructKB, error) {
 	// Create connection parameters
 	connParams := ConnectionParams{
 		Host:     host,
@@ -28,7 +28,7 @@ func NewConstructKB(host string, port int, dbname, user, password, tableName str
 	}
 
 	// Create base KnowledgeBaseManager
-	kbManager, err := NewKnowledgeBaseManager(tableName, connParams)
+	kbManager, err := NewKnowledgeBaseManager(tableName, connParams, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating knowledge base manager: %w", err)
 	}
@@ -106,7 +106,7 @@ func (ckb *ConstructKB) AddHeaderNode(link, nodeName string, nodeProperties, nod
 
 	// Get current path
 	path := strings.Join(ckb.path[ckb.workingKB], ".")
-	fmt.Println("path", path)
+	ckb.logger.Debugf("path %s", path)
 
 	// Add node using parent method
 	return ckb.KnowledgeBaseManager.AddNode(ckb.workingKB, link, nodeName, nodeProperties, nodeData, path)
@@ -2,7 +2,6 @@ package kb_construct_module
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -81,14 +80,17 @@ func (crt *ConstructRPCClientTable) setupSchema() error {
 			response_timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(), -- UTC timestamp
 			
 			-- Boolean to identify new/unprocessed results
-			is_new_result BOOLEAN NOT NULL DEFAULT FALSE
+			is_new_result BOOLEAN NOT NULL DEFAULT FALSE,
+
+			-- When the slot was claimed by a push; NULL while the slot is free
+			claimed_at TIMESTAMPTZ
 		);`, crt.tableName)
 
 	if _, err := crt.conn.Exec(createTableQuery); err != nil {
 		return fmt.Errorf("error creating table: %w", err)
 	}
 
-	fmt.Println("rpc_client table created.")
+	crt.constructKB.logger.Infof("rpc_client table created.")
 	return nil
 }
 
@@ -103,7 +105,7 @@ func (crt *ConstructRPCClientTable) AddRPCClientField(rpcClientKey string, queue
 		return nil, fmt.Errorf("error adding info node: %w", err)
 	}
 
-	fmt.Printf("Added rpc_client field '%s' with properties: %v\n", rpcClientKey, properties)
+	crt.constructKB.logger.Infof("Added rpc_client field '%s' with properties: %v", rpcClientKey, properties)
 
 	result := &RPCClientFieldResult{
 		RPCClient:  "success",
@@ -118,7 +120,7 @@ func (crt *ConstructRPCClientTable) AddRPCClientField(rpcClientKey string, queue
 // RemoveUnspecifiedEntries removes entries from rpc_client_table where client_path is not in the specified list
 func (crt *ConstructRPCClientTable) RemoveUnspecifiedEntries(specifiedClientPaths []string) (int, error) {
 	if len(specifiedClientPaths) == 0 {
-		fmt.Println("Warning: No client_paths specified. No entries will be removed.")
+		crt.constructKB.logger.Infof("Warning: No client_paths specified. No entries will be removed.")
 		return 0, nil
 	}
 
@@ -131,11 +133,11 @@ func (crt *ConstructRPCClientTable) RemoveUnspecifiedEntries(specifiedClientPath
 	}
 
 	if len(validPaths) == 0 {
-		fmt.Println("Warning: No valid client_paths found after filtering. No entries will be removed.")
+		crt.constructKB.logger.Infof("Warning: No valid client_paths found after filtering. No entries will be removed.")
 		return 0, nil
 	}
 
-	fmt.Printf("Processing %d valid client paths\n", len(validPaths))
+	crt.constructKB.logger.Infof("Processing %d valid client paths", len(validPaths))
 
 	// Begin transaction
 	tx, err := crt.conn.Begin()
@@ -200,7 +202,7 @@ func (crt *ConstructRPCClientTable) RemoveUnspecifiedEntries(specifiedClientPath
 	// Clean up temp table (best effort)
 	crt.conn.Exec("DROP TABLE IF EXISTS valid_client_paths")
 
-	fmt.Printf("Removed %d unspecified entries from %s\n", deletedCount, crt.tableName)
+	crt.constructKB.logger.Infof("Removed %d unspecified entries from %s", deletedCount, crt.tableName)
 	return int(deletedCount), nil
 }
 
@@ -323,7 +325,8 @@ func (crt *ConstructRPCClientTable) RestoreDefaultValues() (int, error) {
 			rpc_action = 'none',
 			response_payload = '{}'::jsonb,
 			response_timestamp = NOW(),
-			is_new_result = FALSE
+			is_new_result = FALSE,
+			claimed_at = NULL
 		RETURNING id`, crt.tableName)
 
 	rows, err := crt.conn.Query(updateQuery)
@@ -360,7 +363,7 @@ func (crt *ConstructRPCClientTable) CheckInstallation() error {
 	var paths []string
 	var lengths []int
 
-	fmt.Println("specified_paths_data:")
+	crt.constructKB.logger.Debugf("specified_paths_data:")
 	for rows.Next() {
 		var path string
 		var propertiesJSON []byte
@@ -370,7 +373,7 @@ func (crt *ConstructRPCClientTable) CheckInstallation() error {
 		}
 
 		var properties map[string]interface{}
-		if err := json.Unmarshal(propertiesJSON, &properties); err != nil {
+		if err := decodeJSONMap(propertiesJSON, &properties); err != nil {
 			return fmt.Errorf("error unmarshaling properties: %w", err)
 		}
 
@@ -383,7 +386,7 @@ func (crt *ConstructRPCClientTable) CheckInstallation() error {
 			return fmt.Errorf("queue_depth not found or invalid for path %s", path)
 		}
 
-		fmt.Printf("  path: %s, properties: %v\n", path, properties)
+		crt.constructKB.logger.Debugf("path: %s, properties: %v", path, properties)
 	}
 
 	// Execute the three operations
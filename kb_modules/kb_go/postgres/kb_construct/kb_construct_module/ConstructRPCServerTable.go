@@ -2,7 +2,6 @@ package kb_construct_module
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -89,7 +88,31 @@ func (crt *ConstructRPCServerTable) setupSchema() error {
 		return fmt.Errorf("error creating table: %w", err)
 	}
 
-	fmt.Println("rpc_server table created.")
+	// Notify waiting servers whenever a slot becomes a new job
+	notifyFunctionQuery := fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.state = 'new_job' THEN
+				PERFORM pg_notify(TG_TABLE_NAME, NEW.server_path::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;`, crt.tableName)
+
+	if _, err := crt.conn.Exec(notifyFunctionQuery); err != nil {
+		return fmt.Errorf("error creating notify function: %w", err)
+	}
+
+	notifyTriggerQuery := fmt.Sprintf(`
+		CREATE TRIGGER %s_notify_trigger
+		AFTER INSERT OR UPDATE ON %s
+		FOR EACH ROW EXECUTE FUNCTION %s_notify();`, crt.tableName, crt.tableName, crt.tableName)
+
+	if _, err := crt.conn.Exec(notifyTriggerQuery); err != nil {
+		return fmt.Errorf("error creating notify trigger: %w", err)
+	}
+
+	crt.constructKB.logger.Infof("rpc_server table created.")
 	return nil
 }
 
@@ -105,7 +128,7 @@ func (crt *ConstructRPCServerTable) AddRPCServerField(rpcServerKey string, queue
 		return nil, fmt.Errorf("error adding info node: %w", err)
 	}
 
-	fmt.Printf("Added rpc_server field '%s' with properties: %v and data: %v\n", rpcServerKey, properties, data)
+	crt.constructKB.logger.Infof("Added rpc_server field '%s' with properties: %v and data: %v", rpcServerKey, properties, data)
 
 	result := &RPCServerFieldResult{
 		Status:     "success",
@@ -120,7 +143,7 @@ func (crt *ConstructRPCServerTable) AddRPCServerField(rpcServerKey string, queue
 // RemoveUnspecifiedEntries removes entries from rpc_server_table where server_path is not in the specified list
 func (crt *ConstructRPCServerTable) RemoveUnspecifiedEntries(specifiedServerPaths []string) (int, error) {
 	if len(specifiedServerPaths) == 0 {
-		fmt.Println("Warning: No server_paths specified. No entries will be removed.")
+		crt.constructKB.logger.Infof("Warning: No server_paths specified. No entries will be removed.")
 		return 0, nil
 	}
 
@@ -133,11 +156,11 @@ func (crt *ConstructRPCServerTable) RemoveUnspecifiedEntries(specifiedServerPath
 	}
 
 	if len(validPaths) == 0 {
-		fmt.Println("Warning: No valid server_paths found after filtering. No entries will be removed.")
+		crt.constructKB.logger.Infof("Warning: No valid server_paths found after filtering. No entries will be removed.")
 		return 0, nil
 	}
 
-	fmt.Printf("Processing %d valid server paths\n", len(validPaths))
+	crt.constructKB.logger.Infof("Processing %d valid server paths", len(validPaths))
 
 	// Begin transaction
 	tx, err := crt.conn.Begin()
@@ -214,7 +237,7 @@ func (crt *ConstructRPCServerTable) RemoveUnspecifiedEntries(specifiedServerPath
 	// Clean up temp table (best effort)
 	crt.conn.Exec("DROP TABLE IF EXISTS valid_server_paths")
 
-	fmt.Printf("Removed %d unspecified entries from %s\n", deletedCount, crt.tableName)
+	crt.constructKB.logger.Infof("Removed %d unspecified entries from %s", deletedCount, crt.tableName)
 	return int(deletedCount), nil
 }
 
@@ -356,7 +379,7 @@ func (crt *ConstructRPCServerTable) RestoreDefaultValues() (int, error) {
 		updatedCount++
 	}
 
-	fmt.Printf("Restored default values for %d records\n", updatedCount)
+	crt.constructKB.logger.Infof("Restored default values for %d records", updatedCount)
 	return updatedCount, nil
 }
 
@@ -385,7 +408,7 @@ func (crt *ConstructRPCServerTable) CheckInstallation() error {
 		}
 
 		var properties map[string]interface{}
-		if err := json.Unmarshal(propertiesJSON, &properties); err != nil {
+		if err := decodeJSONMap(propertiesJSON, &properties); err != nil {
 			return fmt.Errorf("error unmarshaling properties: %w", err)
 		}
 
@@ -399,7 +422,7 @@ func (crt *ConstructRPCServerTable) CheckInstallation() error {
 		}
 	}
 
-	fmt.Printf("paths: %v, lengths: %v\n", paths, lengths)
+	crt.constructKB.logger.Debugf("paths: %v, lengths: %v", paths, lengths)
 
 	// Execute the three operations
 	if _, err := crt.RemoveUnspecifiedEntries(paths); err != nil {
@@ -39,7 +39,7 @@ func NewConstructStatusTable(conn *sql.DB, constructKB *ConstructKB, database st
 		tableName:   database + "_status",
 	}
 
-	fmt.Printf("database: %s\n", database)
+	constructKB.logger.Debugf("database: %s", database)
 
 	if err := cst.setupSchema(); err != nil {
 		return nil, fmt.Errorf("error setting up schema: %w", err)
@@ -90,7 +90,28 @@ func (cst *ConstructStatusTable) setupSchema() error {
 		}
 	}
 
-	fmt.Printf("Status table '%s' created with optimized indexes.\n", cst.tableName)
+	// Create the status history table; it stays empty unless history is enabled on the reader
+	historyTable := cst.tableName + "_history"
+	historyQueries := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", historyTable),
+		fmt.Sprintf(`
+		CREATE TABLE %s (
+			id SERIAL PRIMARY KEY,
+			path LTREE NOT NULL,
+			data JSON,
+			recorded_at TIMESTAMPTZ DEFAULT NOW()
+		);`, historyTable),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_path_recorded_at ON %s (path, recorded_at DESC);",
+			historyTable, historyTable),
+	}
+
+	for _, historyQuery := range historyQueries {
+		if _, err := cst.conn.Exec(historyQuery); err != nil {
+			return fmt.Errorf("error creating status history table: %w", err)
+		}
+	}
+
+	cst.constructKB.logger.Infof("Status table '%s' created with optimized indexes.", cst.tableName)
 	return nil
 }
 
@@ -105,7 +126,7 @@ func (cst *ConstructStatusTable) AddStatusField(statusKey string, properties map
 		initialData = make(map[string]interface{})
 	}
 
-	fmt.Printf("Added status field '%s' with properties: %v and data: %v\n", statusKey, properties, initialData)
+	cst.constructKB.logger.Infof("Added status field '%s' with properties: %v and data: %v", statusKey, properties, initialData)
 
 	// Add the node to the knowledge base
 	if err := cst.constructKB.AddInfoNode("KB_STATUS_FIELD", statusKey, properties, initialData, description); err != nil {
@@ -161,15 +182,15 @@ func (cst *ConstructStatusTable) CheckInstallation() (*CheckInstallationResult,
 		specifiedPaths = append(specifiedPaths, path)
 	}
 
-	fmt.Printf("specified_paths: %v\n", specifiedPaths)
+	cst.constructKB.logger.Debugf("specified_paths: %v", specifiedPaths)
 
 	// Find missing paths (in specified_paths but not in all_paths)
 	missingPaths := findDifference(specifiedPaths, allPaths)
-	fmt.Printf("missing_paths: %v\n", missingPaths)
+	cst.constructKB.logger.Debugf("missing_paths: %v", missingPaths)
 
 	// Find not specified paths (in all_paths but not in specified_paths)
 	notSpecifiedPaths := findDifference(allPaths, specifiedPaths)
-	fmt.Printf("not_specified_paths: %v\n", notSpecifiedPaths)
+	cst.constructKB.logger.Debugf("not_specified_paths: %v", notSpecifiedPaths)
 
 	// Begin transaction for consistency
 	tx, err := cst.conn.Begin()
@@ -187,7 +208,7 @@ func (cst *ConstructStatusTable) CheckInstallation() (*CheckInstallationResult,
 	defer deleteStmt.Close()
 
 	for _, path := range notSpecifiedPaths {
-		fmt.Printf("deleting path: %s\n", path)
+		cst.constructKB.logger.Debugf("deleting path: %s", path)
 		if _, err := deleteStmt.Exec(path); err != nil {
 			return nil, fmt.Errorf("error deleting path %s: %w", path, err)
 		}
@@ -204,7 +225,7 @@ func (cst *ConstructStatusTable) CheckInstallation() (*CheckInstallationResult,
 	defer insertStmt.Close()
 
 	for _, path := range missingPaths {
-		fmt.Printf("inserting path: %s\n", path)
+		cst.constructKB.logger.Debugf("inserting path: %s", path)
 		if _, err := insertStmt.Exec("{}", path); err != nil {
 			return nil, fmt.Errorf("error inserting path %s: %w", path, err)
 		}
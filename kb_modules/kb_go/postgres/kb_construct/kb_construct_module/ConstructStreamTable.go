@@ -1,7 +1,6 @@
 package kb_construct_module
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	//"time"
 
@@ -60,7 +59,8 @@ func (cst *ConstructStreamTable) setupSchema() error {
 			path LTREE,
 			recorded_at TIMESTAMPTZ DEFAULT NOW(),
 			valid BOOLEAN DEFAULT FALSE,
-			data JSONB
+			data JSONB,
+			idempotency_key TEXT UNIQUE
 		);`, cst.tableName)
 
 	if _, err := cst.conn.Exec(createTableQuery); err != nil {
@@ -96,6 +96,31 @@ func (cst *ConstructStreamTable) setupSchema() error {
 		}
 	}
 
+	// Notify subscribers whenever a record becomes valid. Stream rows are
+	// pre-allocated and overwritten in place, so updates are notified as well as inserts.
+	notifyFunctionQuery := fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %s_notify() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.valid THEN
+				PERFORM pg_notify(TG_TABLE_NAME, json_build_object('id', NEW.id, 'path', NEW.path::text)::text);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;`, cst.tableName)
+
+	if _, err := cst.conn.Exec(notifyFunctionQuery); err != nil {
+		return fmt.Errorf("error creating notify function: %w", err)
+	}
+
+	notifyTriggerQuery := fmt.Sprintf(`
+		CREATE TRIGGER %s_notify_trigger
+		AFTER INSERT OR UPDATE ON %s
+		FOR EACH ROW EXECUTE FUNCTION %s_notify();`, cst.tableName, cst.tableName, cst.tableName)
+
+	if _, err := cst.conn.Exec(notifyTriggerQuery); err != nil {
+		return fmt.Errorf("error creating notify trigger: %w", err)
+	}
+
 	return nil
 }
 
@@ -247,7 +272,7 @@ func (cst *ConstructStreamTable) CheckInstallation() error {
 		}
 
 		var properties map[string]interface{}
-		if err := json.Unmarshal(propertiesJSON, &properties); err != nil {
+		if err := decodeJSONMap(propertiesJSON, &properties); err != nil {
 			return fmt.Errorf("error unmarshaling properties: %w", err)
 		}
 
@@ -261,8 +286,8 @@ func (cst *ConstructStreamTable) CheckInstallation() error {
 		}
 	}
 
-	fmt.Printf("specified_stream_paths: %v\n", specifiedStreamPaths)
-	fmt.Printf("specified_stream_length: %v\n", specifiedStreamLength)
+	cst.constructKB.logger.Debugf("specified_stream_paths: %v", specifiedStreamPaths)
+	cst.constructKB.logger.Debugf("specified_stream_length: %v", specifiedStreamLength)
 
 	// Find invalid paths (in stream_table but not in knowledge_base)
 	invalidStreamPaths := findDifference(uniqueStreamPaths, specifiedStreamPaths)
@@ -270,8 +295,8 @@ func (cst *ConstructStreamTable) CheckInstallation() error {
 	// Find missing paths (in knowledge_base but not in stream_table)
 	missingStreamPaths := findDifference(specifiedStreamPaths, uniqueStreamPaths)
 
-	fmt.Printf("invalid_stream_paths: %v\n", invalidStreamPaths)
-	fmt.Printf("missing_stream_paths: %v\n", missingStreamPaths)
+	cst.constructKB.logger.Debugf("invalid_stream_paths: %v", invalidStreamPaths)
+	cst.constructKB.logger.Debugf("missing_stream_paths: %v", missingStreamPaths)
 
 	// Remove invalid stream fields
 	if err := cst.removeInvalidStreamFields(invalidStreamPaths, 500); err != nil {
@@ -0,0 +1,122 @@
+package kb_construct_module
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportDOT writes kbName as a Graphviz digraph to w. Each node is drawn with
+// its name and label and joined to its ltree parent (the path without its last
+// label); the knowledge base itself is the root. Links from a node to a mount
+// are drawn as dashed edges to the mounted path in the target knowledge base.
+// Rows are written as they are read, so large knowledge bases are not held in
+// memory. Render with e.g. "dot -Tsvg kb.dot > kb.svg".
+func (kb *KnowledgeBaseManager) ExportDOT(kbName string, w io.Writer) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	dot := &dotWriter{w: w}
+	dot.begin(kbName)
+
+	nodeQuery := fmt.Sprintf(`
+		SELECT path::text, label, name FROM %s
+		WHERE knowledge_base = $1%s
+		ORDER BY path`, kb.tableName, kb.liveNodes())
+	rows, err := kb.db().Query(nodeQuery, kbName)
+	if err != nil {
+		return fmt.Errorf("error querying nodes: %w", err)
+	}
+	for rows.Next() && dot.err == nil {
+		var path, label, name string
+		if err := rows.Scan(&path, &label, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning node: %w", err)
+		}
+		dot.node(kbName, path, label, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating nodes: %w", err)
+	}
+
+	linkQuery := fmt.Sprintf(`
+		SELECT l.parent_path::text, l.link_name, m.mount_path::text
+		FROM %s l
+		JOIN %s m ON m.link_name = l.link_name
+		WHERE l.parent_node_kb = $1
+		ORDER BY l.parent_path, l.link_name`, kb.linkTable, kb.linkMountTable)
+	rows, err = kb.db().Query(linkQuery, kbName)
+	if err != nil {
+		return fmt.Errorf("error querying links: %w", err)
+	}
+	for rows.Next() && dot.err == nil {
+		var parentPath, linkName, mountPath string
+		if err := rows.Scan(&parentPath, &linkName, &mountPath); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning link: %w", err)
+		}
+		dot.link(parentPath, linkName, mountPath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating links: %w", err)
+	}
+
+	dot.end()
+	if dot.err != nil {
+		return fmt.Errorf("error writing dot output: %w", dot.err)
+	}
+	return nil
+}
+
+// dotWriter emits DOT statements, keeping the first write error
+type dotWriter struct {
+	w   io.Writer
+	err error
+}
+
+// printf writes one formatted line unless an earlier write failed
+func (d *dotWriter) printf(format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format+"\n", args...)
+}
+
+// begin opens the digraph and draws the knowledge base root
+func (d *dotWriter) begin(kbName string) {
+	d.printf("digraph %s {", dotQuote(kbName))
+	d.printf("\trankdir=LR;")
+	d.printf("\tnode [shape=box];")
+	d.printf("\t%s [shape=folder];", dotQuote(kbName))
+}
+
+// node draws a node and the edge from its parent
+func (d *dotWriter) node(kbName, path, label, name string) {
+	parent := kbName
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent = path[:i]
+	}
+	d.printf("\t%s [label=%s];", dotQuote(path), dotQuote(name+"\n("+label+")"))
+	d.printf("\t%s -> %s;", dotQuote(parent), dotQuote(path))
+}
+
+// link draws a dashed edge from a linking node to its mount point
+func (d *dotWriter) link(parentPath, linkName, mountPath string) {
+	d.printf("\t%s -> %s [style=dashed, label=%s];", dotQuote(parentPath), dotQuote(mountPath), dotQuote(linkName))
+}
+
+// end closes the digraph
+func (d *dotWriter) end() {
+	d.printf("}")
+}
+
+// dotQuote returns s as a double-quoted DOT ID
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,82 @@
+package kb_construct_module
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden compares got with testdata/name, rewriting it under -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("Error writing golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Error reading golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Output does not match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+// TestDOTWriterGolden renders the golden knowledge base without a database
+func TestDOTWriterGolden(t *testing.T) {
+	var buf bytes.Buffer
+	dot := &dotWriter{w: &buf}
+	dot.begin("kb1")
+	dot.node("kb1", "kb1.a", "header", "a")
+	dot.node("kb1", "kb1.a.b", "info", `quoted "b"`)
+	dot.node("kb1", "kb1.c", "header", "c")
+	dot.link("kb1.a.b", "link1", "kb2.mount")
+	dot.end()
+	if dot.err != nil {
+		t.Fatalf("Error writing dot: %v", dot.err)
+	}
+
+	checkGolden(t, "export_kb1.dot", buf.Bytes())
+}
+
+// TestExportDOT exports the same knowledge base from the database
+func TestExportDOT(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "DOT export"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+	nodes := []struct{ kb, label, name, path string }{
+		{"kb1", "header", "a", "kb1.a"},
+		{"kb1", "info", `quoted "b"`, "kb1.a.b"},
+		{"kb1", "header", "c", "kb1.c"},
+		{"kb2", "header", "mount", "kb2.mount"},
+	}
+	for _, n := range nodes {
+		if err := kbManager.AddNode(n.kb, n.label, n.name, nil, nil, n.path); err != nil {
+			t.Fatalf("Error adding node %s: %v", n.path, err)
+		}
+	}
+	if _, _, err := kbManager.AddLinkMount("kb2", "kb2.mount", "link1", "mount point"); err != nil {
+		t.Fatalf("Error adding link mount: %v", err)
+	}
+	if err := kbManager.AddLink("kb1", "kb1.a.b", "link1"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := kbManager.ExportDOT("kb1", &buf); err != nil {
+		t.Fatalf("Error exporting dot: %v", err)
+	}
+	checkGolden(t, "export_kb1.dot", buf.Bytes())
+}
@@ -1,20 +1,49 @@
 package kb_construct_module
 
 import (
+	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"time"
 	//"log"
 	//"os"
-	//"strings"
+	"strings"
+	"sync"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // KnowledgeBaseManager manages knowledge base operations
 type KnowledgeBaseManager struct {
-	conn      *sql.DB
-	tableName string
+	connMu             sync.RWMutex // guards conn, which ensureConnected may replace, useJSONB and kbScopedPaths
+	conn               *sql.DB
+	tableName          string
+	infoTable          string
+	linkTable          string
+	linkMountTable     string
+	tablePrefix        string
+	tableNames         TableNames
+	dial               func() (*sql.DB, error) // re-dials a dropped connection; nil for an injected pool
+	ownsConn           bool
+	reconnectRetries   int
+	reconnectBackoff   time.Duration
+	txRetries          int
+	txRetryDelay       time.Duration
+	serializableWrites bool
+	logger             Logger
+	includeDeleted     bool
+	useJSONB           bool
+	useNumber          bool
+	rejectDoubleMount  bool
+	requireMountParent bool
+	kbScopedPaths      bool
+	schemaMu           sync.RWMutex
+	labelSchemas       map[string]*jsonSchema // set by RegisterLabelSchema
 }
 
 // ConnectionParams holds database connection parameters
@@ -26,28 +55,279 @@ type ConnectionParams struct {
 	Port     int
 }
 
-// NewKnowledgeBaseManager creates a new instance of KnowledgeBaseManager
-func NewKnowledgeBaseManager(tableName string, connParams ConnectionParams) (*KnowledgeBaseManager, error) {
+// ManagerOption configures optional behavior of a KnowledgeBaseManager
+type ManagerOption func(*KnowledgeBaseManager)
+
+// WithReconnectRetries sets how many times a dropped connection is re-dialed before giving up
+func WithReconnectRetries(retries int) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.reconnectRetries = retries
+	}
+}
+
+// WithReconnectBackoff sets the delay between reconnect attempts
+func WithReconnectBackoff(backoff time.Duration) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.reconnectBackoff = backoff
+	}
+}
+
+// WithTxRetries sets how many times AddNode retries a transaction that failed
+// with a serialization failure or deadlock, and the delay before the first
+// retry. The delay doubles after each retry. Zero retries disables retrying.
+func WithTxRetries(retries int, delay time.Duration) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.txRetries = retries
+		kb.txRetryDelay = delay
+	}
+}
+
+// WithSerializableWrites runs AddNode's knowledge base check and insert in a
+// serializable transaction, so a node cannot be added to a knowledge base
+// removed concurrently. Serialization failures are retried as set by
+// WithTxRetries. By default AddNode uses the database's default isolation level.
+func WithSerializableWrites() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.serializableWrites = true
+	}
+}
+
+// WithIncludeDeleted makes the node read APIs (CountNodes, CountByLabel and the
+// Query* methods) return soft-deleted nodes as well. Tables created before
+// soft-delete support need MigrateSoftDelete first.
+func WithIncludeDeleted() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.includeDeleted = true
+	}
+}
+
+// WithJSONB creates the properties and data columns as JSONB with a GIN index on
+// properties, so containment searches such as SearchByProperty use the index
+// instead of scanning the table. Existing tables can be converted with MigrateToJSONB.
+func WithJSONB() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.useJSONB = true
+	}
+}
+
+// WithJSONNumbers decodes numbers in node properties and data as json.Number
+// instead of float64, so integers beyond 2^53 read back exactly. Writes need no
+// option: AddNode, UpsertNode and UpdateNode marshal integer types and
+// json.Number verbatim, so values read this way round-trip unchanged.
+func WithJSONNumbers() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.useNumber = true
+	}
+}
+
+// WithRejectDoubleMount makes AddLinkMount and AddLinkMounts refuse a path
+// that is already a mount point, so mounts cannot be stacked into chains
+func WithRejectDoubleMount() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.rejectDoubleMount = true
+	}
+}
+
+// WithMountRequiresChildren makes AddLinkMount and AddLinkMounts refuse a leaf
+// path, so only header nodes with children can be mounted
+func WithMountRequiresChildren() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.requireMountParent = true
+	}
+}
+
+// WithKBScopedPaths makes node paths unique per knowledge base, with a
+// composite (knowledge_base, path) constraint, instead of unique across the
+// whole table. Separate knowledge bases can then reuse the same path, for
+// example when several are built from one template. The trade-off is that a
+// path alone no longer names a single node: lookups that take only a path may
+// match nodes in several knowledge bases, so callers must also filter by
+// knowledge base. Existing tables can be converted with MigrateToKBScopedPaths.
+func WithKBScopedPaths() ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.kbScopedPaths = true
+	}
+}
+
+// TableNames overrides the names of the four knowledge base tables. Empty
+// fields fall back to the base table name and its _info, _link and _link_mount
+// derivatives.
+type TableNames struct {
+	Base      string
+	Info      string
+	Link      string
+	LinkMount string
+}
+
+// WithTableNames sets explicit names for any of the four knowledge base tables
+func WithTableNames(names TableNames) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.tableNames = names
+	}
+}
+
+// WithTablePrefix prepends prefix to all four knowledge base table names, so
+// managers with the same base name can share a database
+func WithTablePrefix(prefix string) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		kb.tablePrefix = prefix
+	}
+}
+
+// resolveTableNames applies the table name options to baseName and validates
+// the resulting identifiers
+func (kb *KnowledgeBaseManager) resolveTableNames(baseName string) error {
+	names := kb.tableNames
+	if names.Base != "" {
+		baseName = names.Base
+	}
+	if names.Info == "" {
+		names.Info = baseName + "_info"
+	}
+	if names.Link == "" {
+		names.Link = baseName + "_link"
+	}
+	if names.LinkMount == "" {
+		names.LinkMount = baseName + "_link_mount"
+	}
+
+	kb.tableName = kb.tablePrefix + baseName
+	kb.infoTable = kb.tablePrefix + names.Info
+	kb.linkTable = kb.tablePrefix + names.Link
+	kb.linkMountTable = kb.tablePrefix + names.LinkMount
+
+	seen := make(map[string]bool)
+	for _, name := range []string{kb.tableName, kb.infoTable, kb.linkTable, kb.linkMountTable} {
+		if err := validateIdentifier(name); err != nil {
+			return err
+		}
+		if seen[name] {
+			return fmt.Errorf("table name '%s' is used for more than one table", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// TableNames returns the names of the four knowledge base tables in use
+func (kb *KnowledgeBaseManager) TableNames() TableNames {
+	return TableNames{
+		Base:      kb.tableName,
+		Info:      kb.infoTable,
+		Link:      kb.linkTable,
+		LinkMount: kb.linkMountTable,
+	}
+}
+
+// identifierPattern matches the unquoted SQL identifiers accepted for table names
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// maxIdentifierLength is the longest identifier Postgres stores without
+// truncating it (NAMEDATALEN - 1)
+const maxIdentifierLength = 63
+
+// ErrKBNotFound is returned when a knowledge base has no row in the info table
+var ErrKBNotFound = errors.New("knowledge base not found")
+
+// ErrNodeNotFound is returned when no node exists at a requested path
+var ErrNodeNotFound = errors.New("node not found")
+
+// validateIdentifier rejects names that cannot be safely interpolated into SQL.
+// Table names are formatted into queries with fmt.Sprintf because identifiers
+// cannot be bound as parameters, so they are restricted to [a-zA-Z_][a-zA-Z0-9_]*.
+// Longer names than Postgres stores are rejected rather than silently truncated.
+func validateIdentifier(name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("invalid identifier '%s': must match [a-zA-Z_][a-zA-Z0-9_]*", name)
+	}
+	if len(name) > maxIdentifierLength {
+		return fmt.Errorf("invalid identifier '%s': longer than %d characters", name, maxIdentifierLength)
+	}
+	return nil
+}
+
+// openConnection opens and pings a database connection using the given parameters
+func openConnection(connParams ConnectionParams) (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		connParams.Host, connParams.Port, connParams.User, connParams.Password, connParams.Database)
+	return openDSN(connStr)
+}
 
-	db, err := sql.Open("postgres", connStr)
+// openDSN opens and pings a database connection from a key=value connection
+// string or a postgres:// URL
+func openDSN(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("error pinging database: %w", err)
 	}
 
+	return db, nil
+}
+
+// NewKnowledgeBaseManager creates a new instance of KnowledgeBaseManager.
+// tableName must match [a-zA-Z_][a-zA-Z0-9_]*; it is used as the base name
+// for the _info, _link and _link_mount tables as well, unless overridden with
+// WithTableNames or WithTablePrefix.
+func NewKnowledgeBaseManager(tableName string, connParams ConnectionParams, opts ...ManagerOption) (*KnowledgeBaseManager, error) {
+	return newKnowledgeBaseManager(tableName, nil, func() (*sql.DB, error) {
+		return openConnection(connParams)
+	}, opts)
+}
+
+// NewKnowledgeBaseManagerFromURL creates a KnowledgeBaseManager from a
+// postgres:// URL or key=value connection string, such as a DATABASE_URL
+func NewKnowledgeBaseManagerFromURL(dsn string, tableName string, opts ...ManagerOption) (*KnowledgeBaseManager, error) {
+	return newKnowledgeBaseManager(tableName, nil, func() (*sql.DB, error) {
+		return openDSN(dsn)
+	}, opts)
+}
+
+// NewKnowledgeBaseManagerFromDB creates a KnowledgeBaseManager on an existing
+// connection pool. The manager does not take ownership of db: Close leaves it
+// open, and a dropped connection is not re-dialed.
+func NewKnowledgeBaseManagerFromDB(db *sql.DB, tableName string, opts ...ManagerOption) (*KnowledgeBaseManager, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db cannot be nil")
+	}
+	return newKnowledgeBaseManager(tableName, db, nil, opts)
+}
+
+// newKnowledgeBaseManager applies opts, then either adopts db or opens a pool
+// with dial, and creates the tables
+func newKnowledgeBaseManager(tableName string, db *sql.DB, dial func() (*sql.DB, error), opts []ManagerOption) (*KnowledgeBaseManager, error) {
 	kb := &KnowledgeBaseManager{
-		conn:      db,
-		tableName: tableName,
+		dial:             dial,
+		reconnectRetries: 3,
+		reconnectBackoff: time.Second,
+		txRetries:        3,
+		txRetryDelay:     50 * time.Millisecond,
+		logger:           noopLogger{},
+	}
+	for _, opt := range opts {
+		opt(kb)
+	}
+
+	if err := kb.resolveTableNames(tableName); err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+
+	if db == nil {
+		var err error
+		if db, err = dial(); err != nil {
+			return nil, err
+		}
+		kb.ownsConn = true
 	}
+	kb.conn = db
 
 	// Enable ltree extension
-	if _, err := kb.conn.Exec("CREATE EXTENSION IF NOT EXISTS ltree;"); err != nil {
+	if _, err := kb.db().Exec("CREATE EXTENSION IF NOT EXISTS ltree;"); err != nil {
 		return nil, fmt.Errorf("error creating ltree extension: %w", err)
 	}
 
@@ -59,18 +339,138 @@ func NewKnowledgeBaseManager(tableName string, connParams ConnectionParams) (*Kn
 	return kb, nil
 }
 
-// Disconnect closes the database connection
-func (kb *KnowledgeBaseManager) Disconnect() error {
-	if kb.conn != nil {
-		return kb.conn.Close()
+// Close closes the database connection and returns the error from the
+// underlying pool. It is safe to call more than once; later calls return nil.
+// A pool passed to NewKnowledgeBaseManagerFromDB is released but left open.
+func (kb *KnowledgeBaseManager) Close() error {
+	kb.connMu.Lock()
+	conn := kb.conn
+	kb.conn = nil
+	kb.connMu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	if !kb.ownsConn {
+		return nil
+	}
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("error closing database connection: %w", err)
 	}
 	return nil
 }
 
+// Disconnect closes the database connection; it is equivalent to Close
+func (kb *KnowledgeBaseManager) Disconnect() error {
+	return kb.Close()
+}
+
+// Ping verifies that the database connection is alive
+func (kb *KnowledgeBaseManager) Ping(ctx context.Context) error {
+	conn := kb.db()
+	if conn == nil {
+		return fmt.Errorf("not connected to database")
+	}
+	return conn.PingContext(ctx)
+}
+
+// db returns the current connection pool, which ensureConnected may replace
+func (kb *KnowledgeBaseManager) db() *sql.DB {
+	kb.connMu.RLock()
+	defer kb.connMu.RUnlock()
+	return kb.conn
+}
+
+// jsonb reports whether the properties and data columns are JSONB
+func (kb *KnowledgeBaseManager) jsonb() bool {
+	kb.connMu.RLock()
+	defer kb.connMu.RUnlock()
+	return kb.useJSONB
+}
+
+// scopedPaths reports whether paths are unique per knowledge base
+func (kb *KnowledgeBaseManager) scopedPaths() bool {
+	kb.connMu.RLock()
+	defer kb.connMu.RUnlock()
+	return kb.kbScopedPaths
+}
+
+// ensureConnected pings the database and, if the ping fails, re-dials using the
+// stored connection settings up to reconnectRetries times, trying at least
+// once. Concurrent callers wait for one reconnect. An injected pool is never
+// re-dialed.
+func (kb *KnowledgeBaseManager) ensureConnected() error {
+	conn := kb.db()
+	if conn == nil {
+		return fmt.Errorf("database connection is closed")
+	}
+	if err := conn.PingContext(context.Background()); err == nil {
+		return nil
+	} else if kb.dial == nil {
+		return fmt.Errorf("error pinging injected database pool: %w", err)
+	}
+
+	kb.connMu.Lock()
+	defer kb.connMu.Unlock()
+	if kb.conn == nil {
+		return fmt.Errorf("database connection is closed")
+	}
+	if kb.conn != conn {
+		return nil // another caller has already reconnected
+	}
+
+	attempts := kb.reconnectRetries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(kb.reconnectBackoff)
+		}
+
+		db, err := kb.dial()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		kb.conn.Close()
+		kb.conn = db
+		return nil
+	}
+
+	return fmt.Errorf("error reconnecting to database after %d attempts: %w", attempts, lastErr)
+}
+
+// isSerializationError checks if err wraps a serialization failure (40001) or
+// deadlock (40P01). Other errors, such as a unique violation, fail the same way
+// when retried and are returned immediately.
+func isSerializationError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// retry calls fn until it succeeds, returns an error isSerializationError
+// rejects, or txRetries retries are used up, doubling the wait after each retry
+func (kb *KnowledgeBaseManager) retry(fn func() error) error {
+	delay := kb.txRetryDelay
+	err := fn()
+	for attempt := 1; attempt <= kb.txRetries && isSerializationError(err); attempt++ {
+		kb.logger.Debugf("retrying transaction after %v (attempt %d): %v", delay, attempt, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
+
 // deleteTable deletes a specified table
 func (kb *KnowledgeBaseManager) deleteTable(tableName string, schema string) error {
 	query := fmt.Sprintf("DROP TABLE IF EXISTS %s.%s CASCADE;", schema, tableName)
-	_, err := kb.conn.Exec(query)
+	_, err := kb.db().Exec(query)
 	if err != nil {
 		return fmt.Errorf("error deleting table %s.%s: %w", schema, tableName, err)
 	}
@@ -82,9 +482,9 @@ func (kb *KnowledgeBaseManager) createTables() error {
 	// Delete existing tables
 	tables := []string{
 		kb.tableName,
-		kb.tableName + "_info",
-		kb.tableName + "_link",
-		kb.tableName + "_link_mount",
+		kb.infoTable,
+		kb.linkTable,
+		kb.linkMountTable,
 	}
 	for _, table := range tables {
 		//fmt.Println("deleting table", table)
@@ -94,6 +494,15 @@ func (kb *KnowledgeBaseManager) createTables() error {
 	}
 	
 
+	jsonType := "JSON"
+	if kb.jsonb() {
+		jsonType = "JSONB"
+	}
+	pathUnique, tableUnique := " UNIQUE", ""
+	if kb.scopedPaths() {
+		pathUnique, tableUnique = "", ", UNIQUE(knowledge_base, path)"
+	}
+
 	// Create main knowledge base table
 	kbTableQuery := fmt.Sprintf(`
 		CREATE TABLE %s (
@@ -101,47 +510,50 @@ func (kb *KnowledgeBaseManager) createTables() error {
 			knowledge_base VARCHAR NOT NULL,
 			label VARCHAR NOT NULL,
 			name VARCHAR NOT NULL,
-			properties JSON,
-			data JSON,
+			properties %s,
+			data %s,
 			has_link BOOLEAN DEFAULT FALSE,
 			has_link_mount BOOLEAN DEFAULT FALSE,
-			path LTREE UNIQUE
-		)`, kb.tableName)
+			path LTREE%s,
+			deleted_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()%s
+		)`, kb.tableName, jsonType, jsonType, pathUnique, tableUnique)
 
-	if _, err := kb.conn.Exec(kbTableQuery); err != nil {
+	if _, err := kb.db().Exec(kbTableQuery); err != nil {
 		return fmt.Errorf("error creating knowledge base table: %w", err)
 	}
 
 	// Create info table
 	infoTableQuery := fmt.Sprintf(`
-		CREATE TABLE %s_info (
+		CREATE TABLE %s (
 			id SERIAL PRIMARY KEY,
 			knowledge_base VARCHAR NOT NULL UNIQUE,
 			description VARCHAR
-		)`, kb.tableName)
+		)`, kb.infoTable)
 
-	if _, err := kb.conn.Exec(infoTableQuery); err != nil {
+	if _, err := kb.db().Exec(infoTableQuery); err != nil {
 		return fmt.Errorf("error creating info table: %w", err)
 	}
 
 	// Create link table
 	linkTableQuery := fmt.Sprintf(`
-		CREATE TABLE %s_link (
+		CREATE TABLE %s (
 			id SERIAL PRIMARY KEY,
 			link_name VARCHAR NOT NULL,
 			parent_node_kb VARCHAR NOT NULL,
 			parent_path LTREE NOT NULL,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(link_name, parent_node_kb, parent_path)
-		)`, kb.tableName)
+		)`, kb.linkTable)
 
-	if _, err := kb.conn.Exec(linkTableQuery); err != nil {
+	if _, err := kb.db().Exec(linkTableQuery); err != nil {
 		return fmt.Errorf("error creating link table: %w", err)
 	}
 
 	// Create link mount table
 	linkMountTableQuery := fmt.Sprintf(`
-		CREATE TABLE %s_link_mount (
+		CREATE TABLE %s (
 			id SERIAL PRIMARY KEY,
 			link_name VARCHAR NOT NULL UNIQUE,
 			knowledge_base VARCHAR NOT NULL,
@@ -149,9 +561,9 @@ func (kb *KnowledgeBaseManager) createTables() error {
 			description VARCHAR,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(knowledge_base, mount_path)
-		)`, kb.tableName)
+		)`, kb.linkMountTable)
 
-	if _, err := kb.conn.Exec(linkMountTableQuery); err != nil {
+	if _, err := kb.db().Exec(linkMountTableQuery); err != nil {
 		return fmt.Errorf("error creating link mount table: %w", err)
 	}
 
@@ -159,38 +571,227 @@ func (kb *KnowledgeBaseManager) createTables() error {
 	return kb.createIndexes()
 }
 
-// createIndexes creates all necessary indexes
-func (kb *KnowledgeBaseManager) createIndexes() error {
-	indexes := []string{
+// indexSpec describes one secondary index on a knowledge base table
+type indexSpec struct {
+	name    string
+	table   string
+	method  string // "btree", "gist" or "gin"
+	columns string
+}
+
+// indexName returns idx_<stem>_<suffix>. Names Postgres would truncate have
+// their tail replaced with a hash of the full name, so they stay distinct.
+func indexName(stem, suffix string) string {
+	name := fmt.Sprintf("idx_%s_%s", stem, suffix)
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+	sum := md5.Sum([]byte(name))
+	hash := hex.EncodeToString(sum[:4])
+	return name[:maxIdentifierLength-len(hash)-1] + "_" + hash
+}
+
+// indexSpecs lists the secondary indexes created for the four tables. Index
+// names are built from the table names, except that the default link mount
+// table keeps the <base>_mount stem its indexes have always had, so existing
+// indexes are found by CREATE INDEX IF NOT EXISTS instead of being duplicated.
+func (kb *KnowledgeBaseManager) indexSpecs() []indexSpec {
+	mountStem := kb.linkMountTable
+	if kb.linkMountTable == kb.tableName+"_link_mount" {
+		mountStem = kb.tableName + "_mount"
+	}
+	spec := func(table, suffix, method, columns string) indexSpec {
+		stem := table
+		if table == kb.linkMountTable {
+			stem = mountStem
+		}
+		return indexSpec{name: indexName(stem, suffix), table: table, method: method, columns: columns}
+	}
+	specs := []indexSpec{
 		// Main table indexes
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_kb ON %s (knowledge_base)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_path ON %s USING GIST (path)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_label ON %s (label)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_name ON %s (name)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_has_link ON %s (has_link)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_has_link_mount ON %s (has_link_mount)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_kb_path ON %s (knowledge_base, path)", kb.tableName, kb.tableName),
+		spec(kb.tableName, "kb", "btree", "knowledge_base"),
+		spec(kb.tableName, "path", "gist", "path"),
+		spec(kb.tableName, "label", "btree", "label"),
+		spec(kb.tableName, "name", "btree", "name"),
+		spec(kb.tableName, "has_link", "btree", "has_link"),
+		spec(kb.tableName, "has_link_mount", "btree", "has_link_mount"),
+		spec(kb.tableName, "kb_path", "btree", "knowledge_base, path"),
 
 		// Info table indexes
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_info_kb ON %s_info (knowledge_base)", kb.tableName, kb.tableName),
+		spec(kb.infoTable, "kb", "btree", "knowledge_base"),
 
 		// Link table indexes
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_link_name ON %s_link (link_name)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_link_parent_kb ON %s_link (parent_node_kb)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_link_parent_path ON %s_link USING GIST (parent_path)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_link_created ON %s_link (created_at)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_link_composite ON %s_link (link_name, parent_node_kb)", kb.tableName, kb.tableName),
+		spec(kb.linkTable, "name", "btree", "link_name"),
+		spec(kb.linkTable, "parent_kb", "btree", "parent_node_kb"),
+		spec(kb.linkTable, "parent_path", "gist", "parent_path"),
+		spec(kb.linkTable, "created", "btree", "created_at"),
+		spec(kb.linkTable, "composite", "btree", "link_name, parent_node_kb"),
 
 		// Mount table indexes
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_mount_link_name ON %s_link_mount (link_name)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_mount_kb ON %s_link_mount (knowledge_base)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_mount_path ON %s_link_mount USING GIST (mount_path)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_mount_created ON %s_link_mount (created_at)", kb.tableName, kb.tableName),
-		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_mount_composite ON %s_link_mount (knowledge_base, mount_path)", kb.tableName, kb.tableName),
+		spec(kb.linkMountTable, "link_name", "btree", "link_name"),
+		spec(kb.linkMountTable, "kb", "btree", "knowledge_base"),
+		spec(kb.linkMountTable, "path", "gist", "mount_path"),
+		spec(kb.linkMountTable, "created", "btree", "created_at"),
+		spec(kb.linkMountTable, "composite", "btree", "knowledge_base, mount_path"),
+	}
+	if kb.jsonb() {
+		specs = append(specs, kb.jsonbIndexSpec())
+	}
+	return specs
+}
+
+// jsonbIndexSpec is the GIN index on properties created for JSONB tables
+func (kb *KnowledgeBaseManager) jsonbIndexSpec() indexSpec {
+	return indexSpec{name: indexName(kb.tableName, "properties"), table: kb.tableName, method: "gin", columns: "properties"}
+}
+
+// MigrateToJSONB converts the properties and data columns of an existing main
+// table to JSONB and builds the GIN index on properties. The index is built
+// concurrently so writers are not blocked, which means the call cannot run
+// inside a transaction. Only columns that are not yet JSONB are converted, so
+// running it on a table that is already JSONB does not rewrite the table and
+// only ensures the index exists.
+func (kb *KnowledgeBaseManager) MigrateToJSONB() error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	// Unquoted identifiers are stored in lower case
+	rows, err := kb.db().Query(`
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1
+			AND column_name IN ('properties', 'data') AND data_type <> 'jsonb'
+		ORDER BY column_name DESC`, strings.ToLower(kb.tableName))
+	if err != nil {
+		return fmt.Errorf("error reading column types: %w", err)
+	}
+	var alters []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning column type: %w", err)
+		}
+		alters = append(alters, fmt.Sprintf("ALTER COLUMN %s TYPE JSONB USING %s::jsonb", column, column))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading column types: %w", err)
+	}
+
+	if len(alters) > 0 {
+		alterQuery := fmt.Sprintf("ALTER TABLE %s %s", kb.tableName, strings.Join(alters, ", "))
+		if _, err := kb.db().Exec(alterQuery); err != nil {
+			return fmt.Errorf("error converting columns to jsonb: %w", err)
+		}
+	}
+
+	index := kb.jsonbIndexSpec()
+	indexQuery := fmt.Sprintf("CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s USING %s (%s)",
+		index.name, index.table, strings.ToUpper(index.method), index.columns)
+	if _, err := kb.db().Exec(indexQuery); err != nil {
+		return fmt.Errorf("error creating properties index: %w", err)
+	}
+
+	kb.connMu.Lock()
+	kb.useJSONB = true
+	kb.connMu.Unlock()
+	return nil
+}
+
+// MigrateToKBScopedPaths replaces the table-wide unique constraint on path of
+// an existing main table with a (knowledge_base, path) constraint, as created
+// by WithKBScopedPaths. Both steps run in one transaction, so the table is
+// never left without a uniqueness constraint. Running it on a table that is
+// already scoped is a no-op.
+func (kb *KnowledgeBaseManager) MigrateToKBScopedPaths() error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Unique constraints on the main table, with their columns in key order
+	constraintQuery := `
+		SELECT c.conname, array_to_string(array_agg(a.attname::text ORDER BY k.ord), ',')
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		WHERE c.conrelid = $1::regclass AND c.contype = 'u'
+		GROUP BY c.conname`
+	rows, err := tx.Query(constraintQuery, kb.tableName)
+	if err != nil {
+		return fmt.Errorf("error reading constraints: %w", err)
+	}
+	var pathConstraints []string
+	scoped := false
+	for rows.Next() {
+		var name, columns string
+		if err := rows.Scan(&name, &columns); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning constraint: %w", err)
+		}
+		switch columns {
+		case "path":
+			pathConstraints = append(pathConstraints, name)
+		case "knowledge_base,path":
+			scoped = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating constraints: %w", err)
+	}
+
+	for _, name := range pathConstraints {
+		dropQuery := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", kb.tableName, pq.QuoteIdentifier(name))
+		if _, err := tx.Exec(dropQuery); err != nil {
+			return fmt.Errorf("error dropping path constraint: %w", err)
+		}
+	}
+	if !scoped {
+		addQuery := fmt.Sprintf("ALTER TABLE %s ADD UNIQUE (knowledge_base, path)", kb.tableName)
+		if _, err := tx.Exec(addQuery); err != nil {
+			return fmt.Errorf("error adding scoped path constraint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	kb.connMu.Lock()
+	kb.kbScopedPaths = true
+	kb.connMu.Unlock()
+	return nil
+}
+
+// MigrateSoftDelete adds the deleted_at column used by SoftDeleteNode to a main
+// table created before soft-delete support. Searches skip the filter on such
+// tables, but adding links and mounts here checks the column, so they must be
+// migrated first. Running it on a table that already has the column is a no-op.
+func (kb *KnowledgeBaseManager) MigrateSoftDelete() error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
 	}
 
-	for _, indexQuery := range indexes {
-		if _, err := kb.conn.Exec(indexQuery); err != nil {
+	alterQuery := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ", kb.tableName)
+	if _, err := kb.db().Exec(alterQuery); err != nil {
+		return fmt.Errorf("error adding deleted_at column: %w", err)
+	}
+	return nil
+}
+
+// createIndexes creates all necessary indexes
+func (kb *KnowledgeBaseManager) createIndexes() error {
+	for _, index := range kb.indexSpecs() {
+		indexQuery := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING %s (%s)",
+			index.name, index.table, strings.ToUpper(index.method), index.columns)
+		if _, err := kb.db().Exec(indexQuery); err != nil {
 			return fmt.Errorf("error creating index: %w", err)
 		}
 	}
@@ -198,15 +799,30 @@ func (kb *KnowledgeBaseManager) createIndexes() error {
 	return nil
 }
 
+// dbExecutor is the subset of *sql.DB and *sql.Tx used by the add operations
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // AddKB adds a knowledge base entry to the information table
 func (kb *KnowledgeBaseManager) AddKB(kbName string, description string) error {
-	infoTable := kb.tableName + "_info"
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	return kb.addKB(kb.db(), kbName, description)
+}
+
+// addKB inserts a knowledge base entry using q
+func (kb *KnowledgeBaseManager) addKB(q dbExecutor, kbName string, description string) error {
+	infoTable := kb.infoTable
 	query := fmt.Sprintf(`
 		INSERT INTO %s (knowledge_base, description)
 		VALUES ($1, $2)
 		ON CONFLICT (knowledge_base) DO NOTHING`, infoTable)
 
-	_, err := kb.conn.Exec(query, kbName, description)
+	_, err := q.Exec(query, kbName, description)
 	if err != nil {
 		return fmt.Errorf("error adding knowledge base: %w", err)
 	}
@@ -214,20 +830,113 @@ func (kb *KnowledgeBaseManager) AddKB(kbName string, description string) error {
 	return nil
 }
 
-// AddNode adds a node to the knowledge base
+// KBInfo describes a knowledge base as stored in the info table
+type KBInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	NodeCount   int    `json:"node_count"` // Nodes visible to CountNodes
+}
+
+// GetKBInfo returns the description and node count of kbName, or an error
+// wrapping ErrKBNotFound when it has no info row
+func (kb *KnowledgeBaseManager) GetKBInfo(kbName string) (KBInfo, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return KBInfo{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT i.description,
+			(SELECT COUNT(*) FROM %s WHERE knowledge_base = i.knowledge_base%s)
+		FROM %s i
+		WHERE i.knowledge_base = $1`, kb.tableName, kb.liveNodes(), kb.infoTable)
+
+	info := KBInfo{Name: kbName}
+	var description sql.NullString
+	err := kb.db().QueryRow(query, kbName).Scan(&description, &info.NodeCount)
+	if err == sql.ErrNoRows {
+		return KBInfo{}, fmt.Errorf("%w: '%s'", ErrKBNotFound, kbName)
+	} else if err != nil {
+		return KBInfo{}, fmt.Errorf("error getting knowledge base info: %w", err)
+	}
+	info.Description = description.String
+
+	return info, nil
+}
+
+// UpdateKBDescription replaces the description of kbName, returning an error
+// wrapping ErrKBNotFound when it has no info row. The description is stored as
+// AddKB stores it.
+func (kb *KnowledgeBaseManager) UpdateKBDescription(kbName, description string) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET description = $2 WHERE knowledge_base = $1", kb.infoTable)
+	result, err := kb.db().Exec(query, kbName, description)
+	if err != nil {
+		return fmt.Errorf("error updating knowledge base description: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: '%s'", ErrKBNotFound, kbName)
+	}
+
+	return nil
+}
+
+// AddNode adds a node to the knowledge base. Properties are checked against
+// any schema registered for label with RegisterLabelSchema. The knowledge base
+// check and the insert run in one transaction, serializable when the manager
+// was created with WithSerializableWrites; a transaction aborted by a
+// serialization failure or deadlock is retried as set by WithTxRetries.
 func (kb *KnowledgeBaseManager) AddNode(kbName, label, name string, properties, data map[string]interface{}, path string) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	return kb.retry(func() error {
+		var txOpts *sql.TxOptions
+		if kb.serializableWrites {
+			txOpts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+		}
+		tx, err := kb.db().BeginTx(context.Background(), txOpts)
+		if err != nil {
+			return fmt.Errorf("error beginning transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := kb.addNode(tx, kbName, label, name, properties, data, path); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing transaction: %w", err)
+		}
+		return nil
+	})
+}
+
+// addNode inserts a node using q
+func (kb *KnowledgeBaseManager) addNode(q dbExecutor, kbName, label, name string, properties, data map[string]interface{}, path string) error {
 	// Check if kb_name exists in info table
-	infoTable := kb.tableName + "_info"
+	infoTable := kb.infoTable
 	checkQuery := fmt.Sprintf("SELECT 1 FROM %s WHERE knowledge_base = $1", infoTable)
 
 	var exists int
-	err := kb.conn.QueryRow(checkQuery, kbName).Scan(&exists)
+	err := q.QueryRow(checkQuery, kbName).Scan(&exists)
 	if err == sql.ErrNoRows {
 		return fmt.Errorf("knowledge base '%s' not found in info table", kbName)
 	} else if err != nil {
 		return fmt.Errorf("error checking knowledge base: %w", err)
 	}
 
+	if err := kb.validateProperties(label, properties); err != nil {
+		return err
+	}
+
 	// Convert maps to JSON
 	var propertiesJSON, dataJSON []byte
 	if properties != nil {
@@ -248,7 +957,7 @@ func (kb *KnowledgeBaseManager) AddNode(kbName, label, name string, properties,
 		INSERT INTO %s (knowledge_base, label, name, properties, data, has_link, path)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`, kb.tableName)
 
-	_, err = kb.conn.Exec(insertQuery, kbName, label, name, propertiesJSON, dataJSON, false, path)
+	_, err = q.Exec(insertQuery, kbName, label, name, propertiesJSON, dataJSON, false, path)
 	if err != nil {
 		return fmt.Errorf("error adding node: %w", err)
 	}
@@ -256,124 +965,280 @@ func (kb *KnowledgeBaseManager) AddNode(kbName, label, name string, properties,
 	return nil
 }
 
-// AddLink adds a link between nodes
-func (kb *KnowledgeBaseManager) AddLink(parentKB, parentPath, linkName string) error {
-	// Check if parent knowledge base exists
-	infoTable := kb.tableName + "_info"
-	kbCheckQuery := fmt.Sprintf("SELECT knowledge_base FROM %s WHERE knowledge_base = $1", infoTable)
-
-	var foundKB string
-	err := kb.conn.QueryRow(kbCheckQuery, parentKB).Scan(&foundKB)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("parent knowledge base '%s' not found", parentKB)
-	} else if err != nil {
-		return fmt.Errorf("error checking knowledge base: %w", err)
-	}
-
-	// Check if parent node exists
-	nodeCheckQuery := fmt.Sprintf("SELECT path FROM %s WHERE path = $1", kb.tableName)
-	var foundPath string
-	err = kb.conn.QueryRow(nodeCheckQuery, parentPath).Scan(&foundPath)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("parent node with path '%s' not found", parentPath)
-	} else if err != nil {
-		return fmt.Errorf("error checking node: %w", err)
+// UpdateNode replaces the properties and data of the node at path and sets its
+// updated_at to the current time. Nil maps are stored as NULL, as in AddNode,
+// and properties are checked against the schema of the node's label.
+func (kb *KnowledgeBaseManager) UpdateNode(kbName, path string, properties, data map[string]interface{}) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
 	}
 
-	// Check if link name already exists in link_mount table
-	linkTable := kb.tableName + "_link"
-	linkNameExistsQuery := fmt.Sprintf("SELECT link_name FROM %s WHERE link_name = $1", linkTable)
-	var existingLinkName string
-	err = kb.conn.QueryRow(linkNameExistsQuery, linkName).Scan(&existingLinkName)
-	if err != sql.ErrNoRows {
-		return fmt.Errorf("link name '%s' already exists in link_mount table", linkName)
+	if kb.hasLabelSchemas() {
+		var label string
+		labelQuery := fmt.Sprintf("SELECT label FROM %s WHERE knowledge_base = $1 AND path = $2%s", kb.tableName, kb.liveNodes())
+		err := kb.db().QueryRow(labelQuery, kbName, path).Scan(&label)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("error updating node: no node at '%s' in knowledge base '%s'", path, kbName)
+		} else if err != nil {
+			return fmt.Errorf("error reading node label: %w", err)
+		}
+		if err := kb.validateProperties(label, properties); err != nil {
+			return err
+		}
 	}
 
-	// Begin transaction
-	tx, err := kb.conn.Begin()
+	var propertiesJSON, dataJSON []byte
+	var err error
+	if properties != nil {
+		propertiesJSON, err = json.Marshal(properties)
+		if err != nil {
+			return fmt.Errorf("error marshaling properties: %w", err)
+		}
+	}
+	if data != nil {
+		dataJSON, err = json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshaling data: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET properties = $3, data = $4, updated_at = NOW()
+		WHERE knowledge_base = $1 AND path = $2%s`, kb.tableName, kb.liveNodes())
+
+	result, err := kb.db().Exec(query, kbName, path, propertiesJSON, dataJSON)
+	if err != nil {
+		return fmt.Errorf("error updating node: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("error updating node: no node at '%s' in knowledge base '%s'", path, kbName)
+	}
+
+	return nil
+}
+
+// UpsertNode adds the node at path, or replaces the label, name, properties and
+// data of the node already there, in a single statement so concurrent callers
+// cannot race between a check and an insert. A soft-deleted node at path is
+// restored. It reports whether the node was inserted. The existing node must
+// belong to kbName. Properties are checked as in AddNode.
+func (kb *KnowledgeBaseManager) UpsertNode(kbName, label, name string, properties, data map[string]interface{}, path string) (bool, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return false, err
+	}
+
+	checkQuery := fmt.Sprintf("SELECT 1 FROM %s WHERE knowledge_base = $1", kb.infoTable)
+	var exists int
+	err := kb.db().QueryRow(checkQuery, kbName).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("knowledge base '%s' not found in info table", kbName)
+	} else if err != nil {
+		return false, fmt.Errorf("error checking knowledge base: %w", err)
+	}
+
+	if err := kb.validateProperties(label, properties); err != nil {
+		return false, err
+	}
+
+	var propertiesJSON, dataJSON []byte
+	if properties != nil {
+		propertiesJSON, err = json.Marshal(properties)
+		if err != nil {
+			return false, fmt.Errorf("error marshaling properties: %w", err)
+		}
+	}
+	if data != nil {
+		dataJSON, err = json.Marshal(data)
+		if err != nil {
+			return false, fmt.Errorf("error marshaling data: %w", err)
+		}
+	}
+
+	conflictTarget := "path"
+	if kb.scopedPaths() {
+		conflictTarget = "knowledge_base, path"
+	}
+	upsertQuery := fmt.Sprintf(`
+		INSERT INTO %s AS t (knowledge_base, label, name, properties, data, has_link, path)
+		VALUES ($1, $2, $3, $4, $5, FALSE, $6)
+		ON CONFLICT (%s) DO UPDATE SET
+			label = EXCLUDED.label,
+			name = EXCLUDED.name,
+			properties = EXCLUDED.properties,
+			data = EXCLUDED.data,
+			deleted_at = NULL,
+			updated_at = NOW()
+		WHERE t.knowledge_base = EXCLUDED.knowledge_base
+		RETURNING (xmax = 0) AS inserted`, kb.tableName, conflictTarget)
+
+	var inserted bool
+	err = kb.db().QueryRow(upsertQuery, kbName, label, name, propertiesJSON, dataJSON, path).Scan(&inserted)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("error upserting node: path '%s' belongs to another knowledge base", path)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error upserting node: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// AddLink adds a link to the knowledge base
+func (kb *KnowledgeBaseManager) AddLink(parentKB, parentPath, linkName string) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	// Begin transaction
+	tx, err := kb.db().Begin()
 	if err != nil {
 		return fmt.Errorf("error beginning transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	
+	if err := kb.addLink(tx, parentKB, parentPath, linkName); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// addLink inserts a link and sets the parent's has_link flag using q
+func (kb *KnowledgeBaseManager) addLink(q dbExecutor, parentKB, parentPath, linkName string) error {
+	// Check if parent knowledge base exists
+	infoTable := kb.infoTable
+	kbCheckQuery := fmt.Sprintf("SELECT knowledge_base FROM %s WHERE knowledge_base = $1", infoTable)
+
+	var foundKB string
+	err := q.QueryRow(kbCheckQuery, parentKB).Scan(&foundKB)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("parent knowledge base '%s' not found", parentKB)
+	} else if err != nil {
+		return fmt.Errorf("error checking knowledge base: %w", err)
+	}
+
+	// Check if parent node exists
+	nodeCheckQuery := fmt.Sprintf("SELECT path FROM %s WHERE knowledge_base = $1 AND path = $2 AND deleted_at IS NULL", kb.tableName)
+	var foundPath string
+	err = q.QueryRow(nodeCheckQuery, parentKB, parentPath).Scan(&foundPath)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("parent node with path '%s' not found", parentPath)
+	} else if err != nil {
+		return fmt.Errorf("error checking node: %w", err)
+	}
+
+	// Check if link name already exists in link_mount table
+	linkTable := kb.linkTable
+	linkNameExistsQuery := fmt.Sprintf("SELECT link_name FROM %s WHERE link_name = $1", linkTable)
+	var existingLinkName string
+	err = q.QueryRow(linkNameExistsQuery, linkName).Scan(&existingLinkName)
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("link name '%s' already exists in link_mount table", linkName)
+	}
+
 	linkInsertQuery := fmt.Sprintf(`
 		INSERT INTO %s (parent_node_kb, parent_path, link_name)
 		VALUES ($1, $2, $3)`, linkTable)
 
-	_, err = tx.Exec(linkInsertQuery, parentKB, parentPath, linkName)
+	_, err = q.Exec(linkInsertQuery, parentKB, parentPath, linkName)
 	if err != nil {
 		return fmt.Errorf("error inserting link: %w", err)
 	}
 
 	// Update has_link flag
-	updateQuery := fmt.Sprintf("UPDATE %s SET has_link = TRUE WHERE path = $1", kb.tableName)
-	_, err = tx.Exec(updateQuery, parentPath)
+	updateQuery := fmt.Sprintf("UPDATE %s SET has_link = TRUE WHERE knowledge_base = $1 AND path = $2", kb.tableName)
+	_, err = q.Exec(updateQuery, parentKB, parentPath)
 	if err != nil {
 		return fmt.Errorf("error updating has_link flag: %w", err)
 	}
 
+	return nil
+}
+
+// AddLinkMount adds a link mount
+func (kb *KnowledgeBaseManager) AddLinkMount(knowledgeBase, path, linkMountName, description string) (string, string, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return "", "", err
+	}
+
+	// Begin transaction
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := kb.addLinkMount(tx, knowledgeBase, path, linkMountName, description); err != nil {
+		return "", "", err
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+		return "", "", fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return nil
+	return knowledgeBase, path, nil
 }
 
-// AddLinkMount adds a link mount
-func (kb *KnowledgeBaseManager) AddLinkMount(knowledgeBase, path, linkMountName, description string) (string, string, error) {
+// addLinkMount inserts a link mount and sets the node's has_link_mount flag using q
+func (kb *KnowledgeBaseManager) addLinkMount(q dbExecutor, knowledgeBase, path, linkMountName, description string) error {
 	// Verify that knowledge_base exists in info table
-	infoCheckQuery := fmt.Sprintf("SELECT knowledge_base FROM %s_info WHERE knowledge_base = $1", kb.tableName)
+	infoCheckQuery := fmt.Sprintf("SELECT knowledge_base FROM %s WHERE knowledge_base = $1", kb.infoTable)
 	var foundKB string
-	err := kb.conn.QueryRow(infoCheckQuery, knowledgeBase).Scan(&foundKB)
+	err := q.QueryRow(infoCheckQuery, knowledgeBase).Scan(&foundKB)
 	if err == sql.ErrNoRows {
-		return "", "", fmt.Errorf("knowledge base '%s' does not exist in info table", knowledgeBase)
+		return fmt.Errorf("knowledge base '%s' does not exist in info table", knowledgeBase)
 	} else if err != nil {
-		return "", "", fmt.Errorf("error checking knowledge base: %w", err)
+		return fmt.Errorf("error checking knowledge base: %w", err)
 	}
 
 	// Verify that the path exists for the given knowledge base
-	pathCheckQuery := fmt.Sprintf("SELECT id FROM %s WHERE knowledge_base = $1 AND path = $2", kb.tableName)
+	pathCheckQuery := fmt.Sprintf("SELECT id FROM %s WHERE knowledge_base = $1 AND path = $2 AND deleted_at IS NULL", kb.tableName)
 	var nodeID int
-	err = kb.conn.QueryRow(pathCheckQuery, knowledgeBase, path).Scan(&nodeID)
+	err = q.QueryRow(pathCheckQuery, knowledgeBase, path).Scan(&nodeID)
 	if err == sql.ErrNoRows {
-		return "", "", fmt.Errorf("path '%s' does not exist for knowledge base '%s'", path, knowledgeBase)
+		return fmt.Errorf("path '%s' does not exist for knowledge base '%s'", path, knowledgeBase)
 	} else if err != nil {
-		return "", "", fmt.Errorf("error checking path: %w", err)
+		return fmt.Errorf("error checking path: %w", err)
 	}
 
 	// Verify that link_name does not already exist in link_mount table
-	linkNameExistsQuery := fmt.Sprintf("SELECT link_name FROM %s_link_mount WHERE link_name = $1", kb.tableName)
+	linkNameExistsQuery := fmt.Sprintf("SELECT link_name FROM %s WHERE link_name = $1", kb.linkMountTable)
 	var existingLinkName string
-	err = kb.conn.QueryRow(linkNameExistsQuery, linkMountName).Scan(&existingLinkName)
+	err = q.QueryRow(linkNameExistsQuery, linkMountName).Scan(&existingLinkName)
 	if err != sql.ErrNoRows {
-		return "", "", fmt.Errorf("link name '%s' already exists in link_mount table", linkMountName)
+		return fmt.Errorf("link name '%s' already exists in link_mount table", linkMountName)
 	}
 
-	// Begin transaction
-	tx, err := kb.conn.Begin()
-	if err != nil {
-		return "", "", fmt.Errorf("error beginning transaction: %w", err)
+	if err := kb.checkMountTarget(q, knowledgeBase, path); err != nil {
+		return err
 	}
-	defer tx.Rollback()
 
 	// Insert record in link_mount table
 	insertLinkMountQuery := fmt.Sprintf(`
-		INSERT INTO %s_link_mount (link_name, knowledge_base, mount_path, description)
-		VALUES ($1, $2, $3, $4)`, kb.tableName)
+		INSERT INTO %s (link_name, knowledge_base, mount_path, description)
+		VALUES ($1, $2, $3, $4)`, kb.linkMountTable)
 
-	result, err := tx.Exec(insertLinkMountQuery, linkMountName, knowledgeBase, path, description)
+	result, err := q.Exec(insertLinkMountQuery, linkMountName, knowledgeBase, path, description)
 	if err != nil {
-		return "", "", fmt.Errorf("error inserting link mount: %w", err)
+		return fmt.Errorf("error inserting link mount: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return "", "", fmt.Errorf("error getting rows affected: %w", err)
+		return fmt.Errorf("error getting rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return "", "", fmt.Errorf("failed to insert record with link_name '%s', knowledge_base '%s', path '%s' into link_mount table", linkMountName, knowledgeBase, path)
+		return fmt.Errorf("failed to insert record with link_name '%s', knowledge_base '%s', path '%s' into link_mount table", linkMountName, knowledgeBase, path)
 	}
 
 	// Update has_link_mount flag
@@ -381,25 +1246,661 @@ func (kb *KnowledgeBaseManager) AddLinkMount(knowledgeBase, path, linkMountName,
 		UPDATE %s SET has_link_mount = TRUE 
 		WHERE knowledge_base = $1 AND path = $2`, kb.tableName)
 
-	result, err = tx.Exec(updateQuery, knowledgeBase, path)
+	result, err = q.Exec(updateQuery, knowledgeBase, path)
 	if err != nil {
-		return "", "", fmt.Errorf("error updating has_link_mount flag: %w", err)
+		return fmt.Errorf("error updating has_link_mount flag: %w", err)
 	}
 
 	rowsAffected, err = result.RowsAffected()
 	if err != nil {
-		return "", "", fmt.Errorf("error getting rows affected: %w", err)
+		return fmt.Errorf("error getting rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return "", "", fmt.Errorf("no rows were updated for knowledge_base '%s' and path '%s'", knowledgeBase, path)
+		return fmt.Errorf("no rows were updated for knowledge_base '%s' and path '%s'", knowledgeBase, path)
+	}
+
+	return nil
+}
+
+// MountInput describes a single link mount for AddLinkMounts
+type MountInput struct {
+	KnowledgeBase string
+	Path          string
+	LinkName      string
+	Description   string
+	SkipExisting  bool // skip instead of failing when LinkName already exists
+}
+
+// MountResult reports the outcome of a single mount from AddLinkMounts
+type MountResult struct {
+	KnowledgeBase string
+	Path          string
+	LinkName      string
+	Inserted      bool
+	Skipped       bool
+}
+
+// checkMountTarget applies the WithRejectDoubleMount and WithMountRequiresChildren
+// rules to the node at path
+func (kb *KnowledgeBaseManager) checkMountTarget(q dbExecutor, knowledgeBase, path string) error {
+	if !kb.rejectDoubleMount && !kb.requireMountParent {
+		return nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(n.has_link_mount, FALSE), EXISTS (
+			SELECT 1 FROM %s c
+			WHERE c.path <@ n.path AND c.path <> n.path%s
+		)
+		FROM %s n
+		WHERE n.knowledge_base = $1 AND n.path = $2`, kb.tableName, kb.liveNodes(), kb.tableName)
+
+	var mounted, hasChildren bool
+	if err := q.QueryRow(query, knowledgeBase, path).Scan(&mounted, &hasChildren); err != nil {
+		return fmt.Errorf("error checking mount target: %w", err)
+	}
+	if kb.rejectDoubleMount && mounted {
+		return fmt.Errorf("path '%s' in knowledge base '%s' is already a mount point", path, knowledgeBase)
+	}
+	if kb.requireMountParent && !hasChildren {
+		return fmt.Errorf("path '%s' in knowledge base '%s' is a leaf node; mount points must have children", path, knowledgeBase)
+	}
+	return nil
+}
+
+// AddLinkMounts adds several link mounts atomically in a single transaction.
+// Any validation or insert failure rolls back every mount in the batch.
+func (kb *KnowledgeBaseManager) AddLinkMounts(mounts []MountInput) ([]MountResult, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	infoCheckQuery := fmt.Sprintf("SELECT knowledge_base FROM %s WHERE knowledge_base = $1", kb.infoTable)
+	pathCheckQuery := fmt.Sprintf("SELECT id FROM %s WHERE knowledge_base = $1 AND path = $2 AND deleted_at IS NULL", kb.tableName)
+	linkNameExistsQuery := fmt.Sprintf("SELECT link_name FROM %s WHERE link_name = $1", kb.linkMountTable)
+	insertLinkMountQuery := fmt.Sprintf(`
+		INSERT INTO %s (link_name, knowledge_base, mount_path, description)
+		VALUES ($1, $2, $3, $4)`, kb.linkMountTable)
+	updateQuery := fmt.Sprintf(`
+		UPDATE %s SET has_link_mount = TRUE
+		WHERE knowledge_base = $1 AND path = $2`, kb.tableName)
+
+	// Begin transaction
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]MountResult, 0, len(mounts))
+	for _, mount := range mounts {
+		result := MountResult{
+			KnowledgeBase: mount.KnowledgeBase,
+			Path:          mount.Path,
+			LinkName:      mount.LinkName,
+		}
+
+		// Verify that knowledge_base exists in info table
+		var foundKB string
+		err := tx.QueryRow(infoCheckQuery, mount.KnowledgeBase).Scan(&foundKB)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("knowledge base '%s' does not exist in info table", mount.KnowledgeBase)
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking knowledge base: %w", err)
+		}
+
+		// Verify that the path exists for the given knowledge base
+		var nodeID int
+		err = tx.QueryRow(pathCheckQuery, mount.KnowledgeBase, mount.Path).Scan(&nodeID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("path '%s' does not exist for knowledge base '%s'", mount.Path, mount.KnowledgeBase)
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking path: %w", err)
+		}
+
+		// Skip or fail on an existing link_name
+		var existingLinkName string
+		err = tx.QueryRow(linkNameExistsQuery, mount.LinkName).Scan(&existingLinkName)
+		if err == nil {
+			if mount.SkipExisting {
+				result.Skipped = true
+				results = append(results, result)
+				continue
+			}
+			return nil, fmt.Errorf("link name '%s' already exists in link_mount table", mount.LinkName)
+		} else if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("error checking link name: %w", err)
+		}
+
+		if err := kb.checkMountTarget(tx, mount.KnowledgeBase, mount.Path); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(insertLinkMountQuery, mount.LinkName, mount.KnowledgeBase, mount.Path, mount.Description); err != nil {
+			return nil, fmt.Errorf("error inserting link mount '%s': %w", mount.LinkName, err)
+		}
+
+		if _, err := tx.Exec(updateQuery, mount.KnowledgeBase, mount.Path); err != nil {
+			return nil, fmt.Errorf("error updating has_link_mount flag: %w", err)
+		}
+
+		result.Inserted = true
+		results = append(results, result)
 	}
 
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		return "", "", fmt.Errorf("error committing transaction: %w", err)
+		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return knowledgeBase, path, nil
+	return results, nil
+}
+
+// CountNodes returns the number of nodes in the given knowledge base
+func (kb *KnowledgeBaseManager) CountNodes(kbName string) (int, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE knowledge_base = $1%s", kb.tableName, kb.liveNodes())
+
+	var count int
+	if err := kb.db().QueryRow(query, kbName).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting nodes: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountByLabel returns the number of nodes per label in the given knowledge base
+func (kb *KnowledgeBaseManager) CountByLabel(kbName string) (map[string]int, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT label, COUNT(*) FROM %s
+		WHERE knowledge_base = $1%s
+		GROUP BY label`, kb.tableName, kb.liveNodes())
+
+	rows, err := kb.db().Query(query, kbName)
+	if err != nil {
+		return nil, fmt.Errorf("error counting nodes by label: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var label string
+		var count int
+		if err := rows.Scan(&label, &count); err != nil {
+			return nil, fmt.Errorf("error scanning label count: %w", err)
+		}
+		counts[label] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating label counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CopyKB clones srcKB under the name dstKB in a single transaction and returns
+// the number of nodes copied. The info row, every node, and the links and link
+// mounts of srcKB are copied with the leading path label rewritten from srcKB to
+// dstKB. Link names are unique across all knowledge bases, so each copied link
+// and mount is renamed to dstKB + "." + name, keeping the copied links resolving
+// to the copied mounts. It fails if dstKB already exists, if a link of srcKB
+// resolves to a mount outside it, or if a renamed link is already taken.
+func (kb *KnowledgeBaseManager) CopyKB(srcKB, dstKB string) (int, error) {
+	if srcKB == "" || dstKB == "" {
+		return 0, fmt.Errorf("source and destination knowledge base names must be non-empty")
+	}
+	if srcKB == dstKB {
+		return 0, fmt.Errorf("destination knowledge base must differ from '%s'", srcKB)
+	}
+	if err := kb.ensureConnected(); err != nil {
+		return 0, err
+	}
+
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(fmt.Sprintf("SELECT 1 FROM %s WHERE knowledge_base = $1", kb.infoTable), dstKB).Scan(&exists)
+	if err == nil {
+		return 0, fmt.Errorf("knowledge base '%s' already exists", dstKB)
+	} else if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error checking knowledge base: %w", err)
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (knowledge_base, description)
+		SELECT $2, description FROM %s WHERE knowledge_base = $1`, kb.infoTable, kb.infoTable), srcKB, dstKB)
+	if err != nil {
+		return 0, fmt.Errorf("error copying knowledge base info: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	} else if rows == 0 {
+		return 0, fmt.Errorf("knowledge base '%s' not found in info table", srcKB)
+	}
+
+	// reroot replaces the leading label of column with $2
+	reroot := func(column string) string {
+		return fmt.Sprintf("CASE WHEN nlevel(%s) > 1 THEN $2::ltree || subpath(%s, 1) ELSE $2::ltree END", column, column)
+	}
+
+	// A copied link can only be renamed if its mount is copied with it
+	var linkName string
+	err = tx.QueryRow(fmt.Sprintf(`
+		SELECT l.link_name FROM %s l
+		WHERE l.parent_node_kb = $1
+			AND NOT EXISTS (SELECT 1 FROM %s m WHERE m.link_name = l.link_name AND m.knowledge_base = $1)
+		LIMIT 1`, kb.linkTable, kb.linkMountTable), srcKB).Scan(&linkName)
+	if err == nil {
+		return 0, fmt.Errorf("link '%s' of knowledge base '%s' does not resolve to a mount inside it and cannot be copied", linkName, srcKB)
+	} else if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error checking links: %w", err)
+	}
+
+	err = tx.QueryRow(fmt.Sprintf(`
+		SELECT $2 || '.' || link_name FROM %s
+		WHERE knowledge_base = $1
+			AND $2 || '.' || link_name IN (SELECT link_name FROM %s UNION SELECT link_name FROM %s)
+		LIMIT 1`, kb.linkMountTable, kb.linkTable, kb.linkMountTable), srcKB, dstKB).Scan(&linkName)
+	if err == nil {
+		return 0, fmt.Errorf("link name '%s' for the copy already exists", linkName)
+	} else if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error checking link names: %w", err)
+	}
+
+	result, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (knowledge_base, label, name, properties, data, has_link, has_link_mount, path, deleted_at)
+		SELECT $2, label, name, properties, data, has_link, has_link_mount, %s, deleted_at
+		FROM %s WHERE knowledge_base = $1`, kb.tableName, reroot("path"), kb.tableName), srcKB, dstKB)
+	if err != nil {
+		return 0, fmt.Errorf("error copying nodes: %w", err)
+	}
+	copied, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (link_name, knowledge_base, mount_path, description)
+		SELECT $2 || '.' || link_name, $2, %s, description
+		FROM %s WHERE knowledge_base = $1`, kb.linkMountTable, reroot("mount_path"), kb.linkMountTable), srcKB, dstKB)
+	if err != nil {
+		return 0, fmt.Errorf("error copying link mounts: %w", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (link_name, parent_node_kb, parent_path)
+		SELECT $2 || '.' || link_name, $2, %s
+		FROM %s WHERE parent_node_kb = $1`, kb.linkTable, reroot("parent_path"), kb.linkTable), srcKB, dstKB)
+	if err != nil {
+		return 0, fmt.Errorf("error copying links: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return int(copied), nil
+}
+
+// liveNodes returns the condition that hides soft-deleted nodes from reads, or
+// nothing when the manager was created WithIncludeDeleted
+func (kb *KnowledgeBaseManager) liveNodes() string {
+	if kb.includeDeleted {
+		return ""
+	}
+	return " AND deleted_at IS NULL"
+}
+
+// SoftDeleteNode marks the node at path as deleted without removing it. The node
+// is hidden from reads until RestoreNode clears the mark or PurgeDeleted removes
+// it; its descendants, links and mounts are left untouched.
+func (kb *KnowledgeBaseManager) SoftDeleteNode(kbName, path string) error {
+	return kb.setDeletedAt(kbName, path, "NOW()", "deleted_at IS NULL", "soft-deleting")
+}
+
+// RestoreNode clears the soft-delete mark on the node at path
+func (kb *KnowledgeBaseManager) RestoreNode(kbName, path string) error {
+	return kb.setDeletedAt(kbName, path, "NULL", "deleted_at IS NOT NULL", "restoring")
+}
+
+// setDeletedAt sets deleted_at to value on the node at path when it matches state
+func (kb *KnowledgeBaseManager) setDeletedAt(kbName, path, value, state, action string) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET deleted_at = %s
+		WHERE knowledge_base = $1 AND path = $2 AND %s`, kb.tableName, value, state)
+
+	result, err := kb.db().Exec(query, kbName, path)
+	if err != nil {
+		return fmt.Errorf("error %s node: %w", action, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("error %s node: no node at '%s' in knowledge base '%s' where %s", action, path, kbName, state)
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently removes nodes soft-deleted before the given time,
+// together with the links and mounts attached to them, and returns the number
+// of nodes removed
+func (kb *KnowledgeBaseManager) PurgeDeleted(before time.Time) (int, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return 0, err
+	}
+
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	purged := fmt.Sprintf("SELECT knowledge_base, path FROM %s WHERE deleted_at < $1", kb.tableName)
+	statements := []string{
+		fmt.Sprintf("DELETE FROM %s WHERE (parent_node_kb, parent_path) IN (%s)", kb.linkTable, purged),
+		fmt.Sprintf("DELETE FROM %s WHERE (knowledge_base, mount_path) IN (%s)", kb.linkMountTable, purged),
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, before); err != nil {
+			return 0, fmt.Errorf("error purging links of deleted nodes: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted_at < $1", kb.tableName), before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted nodes: %w", err)
+	}
+	purgedCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return int(purgedCount), nil
+}
+
+// DeleteSummary counts the rows removed or changed by DeleteNode
+type DeleteSummary struct {
+	NodesDeleted  int // The node and its descendants
+	LinksDeleted  int // Links from deleted nodes and links to deleted mounts
+	MountsDeleted int // Mounts on deleted nodes
+	FlagsReset    int // Surviving nodes whose has_link was cleared because their last link was deleted
+}
+
+// DeleteNode permanently removes the node at path together with its
+// descendants, the links and mounts attached to them, and any link elsewhere
+// that points at one of the removed mounts. Nodes outside the subtree left
+// without links have has_link cleared. Everything runs in one transaction and
+// the returned summary counts the rows each statement touched.
+func (kb *KnowledgeBaseManager) DeleteNode(kbName, path string) (DeleteSummary, error) {
+	var summary DeleteSummary
+	if err := kb.ensureConnected(); err != nil {
+		return summary, err
+	}
+
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return summary, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	checkQuery := fmt.Sprintf("SELECT 1 FROM %s WHERE knowledge_base = $1 AND path = $2 FOR UPDATE", kb.tableName)
+	var exists int
+	err = tx.QueryRow(checkQuery, kbName, path).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return summary, fmt.Errorf("no node at '%s' in knowledge base '%s'", path, kbName)
+	} else if err != nil {
+		return summary, fmt.Errorf("error checking node: %w", err)
+	}
+
+	mountNames := fmt.Sprintf("SELECT link_name FROM %s WHERE knowledge_base = $1 AND mount_path <@ $2::ltree", kb.linkMountTable)
+	statements := []struct {
+		action string
+		query  string
+		count  *int
+	}{
+		{"resetting link flags", fmt.Sprintf(`
+			UPDATE %s AS t SET has_link = FALSE
+			WHERE t.has_link AND NOT (t.knowledge_base = $1 AND t.path <@ $2::ltree)
+			AND EXISTS (SELECT 1 FROM %s l WHERE l.parent_node_kb = t.knowledge_base AND l.parent_path = t.path
+				AND l.link_name IN (%s))
+			AND NOT EXISTS (SELECT 1 FROM %s l WHERE l.parent_node_kb = t.knowledge_base AND l.parent_path = t.path
+				AND l.link_name NOT IN (%s))`, kb.tableName, kb.linkTable, mountNames, kb.linkTable, mountNames), &summary.FlagsReset},
+		{"deleting links", fmt.Sprintf(`
+			DELETE FROM %s
+			WHERE (parent_node_kb = $1 AND parent_path <@ $2::ltree) OR link_name IN (%s)`, kb.linkTable, mountNames), &summary.LinksDeleted},
+		{"deleting mounts", fmt.Sprintf("DELETE FROM %s WHERE knowledge_base = $1 AND mount_path <@ $2::ltree", kb.linkMountTable), &summary.MountsDeleted},
+		{"deleting nodes", fmt.Sprintf("DELETE FROM %s WHERE knowledge_base = $1 AND path <@ $2::ltree", kb.tableName), &summary.NodesDeleted},
+	}
+	for _, stmt := range statements {
+		result, err := tx.Exec(stmt.query, kbName, path)
+		if err != nil {
+			return DeleteSummary{}, fmt.Errorf("error %s: %w", stmt.action, err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return DeleteSummary{}, fmt.Errorf("error getting rows affected: %w", err)
+		}
+		*stmt.count = int(rowsAffected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DeleteSummary{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return summary, nil
+}
+
+// ReconcileLinkFlags recomputes has_link and has_link_mount for every node in
+// kbName from the link and link mount tables and corrects the nodes whose flags
+// disagree, such as after rows were deleted out of band. It returns the number
+// of nodes corrected; soft-deleted nodes are included.
+func (kb *KnowledgeBaseManager) ReconcileLinkFlags(kbName string) (int, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s AS t SET has_link = f.has_link, has_link_mount = f.has_link_mount
+		FROM (
+			SELECT n.id,
+				EXISTS (SELECT 1 FROM %s l WHERE l.parent_node_kb = n.knowledge_base AND l.parent_path = n.path) AS has_link,
+				EXISTS (SELECT 1 FROM %s m WHERE m.knowledge_base = n.knowledge_base AND m.mount_path = n.path) AS has_link_mount
+			FROM %s n
+			WHERE n.knowledge_base = $1
+		) AS f
+		WHERE t.id = f.id
+		AND (t.has_link IS DISTINCT FROM f.has_link OR t.has_link_mount IS DISTINCT FROM f.has_link_mount)`,
+		kb.tableName, kb.linkTable, kb.linkMountTable, kb.tableName)
+
+	result, err := kb.db().Exec(query, kbName)
+	if err != nil {
+		return 0, fmt.Errorf("error reconciling link flags: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// TxManager exposes the add operations bound to a single transaction opened by WithTx
+type TxManager struct {
+	kb *KnowledgeBaseManager
+	tx *sql.Tx
+}
+
+// AddKB adds a knowledge base entry within the transaction
+func (t *TxManager) AddKB(kbName string, description string) error {
+	return t.kb.addKB(t.tx, kbName, description)
+}
+
+// AddNode adds a node within the transaction
+func (t *TxManager) AddNode(kbName, label, name string, properties, data map[string]interface{}, path string) error {
+	return t.kb.addNode(t.tx, kbName, label, name, properties, data, path)
+}
+
+// AddLink adds a link within the transaction
+func (t *TxManager) AddLink(parentKB, parentPath, linkName string) error {
+	return t.kb.addLink(t.tx, parentKB, parentPath, linkName)
+}
+
+// AddLinkMount adds a link mount within the transaction
+func (t *TxManager) AddLinkMount(knowledgeBase, path, linkMountName, description string) error {
+	return t.kb.addLinkMount(t.tx, knowledgeBase, path, linkMountName, description)
+}
+
+// WithTx runs fn inside a single transaction, committing if fn returns nil and
+// rolling back otherwise. Nested WithTx calls are not supported: calling WithTx
+// from inside fn opens an independent transaction.
+func (kb *KnowledgeBaseManager) WithTx(ctx context.Context, fn func(*TxManager) error) error {
+	if err := kb.ensureConnected(); err != nil {
+		return err
+	}
+
+	tx, err := kb.db().BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&TxManager{kb: kb, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SchemaIssue describes one difference between the database and the schema
+// created by NewKnowledgeBaseManager
+type SchemaIssue struct {
+	Table   string // Table the issue was found on
+	Kind    string // "table", "column" or "index"
+	Name    string // Name of the missing or mismatched object
+	Message string
+}
+
+// schemaTable lists the columns expected on one knowledge base table
+type schemaTable struct {
+	name    string
+	columns []string
+}
+
+// expectedSchema lists the four tables and their columns as created by createTables
+func (kb *KnowledgeBaseManager) expectedSchema() []schemaTable {
+	return []schemaTable{
+		{kb.tableName, []string{"id", "knowledge_base", "label", "name", "properties", "data", "has_link", "has_link_mount", "path", "deleted_at", "created_at", "updated_at"}},
+		{kb.infoTable, []string{"id", "knowledge_base", "description"}},
+		{kb.linkTable, []string{"id", "link_name", "parent_node_kb", "parent_path", "created_at"}},
+		{kb.linkMountTable, []string{"id", "link_name", "knowledge_base", "mount_path", "description", "created_at"}},
+	}
+}
+
+// indexMethodPattern extracts the access method from a pg_indexes indexdef
+var indexMethodPattern = regexp.MustCompile(`USING (\w+)`)
+
+// VerifySchema checks that the four tables, their columns and their indexes
+// exist in the public schema and reports every difference found. An empty
+// report means the schema is as expected.
+func (kb *KnowledgeBaseManager) VerifySchema() ([]SchemaIssue, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	issues := make([]SchemaIssue, 0)
+	presentTables := make(map[string]bool)
+
+	for _, table := range kb.expectedSchema() {
+		// Unquoted identifiers are stored in lower case
+		tableName := strings.ToLower(table.name)
+
+		rows, err := kb.db().Query(`
+			SELECT column_name FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = $1`, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("error reading columns of %s: %w", table.name, err)
+		}
+		columns := make(map[string]bool)
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning column of %s: %w", table.name, err)
+			}
+			columns[column] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading columns of %s: %w", table.name, err)
+		}
+
+		if len(columns) == 0 {
+			issues = append(issues, SchemaIssue{Table: table.name, Kind: "table", Name: table.name, Message: "table is missing"})
+			continue
+		}
+		presentTables[table.name] = true
+
+		for _, column := range table.columns {
+			if !columns[column] {
+				issues = append(issues, SchemaIssue{Table: table.name, Kind: "column", Name: column, Message: "column is missing"})
+			}
+		}
+	}
+
+	for _, index := range kb.indexSpecs() {
+		if !presentTables[index.table] {
+			continue
+		}
+
+		var indexDef string
+		err := kb.db().QueryRow(`
+			SELECT indexdef FROM pg_indexes
+			WHERE schemaname = 'public' AND tablename = $1 AND indexname = $2`,
+			strings.ToLower(index.table), strings.ToLower(index.name)).Scan(&indexDef)
+		if err == sql.ErrNoRows {
+			issues = append(issues, SchemaIssue{Table: index.table, Kind: "index", Name: index.name, Message: "index is missing"})
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading index %s: %w", index.name, err)
+		}
+
+		if match := indexMethodPattern.FindStringSubmatch(indexDef); match == nil || !strings.EqualFold(match[1], index.method) {
+			issues = append(issues, SchemaIssue{
+				Table:   index.table,
+				Kind:    "index",
+				Name:    index.name,
+				Message: fmt.Sprintf("index is not a %s index: %s", index.method, indexDef),
+			})
+		}
+	}
+
+	return issues, nil
 }
 
 /*
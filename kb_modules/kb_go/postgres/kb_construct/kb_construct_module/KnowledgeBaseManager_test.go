@@ -2,13 +2,21 @@
 package kb_construct_module
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	//"syscall"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 	//"bufio"
 	//"strings"
-	//"github.com/lib/pq"
+	"github.com/lib/pq"
 	//"golang.org/x/term"
 )
 
@@ -106,3 +114,1207 @@ func TestKnowledgeBaseManager(t *testing.T) {
 }
 
 
+
+// setupTestManager creates a KnowledgeBaseManager against the test table
+func setupTestManager(t testing.TB, opts ...ManagerOption) *KnowledgeBaseManager {
+	t.Helper()
+
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	connParams := ConnectionParams{
+		Host:     testDBHost,
+		Database: testDBName,
+		User:     testDBUser,
+		Password: testDBPassword,
+		Port:     testDBPort,
+	}
+
+	kbManager, err := NewKnowledgeBaseManager(testDBTable, connParams, opts...)
+	if err != nil {
+		t.Fatalf("Error initializing KnowledgeBaseManager: %v", err)
+	}
+
+	return kbManager
+}
+
+// TestReconnectAfterClose verifies that a dropped connection is transparently re-dialed
+func TestReconnectAfterClose(t *testing.T) {
+	kbManager := setupTestManager(t, WithReconnectRetries(2), WithReconnectBackoff(10*time.Millisecond))
+	defer kbManager.Disconnect()
+
+	// Simulate a dropped connection
+	if err := kbManager.conn.Close(); err != nil {
+		t.Fatalf("Error closing connection: %v", err)
+	}
+	if err := kbManager.Ping(context.Background()); err == nil {
+		t.Fatal("Expected ping to fail on a closed connection")
+	}
+
+	// The next call should reconnect and succeed
+	if err := kbManager.AddKB("kb1", "First knowledge base"); err != nil {
+		t.Fatalf("Expected AddKB to reconnect, got: %v", err)
+	}
+	if err := kbManager.Ping(context.Background()); err != nil {
+		t.Fatalf("Expected ping to succeed after reconnect, got: %v", err)
+	}
+}
+
+// TestEnsureConnectedConcurrent re-dials a dropped pool from several goroutines
+// at once, and checks a negative retry count still dials once and reports the
+// dial error. It needs no database: the pools are never used for a query.
+func TestEnsureConnectedConcurrent(t *testing.T) {
+	closedPool := func() *sql.DB {
+		db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+		if err != nil {
+			t.Fatalf("Error opening pool: %v", err)
+		}
+		db.Close()
+		return db
+	}
+
+	var mu sync.Mutex
+	dials := 0
+	kbManager := &KnowledgeBaseManager{conn: closedPool(), ownsConn: true, logger: noopLogger{},
+		dial: func() (*sql.DB, error) {
+			mu.Lock()
+			dials++
+			mu.Unlock()
+			return closedPool(), nil
+		}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := kbManager.ensureConnected(); err != nil {
+				t.Errorf("Expected ensureConnected to re-dial, got %v", err)
+			}
+			kbManager.Ping(context.Background())
+		}()
+	}
+	wg.Wait()
+	if dials == 0 {
+		t.Error("Expected the dropped pool to be re-dialed")
+	}
+
+	dialErr := errors.New("dial failed")
+	dials = 0
+	kbManager.reconnectRetries = -1
+	kbManager.dial = func() (*sql.DB, error) { dials++; return nil, dialErr }
+	if err := kbManager.ensureConnected(); !errors.Is(err, dialErr) || dials != 1 {
+		t.Errorf("Expected one dial returning %v, got %d dials and %v", dialErr, dials, err)
+	}
+
+	kbManager.Close()
+	if err := kbManager.ensureConnected(); err == nil {
+		t.Error("Expected ensureConnected to fail after Close")
+	}
+}
+
+// TestCloseIsIdempotent verifies that a second Close is a no-op
+func TestCloseIsIdempotent(t *testing.T) {
+	kbManager := setupTestManager(t)
+
+	if err := kbManager.Close(); err != nil {
+		t.Fatalf("Error closing manager: %v", err)
+	}
+	if err := kbManager.Close(); err != nil {
+		t.Errorf("Expected nil error on second Close, got %v", err)
+	}
+	if err := kbManager.Disconnect(); err != nil {
+		t.Errorf("Expected nil error on Disconnect after Close, got %v", err)
+	}
+	if err := kbManager.AddKB("kb1", "after close"); err == nil {
+		t.Error("Expected AddKB to fail after Close")
+	}
+}
+
+// TestAddLinkMounts verifies bulk mounts, skip-on-existing, and rollback on failure
+func TestAddLinkMounts(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "First knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.b", "kb1.c"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+
+	results, err := kbManager.AddLinkMounts([]MountInput{
+		{KnowledgeBase: "kb1", Path: "kb1.a", LinkName: "mount_a"},
+		{KnowledgeBase: "kb1", Path: "kb1.b", LinkName: "mount_b"},
+	})
+	if err != nil {
+		t.Fatalf("Error adding link mounts: %v", err)
+	}
+	if len(results) != 2 || !results[0].Inserted || !results[1].Inserted {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	t.Run("SkipExisting", func(t *testing.T) {
+		results, err := kbManager.AddLinkMounts([]MountInput{
+			{KnowledgeBase: "kb1", Path: "kb1.a", LinkName: "mount_a", SkipExisting: true},
+			{KnowledgeBase: "kb1", Path: "kb1.c", LinkName: "mount_c"},
+		})
+		if err != nil {
+			t.Fatalf("Error adding link mounts: %v", err)
+		}
+		if !results[0].Skipped || results[0].Inserted {
+			t.Errorf("Expected mount_a to be skipped, got %+v", results[0])
+		}
+		if !results[1].Inserted {
+			t.Errorf("Expected mount_c to be inserted, got %+v", results[1])
+		}
+	})
+
+	t.Run("FailRollsBack", func(t *testing.T) {
+		_, err := kbManager.AddLinkMounts([]MountInput{
+			{KnowledgeBase: "kb1", Path: "kb1.c", LinkName: "mount_d"},
+			{KnowledgeBase: "kb1", Path: "kb1.b", LinkName: "mount_b"},
+		})
+		if err == nil {
+			t.Fatal("Expected error for duplicate link name")
+		}
+
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s_link_mount WHERE link_name = $1", testDBTable)
+		if err := kbManager.conn.QueryRow(query, "mount_d").Scan(&count); err != nil {
+			t.Fatalf("Error counting mounts: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("Expected mount_d to be rolled back, found %d rows", count)
+		}
+	})
+}
+
+// TestMountTargetValidation verifies double-mount and leaf-target rejection
+func TestMountTargetValidation(t *testing.T) {
+	kbManager := setupTestManager(t, WithRejectDoubleMount(), WithMountRequiresChildren())
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "First knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.a.b", "kb1.c", "kb1.c.d"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+
+	if _, _, err := kbManager.AddLinkMount("kb1", "kb1.a", "mount_a", ""); err != nil {
+		t.Fatalf("Error adding first mount: %v", err)
+	}
+
+	t.Run("DoubleMount", func(t *testing.T) {
+		_, _, err := kbManager.AddLinkMount("kb1", "kb1.a", "mount_a2", "")
+		if err == nil || !strings.Contains(err.Error(), "already a mount point") {
+			t.Fatalf("Expected double-mount error, got %v", err)
+		}
+
+		_, err = kbManager.AddLinkMounts([]MountInput{
+			{KnowledgeBase: "kb1", Path: "kb1.c", LinkName: "mount_c"},
+			{KnowledgeBase: "kb1", Path: "kb1.a", LinkName: "mount_a3"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "already a mount point") {
+			t.Fatalf("Expected double-mount error from AddLinkMounts, got %v", err)
+		}
+
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s_link_mount WHERE link_name = $1", testDBTable)
+		if err := kbManager.conn.QueryRow(query, "mount_c").Scan(&count); err != nil {
+			t.Fatalf("Error counting mounts: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("Expected mount_c to be rolled back, found %d rows", count)
+		}
+	})
+
+	t.Run("LeafTarget", func(t *testing.T) {
+		_, _, err := kbManager.AddLinkMount("kb1", "kb1.a.b", "mount_leaf", "")
+		if err == nil || !strings.Contains(err.Error(), "leaf node") {
+			t.Fatalf("Expected leaf-target error, got %v", err)
+		}
+	})
+
+	t.Run("DefaultAllowsDoubleMount", func(t *testing.T) {
+		kbManager.rejectDoubleMount = false
+		kbManager.requireMountParent = false
+
+		if _, _, err := kbManager.AddLinkMount("kb1", "kb1.a", "mount_a4", ""); err != nil {
+			t.Errorf("Expected double mount to succeed without options, got %v", err)
+		}
+	})
+}
+
+// TestValidateIdentifier checks that unsafe table names are rejected
+func TestValidateIdentifier(t *testing.T) {
+	valid := []string{"knowledge_base", "_kb", "KB1", "kb_test_2"}
+	for _, name := range valid {
+		if err := validateIdentifier(name); err != nil {
+			t.Errorf("Expected '%s' to be valid, got: %v", name, err)
+		}
+	}
+
+	invalid := []string{"", "kb; DROP", "kb'", "1kb", "kb-name", "kb.name", "kb name", `kb"`, strings.Repeat("k", 64)}
+	for _, name := range invalid {
+		if err := validateIdentifier(name); err == nil {
+			t.Errorf("Expected '%s' to be rejected", name)
+		}
+	}
+}
+
+// TestNewKnowledgeBaseManagerRejectsBadTableName checks validation happens before connecting
+func TestNewKnowledgeBaseManagerRejectsBadTableName(t *testing.T) {
+	_, err := NewKnowledgeBaseManager("kb; DROP", ConnectionParams{})
+	if err == nil {
+		t.Fatal("Expected error for table name 'kb; DROP'")
+	}
+	if !contains(err.Error(), "invalid table name") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+// TestResolveTableNames checks defaults, prefixes, explicit names and validation
+func TestResolveTableNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ManagerOption
+		want    TableNames
+		wantErr bool
+	}{
+		{"Default", nil, TableNames{"kb", "kb_info", "kb_link", "kb_link_mount"}, false},
+		{"Prefix", []ManagerOption{WithTablePrefix("a_")}, TableNames{"a_kb", "a_kb_info", "a_kb_link", "a_kb_link_mount"}, false},
+		{"Explicit", []ManagerOption{WithTableNames(TableNames{Info: "infos", LinkMount: "mounts"})}, TableNames{"kb", "infos", "kb_link", "mounts"}, false},
+		{"ExplicitBase", []ManagerOption{WithTableNames(TableNames{Base: "nodes"}), WithTablePrefix("p_")}, TableNames{"p_nodes", "p_nodes_info", "p_nodes_link", "p_nodes_link_mount"}, false},
+		{"BadPrefix", []ManagerOption{WithTablePrefix("1-")}, TableNames{}, true},
+		{"Duplicate", []ManagerOption{WithTableNames(TableNames{Link: "kb_info"})}, TableNames{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kb := &KnowledgeBaseManager{}
+			for _, opt := range tt.opts {
+				opt(kb)
+			}
+			err := kb.resolveTableNames("kb")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && kb.TableNames() != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, kb.TableNames())
+			}
+		})
+	}
+}
+
+// TestIndexNames checks the default tables keep their original index names and
+// that long table names give distinct names Postgres does not truncate
+func TestIndexNames(t *testing.T) {
+	kb := &KnowledgeBaseManager{useJSONB: true}
+	if err := kb.resolveTableNames("kb"); err != nil {
+		t.Fatalf("Error resolving table names: %v", err)
+	}
+	want := []string{
+		"idx_kb_kb", "idx_kb_path", "idx_kb_label", "idx_kb_name", "idx_kb_has_link", "idx_kb_has_link_mount", "idx_kb_kb_path",
+		"idx_kb_info_kb",
+		"idx_kb_link_name", "idx_kb_link_parent_kb", "idx_kb_link_parent_path", "idx_kb_link_created", "idx_kb_link_composite",
+		"idx_kb_mount_link_name", "idx_kb_mount_kb", "idx_kb_mount_path", "idx_kb_mount_created", "idx_kb_mount_composite",
+		"idx_kb_properties",
+	}
+	specs := kb.indexSpecs()
+	if len(specs) != len(want) {
+		t.Fatalf("Expected %d indexes, got %d", len(want), len(specs))
+	}
+	for i, spec := range specs {
+		if spec.name != want[i] {
+			t.Errorf("Expected index %d to be named %s, got %s", i, want[i], spec.name)
+		}
+	}
+
+	long := &KnowledgeBaseManager{}
+	if err := long.resolveTableNames(strings.Repeat("k", 52)); err != nil {
+		t.Fatalf("Error resolving table names: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, spec := range long.indexSpecs() {
+		if len(spec.name) > maxIdentifierLength {
+			t.Errorf("Expected index name %s to fit in %d characters", spec.name, maxIdentifierLength)
+		}
+		if seen[spec.name] {
+			t.Errorf("Expected index name %s to be unique", spec.name)
+		}
+		seen[spec.name] = true
+	}
+}
+
+// TestTablePrefixIsolation checks that managers with the same base name but
+// distinct prefixes do not interfere
+func TestTablePrefixIsolation(t *testing.T) {
+	first := setupTestManager(t, WithTablePrefix("first_"))
+	defer first.Disconnect()
+	second := setupTestManager(t, WithTablePrefix("second_"))
+	defer second.Disconnect()
+
+	for _, kbManager := range []*KnowledgeBaseManager{first, second} {
+		if err := kbManager.AddKB("kb1", "Test knowledge base"); err != nil {
+			t.Fatalf("Error adding kb1 to %s: %v", kbManager.TableNames().Base, err)
+		}
+	}
+	if err := first.AddNode("kb1", "header", "a", nil, nil, "kb1.a"); err != nil {
+		t.Fatalf("Error adding node: %v", err)
+	}
+
+	for _, tc := range []struct {
+		kbManager *KnowledgeBaseManager
+		want      int
+	}{{first, 1}, {second, 0}} {
+		count, err := tc.kbManager.CountNodes("kb1")
+		if err != nil {
+			t.Fatalf("Error counting nodes: %v", err)
+		}
+		if count != tc.want {
+			t.Errorf("%s: expected %d nodes, got %d", tc.kbManager.TableNames().Base, tc.want, count)
+		}
+	}
+}
+
+// TestVerifySchema checks a fresh schema is clean and that dropped objects are reported
+func TestVerifySchema(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	issues, err := kbManager.VerifySchema()
+	if err != nil {
+		t.Fatalf("Error verifying schema: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("Expected no issues on a fresh schema, got %+v", issues)
+	}
+
+	labelIndex := fmt.Sprintf("idx_%s_label", testDBTable)
+	statements := []string{
+		fmt.Sprintf("DROP INDEX %s", labelIndex),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN description", kbManager.TableNames().Info),
+		fmt.Sprintf("DROP TABLE %s", kbManager.TableNames().LinkMount),
+	}
+	for _, statement := range statements {
+		if _, err := kbManager.conn.Exec(statement); err != nil {
+			t.Fatalf("Error running %q: %v", statement, err)
+		}
+	}
+
+	issues, err = kbManager.VerifySchema()
+	if err != nil {
+		t.Fatalf("Error verifying schema: %v", err)
+	}
+	expected := []SchemaIssue{
+		{Table: kbManager.TableNames().Info, Kind: "column", Name: "description", Message: "column is missing"},
+		{Table: kbManager.TableNames().LinkMount, Kind: "table", Name: kbManager.TableNames().LinkMount, Message: "table is missing"},
+		{Table: testDBTable, Kind: "index", Name: labelIndex, Message: "index is missing"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), issues)
+	}
+	for i := range expected {
+		if issues[i] != expected[i] {
+			t.Errorf("Issue %d: expected %+v, got %+v", i, expected[i], issues[i])
+		}
+	}
+}
+
+// TestCountNodes verifies node counts and per-label grouping
+func TestCountNodes(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "Test knowledge base"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+
+	nodes := []struct{ label, path string }{
+		{"header", "kb1.a"},
+		{"header", "kb1.b"},
+		{"info", "kb1.a.x"},
+		{"info", "kb1.a.y"},
+		{"info", "kb1.b.z"},
+		{"link", "kb1.b.l"},
+	}
+	for _, n := range nodes {
+		if err := kbManager.AddNode("kb1", n.label, n.path, nil, nil, n.path); err != nil {
+			t.Fatalf("Error adding node %s: %v", n.path, err)
+		}
+	}
+
+	count, err := kbManager.CountNodes("kb1")
+	if err != nil {
+		t.Fatalf("Error counting nodes: %v", err)
+	}
+	if count != len(nodes) {
+		t.Errorf("Expected %d nodes, got %d", len(nodes), count)
+	}
+
+	counts, err := kbManager.CountByLabel("kb1")
+	if err != nil {
+		t.Fatalf("Error counting by label: %v", err)
+	}
+	expected := map[string]int{"header": 2, "info": 3, "link": 1}
+	if len(counts) != len(expected) {
+		t.Errorf("Expected %d labels, got %v", len(expected), counts)
+	}
+	for label, want := range expected {
+		if counts[label] != want {
+			t.Errorf("Expected %d nodes with label '%s', got %d", want, label, counts[label])
+		}
+	}
+
+	t.Run("EmptyKB", func(t *testing.T) {
+		count, err := kbManager.CountNodes("kb2")
+		if err != nil || count != 0 {
+			t.Errorf("Expected 0 nodes and no error, got %d, %v", count, err)
+		}
+		counts, err := kbManager.CountByLabel("kb2")
+		if err != nil || len(counts) != 0 {
+			t.Errorf("Expected empty counts and no error, got %v, %v", counts, err)
+		}
+	})
+}
+
+// TestWithTx verifies composed operations commit together and roll back together
+func TestWithTx(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	err := kbManager.WithTx(context.Background(), func(tx *TxManager) error {
+		if err := tx.AddKB("kb1", "First knowledge base"); err != nil {
+			return err
+		}
+		if err := tx.AddNode("kb1", "header", "a", nil, nil, "kb1.a"); err != nil {
+			return err
+		}
+		return tx.AddLink("kb1", "kb1.a", "link_a")
+	})
+	if err != nil {
+		t.Fatalf("Error in committed transaction: %v", err)
+	}
+
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 1 {
+		t.Errorf("Expected 1 committed node, got %d, %v", count, err)
+	}
+
+	t.Run("RollbackOnError", func(t *testing.T) {
+		err := kbManager.WithTx(context.Background(), func(tx *TxManager) error {
+			if err := tx.AddNode("kb1", "header", "b", nil, nil, "kb1.b"); err != nil {
+				return err
+			}
+			// Duplicate link name fails and must undo the node above
+			return tx.AddLink("kb1", "kb1.b", "link_a")
+		})
+		if err == nil {
+			t.Fatal("Expected error for duplicate link name")
+		}
+
+		if count, err := kbManager.CountNodes("kb1"); err != nil || count != 1 {
+			t.Errorf("Expected node kb1.b to be rolled back, got %d nodes, %v", count, err)
+		}
+	})
+}
+
+// TestNewKnowledgeBaseManagerFromDB shares one pool between two managers and
+// checks that closing either leaves the pool open
+func TestNewKnowledgeBaseManagerFromDB(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		url.PathEscape(testDBUser), url.PathEscape(testDBPassword), testDBHost, testDBPort, testDBName)
+	owner, err := NewKnowledgeBaseManagerFromURL(dsn, testDBTable)
+	if err != nil {
+		t.Fatalf("Error connecting from URL: %v", err)
+	}
+	defer owner.Close()
+	db := owner.conn
+
+	first, err := NewKnowledgeBaseManagerFromDB(db, testDBTable, WithTablePrefix("first_"))
+	if err != nil {
+		t.Fatalf("Error creating first manager: %v", err)
+	}
+	second, err := NewKnowledgeBaseManagerFromDB(db, testDBTable, WithTablePrefix("second_"))
+	if err != nil {
+		t.Fatalf("Error creating second manager: %v", err)
+	}
+
+	if err := first.AddKB("kb1", "first"); err != nil {
+		t.Fatalf("Error adding kb to first manager: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Error closing first manager: %v", err)
+	}
+
+	if err := second.AddKB("kb1", "second"); err != nil {
+		t.Errorf("Expected second manager to keep working, got %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("Error closing second manager: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("Expected the injected pool to stay open, got %v", err)
+	}
+
+	if _, err := NewKnowledgeBaseManagerFromDB(nil, testDBTable); err == nil {
+		t.Error("Expected an error for a nil pool")
+	}
+}
+
+// TestCopyKB copies a multi-node knowledge base and checks the paths were re-rooted
+func TestCopyKB(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Source knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.a.b", "kb1.a.b.c", "kb1.d"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+	if _, _, err := kbManager.AddLinkMount("kb1", "kb1.d", "link1", "Mount"); err != nil {
+		t.Fatalf("Error adding link mount: %v", err)
+	}
+	if err := kbManager.AddLink("kb1", "kb1.a.b", "link1"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+
+	copied, err := kbManager.CopyKB("kb1", "kb2")
+	if err != nil {
+		t.Fatalf("Error copying knowledge base: %v", err)
+	}
+	if copied != 4 {
+		t.Errorf("Expected 4 nodes copied, got %d", copied)
+	}
+
+	nodes, err := kbManager.QueryLquery("kb2", "*")
+	if err != nil {
+		t.Fatalf("Error querying copied nodes: %v", err)
+	}
+	want := []string{"kb2.a", "kb2.a.b", "kb2.a.b.c", "kb2.d"}
+	if got := nodePaths(nodes); !samePaths(got, want) {
+		t.Errorf("Expected paths %v, got %v", want, got)
+	}
+
+	var linkName, mountPath string
+	err = kbManager.conn.QueryRow(fmt.Sprintf("SELECT link_name FROM %s WHERE parent_node_kb = 'kb2' AND parent_path = 'kb2.a.b'",
+		kbManager.linkTable)).Scan(&linkName)
+	if err != nil || linkName != "kb2.link1" {
+		t.Errorf("Expected the link re-rooted to kb2.a.b as kb2.link1, got %q, %v", linkName, err)
+	}
+	err = kbManager.conn.QueryRow(fmt.Sprintf("SELECT mount_path::text FROM %s WHERE link_name = 'kb2.link1' AND knowledge_base = 'kb2'",
+		kbManager.linkMountTable)).Scan(&mountPath)
+	if err != nil || mountPath != "kb2.d" {
+		t.Errorf("Expected the mount re-rooted to kb2.d as kb2.link1, got %q, %v", mountPath, err)
+	}
+	var sourceLinks int
+	err = kbManager.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE link_name = 'link1'",
+		kbManager.linkTable)).Scan(&sourceLinks)
+	if err != nil || sourceLinks != 1 {
+		t.Errorf("Expected link1 to stay unique, found %d, %v", sourceLinks, err)
+	}
+
+	if _, err := kbManager.CopyKB("kb1", "kb2"); err == nil {
+		t.Error("Expected copying onto an existing knowledge base to fail")
+	}
+
+	// A link into another knowledge base cannot be renamed without its mount
+	if err := kbManager.AddKB("kb3", "Links into kb1"); err != nil {
+		t.Fatalf("Error adding kb3: %v", err)
+	}
+	if err := kbManager.AddNode("kb3", "header", "kb3.a", nil, nil, "kb3.a"); err != nil {
+		t.Fatalf("Error adding kb3.a: %v", err)
+	}
+	if _, _, err := kbManager.AddLinkMount("kb1", "kb1.a", "link2", "Mount"); err != nil {
+		t.Fatalf("Error adding link mount: %v", err)
+	}
+	if err := kbManager.AddLink("kb3", "kb3.a", "link2"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+	if _, err := kbManager.CopyKB("kb3", "kb4"); err == nil {
+		t.Error("Expected copying a link to a mount outside the knowledge base to fail")
+	}
+	if _, err := kbManager.GetKBInfo("kb4"); err == nil {
+		t.Error("Expected the failed copy to leave no kb4 behind")
+	}
+}
+
+// TestSoftDelete checks that tombstoned nodes are hidden from reads, visible
+// with includeDeleted, restorable, and removed by PurgeDeleted
+func TestSoftDelete(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Soft delete"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.a.b", "kb1.c"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+	if err := kbManager.AddLink("kb1", "kb1.a.b", "link1"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+
+	if err := kbManager.SoftDeleteNode("kb1", "kb1.a.b"); err != nil {
+		t.Fatalf("Error soft-deleting node: %v", err)
+	}
+	if err := kbManager.SoftDeleteNode("kb1", "kb1.a.b"); err == nil {
+		t.Error("Expected soft-deleting a deleted node to fail")
+	}
+	if err := kbManager.AddLink("kb1", "kb1.a.b", "link2"); err == nil {
+		t.Error("Expected linking a deleted node to fail")
+	}
+	if _, _, err := kbManager.AddLinkMount("kb1", "kb1.a.b", "mount1", ""); err == nil {
+		t.Error("Expected mounting a deleted node to fail")
+	}
+
+	visible := func(want []string) {
+		t.Helper()
+		nodes, err := kbManager.QueryLquery("kb1", "*")
+		if err != nil {
+			t.Fatalf("Error querying nodes: %v", err)
+		}
+		if got := nodePaths(nodes); !samePaths(got, want) {
+			t.Errorf("Expected paths %v, got %v", want, got)
+		}
+		count, err := kbManager.CountNodes("kb1")
+		if err != nil {
+			t.Fatalf("Error counting nodes: %v", err)
+		}
+		if count != len(want) {
+			t.Errorf("Expected CountNodes %d, got %d", len(want), count)
+		}
+	}
+	visible([]string{"kb1.a", "kb1.c"})
+
+	kbManager.includeDeleted = true
+	visible([]string{"kb1.a", "kb1.a.b", "kb1.c"})
+	nodes, err := kbManager.QueryLquery("kb1", "kb1.a.b")
+	if err != nil || len(nodes) != 1 || nodes[0].DeletedAt == nil {
+		t.Errorf("Expected the tombstoned node with DeletedAt set, got %v, %v", nodes, err)
+	}
+	kbManager.includeDeleted = false
+
+	if err := kbManager.RestoreNode("kb1", "kb1.a.b"); err != nil {
+		t.Fatalf("Error restoring node: %v", err)
+	}
+	if err := kbManager.RestoreNode("kb1", "kb1.a.b"); err == nil {
+		t.Error("Expected restoring a live node to fail")
+	}
+	visible([]string{"kb1.a", "kb1.a.b", "kb1.c"})
+
+	if err := kbManager.SoftDeleteNode("kb1", "kb1.a.b"); err != nil {
+		t.Fatalf("Error soft-deleting node: %v", err)
+	}
+	purged, err := kbManager.PurgeDeleted(time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Errorf("Expected nothing purged before the tombstone, got %d, %v", purged, err)
+	}
+	purged, err = kbManager.PurgeDeleted(time.Now().Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Errorf("Expected one node purged, got %d, %v", purged, err)
+	}
+
+	kbManager.includeDeleted = true
+	visible([]string{"kb1.a", "kb1.c"})
+
+	var linkCount int
+	err = kbManager.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE parent_path = 'kb1.a.b'",
+		kbManager.linkTable)).Scan(&linkCount)
+	if err != nil {
+		t.Fatalf("Error counting links: %v", err)
+	}
+	if linkCount != 0 {
+		t.Errorf("Expected the purged node's link to be removed, found %d", linkCount)
+	}
+}
+
+// TestDeleteNode deletes a subtree whose node has both a link and a mount and
+// checks the summary accounts for every row removed or changed
+func TestDeleteNode(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Delete"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.a.b", "kb1.c", "kb1.d"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+	// kb1.a.b carries mount1 and a link to mount2 on kb1.d; kb1.c links to mount1
+	for _, mount := range [][2]string{{"kb1.a.b", "mount1"}, {"kb1.d", "mount2"}} {
+		if _, _, err := kbManager.AddLinkMount("kb1", mount[0], mount[1], ""); err != nil {
+			t.Fatalf("Error adding mount %s: %v", mount[1], err)
+		}
+	}
+	for _, link := range [][2]string{{"kb1.a.b", "mount2"}, {"kb1.c", "mount1"}} {
+		if err := kbManager.AddLink("kb1", link[0], link[1]); err != nil {
+			t.Fatalf("Error adding link %s: %v", link[1], err)
+		}
+	}
+
+	summary, err := kbManager.DeleteNode("kb1", "kb1.a")
+	if err != nil {
+		t.Fatalf("Error deleting node: %v", err)
+	}
+	want := DeleteSummary{NodesDeleted: 2, LinksDeleted: 2, MountsDeleted: 1, FlagsReset: 1}
+	if summary != want {
+		t.Errorf("Expected summary %+v, got %+v", want, summary)
+	}
+
+	var hasLink, hasLinkMount bool
+	query := fmt.Sprintf("SELECT has_link, has_link_mount FROM %s WHERE path = $1", kbManager.tableName)
+	if err := kbManager.conn.QueryRow(query, "kb1.c").Scan(&hasLink, &hasLinkMount); err != nil || hasLink {
+		t.Errorf("Expected has_link cleared on kb1.c, got %v, %v", hasLink, err)
+	}
+	if err := kbManager.conn.QueryRow(query, "kb1.d").Scan(&hasLink, &hasLinkMount); err != nil || !hasLinkMount {
+		t.Errorf("Expected mount2 to survive on kb1.d, got %v, %v", hasLinkMount, err)
+	}
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 2 {
+		t.Errorf("Expected 2 nodes left, got %d, %v", count, err)
+	}
+
+	if _, err := kbManager.DeleteNode("kb1", "kb1.a"); err == nil {
+		t.Error("Expected deleting a missing node to fail")
+	}
+}
+
+// TestReconcileLinkFlags corrupts the link flags in both directions and checks
+// ReconcileLinkFlags restores them from the link tables
+func TestReconcileLinkFlags(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Reconcile"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.b", "kb1.c"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+	if _, _, err := kbManager.AddLinkMount("kb1", "kb1.a", "mount1", ""); err != nil {
+		t.Fatalf("Error adding mount: %v", err)
+	}
+	if err := kbManager.AddLink("kb1", "kb1.b", "mount1"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+
+	if corrected, err := kbManager.ReconcileLinkFlags("kb1"); err != nil || corrected != 0 {
+		t.Errorf("Expected consistent flags to need no correction, got %d, %v", corrected, err)
+	}
+
+	// Clear a set flag, set a stale one, and drop a link out of band
+	corrupt := []string{
+		fmt.Sprintf("UPDATE %s SET has_link_mount = FALSE WHERE path = 'kb1.a'", kbManager.tableName),
+		fmt.Sprintf("UPDATE %s SET has_link = TRUE WHERE path = 'kb1.c'", kbManager.tableName),
+		fmt.Sprintf("DELETE FROM %s WHERE parent_path = 'kb1.b'", kbManager.linkTable),
+	}
+	for _, stmt := range corrupt {
+		if _, err := kbManager.conn.Exec(stmt); err != nil {
+			t.Fatalf("Error corrupting flags: %v", err)
+		}
+	}
+
+	corrected, err := kbManager.ReconcileLinkFlags("kb1")
+	if err != nil {
+		t.Fatalf("Error reconciling link flags: %v", err)
+	}
+	if corrected != 3 {
+		t.Errorf("Expected 3 nodes corrected, got %d", corrected)
+	}
+
+	want := map[string][2]bool{"kb1.a": {false, true}, "kb1.b": {false, false}, "kb1.c": {false, false}}
+	query := fmt.Sprintf("SELECT has_link, has_link_mount FROM %s WHERE path = $1", kbManager.tableName)
+	for path, flags := range want {
+		var hasLink, hasLinkMount bool
+		if err := kbManager.conn.QueryRow(query, path).Scan(&hasLink, &hasLinkMount); err != nil {
+			t.Fatalf("Error reading flags of %s: %v", path, err)
+		}
+		if hasLink != flags[0] || hasLinkMount != flags[1] {
+			t.Errorf("Expected %s flags %v, got [%v %v]", path, flags, hasLink, hasLinkMount)
+		}
+	}
+
+	if corrected, err := kbManager.ReconcileLinkFlags("kb1"); err != nil || corrected != 0 {
+		t.Errorf("Expected a second pass to correct nothing, got %d, %v", corrected, err)
+	}
+}
+
+// TestKBInfo checks GetKBInfo reads back AddKB and UpdateKBDescription, and
+// that a missing knowledge base reports ErrKBNotFound
+func TestKBInfo(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "First description"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.b"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+
+	info, err := kbManager.GetKBInfo("kb1")
+	if err != nil {
+		t.Fatalf("Error getting info: %v", err)
+	}
+	if info != (KBInfo{Name: "kb1", Description: "First description", NodeCount: 2}) {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	if err := kbManager.UpdateKBDescription("kb1", "Second description"); err != nil {
+		t.Fatalf("Error updating description: %v", err)
+	}
+	if info, err := kbManager.GetKBInfo("kb1"); err != nil || info.Description != "Second description" {
+		t.Errorf("Expected the updated description, got %+v, %v", info, err)
+	}
+
+	if err := kbManager.UpdateKBDescription("kb1", "bad\x00description"); err == nil {
+		t.Error("Expected the database to reject a description with a NUL byte")
+	}
+	if err := kbManager.UpdateKBDescription("missing", "x"); !errors.Is(err, ErrKBNotFound) {
+		t.Errorf("Expected ErrKBNotFound updating a missing kb, got %v", err)
+	}
+	if _, err := kbManager.GetKBInfo("missing"); !errors.Is(err, ErrKBNotFound) {
+		t.Errorf("Expected ErrKBNotFound reading a missing kb, got %v", err)
+	}
+}
+
+// TestUpdateNode checks UpdateNode replaces the node's data and advances updated_at only
+func TestUpdateNode(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Timestamps"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	if err := kbManager.AddNode("kb1", "header", "a", nil, map[string]interface{}{"v": 1}, "kb1.a"); err != nil {
+		t.Fatalf("Error adding node: %v", err)
+	}
+
+	read := func() Node {
+		t.Helper()
+		nodes, err := kbManager.QuerySubtree("kb1", "kb1.a", 0)
+		if err != nil || len(nodes) != 1 {
+			t.Fatalf("Error reading kb1.a: %v, %v", nodes, err)
+		}
+		return nodes[0]
+	}
+
+	before := read()
+	if before.CreatedAt.IsZero() || !before.UpdatedAt.Equal(before.CreatedAt) {
+		t.Fatalf("Expected created_at and updated_at to be set and equal, got %v and %v", before.CreatedAt, before.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := kbManager.UpdateNode("kb1", "kb1.a", map[string]interface{}{"p": "x"}, map[string]interface{}{"v": 2}); err != nil {
+		t.Fatalf("Error updating node: %v", err)
+	}
+
+	after := read()
+	if !after.UpdatedAt.After(before.UpdatedAt) {
+		t.Errorf("Expected updated_at to advance past %v, got %v", before.UpdatedAt, after.UpdatedAt)
+	}
+	if !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Errorf("Expected created_at to stay %v, got %v", before.CreatedAt, after.CreatedAt)
+	}
+	if after.Data["v"] != float64(2) || after.Properties["p"] != "x" {
+		t.Errorf("Expected updated properties and data, got %v and %v", after.Properties, after.Data)
+	}
+
+	if err := kbManager.UpdateNode("kb1", "kb1.missing", nil, nil); err == nil {
+		t.Error("Expected updating a missing node to fail")
+	}
+}
+
+// TestUpsertNode covers the insert and update branches and concurrent upserts of one path
+func TestUpsertNode(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "Upsert"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+
+	inserted, err := kbManager.UpsertNode("kb1", "header", "a", nil, map[string]interface{}{"v": 1}, "kb1.a")
+	if err != nil || !inserted {
+		t.Fatalf("Expected insert, got %v, %v", inserted, err)
+	}
+	inserted, err = kbManager.UpsertNode("kb1", "info", "renamed", map[string]interface{}{"p": "x"}, map[string]interface{}{"v": 2}, "kb1.a")
+	if err != nil || inserted {
+		t.Fatalf("Expected update, got %v, %v", inserted, err)
+	}
+
+	nodes, err := kbManager.QuerySubtree("kb1", "kb1.a", 0)
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Error reading kb1.a: %v, %v", nodes, err)
+	}
+	if n := nodes[0]; n.Label != "info" || n.Name != "renamed" || n.Properties["p"] != "x" || n.Data["v"] != float64(2) {
+		t.Errorf("Expected updated node, got %+v", n)
+	}
+
+	if _, err := kbManager.UpsertNode("kb2", "header", "a", nil, nil, "kb1.a"); err == nil {
+		t.Error("Expected upserting another knowledge base's path to fail")
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, workers)
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			inserted, err := kbManager.UpsertNode("kb1", "header", "b", nil, map[string]interface{}{"worker": i}, "kb1.b")
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- inserted
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent upsert failed: %v", err)
+	}
+	inserts := 0
+	for inserted := range results {
+		if inserted {
+			inserts++
+		}
+	}
+	if inserts != 1 {
+		t.Errorf("Expected exactly one concurrent insert, got %d", inserts)
+	}
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 2 {
+		t.Errorf("Expected 2 nodes in kb1, got %d, %v", count, err)
+	}
+}
+
+// checkScopedPaths adds the same path under two knowledge bases and checks each
+// knowledge base keeps its own node
+func checkScopedPaths(t *testing.T, kbManager *KnowledgeBaseManager) {
+	t.Helper()
+
+	if err := kbManager.AddNode("kb2", "header", "shared", nil, nil, "shared.a"); err != nil {
+		t.Fatalf("Error adding shared.a to kb2: %v", err)
+	}
+	if err := kbManager.AddNode("kb2", "header", "shared", nil, nil, "shared.a"); err == nil {
+		t.Error("Expected a duplicate path within one knowledge base to fail")
+	}
+	if inserted, err := kbManager.UpsertNode("kb2", "info", "renamed", nil, nil, "shared.a"); err != nil || inserted {
+		t.Errorf("Expected upsert to update kb2's node, got %v, %v", inserted, err)
+	}
+	if err := kbManager.AddLink("kb2", "shared.a", "link1"); err != nil {
+		t.Fatalf("Error adding link: %v", err)
+	}
+
+	rows, err := kbManager.conn.Query(fmt.Sprintf("SELECT knowledge_base, name, has_link FROM %s WHERE path = 'shared.a' ORDER BY knowledge_base", kbManager.tableName))
+	if err != nil {
+		t.Fatalf("Error reading nodes: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var kbName, name string
+		var hasLink bool
+		if err := rows.Scan(&kbName, &name, &hasLink); err != nil {
+			t.Fatalf("Error scanning node: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s:%s:%v", kbName, name, hasLink))
+	}
+	want := []string{"kb1:shared:false", "kb2:renamed:true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected nodes %v, got %v", want, got)
+	}
+}
+
+// TestKBScopedPaths checks a scoped table accepts the same path in two knowledge bases
+func TestKBScopedPaths(t *testing.T) {
+	kbManager := setupTestManager(t, WithKBScopedPaths())
+	defer kbManager.Disconnect()
+
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "Scoped"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+	if err := kbManager.AddNode("kb1", "header", "shared", nil, nil, "shared.a"); err != nil {
+		t.Fatalf("Error adding shared.a to kb1: %v", err)
+	}
+	checkScopedPaths(t, kbManager)
+}
+
+// TestMigrateToKBScopedPaths checks the default table rejects a path reused
+// across knowledge bases until it is migrated
+func TestMigrateToKBScopedPaths(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "Scoped"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+	if err := kbManager.AddNode("kb1", "header", "shared", nil, nil, "shared.a"); err != nil {
+		t.Fatalf("Error adding shared.a to kb1: %v", err)
+	}
+	if err := kbManager.AddNode("kb2", "header", "shared", nil, nil, "shared.a"); err == nil {
+		t.Fatal("Expected a path reused across knowledge bases to fail before migration")
+	}
+
+	if err := kbManager.MigrateToKBScopedPaths(); err != nil {
+		t.Fatalf("Error migrating to scoped paths: %v", err)
+	}
+	if err := kbManager.MigrateToKBScopedPaths(); err != nil {
+		t.Fatalf("Expected a repeated migration to succeed, got %v", err)
+	}
+	checkScopedPaths(t, kbManager)
+}
+
+// TestMigrateSoftDelete checks a main table without deleted_at can be read
+// after migration and that a repeated migration is a no-op
+func TestMigrateSoftDelete(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Migrate"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	if err := kbManager.AddNode("kb1", "header", "a", nil, nil, "kb1.a"); err != nil {
+		t.Fatalf("Error adding node: %v", err)
+	}
+	dropQuery := fmt.Sprintf("ALTER TABLE %s DROP COLUMN deleted_at", kbManager.tableName)
+	if _, err := kbManager.conn.Exec(dropQuery); err != nil {
+		t.Fatalf("Error dropping deleted_at: %v", err)
+	}
+	if _, err := kbManager.CountNodes("kb1"); err == nil {
+		t.Fatal("Expected reads to fail on a table without deleted_at")
+	}
+
+	if err := kbManager.MigrateSoftDelete(); err != nil {
+		t.Fatalf("Error migrating: %v", err)
+	}
+	if err := kbManager.MigrateSoftDelete(); err != nil {
+		t.Fatalf("Expected a repeated migration to succeed, got %v", err)
+	}
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 1 {
+		t.Errorf("Expected one node after migration, got %d, %v", count, err)
+	}
+}
+
+// TestRetry checks only serialization failures and deadlocks are retried
+func TestRetry(t *testing.T) {
+	kbManager := &KnowledgeBaseManager{txRetries: 3, txRetryDelay: time.Millisecond, logger: noopLogger{}}
+
+	attempts := 0
+	err := kbManager.retry(func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("error committing transaction: %w", &pq.Error{Code: "40001"})
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on attempt 3, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	deadlock := &pq.Error{Code: "40P01"}
+	if err := kbManager.retry(func() error { attempts++; return deadlock }); err != deadlock || attempts != 4 {
+		t.Errorf("Expected 4 attempts returning the deadlock, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	if err := kbManager.retry(func() error { attempts++; return &pq.Error{Code: "23505"} }); err == nil || attempts != 1 {
+		t.Errorf("Expected a unique violation to fail on the first attempt, got %d attempts and %v", attempts, err)
+	}
+}
+
+// TestAddNodeUnderContention adds nodes from several goroutines while another
+// transaction keeps rewriting the knowledge base's info row, which aborts
+// serializable inserts, and checks every AddNode call still succeeds
+func TestAddNodeUnderContention(t *testing.T) {
+	kbManager := setupTestManager(t, WithTxRetries(10, time.Millisecond), WithSerializableWrites())
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Contention"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		countQuery := fmt.Sprintf("SELECT count(*) FROM %s WHERE knowledge_base = 'kb1'", kbManager.tableName)
+		updateQuery := fmt.Sprintf("UPDATE %s SET description = $1 WHERE knowledge_base = 'kb1'", kbManager.infoTable)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			tx, err := kbManager.conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+			if err != nil {
+				continue
+			}
+			var count int
+			tx.QueryRow(countQuery).Scan(&count)
+			tx.Exec(updateQuery, fmt.Sprintf("Contention %d", i))
+			tx.Commit()
+		}
+	}()
+
+	const workers, perWorker = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				path := fmt.Sprintf("kb1.w%d.n%d", w, i)
+				if err := kbManager.AddNode("kb1", "item", path, nil, nil, path); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-done
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("AddNode failed under contention: %v", err)
+	}
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != workers*perWorker {
+		t.Errorf("Expected %d nodes, got %d, %v", workers*perWorker, count, err)
+	}
+}
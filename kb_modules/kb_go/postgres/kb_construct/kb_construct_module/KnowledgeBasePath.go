@@ -0,0 +1,123 @@
+package kb_construct_module
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// pathHeader records a header entered with PushHeader
+type pathHeader struct {
+	label string
+	name  string
+}
+
+// PathSession builds node paths from nested headers the way ConstructMemDB does,
+// adding each node with AddNode inside a single transaction opened by BeginPath.
+// Nothing is visible to other connections until Commit. A PathSession is not
+// safe for concurrent use.
+type PathSession struct {
+	kb      *KnowledgeBaseManager
+	tx      *sql.Tx
+	kbName  string
+	path    []string
+	headers []pathHeader
+}
+
+// BeginPath opens a transaction and starts a path at the root of kbName. The
+// caller must finish the session with Commit or Rollback.
+func (kb *KnowledgeBaseManager) BeginPath(kbName string) (*PathSession, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	tx, err := kb.db().Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	return &PathSession{
+		kb:     kb,
+		tx:     tx,
+		kbName: kbName,
+		path:   []string{kbName},
+	}, nil
+}
+
+// CurrentPath returns the dotted path new nodes are added under
+func (s *PathSession) CurrentPath() string {
+	return strings.Join(s.path, ".")
+}
+
+// add inserts a node labelled link at the current path extended by link and name
+// and returns the extended path. The current path is not changed.
+func (s *PathSession) add(link, name string, data map[string]interface{}) ([]string, error) {
+	nodePath := append(append([]string{}, s.path...), link, name)
+	if err := s.kb.addNode(s.tx, s.kbName, link, name, nil, data, strings.Join(nodePath, ".")); err != nil {
+		return nil, err
+	}
+	return nodePath, nil
+}
+
+// PushHeader adds a header node labelled link under the current path and enters
+// it, so later nodes are added beneath it until PopHeader. On error the path is
+// unchanged; the transaction is aborted by a failed insert and should be rolled back.
+func (s *PathSession) PushHeader(link, name string) error {
+	nodePath, err := s.add(link, name, nil)
+	if err != nil {
+		return err
+	}
+
+	s.path = nodePath
+	s.headers = append(s.headers, pathHeader{label: link, name: name})
+	return nil
+}
+
+// AddInfo adds a leaf node labelled link under the current path with data stored
+// in the data column. The current path is not changed.
+func (s *PathSession) AddInfo(link, name string, data map[string]interface{}) error {
+	_, err := s.add(link, name, data)
+	return err
+}
+
+// PopHeader leaves the innermost header entered with PushHeader, verifying the
+// label and name. On a mismatch nothing is left.
+func (s *PathSession) PopHeader(label, name string) error {
+	if len(s.headers) == 0 {
+		return fmt.Errorf("tried to leave '%s.%s' but no header node is open", label, name)
+	}
+
+	current := s.headers[len(s.headers)-1]
+	if current.label != label || current.name != name {
+		return fmt.Errorf("tried to leave '%s.%s' but current header is '%s.%s'", label, name, current.label, current.name)
+	}
+
+	s.headers = s.headers[:len(s.headers)-1]
+	s.path = s.path[:len(s.path)-2]
+	return nil
+}
+
+// Commit commits the nodes added in the session. Every header must have been
+// left with PopHeader; otherwise the transaction is rolled back and an error
+// naming the open path is returned.
+func (s *PathSession) Commit() error {
+	if len(s.headers) > 0 {
+		s.tx.Rollback()
+		return fmt.Errorf("cannot commit: header nodes still open at path %s", s.CurrentPath())
+	}
+
+	if err := s.tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// Rollback discards the nodes added in the session. It is a no-op after Commit,
+// so it can be deferred.
+func (s *PathSession) Rollback() error {
+	if err := s.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("error rolling back transaction: %w", err)
+	}
+	return nil
+}
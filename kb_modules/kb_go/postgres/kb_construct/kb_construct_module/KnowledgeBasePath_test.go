@@ -0,0 +1,131 @@
+package kb_construct_module
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestPathSessionPopHeader checks header nesting without a database
+func TestPathSessionPopHeader(t *testing.T) {
+	s := &PathSession{
+		path:    []string{"kb1", "header1_link", "header1_name"},
+		headers: []pathHeader{{label: "header1_link", name: "header1_name"}},
+	}
+
+	if err := s.PopHeader("header1_link", "other"); err == nil {
+		t.Error("Expected a name mismatch to be rejected")
+	}
+	if got := s.CurrentPath(); got != "kb1.header1_link.header1_name" {
+		t.Errorf("Expected path unchanged after mismatch, got %s", got)
+	}
+	if err := s.PopHeader("header1_link", "header1_name"); err != nil {
+		t.Fatalf("Error leaving header: %v", err)
+	}
+	if got := s.CurrentPath(); got != "kb1" {
+		t.Errorf("Expected path kb1, got %s", got)
+	}
+	if err := s.PopHeader("header1_link", "header1_name"); err == nil {
+		t.Error("Expected leaving with no open header to fail")
+	}
+}
+
+// TestPathSession builds the ConstructMemDB example through a session and
+// checks the committed paths, then that unbalanced and rolled back sessions add nothing
+func TestPathSession(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "First knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+
+	session, err := kbManager.BeginPath("kb1")
+	if err != nil {
+		t.Fatalf("Error beginning path: %v", err)
+	}
+	defer session.Rollback()
+
+	steps := []func() error{
+		func() error { return session.PushHeader("header1_link", "header1_name") },
+		func() error {
+			return session.AddInfo("info1_link", "info1_name", map[string]interface{}{"data": "info1_data"})
+		},
+		func() error { return session.PopHeader("header1_link", "header1_name") },
+		func() error { return session.PushHeader("header2_link", "header2_name") },
+		func() error {
+			return session.AddInfo("info2_link", "info2_name", map[string]interface{}{"data": "info2_data"})
+		},
+		func() error { return session.PopHeader("header2_link", "header2_name") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Error in step %d: %v", i, err)
+		}
+	}
+
+	// Uncommitted nodes are not visible outside the transaction
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 0 {
+		t.Errorf("Expected no visible nodes before commit, got %d, %v", count, err)
+	}
+	if err := session.Commit(); err != nil {
+		t.Fatalf("Error committing session: %v", err)
+	}
+
+	rows, err := kbManager.conn.Query(fmt.Sprintf("SELECT path FROM %s WHERE knowledge_base = 'kb1' ORDER BY path", kbManager.tableName))
+	if err != nil {
+		t.Fatalf("Error reading paths: %v", err)
+	}
+	defer rows.Close()
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			t.Fatalf("Error scanning path: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	want := []string{
+		"kb1.header1_link.header1_name",
+		"kb1.header1_link.header1_name.info1_link.info1_name",
+		"kb1.header2_link.header2_name",
+		"kb1.header2_link.header2_name.info2_link.info2_name",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected paths %v, got %v", want, paths)
+	}
+
+	t.Run("UnbalancedCommit", func(t *testing.T) {
+		session, err := kbManager.BeginPath("kb1")
+		if err != nil {
+			t.Fatalf("Error beginning path: %v", err)
+		}
+		defer session.Rollback()
+
+		if err := session.PushHeader("header3_link", "header3_name"); err != nil {
+			t.Fatalf("Error pushing header: %v", err)
+		}
+		if err := session.Commit(); err == nil {
+			t.Error("Expected commit with an open header to fail")
+		}
+		if count, err := kbManager.CountNodes("kb1"); err != nil || count != len(want) {
+			t.Errorf("Expected %d nodes, got %d, %v", len(want), count, err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		session, err := kbManager.BeginPath("kb1")
+		if err != nil {
+			t.Fatalf("Error beginning path: %v", err)
+		}
+		if err := session.AddInfo("info3_link", "info3_name", nil); err != nil {
+			t.Fatalf("Error adding info: %v", err)
+		}
+		if err := session.Rollback(); err != nil {
+			t.Fatalf("Error rolling back: %v", err)
+		}
+		if count, err := kbManager.CountNodes("kb1"); err != nil || count != len(want) {
+			t.Errorf("Expected %d nodes, got %d, %v", len(want), count, err)
+		}
+	})
+}
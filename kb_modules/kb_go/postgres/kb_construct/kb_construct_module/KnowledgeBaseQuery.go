@@ -0,0 +1,340 @@
+package kb_construct_module
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Node is a typed row of the knowledge base table
+type Node struct {
+	ID            int64                  `json:"id"`
+	KnowledgeBase string                 `json:"knowledge_base"`
+	Label         string                 `json:"label"`
+	Name          string                 `json:"name"`
+	Path          string                 `json:"path"`
+	Properties    map[string]interface{} `json:"properties"`
+	Data          map[string]interface{} `json:"data"`
+	HasLink       bool                   `json:"has_link"`
+	HasLinkMount  bool                   `json:"has_link_mount"`
+	DeletedAt     *time.Time             `json:"deleted_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// nodeColumns is the select list scanned by scanNodeRows
+const nodeColumns = "id, knowledge_base, label, name, path::text, properties, data, has_link, has_link_mount, deleted_at, created_at, updated_at"
+
+// decodeJSONMap unmarshals a scanned JSON column into target. AddNode stores
+// nil properties and data as SQL NULL, so a NULL column (nil or empty raw)
+// leaves target nil instead of failing.
+func decodeJSONMap(raw []byte, target *map[string]interface{}) error {
+	if len(raw) == 0 {
+		*target = nil
+		return nil
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// decodeJSONMapNumbers is decodeJSONMap with numbers decoded as json.Number,
+// used under WithJSONNumbers
+func decodeJSONMapNumbers(raw []byte, target *map[string]interface{}) error {
+	if len(raw) == 0 {
+		*target = nil
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+// scanNodeRows converts rows selected with nodeColumns to nodes, decoding
+// numbers in properties and data as json.Number when useNumber is set
+func scanNodeRows(rows *sql.Rows, useNumber bool) ([]Node, error) {
+	decode := decodeJSONMap
+	if useNumber {
+		decode = decodeJSONMapNumbers
+	}
+
+	nodes := []Node{}
+	for rows.Next() {
+		var node Node
+		var properties, data []byte
+		var hasLink, hasLinkMount sql.NullBool
+		var deletedAt, createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(&node.ID, &node.KnowledgeBase, &node.Label, &node.Name, &node.Path,
+			&properties, &data, &hasLink, &hasLinkMount, &deletedAt, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning node: %w", err)
+		}
+
+		if err := decode(properties, &node.Properties); err != nil {
+			return nil, fmt.Errorf("error decoding properties of %s: %w", node.Path, err)
+		}
+		if err := decode(data, &node.Data); err != nil {
+			return nil, fmt.Errorf("error decoding data of %s: %w", node.Path, err)
+		}
+		node.HasLink = hasLink.Bool
+		node.HasLinkMount = hasLinkMount.Bool
+		if deletedAt.Valid {
+			node.DeletedAt = &deletedAt.Time
+		}
+		node.CreatedAt = createdAt.Time
+		node.UpdatedAt = updatedAt.Time
+
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// queryNodes runs a node query whose WHERE clause applies condition, with $1
+// bound to kbName and $2 to arg
+func (kb *KnowledgeBaseManager) queryNodes(kbName, condition string, arg string) ([]Node, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s
+		WHERE knowledge_base = $1 AND %s%s
+		ORDER BY path`, nodeColumns, kb.tableName, condition, kb.liveNodes())
+
+	rows, err := kb.db().Query(query, kbName, arg)
+	if err != nil {
+		return nil, fmt.Errorf("error querying nodes: %w", err)
+	}
+	defer rows.Close()
+
+	return scanNodeRows(rows, kb.useNumber)
+}
+
+// QueryDescendants returns every node below path (path <@ X), excluding path itself
+func (kb *KnowledgeBaseManager) QueryDescendants(kbName, path string) ([]Node, error) {
+	return kb.queryNodes(kbName, "path <@ $2::ltree AND path <> $2::ltree", path)
+}
+
+// QuerySubtree returns path and the nodes at most maxDepth levels below it, so
+// 0 returns just path and 1 adds its direct children. A negative maxDepth
+// returns the whole subtree.
+func (kb *KnowledgeBaseManager) QuerySubtree(kbName, path string, maxDepth int) ([]Node, error) {
+	condition := "path <@ $2::ltree"
+	if maxDepth >= 0 {
+		condition += fmt.Sprintf(" AND nlevel(path) - nlevel($2::ltree) <= %d", maxDepth)
+	}
+	return kb.queryNodes(kbName, condition, path)
+}
+
+// QueryAncestors returns every node above path (path @> X), excluding path itself
+func (kb *KnowledgeBaseManager) QueryAncestors(kbName, path string) ([]Node, error) {
+	return kb.queryNodes(kbName, "path @> $2::ltree AND path <> $2::ltree", path)
+}
+
+// GetParent returns the node one level above path, at
+// subpath(path, 0, nlevel(path)-1). It wraps ErrNodeNotFound when path has a
+// single label or no node is stored at the parent path.
+func (kb *KnowledgeBaseManager) GetParent(kbName, path string) (*Node, error) {
+	if !strings.Contains(path, ".") {
+		return nil, fmt.Errorf("%w: '%s' has no parent", ErrNodeNotFound, path)
+	}
+
+	nodes, err := kb.queryNodes(kbName, "path = subpath($2::ltree, 0, nlevel($2::ltree) - 1)", path)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: no parent of '%s' in knowledge base '%s'", ErrNodeNotFound, path, kbName)
+	}
+	return &nodes[0], nil
+}
+
+// GetChildren returns the nodes exactly one level below path, ordered by path.
+// It wraps ErrNodeNotFound when there is no node at path; a leaf returns an
+// empty slice.
+func (kb *KnowledgeBaseManager) GetChildren(kbName, path string) ([]Node, error) {
+	self, err := kb.queryNodes(kbName, "path = $2::ltree", path)
+	if err != nil {
+		return nil, err
+	}
+	if len(self) == 0 {
+		return nil, fmt.Errorf("%w: '%s' in knowledge base '%s'", ErrNodeNotFound, path, kbName)
+	}
+
+	return kb.queryNodes(kbName, "path <@ $2::ltree AND nlevel(path) = nlevel($2::ltree) + 1", path)
+}
+
+// QueryLquery returns the nodes whose path matches the lquery pattern (path ~ X),
+// e.g. "kb1.*.leaf" or "kb1.header.*{1}"
+func (kb *KnowledgeBaseManager) QueryLquery(kbName, lquery string) ([]Node, error) {
+	return kb.queryNodes(kbName, "path ~ $2::lquery", lquery)
+}
+
+// SearchByProperty returns the nodes whose properties contain every key/value
+// pair in match (properties @> X). Values may be nested objects or arrays,
+// which match by JSON containment. The search uses the GIN index on properties
+// when the table was created WithJSONB or converted with MigrateToJSONB.
+func (kb *KnowledgeBaseManager) SearchByProperty(kbName string, match map[string]interface{}) ([]Node, error) {
+	matchJSON, err := json.Marshal(match)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling property match: %w", err)
+	}
+	return kb.queryNodes(kbName, "properties::jsonb @> $2::jsonb", string(matchJSON))
+}
+
+// ListOptions selects one page of ListNodesPage
+type ListOptions struct {
+	// Limit is the page size; zero or less uses 100
+	Limit int
+	// Offset skips rows on the first page. Prefer Cursor for later pages:
+	// offsets drift when rows are inserted or deleted between calls.
+	Offset int
+	// Cursor is the next-cursor token returned with the previous page; empty
+	// starts from the beginning
+	Cursor string
+	// OrderBy is "path" (the default) or "name"; ties are broken by id
+	OrderBy string
+	// Descending reverses the order
+	Descending bool
+}
+
+// listCursor is the decoded form of a ListNodesPage cursor token
+type listCursor struct {
+	OrderBy    string `json:"o"`
+	Descending bool   `json:"d"`
+	Key        string `json:"k"`
+	ID         int64  `json:"i"`
+}
+
+// ListNodesPage returns one page of the nodes of kbName and a cursor token for
+// the next page, which is empty after the last page. Pages are read by keyset
+// on (OrderBy column, id), so walking every page visits each existing node
+// exactly once even while rows are inserted concurrently.
+func (kb *KnowledgeBaseManager) ListNodesPage(kbName string, opts ListOptions) ([]Node, string, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return nil, "", err
+	}
+
+	orderBy := opts.OrderBy
+	if orderBy == "" {
+		orderBy = "path"
+	}
+	var keyColumn, keyCast string
+	switch orderBy {
+	case "path":
+		keyColumn, keyCast = "path", "::ltree"
+	case "name":
+		keyColumn, keyCast = "name", ""
+	default:
+		return nil, "", fmt.Errorf("unsupported order column '%s'", opts.OrderBy)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	direction, compare := "ASC", ">"
+	if opts.Descending {
+		direction, compare = "DESC", "<"
+	}
+
+	args := []interface{}{kbName}
+	keyset := ""
+	offset := opts.Offset
+	if opts.Cursor != "" {
+		cursor, err := decodeListCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.OrderBy != orderBy || cursor.Descending != opts.Descending {
+			return nil, "", fmt.Errorf("cursor was issued for a different ordering")
+		}
+		keyset = fmt.Sprintf(" AND (%s, id) %s ($2%s, $3)", keyColumn, compare, keyCast)
+		args = append(args, cursor.Key, cursor.ID)
+		offset = 0
+	}
+
+	// Read one extra row to learn whether another page follows
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s
+		WHERE knowledge_base = $1%s%s
+		ORDER BY %s %s, id %s
+		LIMIT %d OFFSET %d`, nodeColumns, kb.tableName, keyset, kb.liveNodes(),
+		keyColumn, direction, direction, limit+1, offset)
+
+	rows, err := kb.db().Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes, err := scanNodeRows(rows, kb.useNumber)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(nodes) <= limit {
+		return nodes, "", nil
+	}
+
+	nodes = nodes[:limit]
+	last := nodes[limit-1]
+	cursor := listCursor{OrderBy: orderBy, Descending: opts.Descending, Key: last.Path, ID: last.ID}
+	if orderBy == "name" {
+		cursor.Key = last.Name
+	}
+	next, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	return nodes, base64.RawURLEncoding.EncodeToString(next), nil
+}
+
+// decodeListCursor parses a cursor token returned by ListNodesPage
+func decodeListCursor(token string) (listCursor, error) {
+	var cursor listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// DepthOf returns the number of labels in path using ltree's nlevel
+func (kb *KnowledgeBaseManager) DepthOf(path string) (int, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return 0, err
+	}
+
+	var depth int
+	if err := kb.db().QueryRow("SELECT nlevel($1::ltree)", path).Scan(&depth); err != nil {
+		return 0, fmt.Errorf("error computing depth of '%s': %w", path, err)
+	}
+	return depth, nil
+}
+
+// Subpath returns ltree's subpath(path, start, length). A nil length is the
+// two-argument form and runs to the end of the path. Negative positions count
+// from the end as in ltree, which rejects out-of-range positions with an error.
+func (kb *KnowledgeBaseManager) Subpath(path string, start int, length *int) (string, error) {
+	if err := kb.ensureConnected(); err != nil {
+		return "", err
+	}
+
+	var sub string
+	var err error
+	if length == nil {
+		err = kb.db().QueryRow("SELECT subpath($1::ltree, $2)::text", path, start).Scan(&sub)
+	} else {
+		err = kb.db().QueryRow("SELECT subpath($1::ltree, $2, $3)::text", path, start, *length).Scan(&sub)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error computing subpath of '%s': %w", path, err)
+	}
+	return sub, nil
+}
@@ -0,0 +1,545 @@
+package kb_construct_module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupQueryTree adds kb1 with a small tree of nodes to a fresh manager
+func setupQueryTree(t *testing.T) *KnowledgeBaseManager {
+	t.Helper()
+
+	kbManager := setupTestManager(t)
+	for _, name := range []string{"kb1", "kb2"} {
+		if err := kbManager.AddKB(name, "Test knowledge base"); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+
+	nodes := []struct{ kb, label, path string }{
+		{"kb1", "a", "kb1.a"},
+		{"kb1", "b", "kb1.a.b"},
+		{"kb1", "c", "kb1.a.x.b"},
+		{"kb1", "d", "kb1.a.x.y.z.deep"},
+		{"kb1", "e", "kb1.other"},
+		{"kb2", "a", "kb2.a.b"},
+	}
+	for _, n := range nodes {
+		if err := kbManager.AddNode(n.kb, n.label, n.path, map[string]interface{}{"p": n.label}, nil, n.path); err != nil {
+			t.Fatalf("Error adding node %s: %v", n.path, err)
+		}
+	}
+	return kbManager
+}
+
+// nodePaths returns the paths of nodes in order
+func nodePaths(nodes []Node) []string {
+	paths := make([]string, len(nodes))
+	for i, node := range nodes {
+		paths[i] = node.Path
+	}
+	return paths
+}
+
+// samePaths reports whether got and want hold the same paths in order
+func samePaths(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestQueryDescendantsAndAncestors checks the <@ and @> helpers, including a deep descendant
+func TestQueryDescendantsAndAncestors(t *testing.T) {
+	kbManager := setupQueryTree(t)
+	defer kbManager.Disconnect()
+
+	descendants, err := kbManager.QueryDescendants("kb1", "kb1.a")
+	if err != nil {
+		t.Fatalf("Error querying descendants: %v", err)
+	}
+	if got, want := nodePaths(descendants), []string{"kb1.a.b", "kb1.a.x.b", "kb1.a.x.y.z.deep"}; !samePaths(got, want) {
+		t.Errorf("Expected descendants %v, got %v", want, got)
+	}
+	if descendants[0].Properties["p"] != "b" {
+		t.Errorf("Expected decoded properties, got %v", descendants[0].Properties)
+	}
+
+	ancestors, err := kbManager.QueryAncestors("kb1", "kb1.a.x.y.z.deep")
+	if err != nil {
+		t.Fatalf("Error querying ancestors: %v", err)
+	}
+	if got, want := nodePaths(ancestors), []string{"kb1.a"}; !samePaths(got, want) {
+		t.Errorf("Expected ancestors %v, got %v", want, got)
+	}
+}
+
+// TestQuerySubtreeDepth checks the depth bound of QuerySubtree over kb1.a
+func TestQuerySubtreeDepth(t *testing.T) {
+	kbManager := setupQueryTree(t)
+	defer kbManager.Disconnect()
+
+	cases := []struct {
+		maxDepth int
+		want     []string
+	}{
+		{0, []string{"kb1.a"}},
+		{1, []string{"kb1.a", "kb1.a.b"}},
+		{2, []string{"kb1.a", "kb1.a.b", "kb1.a.x.b"}},
+		{-1, []string{"kb1.a", "kb1.a.b", "kb1.a.x.b", "kb1.a.x.y.z.deep"}},
+	}
+	for _, c := range cases {
+		nodes, err := kbManager.QuerySubtree("kb1", "kb1.a", c.maxDepth)
+		if err != nil {
+			t.Fatalf("Error querying subtree to depth %d: %v", c.maxDepth, err)
+		}
+		if got := nodePaths(nodes); !samePaths(got, c.want) {
+			t.Errorf("Depth %d: expected %v, got %v", c.maxDepth, c.want, got)
+		}
+	}
+}
+
+// TestGetParentAndChildren checks parent and direct-child selection over a three-level tree
+func TestGetParentAndChildren(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Hierarchy"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	for _, path := range []string{"kb1.a", "kb1.a.b", "kb1.a.c", "kb1.a.b.d"} {
+		if err := kbManager.AddNode("kb1", "header", path, nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+
+	parent, err := kbManager.GetParent("kb1", "kb1.a.b.d")
+	if err != nil {
+		t.Fatalf("Error getting parent: %v", err)
+	}
+	if parent.Path != "kb1.a.b" {
+		t.Errorf("Expected parent kb1.a.b, got %s", parent.Path)
+	}
+	// kb1.a sits below the unstored kb1 label, and kb1 has no parent at all
+	for _, path := range []string{"kb1.a", "kb1"} {
+		if _, err := kbManager.GetParent("kb1", path); !errors.Is(err, ErrNodeNotFound) {
+			t.Errorf("Expected ErrNodeNotFound for the parent of %s, got %v", path, err)
+		}
+	}
+
+	children, err := kbManager.GetChildren("kb1", "kb1.a")
+	if err != nil {
+		t.Fatalf("Error getting children: %v", err)
+	}
+	if got, want := nodePaths(children), []string{"kb1.a.b", "kb1.a.c"}; !samePaths(got, want) {
+		t.Errorf("Expected children %v, got %v", want, got)
+	}
+	if children, err := kbManager.GetChildren("kb1", "kb1.a.b.d"); err != nil || len(children) != 0 {
+		t.Errorf("Expected no children of a leaf, got %v, %v", nodePaths(children), err)
+	}
+	if _, err := kbManager.GetChildren("kb1", "kb1.missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound for a missing node, got %v", err)
+	}
+}
+
+// TestQueryLquery checks lquery matching such as a.*.b
+func TestQueryLquery(t *testing.T) {
+	kbManager := setupQueryTree(t)
+	defer kbManager.Disconnect()
+
+	tests := []struct {
+		lquery string
+		want   []string
+	}{
+		{"kb1.a.*.b", []string{"kb1.a.b", "kb1.a.x.b"}},
+		{"*.b", []string{"kb1.a.b", "kb1.a.x.b"}},
+		{"kb1.*{1}", []string{"kb1.a", "kb1.other"}},
+		{"*.missing", []string{}},
+	}
+	for _, tt := range tests {
+		nodes, err := kbManager.QueryLquery("kb1", tt.lquery)
+		if err != nil {
+			t.Fatalf("Error querying %s: %v", tt.lquery, err)
+		}
+		if got := nodePaths(nodes); !samePaths(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.lquery, tt.want, got)
+		}
+	}
+
+	if _, err := kbManager.QueryLquery("kb1", "not a lquery!"); err == nil {
+		t.Error("Expected error for an invalid lquery")
+	}
+}
+
+// addPropertyNodes adds kb1 nodes whose properties carry a color and, for the
+// first, nested tags
+func addPropertyNodes(t *testing.T, kbManager *KnowledgeBaseManager) {
+	t.Helper()
+
+	if err := kbManager.AddKB("kb1", "Property search"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	nodes := []struct {
+		path       string
+		properties map[string]interface{}
+	}{
+		{"kb1.a", map[string]interface{}{"color": "red", "meta": map[string]interface{}{"tags": []string{"x", "y"}}}},
+		{"kb1.b", map[string]interface{}{"color": "blue"}},
+		{"kb1.c", map[string]interface{}{"color": "red", "size": 3}},
+	}
+	for _, n := range nodes {
+		if err := kbManager.AddNode("kb1", "item", n.path, n.properties, nil, n.path); err != nil {
+			t.Fatalf("Error adding node %s: %v", n.path, err)
+		}
+	}
+}
+
+// checkSearchByProperty runs the containment searches shared by the JSON and JSONB tests
+func checkSearchByProperty(t *testing.T, kbManager *KnowledgeBaseManager) {
+	t.Helper()
+
+	cases := []struct {
+		match map[string]interface{}
+		want  []string
+	}{
+		{map[string]interface{}{"color": "red"}, []string{"kb1.a", "kb1.c"}},
+		{map[string]interface{}{"color": "red", "size": 3}, []string{"kb1.c"}},
+		{map[string]interface{}{"meta": map[string]interface{}{"tags": []string{"y"}}}, []string{"kb1.a"}},
+		{map[string]interface{}{"color": "green"}, []string{}},
+	}
+	for _, c := range cases {
+		nodes, err := kbManager.SearchByProperty("kb1", c.match)
+		if err != nil {
+			t.Fatalf("Error searching %v: %v", c.match, err)
+		}
+		if got := nodePaths(nodes); !samePaths(got, c.want) {
+			t.Errorf("Search %v: expected %v, got %v", c.match, c.want, got)
+		}
+	}
+}
+
+// TestSearchByProperty checks containment searches on a table created WithJSONB
+func TestSearchByProperty(t *testing.T) {
+	kbManager := setupTestManager(t, WithJSONB())
+	defer kbManager.Disconnect()
+
+	addPropertyNodes(t, kbManager)
+	checkSearchByProperty(t, kbManager)
+
+	issues, err := kbManager.VerifySchema()
+	if err != nil {
+		t.Fatalf("Error verifying schema: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Expected the GIN index to be present, got %v", issues)
+	}
+}
+
+// TestMigrateToJSONB converts a JSON table in place and checks data and search survive
+func TestMigrateToJSONB(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	addPropertyNodes(t, kbManager)
+	checkSearchByProperty(t, kbManager)
+
+	if err := kbManager.MigrateToJSONB(); err != nil {
+		t.Fatalf("Error migrating to jsonb: %v", err)
+	}
+
+	// A repeated migration must not rewrite the table, which would give it a new relfilenode
+	relfilenode := func() uint32 {
+		var node uint32
+		err := kbManager.conn.QueryRow("SELECT relfilenode FROM pg_class WHERE oid = $1::regclass", kbManager.tableName).Scan(&node)
+		if err != nil {
+			t.Fatalf("Error reading relfilenode: %v", err)
+		}
+		return node
+	}
+	before := relfilenode()
+	if err := kbManager.MigrateToJSONB(); err != nil {
+		t.Fatalf("Expected a repeated migration to succeed, got %v", err)
+	}
+	if after := relfilenode(); after != before {
+		t.Errorf("Expected a repeated migration to leave the table alone, relfilenode changed from %d to %d", before, after)
+	}
+
+	var dataType string
+	err := kbManager.conn.QueryRow(`
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = $1 AND column_name = 'properties'`, kbManager.tableName).Scan(&dataType)
+	if err != nil {
+		t.Fatalf("Error reading column type: %v", err)
+	}
+	if dataType != "jsonb" {
+		t.Errorf("Expected properties to be jsonb, got %s", dataType)
+	}
+
+	checkSearchByProperty(t, kbManager)
+	issues, err := kbManager.VerifySchema()
+	if err != nil {
+		t.Fatalf("Error verifying schema: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Expected no schema issues after migration, got %v", issues)
+	}
+}
+
+// BenchmarkSearchByProperty compares a containment search on a seeded JSON
+// table against the same table after MigrateToJSONB
+func BenchmarkSearchByProperty(b *testing.B) {
+	const seeded = 20000
+
+	kbManager := setupTestManager(b)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Benchmark"); err != nil {
+		b.Fatalf("Error adding kb1: %v", err)
+	}
+	_, err := kbManager.conn.Exec(fmt.Sprintf(`
+		INSERT INTO %s (knowledge_base, label, name, properties, path)
+		SELECT 'kb1', 'item', 'node' || g, json_build_object('bucket', g %% 1000, 'id', g),
+			('kb1.node' || g)::ltree
+		FROM generate_series(1, $1) AS g`, kbManager.tableName), seeded)
+	if err != nil {
+		b.Fatalf("Error seeding nodes: %v", err)
+	}
+
+	match := map[string]interface{}{"bucket": 7}
+	search := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			nodes, err := kbManager.SearchByProperty("kb1", match)
+			if err != nil {
+				b.Fatalf("Error searching: %v", err)
+			}
+			if len(nodes) != seeded/1000 {
+				b.Fatalf("Expected %d nodes, got %d", seeded/1000, len(nodes))
+			}
+		}
+	}
+
+	b.Run("JSON", search)
+
+	if err := kbManager.MigrateToJSONB(); err != nil {
+		b.Fatalf("Error migrating to jsonb: %v", err)
+	}
+	if _, err := kbManager.conn.Exec(fmt.Sprintf("ANALYZE %s", kbManager.tableName)); err != nil {
+		b.Fatalf("Error analyzing table: %v", err)
+	}
+	b.Run("JSONBWithGIN", search)
+}
+
+// TestDecodeJSONMap checks NULL columns decode to nil maps rather than failing
+func TestDecodeJSONMap(t *testing.T) {
+	target := map[string]interface{}{"stale": true}
+	if err := decodeJSONMap(nil, &target); err != nil || target != nil {
+		t.Errorf("Expected nil map for NULL, got %v, %v", target, err)
+	}
+	if err := decodeJSONMap([]byte("null"), &target); err != nil || target != nil {
+		t.Errorf("Expected nil map for JSON null, got %v, %v", target, err)
+	}
+	if err := decodeJSONMap([]byte(`{"a":1}`), &target); err != nil || target["a"] != float64(1) {
+		t.Errorf("Expected decoded map, got %v, %v", target, err)
+	}
+	if err := decodeJSONMap([]byte("{"), &target); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+}
+
+// TestDecodeJSONMapNumbers checks large integers decode exactly as json.Number
+func TestDecodeJSONMapNumbers(t *testing.T) {
+	var target map[string]interface{}
+	if err := decodeJSONMapNumbers([]byte(`{"big":9007199254740993}`), &target); err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if target["big"] != json.Number("9007199254740993") {
+		t.Errorf("Expected json.Number 9007199254740993, got %#v", target["big"])
+	}
+	if err := decodeJSONMapNumbers(nil, &target); err != nil || target != nil {
+		t.Errorf("Expected nil map for NULL, got %v, %v", target, err)
+	}
+}
+
+// TestJSONNumbersRoundTrip stores a 64-bit integer above 2^53 and reads it back exactly
+func TestJSONNumbersRoundTrip(t *testing.T) {
+	kbManager := setupTestManager(t, WithJSONNumbers())
+	defer kbManager.Disconnect()
+
+	const big = int64(9007199254740993)
+	if err := kbManager.AddKB("kb1", "Test knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	if err := kbManager.AddNode("kb1", "counter", "c", map[string]interface{}{"big": big}, nil, "kb1.c"); err != nil {
+		t.Fatalf("Error adding node: %v", err)
+	}
+
+	nodes, _, err := kbManager.ListNodesPage("kb1", ListOptions{})
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Expected one node, got %v, %v", nodes, err)
+	}
+	got, ok := nodes[0].Properties["big"].(json.Number)
+	if !ok || got.String() != "9007199254740993" {
+		t.Fatalf("Expected json.Number 9007199254740993, got %#v", nodes[0].Properties["big"])
+	}
+
+	if err := kbManager.UpdateNode("kb1", "kb1.c", nodes[0].Properties, map[string]interface{}{"big": got}); err != nil {
+		t.Fatalf("Error updating node: %v", err)
+	}
+	nodes, _, err = kbManager.ListNodesPage("kb1", ListOptions{})
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Expected one node, got %v, %v", nodes, err)
+	}
+	for _, value := range []interface{}{nodes[0].Properties["big"], nodes[0].Data["big"]} {
+		if n, ok := value.(json.Number); !ok || n.String() != "9007199254740993" {
+			t.Errorf("Expected value to survive update exactly, got %#v", value)
+		}
+	}
+}
+
+// TestAddNodeWithoutProperties adds a node with nil properties and data and reads it back
+func TestAddNodeWithoutProperties(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Test knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	if err := kbManager.AddNode("kb1", "bare", "bare", nil, nil, "kb1.bare"); err != nil {
+		t.Fatalf("Error adding node: %v", err)
+	}
+
+	nodes, err := kbManager.QuerySubtree("kb1", "kb1.bare", 0)
+	if err != nil {
+		t.Fatalf("Error reading node without properties: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Properties != nil || nodes[0].Data != nil {
+		t.Errorf("Expected one node with nil properties and data, got %+v", nodes)
+	}
+}
+
+// TestListNodesPage walks every page while inserting rows and checks nothing is skipped or repeated
+func TestListNodesPage(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "Paging"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	const nodes = 10
+	for i := 0; i < nodes; i++ {
+		path := fmt.Sprintf("kb1.n%02d", i)
+		if err := kbManager.AddNode("kb1", "item", fmt.Sprintf("name%02d", i), nil, nil, path); err != nil {
+			t.Fatalf("Error adding node %s: %v", path, err)
+		}
+	}
+
+	seen := map[string]int{}
+	cursor := ""
+	for page := 0; ; page++ {
+		list, next, err := kbManager.ListNodesPage("kb1", ListOptions{Limit: 3, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Error listing page %d: %v", page, err)
+		}
+		for _, node := range list {
+			seen[node.Path]++
+		}
+
+		// Insert rows both behind and ahead of the cursor between pages
+		for _, path := range []string{fmt.Sprintf("kb1.a%02d", page), fmt.Sprintf("kb1.z%02d", page)} {
+			if err := kbManager.AddNode("kb1", "item", path, nil, nil, path); err != nil {
+				t.Fatalf("Error adding node %s: %v", path, err)
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	for i := 0; i < nodes; i++ {
+		path := fmt.Sprintf("kb1.n%02d", i)
+		if seen[path] != 1 {
+			t.Errorf("Expected %s exactly once, saw it %d times", path, seen[path])
+		}
+	}
+	for path, count := range seen {
+		if count > 1 {
+			t.Errorf("Expected %s once, saw it %d times", path, count)
+		}
+	}
+
+	list, _, err := kbManager.ListNodesPage("kb1", ListOptions{Limit: 2, OrderBy: "name", Descending: true})
+	if err != nil {
+		t.Fatalf("Error listing by name: %v", err)
+	}
+	if len(list) != 2 || list[0].Name < list[1].Name {
+		t.Errorf("Expected 2 nodes in descending name order, got %v", nodePaths(list))
+	}
+	if _, _, err := kbManager.ListNodesPage("kb1", ListOptions{OrderBy: "id"}); err == nil {
+		t.Error("Expected an error for an unsupported order column")
+	}
+}
+
+// TestDecodeListCursor checks cursor tokens round-trip and malformed tokens are rejected
+func TestDecodeListCursor(t *testing.T) {
+	if _, err := decodeListCursor("not base64!"); err == nil {
+		t.Error("Expected an error for a malformed cursor")
+	}
+	if _, err := decodeListCursor("bm90IGpzb24"); err == nil {
+		t.Error("Expected an error for a cursor that is not JSON")
+	}
+	cursor, err := decodeListCursor("eyJvIjoicGF0aCIsImQiOmZhbHNlLCJrIjoia2IxLmEiLCJpIjo3fQ")
+	if err != nil || cursor.OrderBy != "path" || cursor.Key != "kb1.a" || cursor.ID != 7 {
+		t.Errorf("Unexpected decoded cursor %+v, %v", cursor, err)
+	}
+}
+
+// TestSubpath checks DepthOf and Subpath against Postgres' nlevel and subpath.
+// testdata/subpath_cases.json is shared with kb_memory's TestDepthOfAndSubpath,
+// which checks its in-memory Subpath against the same table.
+func TestSubpath(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	for path, want := range map[string]int{"a.b.c.d": 4, "a": 1, "": 0} {
+		if got, err := kbManager.DepthOf(path); err != nil || got != want {
+			t.Errorf("DepthOf(%q): expected %d, got %d, %v", path, want, got, err)
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join("testdata", "subpath_cases.json"))
+	if err != nil {
+		t.Fatalf("Error reading subpath cases: %v", err)
+	}
+	var cases []struct {
+		Start  int    `json:"start"`
+		Length *int   `json:"length"` // absent is the two-argument form
+		Want   string `json:"want"`
+		Valid  bool   `json:"valid"` // ltree raises "invalid positions" when false
+	}
+	if err := json.Unmarshal(raw, &cases); err != nil {
+		t.Fatalf("Error decoding subpath cases: %v", err)
+	}
+	for _, c := range cases {
+		got, err := kbManager.Subpath("a.b.c.d", c.Start, c.Length)
+		if !c.Valid {
+			if err == nil {
+				t.Errorf("Subpath(%d, %v): expected an invalid positions error, got %q", c.Start, c.Length, got)
+			}
+			continue
+		}
+		if err != nil || got != c.Want {
+			t.Errorf("Subpath(%d, %v): expected %q, got %q, %v", c.Start, c.Length, c.Want, got, err)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package kb_construct_module
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PropertyError is a single failing field reported by a ValidationError
+type PropertyError struct {
+	Field   string // dotted path into properties, e.g. "owner.email" or "tags[2]"
+	Message string
+}
+
+// ValidationError is returned by AddNode, UpsertNode and UpdateNode when
+// properties do not match the JSON Schema registered for the node's label
+type ValidationError struct {
+	Label  string
+	Errors []PropertyError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		fields[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return fmt.Sprintf("properties for label '%s' failed schema validation: %s", e.Label, strings.Join(fields, "; "))
+}
+
+// jsonSchema is the subset of JSON Schema understood by RegisterLabelSchema:
+// type, required, properties, additionalProperties, items, enum, minimum,
+// maximum, minLength, maxLength and pattern. Annotations that do not constrain
+// values, such as title and description, are accepted; any other keyword is
+// rejected so a schema never promises checks that are not made.
+type jsonSchema struct {
+	Type                 json.RawMessage        `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+
+	types      []string
+	pattern    *regexp.Regexp
+	additional *jsonSchema // schema for unlisted properties; nil allows anything
+	noExtra    bool        // additionalProperties: false
+}
+
+// schemaKeywords are the keywords a jsonSchema may contain: those it checks,
+// followed by the annotations it accepts and ignores
+var schemaKeywords = map[string]bool{
+	"type": true, "required": true, "properties": true, "additionalProperties": true, "items": true,
+	"enum": true, "minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true,
+}
+
+// UnmarshalJSON decodes a schema object, rejecting unsupported keywords at
+// every level of nesting
+func (s *jsonSchema) UnmarshalJSON(raw []byte) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keywords); err != nil {
+		return err
+	}
+	var unsupported []string
+	for keyword := range keywords {
+		if !schemaKeywords[keyword] {
+			unsupported = append(unsupported, keyword)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("unsupported schema keywords: %s", strings.Join(unsupported, ", "))
+	}
+
+	type plainSchema jsonSchema // without this method, to avoid recursion
+	return json.Unmarshal(raw, (*plainSchema)(s))
+}
+
+// compile resolves the polymorphic keywords and compiles patterns, recursing
+// into nested schemas
+func (s *jsonSchema) compile() error {
+	if len(s.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(s.Type, &single); err == nil {
+			s.types = []string{single}
+		} else if err := json.Unmarshal(s.Type, &s.types); err != nil {
+			return fmt.Errorf("type must be a string or an array of strings")
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.noExtra = !allowed
+		} else {
+			s.additional = &jsonSchema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("additionalProperties must be a boolean or a schema")
+			}
+			if err := s.additional.compile(); err != nil {
+				return err
+			}
+		}
+	}
+	for name, child := range s.Properties {
+		if child == nil {
+			return fmt.Errorf("property '%s' has a null schema", name)
+		}
+		if err := child.compile(); err != nil {
+			return fmt.Errorf("property '%s': %w", name, err)
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	return nil
+}
+
+// RegisterLabelSchema sets the JSON Schema that AddNode, UpsertNode and
+// UpdateNode check node properties against for label, replacing any earlier
+// registration. Schemas using keywords outside the supported subset are
+// rejected. An empty schema removes the registration. Labels without a schema
+// are not validated.
+func (kb *KnowledgeBaseManager) RegisterLabelSchema(label string, schema json.RawMessage) error {
+	kb.schemaMu.Lock()
+	defer kb.schemaMu.Unlock()
+
+	if len(schema) == 0 {
+		delete(kb.labelSchemas, label)
+		return nil
+	}
+
+	compiled := &jsonSchema{}
+	if err := json.Unmarshal(schema, compiled); err != nil {
+		return fmt.Errorf("error parsing schema for label '%s': %w", label, err)
+	}
+	if err := compiled.compile(); err != nil {
+		return fmt.Errorf("error compiling schema for label '%s': %w", label, err)
+	}
+
+	if kb.labelSchemas == nil {
+		kb.labelSchemas = make(map[string]*jsonSchema)
+	}
+	kb.labelSchemas[label] = compiled
+	return nil
+}
+
+// hasLabelSchemas reports whether any label has a registered schema
+func (kb *KnowledgeBaseManager) hasLabelSchemas() bool {
+	kb.schemaMu.RLock()
+	defer kb.schemaMu.RUnlock()
+	return len(kb.labelSchemas) > 0
+}
+
+// validateProperties checks properties against the schema registered for
+// label, returning a *ValidationError listing every failing field
+func (kb *KnowledgeBaseManager) validateProperties(label string, properties map[string]interface{}) error {
+	kb.schemaMu.RLock()
+	schema := kb.labelSchemas[label]
+	kb.schemaMu.RUnlock()
+	if schema == nil {
+		return nil
+	}
+
+	// Round-trip through JSON so values are checked as they will be stored
+	var document interface{} = map[string]interface{}{}
+	if properties != nil {
+		raw, err := json.Marshal(properties)
+		if err != nil {
+			return fmt.Errorf("error marshaling properties: %w", err)
+		}
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("error decoding properties: %w", err)
+		}
+	}
+
+	var failures []PropertyError
+	schema.validate("", document, &failures)
+	if len(failures) > 0 {
+		return &ValidationError{Label: label, Errors: failures}
+	}
+	return nil
+}
+
+// validate appends a PropertyError for each way value violates s
+func (s *jsonSchema) validate(field string, value interface{}, failures *[]PropertyError) {
+	fail := func(format string, args ...interface{}) {
+		name := field
+		if name == "" {
+			name = "(root)"
+		}
+		*failures = append(*failures, PropertyError{Field: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 {
+		matched := false
+		for _, typeName := range s.types {
+			if jsonTypeMatches(typeName, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(value))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*failures = append(*failures, PropertyError{Field: joinField(field, name), Message: "required property is missing"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if child, ok := s.Properties[name]; ok {
+				child.validate(joinField(field, name), v[name], failures)
+			} else if s.noExtra {
+				*failures = append(*failures, PropertyError{Field: joinField(field, name), Message: "property is not allowed"})
+			} else if s.additional != nil {
+				s.additional.validate(joinField(field, name), v[name], failures)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item, failures)
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("length %d is shorter than %d", length, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("length %d is longer than %d", length, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("value does not match pattern '%s'", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("value %v is less than %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("value %v is greater than %v", v, *s.Maximum)
+		}
+	}
+}
+
+// joinField appends name to a dotted field path
+func joinField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// jsonTypeMatches reports whether a decoded JSON value is of the named JSON
+// Schema type
+func jsonTypeMatches(typeName string, value interface{}) bool {
+	switch typeName {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeName(value) == typeName
+	}
+}
+
+// jsonTypeName names the JSON type of a decoded value
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
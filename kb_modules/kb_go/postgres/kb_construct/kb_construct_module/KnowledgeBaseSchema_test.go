@@ -0,0 +1,136 @@
+package kb_construct_module
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testPersonSchema = `{
+	"type": "object",
+	"required": ["email", "age"],
+	"properties": {
+		"email": {"type": "string", "pattern": "@"},
+		"age": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"role": {"enum": ["admin", "user"]}
+	}
+}`
+
+// TestValidateProperties checks the supported schema keywords without a database
+func TestValidateProperties(t *testing.T) {
+	kb := &KnowledgeBaseManager{}
+	if err := kb.RegisterLabelSchema("person", json.RawMessage(testPersonSchema)); err != nil {
+		t.Fatalf("Error registering schema: %v", err)
+	}
+
+	if err := kb.validateProperties("person", map[string]interface{}{"email": "a@b", "age": 3}); err != nil {
+		t.Errorf("Expected valid properties, got %v", err)
+	}
+	if err := kb.validateProperties("other", nil); err != nil {
+		t.Errorf("Expected unregistered label to skip validation, got %v", err)
+	}
+
+	err := kb.validateProperties("person", map[string]interface{}{
+		"email": "nobody",
+		"age":   1.5,
+		"tags":  []interface{}{"x", 2},
+		"role":  "guest",
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+	fields := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	if want := []string{"age", "email", "role", "tags[1]"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("Expected failing fields %v, got %v (%v)", want, fields, err)
+	}
+
+	err = kb.validateProperties("person", nil)
+	if !errors.As(err, &validationErr) || len(validationErr.Errors) != 2 {
+		t.Errorf("Expected two missing required fields, got %v", err)
+	}
+
+	strict := `{"type": "object", "additionalProperties": false, "properties": {"a": {"type": "number"}}}`
+	if err := kb.RegisterLabelSchema("strict", json.RawMessage(strict)); err != nil {
+		t.Fatalf("Error registering schema: %v", err)
+	}
+	err = kb.validateProperties("strict", map[string]interface{}{"a": 1, "b": 2})
+	if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "b" {
+		t.Errorf("Expected extra property 'b' to be rejected, got %v", err)
+	}
+
+	if err := kb.RegisterLabelSchema("person", nil); err != nil {
+		t.Fatalf("Error removing schema: %v", err)
+	}
+	if err := kb.validateProperties("person", nil); err != nil {
+		t.Errorf("Expected removed schema to skip validation, got %v", err)
+	}
+
+	if err := kb.RegisterLabelSchema("bad", json.RawMessage(`{"type": 5}`)); err == nil {
+		t.Error("Expected an invalid type keyword to be rejected")
+	}
+	if err := kb.RegisterLabelSchema("bad", json.RawMessage(`{"pattern": "("}`)); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+	nested := `{"properties": {"email": {"type": "string", "format": "email"}}}`
+	if err := kb.RegisterLabelSchema("bad", json.RawMessage(nested)); err == nil {
+		t.Error("Expected the unsupported nested keyword 'format' to be rejected")
+	}
+	if err := kb.RegisterLabelSchema("bad", json.RawMessage(`{"oneOf": [{"type": "string"}]}`)); err == nil {
+		t.Error("Expected the unsupported keyword 'oneOf' to be rejected")
+	}
+	annotated := `{"title": "Person", "description": "A person", "type": "object"}`
+	if err := kb.RegisterLabelSchema("annotated", json.RawMessage(annotated)); err != nil {
+		t.Errorf("Expected annotations to be accepted, got %v", err)
+	}
+}
+
+// TestAddNodeSchemaValidation verifies AddNode and UpsertNode reject nodes that
+// omit a required property
+func TestAddNodeSchemaValidation(t *testing.T) {
+	kbManager := setupTestManager(t)
+	defer kbManager.Disconnect()
+
+	if err := kbManager.AddKB("kb1", "First knowledge base"); err != nil {
+		t.Fatalf("Error adding kb1: %v", err)
+	}
+	if err := kbManager.RegisterLabelSchema("person", json.RawMessage(testPersonSchema)); err != nil {
+		t.Fatalf("Error registering schema: %v", err)
+	}
+
+	err := kbManager.AddNode("kb1", "person", "john", map[string]interface{}{"email": "john@example.com"}, nil, "kb1.john")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "age" {
+		t.Errorf("Expected missing 'age', got %+v", validationErr.Errors)
+	}
+	if count, err := kbManager.CountNodes("kb1"); err != nil || count != 0 {
+		t.Errorf("Expected no node to be inserted, got %d, %v", count, err)
+	}
+
+	if _, err := kbManager.UpsertNode("kb1", "person", "john", map[string]interface{}{"age": 30}, nil, "kb1.john"); !errors.As(err, &validationErr) {
+		t.Errorf("Expected UpsertNode to fail validation, got %v", err)
+	}
+
+	valid := map[string]interface{}{"email": "john@example.com", "age": 30}
+	if err := kbManager.AddNode("kb1", "person", "john", valid, nil, "kb1.john"); err != nil {
+		t.Errorf("Error adding valid node: %v", err)
+	}
+	if err := kbManager.AddNode("kb1", "header", "misc", nil, nil, "kb1.misc"); err != nil {
+		t.Errorf("Expected unregistered label to skip validation, got %v", err)
+	}
+
+	if err := kbManager.UpdateNode("kb1", "kb1.john", map[string]interface{}{"email": "john@example.com"}, nil); !errors.As(err, &validationErr) {
+		t.Errorf("Expected UpdateNode to fail validation, got %v", err)
+	}
+	if err := kbManager.UpdateNode("kb1", "kb1.john", map[string]interface{}{"email": "j@example.com", "age": 31}, nil); err != nil {
+		t.Errorf("Error updating with valid properties: %v", err)
+	}
+}
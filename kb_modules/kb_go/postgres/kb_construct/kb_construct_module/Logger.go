@@ -0,0 +1,27 @@
+package kb_construct_module
+
+// Logger receives diagnostic output from the knowledge base constructors.
+// Library code never writes to stdout or calls log.Fatal; inject a Logger with
+// WithLogger to see progress messages.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards all output and is the default Logger
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Infof(format string, args ...interface{})  {}
+func (noopLogger) Errorf(format string, args ...interface{}) {}
+
+// WithLogger sets the Logger used for diagnostic output; nil restores the no-op logger
+func WithLogger(logger Logger) ManagerOption {
+	return func(kb *KnowledgeBaseManager) {
+		if logger == nil {
+			logger = noopLogger{}
+		}
+		kb.logger = logger
+	}
+}
@@ -0,0 +1,92 @@
+package kb_construct_module
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// captureLogger records every message it receives
+type captureLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *captureLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *captureLogger) Debugf(format string, args ...interface{}) {
+	l.record("debug", format, args...)
+}
+func (l *captureLogger) Infof(format string, args ...interface{}) { l.record("info", format, args...) }
+func (l *captureLogger) Errorf(format string, args ...interface{}) {
+	l.record("error", format, args...)
+}
+
+// contains reports whether any recorded message contains substr
+func (l *captureLogger) contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, message := range l.messages {
+		if strings.Contains(message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestWithLogger checks that a transaction retry is logged through the
+// installed logger and that nil restores the no-op logger
+func TestWithLogger(t *testing.T) {
+	logger := &captureLogger{}
+	kb := &KnowledgeBaseManager{logger: noopLogger{}, txRetries: 2, txRetryDelay: time.Millisecond}
+
+	WithLogger(logger)(kb)
+	calls := 0
+	err := kb.retry(func() error {
+		calls++
+		if calls == 1 {
+			return &pq.Error{Code: "40001", Message: "could not serialize access"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	want := []string{"debug: retrying transaction after 1ms (attempt 1): pq: could not serialize access"}
+	if fmt.Sprint(logger.messages) != fmt.Sprint(want) {
+		t.Errorf("Expected messages %q, got %q", want, logger.messages)
+	}
+
+	WithLogger(nil)(kb)
+	if _, ok := kb.logger.(noopLogger); !ok {
+		t.Errorf("Expected nil logger to restore the no-op logger, got %T", kb.logger)
+	}
+}
+
+// TestConstructDataTablesLogging captures table setup output through an injected logger
+func TestConstructDataTablesLogging(t *testing.T) {
+	if testDBPassword == "" {
+		t.Skip("POSTGRES_PASSWORD environment variable not set")
+	}
+
+	logger := &captureLogger{}
+	cdt, err := NewConstructDataTables(testDBHost, testDBPort, testDBName, testDBUser, testDBPassword, testDBTable, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Error creating ConstructDataTables: %v", err)
+	}
+	defer cdt.Disconnect()
+
+	for _, expected := range []string{"info: rpc_client table created.", "info: rpc_server table created."} {
+		if !logger.contains(expected) {
+			t.Errorf("Expected %q in captured output %v", expected, logger.messages)
+		}
+	}
+}